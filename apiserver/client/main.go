@@ -29,6 +29,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	samplev1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/applyconfiguration/sample/v1alpha1"
 	clientset "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned"
 	_ "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned/scheme"
 )
@@ -86,5 +87,13 @@ func main() {
 		return
 	}
 
+	// server-side apply, the disallowed flunders are owned by the "client" field manager
+	apply := samplev1alpha1.Fischer("hello").WithDisallowedFlunders("a", "b", "c", "d")
+	fischers, err = client.SampleV1alpha1().Fischers().Apply(ctx, apply, metav1.ApplyOptions{FieldManager: "client", Force: true})
+	if err != nil {
+		klog.Fatalf("Error apply fischer: %s", err.Error())
+		return
+	}
+
 	//client.SampleV1alpha1().Fischers().Delete(ctx, "hello", metav1.DeleteOptions{})
 }
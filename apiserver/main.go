@@ -37,6 +37,8 @@ func main() {
 	stopCh := genericapiserver.SetupSignalHandler()
 	options := server.NewWardleServerOptions(os.Stdout, os.Stderr)
 	cmd := server.NewCommandStartWardleServer(options, stopCh)
+	cmd.AddCommand(server.NewCommandReencrypt(os.Stdout, stopCh))
+	cmd.AddCommand(server.NewCommandKMSPlugin(os.Stdout, stopCh))
 	code := cli.Run(cmd)
 	os.Exit(code)
 
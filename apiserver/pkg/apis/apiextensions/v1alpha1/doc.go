@@ -0,0 +1,28 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=package
+// +groupName=apiextensions.kes.io
+
+// Package v1alpha1 is the v1alpha1 version of the apiextensions API, defining resources served by a running
+// apiserver without compiling their Go types.
+package v1alpha1 // import "github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
@@ -0,0 +1,352 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcestrategy"
+)
+
+var _ resource.ObjectWithPrinterColumns = &ResourceDefinition{}
+var _ resourcestrategy.Defaulter = &ResourceDefinition{}
+var _ resourcestrategy.Validater = &ResourceDefinition{}
+var _ resourcestrategy.ValidateUpdater = &ResourceDefinition{}
+
+// ResourceScope is the scope of the objects of a defined resource.
+// +enum
+type ResourceScope string
+
+const (
+	// NamespaceScoped means the objects belong to a namespace.
+	NamespaceScoped ResourceScope = "Namespaced"
+	// ClusterScoped means the objects don't belong to a namespace.
+	ClusterScoped ResourceScope = "Cluster"
+)
+
+const (
+	// Established is the condition of a ResourceDefinition served by the apiserver.
+	Established = "Established"
+)
+
+// ResourceDefinitionNames are the names under which a defined resource is served.
+type ResourceDefinitionNames struct {
+	// Plural is the lowercase plural name of the resource, served at /apis/<group>/<version>/<plural>.
+	Plural string `json:"plural"`
+	// Singular is the lowercase singular name of the resource.  Defaults to the lowercase kind.
+	// +optional
+	Singular string `json:"singular,omitempty"`
+	// ShortNames are the short names of the resource, e.g. for kubectl.
+	// +optional
+	ShortNames []string `json:"shortNames,omitempty"`
+	// Kind is the CamelCase kind of the objects.
+	Kind string `json:"kind"`
+	// ListKind is the kind of the lists of objects.  Defaults to "<kind>List".
+	// +optional
+	ListKind string `json:"listKind,omitempty"`
+	// Categories are the groups of resources the resource belongs to, e.g. "all".
+	// +optional
+	Categories []string `json:"categories,omitempty"`
+}
+
+// ResourceDefinitionSubresourceStatus enables the status subresource of a defined resource.  The main resource
+// ignores the changes to .status and the status subresource ignores the changes outside of .status.
+type ResourceDefinitionSubresourceStatus struct{}
+
+// ResourceDefinitionSubresources are the subresources served for a version of a defined resource.
+type ResourceDefinitionSubresources struct {
+	// Status enables the status subresource.
+	// +optional
+	Status *ResourceDefinitionSubresourceStatus `json:"status,omitempty"`
+}
+
+// ResourceDefinitionPrinterColumn is an additional column printed by `kubectl get`.
+type ResourceDefinitionPrinterColumn struct {
+	// Name is the header of the column.
+	Name string `json:"name"`
+	// Type is the OpenAPI type of the column: integer, number, string, boolean or date.
+	Type string `json:"type"`
+	// Format is the optional OpenAPI format of the column.
+	// +optional
+	Format string `json:"format,omitempty"`
+	// Description is a human readable description of the column.
+	// +optional
+	Description string `json:"description,omitempty"`
+	// Priority is the importance of the column.  Columns with a priority greater than 0 are only printed in
+	// the wide output.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+	// JSONPath is the path of the value of the column in each object, e.g. ".spec.replicas".
+	JSONPath string `json:"jsonPath"`
+}
+
+// ResourceDefinitionVersion is a version of a defined resource.
+type ResourceDefinitionVersion struct {
+	// Name is the version, served at /apis/<group>/<name>.
+	Name string `json:"name"`
+	// Served enables serving the version.
+	Served bool `json:"served"`
+	// Storage marks the version the objects are stored in.  Exactly one version must be the storage version.
+	// The versions share the same fields, objects are converted between versions by changing their apiVersion.
+	Storage bool `json:"storage"`
+	// Schema is the OpenAPI v3 schema of the objects of the version, without apiVersion, kind and metadata.
+	// The objects are validated against the structural constraints and the x-kubernetes-validations rules of
+	// the schema, and defaulted with its default values.
+	// +optional
+	Schema *runtime.RawExtension `json:"schema,omitempty"`
+	// Subresources are the subresources served for the version.
+	// +optional
+	Subresources *ResourceDefinitionSubresources `json:"subresources,omitempty"`
+	// AdditionalPrinterColumns are the columns printed by `kubectl get` after the name.
+	// +optional
+	AdditionalPrinterColumns []ResourceDefinitionPrinterColumn `json:"additionalPrinterColumns,omitempty"`
+}
+
+// ResourceDefinitionSpec is the specification of a ResourceDefinition.
+type ResourceDefinitionSpec struct {
+	// Group is the API group of the resource.  It can't be changed.
+	Group string `json:"group"`
+	// Names are the names of the resource.
+	Names ResourceDefinitionNames `json:"names"`
+	// Scope is the scope of the objects, Namespaced or Cluster.  It can't be changed.
+	Scope ResourceScope `json:"scope"`
+	// Versions are the versions of the resource.
+	Versions []ResourceDefinitionVersion `json:"versions"`
+}
+
+// ResourceDefinitionStatus is the status of a ResourceDefinition.
+type ResourceDefinitionStatus struct {
+	// Conditions are the observations of the definition.  The Established condition is true once the resource
+	// is served.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kes:resource:path=resourcedefinitions,scope=Cluster,storage
+// +kes:subresource:status
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ResourceDefinition defines a resource served by the apiserver from the time it's created, like a
+// CustomResourceDefinition.  Its name must be "<names.plural>.<group>".  The objects of the resource are
+// stored as unstructured objects.  Deleting the definition stops serving the resource, the stored objects are
+// served again if it's created again.
+type ResourceDefinition struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ResourceDefinitionSpec   `json:"spec,omitempty"`
+	Status ResourceDefinitionStatus `json:"status,omitempty"`
+}
+
+// GetPrinterColumns implements resource.ObjectWithPrinterColumns
+func (ResourceDefinition) GetPrinterColumns() []resource.PrinterColumn {
+	return []resource.PrinterColumn{
+		{Name: "Group", Type: "string", Description: "The API group of the resource.", JSONPath: ".spec.group"},
+		{Name: "Kind", Type: "string", Description: "The kind of the objects.", JSONPath: ".spec.names.kind"},
+		{Name: "Established", Type: "string", Description: "Whether the resource is served.", JSONPath: `.status.conditions[?(@.type=="Established")].status`},
+		{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+	}
+}
+
+// Default implements resourcestrategy.Defaulter
+func (d *ResourceDefinition) Default() {
+	if d.Spec.Names.Singular == "" {
+		d.Spec.Names.Singular = strings.ToLower(d.Spec.Names.Kind)
+	}
+	if d.Spec.Names.ListKind == "" && d.Spec.Names.Kind != "" {
+		d.Spec.Names.ListKind = d.Spec.Names.Kind + "List"
+	}
+}
+
+// Validate implements resourcestrategy.Validater
+func (d *ResourceDefinition) Validate(_ context.Context) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if expected := d.Spec.Names.Plural + "." + d.Spec.Group; d.Name != expected {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "name"), d.Name, fmt.Sprintf("must be spec.names.plural+\".\"+spec.group: %q", expected)))
+	}
+	allErrs = append(allErrs, validateResourceDefinitionSpec(&d.Spec, field.NewPath("spec"))...)
+	return allErrs
+}
+
+// ValidateUpdate implements resourcestrategy.ValidateUpdater
+func (d *ResourceDefinition) ValidateUpdate(ctx context.Context, obj runtime.Object) field.ErrorList {
+	allErrs := d.Validate(ctx)
+	old := obj.(*ResourceDefinition)
+	fldPath := field.NewPath("spec")
+	allErrs = append(allErrs, apimachineryvalidation.ValidateImmutableField(d.Spec.Group, old.Spec.Group, fldPath.Child("group"))...)
+	allErrs = append(allErrs, apimachineryvalidation.ValidateImmutableField(d.Spec.Scope, old.Spec.Scope, fldPath.Child("scope"))...)
+	return allErrs
+}
+
+// GetSchema returns the schema of the version, or nil if it has none.
+func (v *ResourceDefinitionVersion) GetSchema() (*spec.Schema, error) {
+	if v.Schema == nil || len(v.Schema.Raw) == 0 {
+		return nil, nil
+	}
+	s := &spec.Schema{}
+	if err := json.Unmarshal(v.Schema.Raw, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StorageVersion returns the storage version of the resource, or nil if there is none.
+func (s *ResourceDefinitionSpec) StorageVersion() *ResourceDefinitionVersion {
+	for i := range s.Versions {
+		if s.Versions[i].Storage {
+			return &s.Versions[i]
+		}
+	}
+	return nil
+}
+
+// validateResourceDefinitionSpec validates a ResourceDefinitionSpec.
+func validateResourceDefinitionSpec(s *ResourceDefinitionSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if len(s.Group) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("group"), ""))
+	} else {
+		for _, msg := range utilvalidation.IsDNS1123Subdomain(s.Group) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("group"), s.Group, msg))
+		}
+		if len(strings.Split(s.Group, ".")) < 2 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("group"), s.Group, "should be a domain with at least one dot"))
+		}
+	}
+
+	namesPath := fldPath.Child("names")
+	for _, name := range []struct {
+		value string
+		path  *field.Path
+	}{
+		{s.Names.Plural, namesPath.Child("plural")},
+		{s.Names.Singular, namesPath.Child("singular")},
+	} {
+		if len(name.value) == 0 {
+			allErrs = append(allErrs, field.Required(name.path, ""))
+			continue
+		}
+		for _, msg := range utilvalidation.IsDNS1035Label(name.value) {
+			allErrs = append(allErrs, field.Invalid(name.path, name.value, msg))
+		}
+	}
+	for i, shortName := range s.Names.ShortNames {
+		for _, msg := range utilvalidation.IsDNS1035Label(shortName) {
+			allErrs = append(allErrs, field.Invalid(namesPath.Child("shortNames").Index(i), shortName, msg))
+		}
+	}
+	for _, kind := range []struct {
+		value string
+		path  *field.Path
+	}{
+		{s.Names.Kind, namesPath.Child("kind")},
+		{s.Names.ListKind, namesPath.Child("listKind")},
+	} {
+		if len(kind.value) == 0 {
+			allErrs = append(allErrs, field.Required(kind.path, ""))
+			continue
+		}
+		if msgs := utilvalidation.IsDNS1035Label(strings.ToLower(kind.value)); len(msgs) != 0 {
+			allErrs = append(allErrs, field.Invalid(kind.path, kind.value, strings.Join(msgs, ", ")))
+		}
+	}
+	if len(s.Names.Kind) != 0 && s.Names.Kind == s.Names.ListKind {
+		allErrs = append(allErrs, field.Invalid(namesPath.Child("listKind"), s.Names.ListKind, "must not be the same as kind"))
+	}
+
+	switch s.Scope {
+	case NamespaceScoped, ClusterScoped:
+	case "":
+		allErrs = append(allErrs, field.Required(fldPath.Child("scope"), ""))
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("scope"), s.Scope, []string{string(ClusterScoped), string(NamespaceScoped)}))
+	}
+
+	versionsPath := fldPath.Child("versions")
+	if len(s.Versions) == 0 {
+		allErrs = append(allErrs, field.Required(versionsPath, "must have exactly one storage version"))
+	}
+	versions := sets.New[string]()
+	storageVersions := 0
+	for i := range s.Versions {
+		v := &s.Versions[i]
+		vPath := versionsPath.Index(i)
+		for _, msg := range utilvalidation.IsDNS1035Label(v.Name) {
+			allErrs = append(allErrs, field.Invalid(vPath.Child("name"), v.Name, msg))
+		}
+		if versions.Has(v.Name) {
+			allErrs = append(allErrs, field.Duplicate(vPath.Child("name"), v.Name))
+		}
+		versions.Insert(v.Name)
+		if v.Storage {
+			storageVersions++
+		}
+		if schema, err := v.GetSchema(); err != nil {
+			allErrs = append(allErrs, field.Invalid(vPath.Child("schema"), "", fmt.Sprintf("must be an OpenAPI v3 schema: %v", err)))
+		} else if schema != nil && len(schema.Type) != 0 && !schema.Type.Contains("object") {
+			allErrs = append(allErrs, field.Invalid(vPath.Child("schema", "type"), schema.Type, "must be object"))
+		}
+		columns := sets.New[string]()
+		for j, col := range v.AdditionalPrinterColumns {
+			colPath := vPath.Child("additionalPrinterColumns").Index(j)
+			if len(col.Name) == 0 {
+				allErrs = append(allErrs, field.Required(colPath.Child("name"), ""))
+			} else if columns.Has(col.Name) {
+				allErrs = append(allErrs, field.Duplicate(colPath.Child("name"), col.Name))
+			}
+			columns.Insert(col.Name)
+			if len(col.JSONPath) == 0 {
+				allErrs = append(allErrs, field.Required(colPath.Child("jsonPath"), ""))
+			}
+		}
+	}
+	if len(s.Versions) != 0 && storageVersions != 1 {
+		allErrs = append(allErrs, field.Invalid(versionsPath, storageVersions, "must have exactly one storage version"))
+	}
+
+	return allErrs
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ResourceDefinitionList is a list of ResourceDefinition objects.
+type ResourceDefinitionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ResourceDefinition `json:"items"`
+}
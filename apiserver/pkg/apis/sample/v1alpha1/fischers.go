@@ -18,17 +18,11 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-
-	"github.com/vine-io/kes/apiserver/pkg/server/resource"
 )
 
-var _ resource.Object = &Fischer{}
-var _ resource.ObjectList = &FischerList{}
-
 // +genclient
 // +genclient:nonNamespaced
+// +kes:resource:path=fischers,scope=Cluster,storage
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // Fischer defines the schema for the "fischers" resource.
@@ -55,41 +49,3 @@ type FischerList struct {
 
 	Items []Fischer `json:"items" protobuf:"bytes,2,rep,name=items"`
 }
-
-// GetGroupVersionResource returns a GroupVersionResource with "fischers" as the resource.
-// GetGroupVersionResource implements resource.Object
-func (Fischer) GetGroupVersionResource() schema.GroupVersionResource {
-	return SchemeGroupVersion.WithResource("fischers")
-}
-
-// GetObjectMeta implements resource.Object
-func (f *Fischer) GetObjectMeta() *metav1.ObjectMeta {
-	return &f.ObjectMeta
-}
-
-// IsStorageVersion returns true -- v1alpha1.Fischer is used as the internal version.
-// IsStorageVersion implements resource.Object.
-func (Fischer) IsStorageVersion() bool {
-	return true
-}
-
-// NamespaceScoped returns false to indicate Fischer is NOT a namespaced resource.
-// NamespaceScoped implements resource.Object.
-func (Fischer) NamespaceScoped() bool {
-	return false
-}
-
-// New implements resource.Object
-func (Fischer) New() runtime.Object {
-	return &Fischer{}
-}
-
-// NewList implements resource.Object
-func (Fischer) NewList() runtime.Object {
-	return &FischerList{}
-}
-
-// GetListMeta implements resource.Object
-func (c *FischerList) GetListMeta() *metav1.ListMeta {
-	return &c.ListMeta
-}
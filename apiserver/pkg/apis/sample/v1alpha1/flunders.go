@@ -21,19 +21,18 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	"github.com/vine-io/kes/apiserver/pkg/server/resource"
 	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcestrategy"
 )
 
-var _ resource.Object = &Flunder{}
-var _ resource.ObjectList = &FlunderList{}
 var _ resourcestrategy.Validater = &Flunder{}
 var _ resourcestrategy.ValidateUpdater = &Flunder{}
+var _ resource.ObjectWithPrinterColumns = &Flunder{}
 
 // ReferenceType defines the type of an object reference.
+// +enum
 type ReferenceType string
 
 const (
@@ -58,6 +57,7 @@ type FlunderStatus struct {
 }
 
 // +genclient
+// +kes:resource:path=flunders,scope=Namespaced,storage
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // Flunder defines the schema for the "flunders" resource.
@@ -69,37 +69,14 @@ type Flunder struct {
 	Status FlunderStatus `json:"status,omitempty" protobuf:"bytes,3,opt,name=status"`
 }
 
-// GetGroupVersionResource returns a GroupVersionResource with "flunders" as the resource.
-// GetGroupVersionResource implements resource.Object
-func (Flunder) GetGroupVersionResource() schema.GroupVersionResource {
-	return SchemeGroupVersion.WithResource("flunders")
-}
-
-// GetObjectMeta implements resource.Object
-func (f *Flunder) GetObjectMeta() *metav1.ObjectMeta {
-	return &f.ObjectMeta
-}
-
-// IsStorageVersion returns true -- v1alpha1.Flunder is used as the internal version.
-// IsStorageVersion implements resource.Object.
-func (Flunder) IsStorageVersion() bool {
-	return true
-}
-
-// NamespaceScoped returns true to indicate Flunder is a namespaced resource.
-// NamespaceScoped implements resource.Object.
-func (Flunder) NamespaceScoped() bool {
-	return true
-}
-
-// New implements resource.Object
-func (Flunder) New() runtime.Object {
-	return &Flunder{}
-}
-
-// NewList implements resource.Object
-func (Flunder) NewList() runtime.Object {
-	return &FlunderList{}
+// GetPrinterColumns implements resource.ObjectWithPrinterColumns
+func (Flunder) GetPrinterColumns() []resource.PrinterColumn {
+	return []resource.PrinterColumn{
+		{Name: "Reference-Type", Type: "string", Description: "The reference type.", JSONPath: ".spec.referenceType"},
+		{Name: "Flunder", Type: "string", Description: "The referenced flunder.", JSONPath: ".spec.flunderReference"},
+		{Name: "Fischer", Type: "string", Description: "The referenced fischer.", JSONPath: ".spec.fischerReference"},
+		{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+	}
 }
 
 // Validate implements resource.Validater
@@ -131,6 +108,7 @@ func validateFlunderSpec(s *FlunderSpec, fldPath *field.Path) field.ErrorList {
 		allErrs = append(allErrs, field.Invalid(fldPath.Child("flunderReference"), s.FlunderReference, "cannot be empty if referenceType is Flunder"))
 	}
 
+	// the +enum marker is only enforced by the schema validation, which requires the OpenAPI definitions
 	if len(s.ReferenceType) != 0 && s.ReferenceType != FischerReferenceType && s.ReferenceType != FlunderReferenceType {
 		allErrs = append(allErrs, field.Invalid(fldPath.Child("referenceType"), s.ReferenceType, "must be Flunder or Fischer"))
 	}
@@ -147,8 +125,3 @@ type FlunderList struct {
 
 	Items []Flunder `json:"items" protobuf:"bytes,2,rep,name=items"`
 }
-
-// GetListMeta returns the ListMeta
-func (c *FlunderList) GetListMeta() *metav1.ListMeta {
-	return &c.ListMeta
-}
@@ -8,10 +8,10 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // +genclient
+// +kes:resource:path=fortunes,scope=Namespaced,storage,noRegister
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // Fortune defines the schema for the "fortunes" resource.
@@ -76,39 +76,6 @@ func (f FortuneList) convertToTable(_ context.Context, tableOptions runtime.Obje
 	return &c.Table, nil
 }
 
-// GetGroupVersionResource returns a GroupVersionResource with "fortunes" as the resource.
-// GetGroupVersionResource implements resource.Object
-func (Fortune) GetGroupVersionResource() schema.GroupVersionResource {
-	return SchemeGroupVersion.WithResource("fortunes")
-}
-
-// GetObjectMeta implements resource.Object
-func (f *Fortune) GetObjectMeta() *metav1.ObjectMeta {
-	return &f.ObjectMeta
-}
-
-// IsStorageVersion returns true -- v1alpha1.Fortune is used as the internal version.
-// IsStorageVersion implements resource.Object.
-func (Fortune) IsStorageVersion() bool {
-	return true
-}
-
-// NamespaceScoped returns true to indicate Fortune is a namespaced resource.
-// NamespaceScoped implements resource.Object.
-func (Fortune) NamespaceScoped() bool {
-	return true
-}
-
-// New implements resource.Object
-func (Fortune) New() runtime.Object {
-	return &Fortune{}
-}
-
-// NewList implements resource.Object
-func (Fortune) NewList() runtime.Object {
-	return &FortuneList{}
-}
-
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // FortuneList is a list of Fortune objects.
@@ -118,8 +85,3 @@ type FortuneList struct {
 
 	Items []Fortune `json:"items" protobuf:"bytes,2,rep,name=items"`
 }
-
-// GetListMeta returns the ListMeta
-func (f *FortuneList) GetListMeta() *metav1.ListMeta {
-	return &f.ListMeta
-}
@@ -39,9 +39,11 @@ func Resource(resource string) schema.GroupResource {
 	return SchemeGroupVersion.WithResource(resource).GroupResource()
 }
 
-// Adds the list of known types to scheme.
+// Adds the list of known types to scheme, the resources registered with the ResourceBuilder.
 func addKnownTypes(scheme *runtime.Scheme) error {
-	scheme.AddKnownTypes(SchemeGroupVersion)
+	for _, obj := range ResourceBuilder {
+		scheme.AddKnownTypes(SchemeGroupVersion, obj.New(), obj.NewList())
+	}
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
 }
@@ -0,0 +1,163 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by apiserver-runtime-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	resource "github.com/vine-io/kes/apiserver/pkg/server/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ResourceBuilder collects the resources of the package to serve them with WithResources.
+var ResourceBuilder resource.Builder
+
+var _ resource.Object = &Fischer{}
+var _ resource.ObjectList = &FischerList{}
+
+// GetGroupVersionResource returns a GroupVersionResource with "fischers" as the resource.
+// GetGroupVersionResource implements resource.Object
+func (Fischer) GetGroupVersionResource() schema.GroupVersionResource {
+	return SchemeGroupVersion.WithResource("fischers")
+}
+
+// GetObjectMeta implements resource.Object
+func (f *Fischer) GetObjectMeta() *v1.ObjectMeta {
+	return &f.ObjectMeta
+}
+
+// IsStorageVersion returns true -- Fischer is used as the internal version.
+// IsStorageVersion implements resource.Object.
+func (Fischer) IsStorageVersion() bool {
+	return true
+}
+
+// NamespaceScoped returns false to indicate Fischer is a cluster scoped resource.
+// NamespaceScoped implements resource.Object.
+func (Fischer) NamespaceScoped() bool {
+	return false
+}
+
+// New implements resource.Object
+func (Fischer) New() runtime.Object {
+	return &Fischer{}
+}
+
+// NewList implements resource.Object
+func (Fischer) NewList() runtime.Object {
+	return &FischerList{}
+}
+
+// GetListMeta implements resource.ObjectList
+func (f *FischerList) GetListMeta() *v1.ListMeta {
+	return &f.ListMeta
+}
+
+func init() {
+	ResourceBuilder.Register(&Fischer{})
+}
+
+var _ resource.Object = &Flunder{}
+var _ resource.ObjectList = &FlunderList{}
+
+// GetGroupVersionResource returns a GroupVersionResource with "flunders" as the resource.
+// GetGroupVersionResource implements resource.Object
+func (Flunder) GetGroupVersionResource() schema.GroupVersionResource {
+	return SchemeGroupVersion.WithResource("flunders")
+}
+
+// GetObjectMeta implements resource.Object
+func (f *Flunder) GetObjectMeta() *v1.ObjectMeta {
+	return &f.ObjectMeta
+}
+
+// IsStorageVersion returns true -- Flunder is used as the internal version.
+// IsStorageVersion implements resource.Object.
+func (Flunder) IsStorageVersion() bool {
+	return true
+}
+
+// NamespaceScoped returns true to indicate Flunder is a namespaced resource.
+// NamespaceScoped implements resource.Object.
+func (Flunder) NamespaceScoped() bool {
+	return true
+}
+
+// New implements resource.Object
+func (Flunder) New() runtime.Object {
+	return &Flunder{}
+}
+
+// NewList implements resource.Object
+func (Flunder) NewList() runtime.Object {
+	return &FlunderList{}
+}
+
+// GetListMeta implements resource.ObjectList
+func (f *FlunderList) GetListMeta() *v1.ListMeta {
+	return &f.ListMeta
+}
+
+func init() {
+	ResourceBuilder.Register(&Flunder{})
+}
+
+var _ resource.Object = &Fortune{}
+var _ resource.ObjectList = &FortuneList{}
+
+// GetGroupVersionResource returns a GroupVersionResource with "fortunes" as the resource.
+// GetGroupVersionResource implements resource.Object
+func (Fortune) GetGroupVersionResource() schema.GroupVersionResource {
+	return SchemeGroupVersion.WithResource("fortunes")
+}
+
+// GetObjectMeta implements resource.Object
+func (f *Fortune) GetObjectMeta() *v1.ObjectMeta {
+	return &f.ObjectMeta
+}
+
+// IsStorageVersion returns true -- Fortune is used as the internal version.
+// IsStorageVersion implements resource.Object.
+func (Fortune) IsStorageVersion() bool {
+	return true
+}
+
+// NamespaceScoped returns true to indicate Fortune is a namespaced resource.
+// NamespaceScoped implements resource.Object.
+func (Fortune) NamespaceScoped() bool {
+	return true
+}
+
+// New implements resource.Object
+func (Fortune) New() runtime.Object {
+	return &Fortune{}
+}
+
+// NewList implements resource.Object
+func (Fortune) NewList() runtime.Object {
+	return &FortuneList{}
+}
+
+// GetListMeta implements resource.ObjectList
+func (f *FortuneList) GetListMeta() *v1.ListMeta {
+	return &f.ListMeta
+}
@@ -0,0 +1,193 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// Reconciler reconciles the object of a key, "namespace/name" or "name" for cluster scoped objects.  The object
+// is read from the lister of the informer of the controller, and may have been deleted.  Returning an error
+// requeues the key with a rate limited delay.
+type Reconciler interface {
+	Reconcile(ctx context.Context, key string) error
+}
+
+// ReconcilerFunc is a function implementing Reconciler.
+type ReconcilerFunc func(ctx context.Context, key string) error
+
+// Reconcile implements Reconciler
+func (f ReconcilerFunc) Reconcile(ctx context.Context, key string) error {
+	return f(ctx, key)
+}
+
+// ControllerOptions are the options of a controller.
+type ControllerOptions struct {
+	// Workers is the number of keys reconciled concurrently, 1 by default.
+	Workers int
+	// RateLimiter delays the keys requeued after an error, workqueue.DefaultControllerRateLimiter by default.
+	RateLimiter workqueue.RateLimiter
+}
+
+// controller reconciles the keys of the objects of an informer.  The keys are queued while the manager leads:
+// the queue is created for each term, with the keys of every object of the informer.
+type controller struct {
+	name       string
+	informer   cache.SharedIndexInformer
+	reconciler Reconciler
+	workers    int
+	limiter    workqueue.RateLimiter
+
+	// started is true once the manager starts the informer
+	started atomic.Bool
+
+	mu    sync.RWMutex
+	queue workqueue.RateLimitingInterface
+}
+
+func newController(name string, informer cache.SharedIndexInformer, r Reconciler, opts ControllerOptions) (*controller, error) {
+	c := &controller{
+		name:       name,
+		informer:   informer,
+		reconciler: r,
+		workers:    opts.Workers,
+		limiter:    opts.RateLimiter,
+	}
+	if c.workers <= 0 {
+		c.workers = 1
+	}
+	if c.limiter == nil {
+		c.limiter = workqueue.DefaultControllerRateLimiter()
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: c.enqueue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *controller) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.queue != nil {
+		c.queue.Add(key)
+	}
+}
+
+// run reconciles the keys until the context is done.
+func (c *controller) run(ctx context.Context) {
+	if !cache.WaitForNamedCacheSync(c.name, ctx.Done(), c.informer.HasSynced) {
+		return
+	}
+
+	queue := workqueue.NewRateLimitingQueueWithConfig(c.limiter, workqueue.RateLimitingQueueConfig{Name: c.name})
+	c.mu.Lock()
+	c.queue = queue
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.queue = nil
+		c.mu.Unlock()
+		queue.ShutDown()
+	}()
+	// the events received before the term are not queued
+	for _, key := range c.informer.GetStore().ListKeys() {
+		queue.Add(key)
+	}
+
+	klog.InfoS("Starting controller", "controller", c.name, "workers", c.workers)
+	defer klog.InfoS("Stopping controller", "controller", c.name)
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.UntilWithContext(ctx, func(ctx context.Context) {
+				for c.processNextKey(ctx, queue) {
+				}
+			}, time.Second)
+		}()
+	}
+	<-ctx.Done()
+	queue.ShutDown()
+	wg.Wait()
+}
+
+func (c *controller) processNextKey(ctx context.Context, queue workqueue.RateLimitingInterface) bool {
+	item, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(item)
+
+	key := item.(string)
+	if err := c.reconcile(ctx, key); err != nil {
+		utilruntime.HandleError(fmt.Errorf("controller %s: reconciling %q: %w", c.name, key, err))
+		queue.AddRateLimited(key)
+		return true
+	}
+	queue.Forget(key)
+	return true
+}
+
+// reconcile calls the reconciler, recovering from its panics as an error.
+func (c *controller) reconcile(ctx context.Context, key string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.reconciler.Reconcile(ctx, key)
+}
+
+// Name implements healthz.HealthChecker
+func (c *controller) Name() string {
+	return "controller-" + c.name
+}
+
+// Check implements healthz.HealthChecker, the controller isn't ready until its informer is synced.
+func (c *controller) Check(_ *http.Request) error {
+	if c.started.Load() && !c.informer.HasSynced() {
+		return fmt.Errorf("the informer of controller %s is not synced", c.name)
+	}
+	return nil
+}
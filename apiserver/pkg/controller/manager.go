@@ -0,0 +1,325 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package controller runs reconcilers of the kes resources next to the apiserver serving them.
+//
+// A Manager shares the typed informers of the generated informers/externalversions between its controllers.
+// Each controller reconciles the keys of the objects of an informer from a rate limited workqueue:
+//
+//	mgr, err := controller.NewManager(ws, controller.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	flunders := mgr.Informers().Sample().V1alpha1().Flunders()
+//	return mgr.Register("flunders", flunders.Informer(), controller.ReconcilerFunc(
+//		func(ctx context.Context, key string) error {
+//			namespace, name, err := cache.SplitMetaNamespaceKey(key)
+//			...
+//		}), controller.ControllerOptions{})
+//
+// With leader election only one replica of the apiserver runs the controllers, the others keep their
+// informers synced to take over.
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"k8s.io/apimachinery/pkg/util/rand"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	apiextensionsv1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned"
+	"github.com/vine-io/kes/apiserver/pkg/generated/informers/externalversions"
+	"github.com/vine-io/kes/apiserver/pkg/server"
+)
+
+// leaderElectionPrefix is the prefix of the etcd keys of the elections.
+const leaderElectionPrefix = "/kes/leaderelection/"
+
+// Options are the options of a Manager.
+type Options struct {
+	// Resync is the resync period of the informers, 0 disables resyncs.
+	Resync time.Duration
+	// LeaderElection, if set, only runs the controllers on the elected replica.
+	LeaderElection *LeaderElectionOptions
+}
+
+// LeaderElectionOptions are the options of the election of the replica running the controllers.
+type LeaderElectionOptions struct {
+	// Name identifies the election, the replicas running the same controllers use the same name.  Required.
+	Name string
+	// Identity identifies the replica, by default the hostname with a random suffix.
+	Identity string
+	// LeaseDuration is how long a replica failing to renew its leadership keeps it, 15s by default.
+	LeaseDuration time.Duration
+	// Client is the etcd client electing the leader.  NewManager uses the etcd storing the resources by default.
+	Client *clientv3.Client
+}
+
+// Manager runs controllers over the informers of the kes resources.
+type Manager struct {
+	client    versioned.Interface
+	informers externalversions.SharedInformerFactory
+	election  *LeaderElectionOptions
+
+	// closeFns release the clients created by the manager once it stops
+	closeFns []func()
+	// server registers the readyz checks of the controllers, nil unless bound to a server
+	server *genericapiserver.GenericAPIServer
+
+	mu          sync.Mutex
+	controllers []*controller
+	started     bool
+	leading     atomic.Bool
+}
+
+// NewManager returns a manager bound to the server: its clients use the in-process loopback config of the server,
+// it starts with the server and the health of its controllers feeds the /readyz endpoint.  It stops as soon as the
+// server shuts down, while the server still serves its requests, e.g. to hand over its leadership.  Controllers
+// must be registered before the server runs, e.g. by WardleServerOptions.ServerFns.
+func NewManager(ws *server.WardleServer, opts Options) (*Manager, error) {
+	client, err := versioned.NewForConfig(ws.InProcessConfig())
+	if err != nil {
+		return nil, err
+	}
+	m := NewManagerForClient(client, opts)
+	m.server = ws.GenericAPIServer
+	if m.election != nil && m.election.Client == nil {
+		// the storage of the ResourceDefinitions is always served
+		etcd, err := ws.NewEtcdClient(apiextensionsv1alpha1.Resource("resourcedefinitions"))
+		if err != nil {
+			return nil, err
+		}
+		m.election.Client = etcd
+		m.closeFns = append(m.closeFns, func() { _ = etcd.Close() })
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var stopped chan struct{}
+	err = ws.GenericAPIServer.AddPostStartHook("start-controller-manager", func(hookCtx genericapiserver.PostStartHookContext) error {
+		mu.Lock()
+		stopped = make(chan struct{})
+		done := stopped
+		mu.Unlock()
+		go func() {
+			defer close(done)
+			defer cancel()
+			go func() {
+				select {
+				case <-hookCtx.StopCh:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			if err := m.Start(ctx); err != nil {
+				utilruntime.HandleError(err)
+			}
+		}()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the pre-shutdown hooks run before the server stops accepting requests
+	err = ws.GenericAPIServer.AddPreShutdownHook("stop-controller-manager", func() error {
+		cancel()
+		mu.Lock()
+		done := stopped
+		mu.Unlock()
+		if done != nil {
+			<-done
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewManagerForClient returns a manager using the client, e.g. a fake clientset in tests.  Leader election
+// requires the etcd client of the LeaderElectionOptions.
+func NewManagerForClient(client versioned.Interface, opts Options) *Manager {
+	m := &Manager{
+		client:    client,
+		informers: externalversions.NewSharedInformerFactory(client, opts.Resync),
+	}
+	if opts.LeaderElection != nil {
+		election := *opts.LeaderElection
+		if election.Identity == "" {
+			hostname, _ := os.Hostname()
+			election.Identity = hostname + "_" + rand.String(8)
+		}
+		if election.LeaseDuration == 0 {
+			election.LeaseDuration = 15 * time.Second
+		}
+		m.election = &election
+	}
+	return m
+}
+
+// Client returns the client of the manager.
+func (m *Manager) Client() versioned.Interface {
+	return m.client
+}
+
+// Informers returns the informers shared by the controllers.
+func (m *Manager) Informers() externalversions.SharedInformerFactory {
+	return m.informers
+}
+
+// IsLeader returns true while the manager runs the controllers.
+func (m *Manager) IsLeader() bool {
+	return m.leading.Load()
+}
+
+// Register adds a controller reconciling the objects of the informer, which must be obtained from Informers.
+// Controllers are registered before the manager starts.
+func (m *Manager) Register(name string, informer cache.SharedIndexInformer, r Reconciler, opts ControllerOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started {
+		return fmt.Errorf("controller %s: the manager is already started", name)
+	}
+	for _, c := range m.controllers {
+		if c.name == name {
+			return fmt.Errorf("controller %s is already registered", name)
+		}
+	}
+	c, err := newController(name, informer, r, opts)
+	if err != nil {
+		return err
+	}
+	if m.server != nil {
+		if err := m.server.AddReadyzChecks(c); err != nil {
+			return err
+		}
+	}
+	m.controllers = append(m.controllers, c)
+	return nil
+}
+
+// Start starts the informers and runs the controllers until the context is done, once elected if leader
+// election is enabled.  A leader losing its leadership stops the controllers and runs for election again.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	if m.started {
+		m.mu.Unlock()
+		return fmt.Errorf("the manager is already started")
+	}
+	m.started = true
+	controllers := m.controllers
+	m.mu.Unlock()
+	defer func() {
+		for _, fn := range m.closeFns {
+			fn()
+		}
+	}()
+	if m.election != nil && (m.election.Name == "" || m.election.Client == nil) {
+		return fmt.Errorf("leader election requires a name and an etcd client")
+	}
+
+	for _, c := range controllers {
+		c.started.Store(true)
+	}
+	m.informers.Start(ctx.Done())
+	defer m.informers.Shutdown()
+
+	if m.election == nil {
+		m.lead(ctx, controllers)
+		return nil
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := m.campaign(ctx, controllers); err != nil && ctx.Err() == nil {
+			utilruntime.HandleError(fmt.Errorf("leader election %s: %w", m.election.Name, err))
+		}
+	}, time.Second)
+	return nil
+}
+
+// campaign runs the controllers once the manager is elected, until it loses the leadership or the context is
+// done.
+func (m *Manager) campaign(ctx context.Context, controllers []*controller) error {
+	ttl := int(m.election.LeaseDuration / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	// the session outlives the context, so that closing it revokes the lease: the leadership is handed over without
+	// waiting for the lease to expire
+	session, err := concurrency.NewSession(m.election.Client, concurrency.WithTTL(ttl))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	election := concurrency.NewElection(session, leaderElectionPrefix+m.election.Name)
+	if err := election.Campaign(ctx, m.election.Identity); err != nil {
+		return err
+	}
+	klog.InfoS("Elected leader", "election", m.election.Name, "identity", m.election.Identity)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Done():
+			klog.InfoS("Lost the leadership", "election", m.election.Name, "identity", m.election.Identity)
+		case <-leaderCtx.Done():
+		}
+		cancel()
+	}()
+	m.lead(leaderCtx, controllers)
+
+	select {
+	case <-session.Done():
+		return fmt.Errorf("%s lost the leadership", m.election.Identity)
+	default:
+		return nil
+	}
+}
+
+// lead runs the controllers until the context is done.
+func (m *Manager) lead(ctx context.Context, controllers []*controller) {
+	m.leading.Store(true)
+	defer m.leading.Store(false)
+
+	var wg sync.WaitGroup
+	for _, c := range controllers {
+		wg.Add(1)
+		go func(c *controller) {
+			defer wg.Done()
+			c.run(ctx)
+		}(c)
+	}
+	wg.Wait()
+}
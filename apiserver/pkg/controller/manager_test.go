@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v3client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/etcd"
+	"github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned/fake"
+)
+
+// recorder records the reconciled keys.
+type recorder struct {
+	mu   sync.Mutex
+	keys []string
+	// fail is the number of reconciles failing before succeeding
+	fail int
+}
+
+func (r *recorder) Reconcile(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, key)
+	if r.fail > 0 {
+		r.fail--
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+func (r *recorder) reconciled() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.keys...)
+}
+
+func flunder(name string) *v1alpha1.Flunder {
+	return &v1alpha1.Flunder{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+}
+
+func TestManager(t *testing.T) {
+	t.Run("reconciles", func(t *testing.T) {
+		client := fake.NewSimpleClientset(flunder("f1"))
+		m := NewManagerForClient(client, Options{})
+		r := &recorder{}
+		informer := m.Informers().Sample().V1alpha1().Flunders().Informer()
+		assert.NoError(t, m.Register("flunders", informer, r, ControllerOptions{}))
+		assert.ErrorContains(t, m.Register("flunders", informer, r, ControllerOptions{}), "already registered")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			assert.NoError(t, m.Start(ctx))
+		}()
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"default/f1"}, r.reconciled())
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.True(t, m.IsLeader())
+		assert.ErrorContains(t, m.Register("fischers", informer, r, ControllerOptions{}), "already started")
+
+		_, err := client.SampleV1alpha1().Flunders("default").Create(ctx, flunder("f2"), metav1.CreateOptions{})
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"default/f1", "default/f2"}, r.reconciled())
+		}, 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		<-done
+		assert.False(t, m.IsLeader())
+	})
+
+	t.Run("requeues errors", func(t *testing.T) {
+		m := NewManagerForClient(fake.NewSimpleClientset(flunder("f1")), Options{})
+		r := &recorder{fail: 2}
+		assert.NoError(t, m.Register("flunders", m.Informers().Sample().V1alpha1().Flunders().Informer(), r,
+			ControllerOptions{RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond)}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = m.Start(ctx) }()
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"default/f1", "default/f1", "default/f1"}, r.reconciled())
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("readiness", func(t *testing.T) {
+		m := NewManagerForClient(fake.NewSimpleClientset(), Options{})
+		assert.NoError(t, m.Register("flunders", m.Informers().Sample().V1alpha1().Flunders().Informer(),
+			&recorder{}, ControllerOptions{}))
+		c := m.controllers[0]
+		assert.Equal(t, "controller-flunders", c.Name())
+
+		c.started.Store(true)
+		assert.ErrorContains(t, c.Check(nil), "not synced")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = m.Start(ctx) }()
+		assert.Eventually(t, func() bool { return c.Check(nil) == nil }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("leader election", func(t *testing.T) {
+		etcdClient := startEtcd(t)
+		newManager := func(identity string) (*Manager, *recorder) {
+			m := NewManagerForClient(fake.NewSimpleClientset(flunder("f1")), Options{
+				LeaderElection: &LeaderElectionOptions{Name: "test", Identity: identity, LeaseDuration: time.Minute, Client: etcdClient},
+			})
+			r := &recorder{}
+			assert.NoError(t, m.Register("flunders", m.Informers().Sample().V1alpha1().Flunders().Informer(), r, ControllerOptions{}))
+			return m, r
+		}
+		first, firstRecorder := newManager("first")
+		second, secondRecorder := newManager("second")
+
+		firstCtx, firstCancel := context.WithCancel(context.Background())
+		firstDone := make(chan struct{})
+		go func() {
+			defer close(firstDone)
+			_ = first.Start(firstCtx)
+		}()
+		assert.Eventually(t, first.IsLeader, 5*time.Second, 10*time.Millisecond)
+		assert.Eventually(t, func() bool { return len(firstRecorder.reconciled()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		secondCtx, secondCancel := context.WithCancel(context.Background())
+		defer secondCancel()
+		go func() { _ = second.Start(secondCtx) }()
+		time.Sleep(100 * time.Millisecond)
+		assert.False(t, second.IsLeader())
+		assert.Empty(t, secondRecorder.reconciled())
+
+		// the first manager hands the leadership over when it stops, before its lease expires
+		firstCancel()
+		<-firstDone
+		assert.Eventually(t, second.IsLeader, 5*time.Second, 10*time.Millisecond)
+		assert.Eventually(t, func() bool { return len(secondRecorder.reconciled()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("leader election requires a client", func(t *testing.T) {
+		m := NewManagerForClient(fake.NewSimpleClientset(), Options{LeaderElection: &LeaderElectionOptions{Name: "test"}})
+		assert.ErrorContains(t, m.Start(context.Background()), "requires a name and an etcd client")
+	})
+}
+
+// startEtcd starts an etcd on free ports and returns an in-process client.
+func startEtcd(t *testing.T) *clientv3.Client {
+	freeURL := func() url.URL {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer l.Close()
+		return url.URL{Scheme: "http", Host: l.Addr().String()}
+	}
+
+	cfg := etcd.NewConfig()
+	cfg.Dir = t.TempDir()
+	clientURL, peerURL := freeURL(), freeURL()
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := etcd.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	<-e.Server.ReadyNotify()
+
+	client := v3client.New(e.Server)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
@@ -38,7 +38,7 @@ import (
 //	  WithResourceAndHandler(&v1alpha1.ExampleResource{},
 //	        jsonfile.NewJsonFileStorageProvider(&v1alpha1.ExampleResource{}, /*the root file-path*/ "data")).
 //	  Build()
-func NewJSONFilepathStorageProvider(obj resource.Object, rootPath string) builderrest.ResourceHandlerProvider {
+func NewJSONFilepathStorageProvider(obj resource.Object, rootPath string) builderrest.StorageProvider {
 	return func(scheme *runtime.Scheme, getter generic.RESTOptionsGetter) (rest.Storage, error) {
 		gr := obj.GetGroupVersionResource().GroupResource()
 		codec, _, err := storage.NewStorageCodec(storage.StorageCodecConfig{
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -49,6 +50,7 @@ func NewFilepathREST(
 	// file REST
 	rest := &filepathREST{
 		TableConvertor: rest.NewDefaultTableConvertor(groupResource),
+		groupResource:  groupResource,
 		codec:          codec,
 		objRootPath:    objRoot,
 		isNamespaced:   isNamespaced,
@@ -61,9 +63,10 @@ func NewFilepathREST(
 
 type filepathREST struct {
 	rest.TableConvertor
-	codec        runtime.Codec
-	objRootPath  string
-	isNamespaced bool
+	groupResource schema.GroupResource
+	codec         runtime.Codec
+	objRootPath   string
+	isNamespaced  bool
 
 	muWatchers sync.RWMutex
 	watchers   map[int]*jsonWatch
@@ -99,7 +102,11 @@ func (f *filepathREST) Get(
 	name string,
 	options *metav1.GetOptions,
 ) (runtime.Object, error) {
-	return read(f.codec, f.objectFileName(ctx, name), f.newFunc)
+	obj, err := read(f.codec, f.objectFileName(ctx, name), f.newFunc)
+	if os.IsNotExist(err) {
+		return nil, apierrors.NewNotFound(f.groupResource, name)
+	}
+	return obj, err
 }
 
 func (f *filepathREST) List(
@@ -151,7 +158,7 @@ func (f *filepathREST) Create(
 	filename := f.objectFileName(ctx, accessor.GetName())
 
 	if exists(filename) {
-		return nil, ErrFileNotExists
+		return nil, apierrors.NewAlreadyExists(f.groupResource, accessor.GetName())
 	}
 
 	if err := write(f.codec, filename, obj); err != nil {
@@ -240,7 +247,7 @@ func (f *filepathREST) Delete(
 	options *metav1.DeleteOptions) (runtime.Object, bool, error) {
 	filename := f.objectFileName(ctx, name)
 	if !exists(filename) {
-		return nil, false, ErrFileNotExists
+		return nil, false, apierrors.NewNotFound(f.groupResource, name)
 	}
 
 	oldObj, err := f.Get(ctx, name, nil)
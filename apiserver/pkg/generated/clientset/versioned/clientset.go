@@ -14,7 +14,7 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Code generated by client-gen. DO NOT EDIT.
+// Code generated by apiserver-runtime-gen. DO NOT EDIT.
 
 package versioned
 
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"net/http"
 
+	apiextensionsv1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned/typed/apiextensions/v1alpha1"
 	samplev1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned/typed/sample/v1alpha1"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
@@ -30,13 +31,20 @@ import (
 
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
+	ApiextensionsV1alpha1() apiextensionsv1alpha1.ApiextensionsV1alpha1Interface
 	SampleV1alpha1() samplev1alpha1.SampleV1alpha1Interface
 }
 
 // Clientset contains the clients for groups.
 type Clientset struct {
 	*discovery.DiscoveryClient
-	sampleV1alpha1 *samplev1alpha1.SampleV1alpha1Client
+	apiextensionsV1alpha1 *apiextensionsv1alpha1.ApiextensionsV1alpha1Client
+	sampleV1alpha1        *samplev1alpha1.SampleV1alpha1Client
+}
+
+// ApiextensionsV1alpha1 retrieves the ApiextensionsV1alpha1Client
+func (c *Clientset) ApiextensionsV1alpha1() apiextensionsv1alpha1.ApiextensionsV1alpha1Interface {
+	return c.apiextensionsV1alpha1
 }
 
 // SampleV1alpha1 retrieves the SampleV1alpha1Client
@@ -88,6 +96,10 @@ func NewForConfigAndClient(c *rest.Config, httpClient *http.Client) (*Clientset,
 
 	var cs Clientset
 	var err error
+	cs.apiextensionsV1alpha1, err = apiextensionsv1alpha1.NewForConfigAndClient(&configShallowCopy, httpClient)
+	if err != nil {
+		return nil, err
+	}
 	cs.sampleV1alpha1, err = samplev1alpha1.NewForConfigAndClient(&configShallowCopy, httpClient)
 	if err != nil {
 		return nil, err
@@ -113,6 +125,7 @@ func NewForConfigOrDie(c *rest.Config) *Clientset {
 // New creates a new Clientset for the given RESTClient.
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
+	cs.apiextensionsV1alpha1 = apiextensionsv1alpha1.New(c)
 	cs.sampleV1alpha1 = samplev1alpha1.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
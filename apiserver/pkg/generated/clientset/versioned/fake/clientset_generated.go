@@ -14,12 +14,14 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Code generated by client-gen. DO NOT EDIT.
+// Code generated by apiserver-runtime-gen. DO NOT EDIT.
 
 package fake
 
 import (
 	clientset "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned"
+	apiextensionsv1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned/typed/apiextensions/v1alpha1"
+	fakeapiextensionsv1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned/typed/apiextensions/v1alpha1/fake"
 	samplev1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned/typed/sample/v1alpha1"
 	fakesamplev1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned/typed/sample/v1alpha1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -79,6 +81,11 @@ var (
 	_ testing.FakeClient  = &Clientset{}
 )
 
+// ApiextensionsV1alpha1 retrieves the ApiextensionsV1alpha1Client
+func (c *Clientset) ApiextensionsV1alpha1() apiextensionsv1alpha1.ApiextensionsV1alpha1Interface {
+	return &fakeapiextensionsv1alpha1.FakeApiextensionsV1alpha1{Fake: &c.Fake}
+}
+
 // SampleV1alpha1 retrieves the SampleV1alpha1Client
 func (c *Clientset) SampleV1alpha1() samplev1alpha1.SampleV1alpha1Interface {
 	return &fakesamplev1alpha1.FakeSampleV1alpha1{Fake: &c.Fake}
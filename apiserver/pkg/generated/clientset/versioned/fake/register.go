@@ -14,11 +14,12 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Code generated by client-gen. DO NOT EDIT.
+// Code generated by apiserver-runtime-gen. DO NOT EDIT.
 
 package fake
 
 import (
+	apiextensionsv1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
 	samplev1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
@@ -31,6 +32,7 @@ var scheme = runtime.NewScheme()
 var codecs = serializer.NewCodecFactory(scheme)
 
 var localSchemeBuilder = runtime.SchemeBuilder{
+	apiextensionsv1alpha1.AddToScheme,
 	samplev1alpha1.AddToScheme,
 }
 
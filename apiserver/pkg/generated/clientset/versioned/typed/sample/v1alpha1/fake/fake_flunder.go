@@ -14,14 +14,17 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Code generated by client-gen. DO NOT EDIT.
+// Code generated by apiserver-runtime-gen. DO NOT EDIT.
 
 package fake
 
 import (
 	"context"
+	json "encoding/json"
+	"fmt"
 
 	v1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	samplev1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/applyconfiguration/sample/v1alpha1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	labels "k8s.io/apimachinery/pkg/labels"
 	types "k8s.io/apimachinery/pkg/types"
@@ -139,3 +142,48 @@ func (c *FakeFlunders) Patch(ctx context.Context, name string, pt types.PatchTyp
 	}
 	return obj.(*v1alpha1.Flunder), err
 }
+
+// Apply takes the given apply declarative configuration, applies it and returns the applied flunder.
+func (c *FakeFlunders) Apply(ctx context.Context, flunder *samplev1alpha1.FlunderApplyConfiguration, opts v1.ApplyOptions) (result *v1alpha1.Flunder, err error) {
+	if flunder == nil {
+		return nil, fmt.Errorf("flunder provided to Apply must not be nil")
+	}
+	data, err := json.Marshal(flunder)
+	if err != nil {
+		return nil, err
+	}
+	name := flunder.Name
+	if name == nil {
+		return nil, fmt.Errorf("flunder.Name must be provided to Apply")
+	}
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(flundersResource, c.ns, *name, types.ApplyPatchType, data), &v1alpha1.Flunder{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.Flunder), err
+}
+
+// ApplyStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating ApplyStatus().
+func (c *FakeFlunders) ApplyStatus(ctx context.Context, flunder *samplev1alpha1.FlunderApplyConfiguration, opts v1.ApplyOptions) (result *v1alpha1.Flunder, err error) {
+	if flunder == nil {
+		return nil, fmt.Errorf("flunder provided to Apply must not be nil")
+	}
+	data, err := json.Marshal(flunder)
+	if err != nil {
+		return nil, err
+	}
+	name := flunder.Name
+	if name == nil {
+		return nil, fmt.Errorf("flunder.Name must be provided to Apply")
+	}
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(flundersResource, c.ns, *name, types.ApplyPatchType, data, "status"), &v1alpha1.Flunder{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.Flunder), err
+}
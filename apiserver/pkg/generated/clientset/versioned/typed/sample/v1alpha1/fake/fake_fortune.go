@@ -14,14 +14,17 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Code generated by client-gen. DO NOT EDIT.
+// Code generated by apiserver-runtime-gen. DO NOT EDIT.
 
 package fake
 
 import (
 	"context"
+	json "encoding/json"
+	"fmt"
 
 	v1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	samplev1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/applyconfiguration/sample/v1alpha1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	labels "k8s.io/apimachinery/pkg/labels"
 	types "k8s.io/apimachinery/pkg/types"
@@ -127,3 +130,25 @@ func (c *FakeFortunes) Patch(ctx context.Context, name string, pt types.PatchTyp
 	}
 	return obj.(*v1alpha1.Fortune), err
 }
+
+// Apply takes the given apply declarative configuration, applies it and returns the applied fortune.
+func (c *FakeFortunes) Apply(ctx context.Context, fortune *samplev1alpha1.FortuneApplyConfiguration, opts v1.ApplyOptions) (result *v1alpha1.Fortune, err error) {
+	if fortune == nil {
+		return nil, fmt.Errorf("fortune provided to Apply must not be nil")
+	}
+	data, err := json.Marshal(fortune)
+	if err != nil {
+		return nil, err
+	}
+	name := fortune.Name
+	if name == nil {
+		return nil, fmt.Errorf("fortune.Name must be provided to Apply")
+	}
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(fortunesResource, c.ns, *name, types.ApplyPatchType, data), &v1alpha1.Fortune{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.Fortune), err
+}
@@ -14,15 +14,18 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Code generated by client-gen. DO NOT EDIT.
+// Code generated by apiserver-runtime-gen. DO NOT EDIT.
 
 package v1alpha1
 
 import (
 	"context"
+	json "encoding/json"
+	"fmt"
 	"time"
 
 	v1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	samplev1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/applyconfiguration/sample/v1alpha1"
 	scheme "github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned/scheme"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	types "k8s.io/apimachinery/pkg/types"
@@ -46,6 +49,7 @@ type FortuneInterface interface {
 	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.FortuneList, error)
 	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
 	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.Fortune, err error)
+	Apply(ctx context.Context, fortune *samplev1alpha1.FortuneApplyConfiguration, opts v1.ApplyOptions) (result *v1alpha1.Fortune, err error)
 	FortuneExpansion
 }
 
@@ -176,3 +180,29 @@ func (c *fortunes) Patch(ctx context.Context, name string, pt types.PatchType, d
 		Into(result)
 	return
 }
+
+// Apply takes the given apply declarative configuration, applies it and returns the applied fortune.
+func (c *fortunes) Apply(ctx context.Context, fortune *samplev1alpha1.FortuneApplyConfiguration, opts v1.ApplyOptions) (result *v1alpha1.Fortune, err error) {
+	if fortune == nil {
+		return nil, fmt.Errorf("fortune provided to Apply must not be nil")
+	}
+	patchOpts := opts.ToPatchOptions()
+	data, err := json.Marshal(fortune)
+	if err != nil {
+		return nil, err
+	}
+	name := fortune.Name
+	if name == nil {
+		return nil, fmt.Errorf("fortune.Name must be provided to Apply")
+	}
+	result = &v1alpha1.Fortune{}
+	err = c.client.Patch(types.ApplyPatchType).
+		Namespace(c.ns).
+		Resource("fortunes").
+		Name(*name).
+		VersionedParams(&patchOpts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
@@ -0,0 +1,32 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package kmsplugin implements a local KMS v2 plugin.
+//
+// The plugin serves the KMS v2 gRPC API on a unix socket and wraps data encryption keys with the AES keys of a
+// key file, in the same format as the --field-encryption-key-file.  It is a stand-in for a real key management
+// service, which makes it possible to enable encryption at rest with --encryption-provider-config on machines
+// without access to one.
+//
+// Keys are rotated by adding a new key to the top of the key file, see RotateKeyFile.  The plugin reloads the
+// file periodically and reports the new primary key id on its status endpoint, which causes the apiserver to
+// use it for new data keys.  Older keys must stay in the file until every object was rewritten.
+package kmsplugin
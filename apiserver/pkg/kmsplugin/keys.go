@@ -0,0 +1,82 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package kmsplugin
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/storage/fieldencryption"
+)
+
+const keySize = 32
+
+// RotateKeyFile generates a new key and adds it as the primary key to the key file at path, creating the file
+// if it does not exist.  If name is empty the key is named after the current time.  The previous keys are kept
+// so that data wrapped with them can still be decrypted.
+func RotateKeyFile(path, name string) (string, error) {
+	f := &fieldencryption.KeyFile{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return "", err
+	default:
+		if err := yaml.UnmarshalStrict(data, f); err != nil {
+			return "", fmt.Errorf("invalid key file %q: %w", path, err)
+		}
+	}
+
+	if name == "" {
+		name = "key-" + strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	secret := make([]byte, keySize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	f.Keys = append([]fieldencryption.Key{{Name: name, Secret: secret}}, f.Keys...)
+	if _, err := fieldencryption.NewLocalKeyService(f.Keys...); err != nil {
+		return "", err
+	}
+
+	data, err = yaml.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	// write the new file next to the old one and rename it, so a reloading plugin never sees a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,165 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package kmsplugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	kmsservice "k8s.io/kms/pkg/service"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/storage/fieldencryption"
+)
+
+const (
+	// Version is the KMS API version reported by the plugin.
+	Version = "v2"
+
+	healthzOK = "ok"
+)
+
+var _ kmsservice.Service = &Service{}
+
+// Service implements the KMS v2 service with the keys of a key file.
+type Service struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    fieldencryption.KeyService
+	hash    [sha256.Size]byte
+	loadErr error
+}
+
+// NewService returns a Service for the key file at path.
+func NewService(path string) (*Service, error) {
+	s := &Service{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the key file again.  If the file cannot be loaded the previous keys are kept, and the error is
+// reported by Status until a reload succeeds.
+func (s *Service) Reload() error {
+	data, err := os.ReadFile(s.path)
+	hash := sha256.Sum256(data)
+
+	var keys fieldencryption.KeyService
+	if err == nil {
+		s.mu.RLock()
+		unchanged := s.keys != nil && s.hash == hash
+		s.mu.RUnlock()
+		if unchanged {
+			keys = s.keyService()
+		} else {
+			keys, err = fieldencryption.ParseKeyFile(data)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.loadErr = fmt.Errorf("invalid key file %q: %w", s.path, err)
+		return s.loadErr
+	}
+	if s.keys != nil && s.keys.PrimaryKeyID() != keys.PrimaryKeyID() {
+		klog.InfoS("KMS plugin primary key rotated", "from", s.keys.PrimaryKeyID(), "to", keys.PrimaryKeyID())
+	}
+	s.keys, s.hash, s.loadErr = keys, hash, nil
+	return nil
+}
+
+// Run reloads the key file every interval until ctx is done.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := s.Reload(); err != nil {
+			klog.ErrorS(err, "Failed to reload KMS plugin key file", "path", s.path)
+		}
+	}, interval)
+}
+
+func (s *Service) keyService() fieldencryption.KeyService {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys
+}
+
+// Encrypt wraps data, the data encryption key of the apiserver, with the primary key.
+func (s *Service) Encrypt(ctx context.Context, uid string, data []byte) (*kmsservice.EncryptResponse, error) {
+	keyID, ciphertext, err := s.keyService().Wrap(data)
+	if err != nil {
+		klog.V(4).InfoS("Encrypt failed", "uid", uid, "err", err)
+		return nil, err
+	}
+	return &kmsservice.EncryptResponse{Ciphertext: ciphertext, KeyID: keyID}, nil
+}
+
+// Decrypt unwraps a data encryption key with the key it was wrapped with.
+func (s *Service) Decrypt(ctx context.Context, uid string, req *kmsservice.DecryptRequest) ([]byte, error) {
+	plaintext, err := s.keyService().Unwrap(req.KeyID, req.Ciphertext)
+	if err != nil {
+		klog.V(4).InfoS("Decrypt failed", "uid", uid, "keyID", req.KeyID, "err", err)
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// Status reports the primary key id.  The plugin is healthy if the last reload of the key file succeeded and
+// the primary key can encrypt and decrypt.
+func (s *Service) Status(ctx context.Context) (*kmsservice.StatusResponse, error) {
+	s.mu.RLock()
+	keys, loadErr := s.keys, s.loadErr
+	s.mu.RUnlock()
+
+	return &kmsservice.StatusResponse{
+		Version: Version,
+		Healthz: healthz(keys, loadErr),
+		KeyID:   keys.PrimaryKeyID(),
+	}, nil
+}
+
+func healthz(keys fieldencryption.KeyService, loadErr error) string {
+	if loadErr != nil {
+		return fmt.Sprintf("failed to load key file: %v", loadErr)
+	}
+	probe := []byte("healthz")
+	keyID, ciphertext, err := keys.Wrap(probe)
+	if err != nil {
+		return fmt.Sprintf("failed to encrypt: %v", err)
+	}
+	plaintext, err := keys.Unwrap(keyID, ciphertext)
+	if err != nil {
+		return fmt.Sprintf("failed to decrypt: %v", err)
+	}
+	if !bytes.Equal(probe, plaintext) {
+		return "decrypted value does not match"
+	}
+	return healthzOK
+}
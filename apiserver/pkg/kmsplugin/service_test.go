@@ -0,0 +1,58 @@
+package kmsplugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	kmsservice "k8s.io/kms/pkg/service"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.TODO()
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+
+	_, err := NewService(path)
+	assert.Error(t, err)
+
+	_, err = RotateKeyFile(path, "key1")
+	assert.NoError(t, err)
+	svc, err := NewService(path)
+	assert.NoError(t, err)
+
+	status, err := svc.Status(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &kmsservice.StatusResponse{Version: "v2", Healthz: "ok", KeyID: "key1"}, status)
+
+	resp, err := svc.Encrypt(ctx, "uid", []byte("dek"))
+	assert.NoError(t, err)
+	assert.Equal(t, "key1", resp.KeyID)
+
+	t.Run("rotation should keep older keys for decryption", func(t *testing.T) {
+		_, err := RotateKeyFile(path, "key2")
+		assert.NoError(t, err)
+		assert.NoError(t, svc.Reload())
+
+		status, err := svc.Status(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "key2", status.KeyID)
+
+		plaintext, err := svc.Decrypt(ctx, "uid", &kmsservice.DecryptRequest{Ciphertext: resp.Ciphertext, KeyID: resp.KeyID})
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("dek"), plaintext)
+	})
+	t.Run("invalid key file should keep the keys and report unhealthy", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(path, []byte("keys: [{name: broken}]"), 0600))
+		assert.Error(t, svc.Reload())
+
+		status, err := svc.Status(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "key2", status.KeyID)
+		assert.NotEqual(t, "ok", status.Healthz)
+
+		_, err = svc.Decrypt(ctx, "uid", &kmsservice.DecryptRequest{Ciphertext: resp.Ciphertext, KeyID: resp.KeyID})
+		assert.NoError(t, err)
+	})
+}
@@ -17,28 +17,39 @@ limitations under the License.
 package server
 
 import (
+	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/go-logr/zapr"
-	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	apiextensionsv1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
 	"github.com/vine-io/kes/apiserver/pkg/etcd"
+	"github.com/vine-io/kes/apiserver/pkg/server/dynamic"
 	"github.com/vine-io/kes/apiserver/pkg/server/resource"
 	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcerest"
-	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcestrategy"
 	"github.com/vine-io/kes/apiserver/pkg/server/rest"
+	"github.com/vine-io/kes/apiserver/pkg/server/storage"
+	"github.com/vine-io/kes/apiserver/pkg/server/storage/fieldencryption"
+	"github.com/vine-io/kes/apiserver/pkg/server/transaction"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/conversion"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apiserver/pkg/endpoints/openapi"
 	genericregistry "k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/registry/generic/registry"
 	restregistry "k8s.io/apiserver/pkg/registry/rest"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	"k8s.io/klog/v2"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
 )
 
 var (
@@ -79,7 +90,12 @@ func init() {
 
 // ExtraConfig holds custom apiserver config
 type ExtraConfig struct {
-	// Place you custom config here.
+	// Resources are served in addition to the ResourceDefinitions.
+	Resources []resource.Object
+	// OpenAPIDefinitions returns the definitions of the Resources not in the OpenAPI config, if any.
+	OpenAPIDefinitions openapicommon.GetOpenAPIDefinitions
+	// EmbeddedEtcd is the config of the etcd started by the server, if any.
+	EmbeddedEtcd *etcd.Config
 }
 
 // Config defines the config for the apiserver
@@ -113,8 +129,9 @@ type completedConfig struct {
 	ExtraConfig   *ExtraConfig
 }
 
-// New returns a new instance of WardleServer from the given config.
-func (c completedConfig) New() (*WardleServer, error) {
+// New returns a new instance of WardleServer from the given config.  The embedded etcd, if any, is closed by the
+// destroy functions of the server, after its storage has been released.
+func (c completedConfig) New() (_ *WardleServer, err error) {
 	genericServer, err := c.GenericConfig.New("sample-apiserver", genericapiserver.NewEmptyDelegate())
 	if err != nil {
 		return nil, err
@@ -123,20 +140,29 @@ func (c completedConfig) New() (*WardleServer, error) {
 	// change: apiserver-runtime
 	// genericServer = ApplyGenericAPIServerFns(genericServer)
 
-	etcdCfg := etcd.NewConfig()
-	zapLogger := etcdCfg.GetLogger()
+	var zapLogger *zap.Logger
+	if c.ExtraConfig.EmbeddedEtcd != nil {
+		zapLogger = c.ExtraConfig.EmbeddedEtcd.GetLogger()
+	}
 	if zapLogger == nil {
 		zapLogger = zap.NewExample()
 	}
 	logr := zapr.NewLogger(zapLogger)
 	klog.SetLogger(logr)
 
-	etcdCfg.Dir = "_output"
-	embedEtcd, err := etcd.StartEtcd(etcdCfg)
-	if err != nil {
-		return nil, err
+	var embedEtcd *etcd.Etcd
+	if c.ExtraConfig.EmbeddedEtcd != nil {
+		embedEtcd, err = etcd.StartEtcd(c.ExtraConfig.EmbeddedEtcd)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				embedEtcd.Close()
+			}
+		}()
+		<-embedEtcd.Server.ReadyNotify()
 	}
-	<-embedEtcd.Server.ReadyNotify()
 
 	s := &WardleServer{
 		APIs:                 map[schema.GroupVersionResource]rest.StorageProvider{},
@@ -144,14 +170,28 @@ func (c completedConfig) New() (*WardleServer, error) {
 		embedEtcd:            embedEtcd,
 		errs:                 []error{},
 		storageProvider:      map[schema.GroupResource]*singletonProvider{},
+		stores:               map[schema.GroupResource]*registry.Store{},
 		groupVersions:        map[schema.GroupVersion]bool{},
 		orderedGroupVersions: []schema.GroupVersion{},
 		schemes:              []*runtime.Scheme{},
 		//schemeBuilder:       ,
 	}
+	if embedEtcd != nil {
+		registerEmbeddedEtcdMetrics()
+		s.embedEtcdMonitor = newEmbeddedEtcdMonitor(embedEtcd)
+		if err := genericServer.AddHealthChecks(s.embedEtcdMonitor.LiveCheck()); err != nil {
+			return nil, err
+		}
+		if err := genericServer.AddReadyzChecks(s.embedEtcdMonitor.ReadyCheck()); err != nil {
+			return nil, err
+		}
+	}
 
-	s.WithResource(&v1alpha1.Fischer{})
-	s.WithResource(&v1alpha1.Flunder{})
+	s.WithResources(c.ExtraConfig.Resources...)
+	s.WithResources(apiextensionsv1alpha1.ResourceBuilder...)
+	if c.ExtraConfig.OpenAPIDefinitions != nil {
+		s.openAPIDefinitions = append(s.openAPIDefinitions, c.ExtraConfig.OpenAPIDefinitions)
+	}
 
 	//versions := s.orderedGroupVersions
 	s.schemes = append(s.schemes, Scheme)
@@ -182,15 +222,49 @@ func (c completedConfig) New() (*WardleServer, error) {
 			}
 			return nil
 		},
+		// after the resources, so every version of a kind is known
+		resource.AddHubConversionsToScheme,
 	)
 	for i := range s.schemes {
 		if err := s.schemeBuilder.AddToScheme(s.schemes[i]); err != nil {
 			s.errs = append(s.errs, err)
 		}
 	}
+	if len(s.errs) != 0 {
+		return nil, utilerrors.NewAggregate(s.errs)
+	}
+
+	// the definitions are only read once the API groups are installed.  The names are resolved again, now that
+	// the resources are registered with the Scheme, so that the definitions carry the group version kinds used
+	// by server-side apply.
+	namer := openapi.NewDefinitionNamer(Scheme)
+	if c.GenericConfig.OpenAPIConfig != nil {
+		c.GenericConfig.OpenAPIConfig.GetDefinitions = s.withOpenAPIDefinitions(c.GenericConfig.OpenAPIConfig.GetDefinitions)
+		c.GenericConfig.OpenAPIConfig.GetDefinitionName = namer.GetDefinitionName
+	}
+	if c.GenericConfig.OpenAPIV3Config != nil {
+		c.GenericConfig.OpenAPIV3Config.GetDefinitions = s.withOpenAPIDefinitions(c.GenericConfig.OpenAPIV3Config.GetDefinitions)
+		c.GenericConfig.OpenAPIV3Config.GetDefinitionName = namer.GetDefinitionName
+		// DefaultOpenAPIV3Config precomputes the definitions, which take precedence over GetDefinitions
+		c.GenericConfig.OpenAPIV3Config.Definitions = nil
+	}
 
 	// Add new APIs through inserting into APIs
-	apiGroups, err := s.BuildAPIGroupInfos(Scheme, c.GenericConfig.RESTOptionsGetter, s.APIs)
+	var optsGetter genericregistry.RESTOptionsGetter = c.GenericConfig.RESTOptionsGetter
+	var definitions openapicommon.GetOpenAPIDefinitions
+	if c.GenericConfig.OpenAPIV3Config != nil {
+		definitions = c.GenericConfig.OpenAPIV3Config.GetDefinitions
+		optsGetter = &openAPIRESTOptionsGetter{
+			RESTOptionsGetter: optsGetter,
+			definitions:       definitions,
+		}
+	}
+	for i := range s.schemes {
+		if err := rest.AddDefaultingFuncs(s.schemes[i], definitions); err != nil {
+			return nil, err
+		}
+	}
+	apiGroups, err := s.BuildAPIGroupInfos(Scheme, optsGetter, s.APIs)
 	if err != nil {
 		return nil, err
 	}
@@ -200,6 +274,21 @@ func (c completedConfig) New() (*WardleServer, error) {
 		}
 	}
 
+	if err := s.installResourceDefinitions(c, apiGroups); err != nil {
+		return nil, err
+	}
+
+	s.restOptionsGetter = c.GenericConfig.RESTOptionsGetter
+	s.transactions = transaction.NewExecutor(Scheme, s.storeFor, c.GenericConfig.RESTOptionsGetter, c.GenericConfig.AdmissionControl)
+	s.GenericAPIServer.RegisterDestroyFunc(s.transactions.Destroy)
+	s.GenericAPIServer.Handler.NonGoRestfulMux.Handle(transaction.Path,
+		transaction.NewHandler(s.transactions, Scheme, Codecs, c.GenericConfig.Authorization.Authorizer))
+
+	// registered last, so the stores have stopped their cachers and watches once the member is closed
+	if s.embedEtcdMonitor != nil {
+		s.GenericAPIServer.RegisterDestroyFunc(s.embedEtcdMonitor.Close)
+	}
+
 	return s, nil
 }
 
@@ -209,6 +298,19 @@ type WardleServer struct {
 	GenericAPIServer *genericapiserver.GenericAPIServer
 
 	embedEtcd *etcd.Etcd
+	// embedEtcdMonitor tracks the state of the embedded etcd member, nil without one
+	embedEtcdMonitor *embeddedEtcdMonitor
+
+	// stores holds the registry stores backing the resources, used for transactions
+	stores       map[schema.GroupResource]*registry.Store
+	transactions *transaction.Executor
+	// restOptionsGetter returns the storage config of the resources, used to connect to their etcd
+	restOptionsGetter genericregistry.RESTOptionsGetter
+	// resourceDefinitions serves the resources defined by the ResourceDefinitions
+	resourceDefinitions *dynamic.Manager
+
+	// openAPIDefinitions holds the definitions of kinds registered by the resources, e.g. by typed subresources
+	openAPIDefinitions []openapicommon.GetOpenAPIDefinitions
 
 	errs                 []error
 	storageProvider      map[schema.GroupResource]*singletonProvider
@@ -242,13 +344,8 @@ func (ws *WardleServer) BuildAPIGroupInfos(s *runtime.Scheme, g genericregistry.
 					return nil, err
 				}
 				apis[gvr.Version][gvr.Resource] = storage
-				// add the defaulting function for this version to the scheme
-				if _, ok := storage.(resourcestrategy.Defaulter); ok {
-					if obj, ok := storage.(runtime.Object); ok {
-						s.AddTypeDefaultingFunc(obj, func(obj interface{}) {
-							obj.(resourcestrategy.Defaulter).Default()
-						})
-					}
+				if store, ok := storage.(*registry.Store); ok && !strings.Contains(gvr.Resource, "/") {
+					ws.stores[gvr.GroupResource()] = store
 				}
 				if c, ok := storage.(restregistry.Connecter); ok {
 					optionsObj, _, _ := c.NewConnectOptions()
@@ -273,6 +370,122 @@ func (ws *WardleServer) BuildAPIGroupInfos(s *runtime.Scheme, g genericregistry.
 	return apiGroups, nil
 }
 
+// withOpenAPIDefinitions returns the definitions of getDefinitions merged with the definitions registered by
+// the resources.
+func (ws *WardleServer) withOpenAPIDefinitions(getDefinitions openapicommon.GetOpenAPIDefinitions) openapicommon.GetOpenAPIDefinitions {
+	if len(ws.openAPIDefinitions) == 0 {
+		return getDefinitions
+	}
+	extra := ws.openAPIDefinitions
+	return func(ref openapicommon.ReferenceCallback) map[string]openapicommon.OpenAPIDefinition {
+		defs := map[string]openapicommon.OpenAPIDefinition{}
+		if getDefinitions != nil {
+			defs = getDefinitions(ref)
+		}
+		for _, getExtra := range extra {
+			for name, def := range getExtra(ref) {
+				if _, found := defs[name]; !found {
+					defs[name] = def
+				}
+			}
+		}
+		return defs
+	}
+}
+
+// openAPIRESTOptionsGetter exposes the OpenAPI definitions of the server to the storage providers.
+type openAPIRESTOptionsGetter struct {
+	genericregistry.RESTOptionsGetter
+	definitions openapicommon.GetOpenAPIDefinitions
+}
+
+var _ rest.OpenAPIDefinitionsGetter = &openAPIRESTOptionsGetter{}
+var _ fieldencryption.EnvelopeGetter = &openAPIRESTOptionsGetter{}
+
+func (g *openAPIRESTOptionsGetter) OpenAPIDefinitions() openapicommon.GetOpenAPIDefinitions {
+	return g.definitions
+}
+
+// FieldEncryptionEnvelope returns the envelope of the wrapped RESTOptionsGetter, if any.
+func (g *openAPIRESTOptionsGetter) FieldEncryptionEnvelope() *fieldencryption.Envelope {
+	if eg, ok := g.RESTOptionsGetter.(fieldencryption.EnvelopeGetter); ok {
+		return eg.FieldEncryptionEnvelope()
+	}
+	return nil
+}
+
+// Transactions returns the Executor committing atomic multi-object writes across the etcd backed resources.
+// The same transactions are served over HTTP at transaction.Path.
+func (ws *WardleServer) Transactions() *transaction.Executor {
+	return ws.transactions
+}
+
+// installResourceDefinitions serves the resources defined by the ResourceDefinitions under /apis, once the
+// server has started.  The groups of the installed APIs cannot be defined.
+func (ws *WardleServer) installResourceDefinitions(c completedConfig, apiGroups []*genericapiserver.APIGroupInfo) error {
+	gr := apiextensionsv1alpha1.Resource("resourcedefinitions")
+	definitions, ok := ws.stores[gr]
+	if !ok {
+		return fmt.Errorf("the storage of %v is not a registry store", gr)
+	}
+	var status restregistry.Updater
+	reserved := sets.New[string]()
+	for _, apiGroup := range apiGroups {
+		group := apiGroup.PrioritizedVersions[0].Group
+		reserved.Insert(group)
+		if group != gr.Group {
+			continue
+		}
+		for _, storage := range apiGroup.VersionedResourcesStorageMap {
+			if updater, ok := storage[gr.Resource+"/status"].(restregistry.Updater); ok {
+				status = updater
+			}
+		}
+	}
+	if status == nil {
+		return fmt.Errorf("the status of %v cannot be updated", gr)
+	}
+
+	ws.resourceDefinitions = dynamic.NewManager(&dynamic.Config{
+		RESTOptionsGetter:               c.GenericConfig.RESTOptionsGetter,
+		Admission:                       c.GenericConfig.AdmissionControl,
+		Authorizer:                      c.GenericConfig.Authorization.Authorizer,
+		Serializer:                      Codecs,
+		DiscoveryGroupManager:           ws.GenericAPIServer.DiscoveryGroupManager,
+		AggregatedDiscoveryGroupManager: ws.GenericAPIServer.AggregatedDiscoveryGroupManager,
+		ReservedGroups:                  reserved,
+		MinRequestTimeout:               time.Duration(c.GenericConfig.MinRequestTimeout) * time.Second,
+		MaxRequestBodyBytes:             c.GenericConfig.MaxRequestBodyBytes,
+	})
+	ws.GenericAPIServer.Handler.NonGoRestfulMux.HandlePrefix("/apis/", ws.resourceDefinitions)
+	// the storage of the defined resources is released along with the storage of the APIs, rather than whenever
+	// Run notices the server has stopped
+	ws.GenericAPIServer.RegisterDestroyFunc(ws.resourceDefinitions.Destroy)
+	return ws.GenericAPIServer.AddPostStartHook("start-resource-definitions", func(ctx genericapiserver.PostStartHookContext) error {
+		go ws.resourceDefinitions.Run(ctx.StopCh, definitions, status)
+		return nil
+	})
+}
+
+// storeFor returns the registry store backing the resource.
+func (ws *WardleServer) storeFor(gr schema.GroupResource) (*registry.Store, error) {
+	store, ok := ws.stores[gr]
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("resource %v does not support transactions", gr))
+	}
+	return store, nil
+}
+
+// NewEtcdClient returns a client of the etcd storing the resource, e.g. to elect a leader among the replicas of
+// the apiserver.  Callers are responsible for closing the client.
+func (ws *WardleServer) NewEtcdClient(gr schema.GroupResource) (*clientv3.Client, error) {
+	opts, err := ws.restOptionsGetter.GetRESTOptions(gr)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewETCD3Client(opts.StorageConfig.Transport)
+}
+
 // WithResource registers the resource with the apiserver.
 //
 // If no versions of this GroupResource have already been registered, a new default handler will be registered.
@@ -286,10 +499,13 @@ func (ws *WardleServer) BuildAPIGroupInfos(s *runtime.Scheme, g genericregistry.
 // behavior.
 //
 // WithResource will automatically register the "status" subresource if the object implements the
-// resource.StatusGetSetter interface.
+// resource.StatusGetSetter interface, and the subresources declared by resource.ObjectWithTypedSubResource.
 //
 // WithResource will automatically register version-specific defaulting for this GroupVersionResource
-// if the object implements the resource.Defaulter interface.
+// if the object implements the resourcestrategy.Defaulter interface or its OpenAPI schema declares default values.
+//
+// WithResource will automatically register the storage lifecycle hooks if the object implements any of the
+// resourcestrategy.BeginCreater, AfterCreater, BeginUpdater, AfterUpdater or AfterDeleter interfaces.
 //
 // WithResource automatically adds the object and its list type to the known types.  If the object also declares itself
 // as the storage version, the object and its list type will be added as storage versions to the SchemeBuilder as well.
@@ -318,7 +534,7 @@ func (ws *WardleServer) WithResource(obj resource.Object) *WardleServer {
 	// If the type implements it's own storage, then use that
 	switch s := obj.(type) {
 	case resourcerest.Creator, resourcerest.Updater, resourcerest.Getter, resourcerest.Lister:
-		parentStorageProvider = rest.StaticHandlerProvider{Storage: s.(restregistry.Storage)}.Get
+		parentStorageProvider = rest.WithManagedFields(obj, rest.StaticHandlerProvider{Storage: s.(restregistry.Storage)}.Get)
 	default:
 		parentStorageProvider = rest.New(obj)
 	}
@@ -328,6 +544,15 @@ func (ws *WardleServer) WithResource(obj resource.Object) *WardleServer {
 	return ws
 }
 
+// WithResources registers each of the resources with the apiserver as WithResource does, e.g. the resources of
+// the ResourceBuilder generated by apiserver-runtime-gen for an API package.
+func (ws *WardleServer) WithResources(objs ...resource.Object) *WardleServer {
+	for _, obj := range objs {
+		ws.WithResource(obj)
+	}
+	return ws
+}
+
 // WithResourceAndStrategy registers the resource with the apiserver creating a new etcd backed storage
 // for the GroupResource using the provided strategy.  In most cases callers should instead use WithResource
 // and implement the interfaces defined in "apiserver-runtime/pkg/builder/rest" to control the Strategy.
@@ -356,10 +581,13 @@ func (ws *WardleServer) WithResourceAndStrategy(obj resource.Object, strategy re
 // Note: WithResourceAndHandler should never be called after the GroupResource has already been registered with
 // another version.
 //
-// Note: WithResourceAndHandler will NOT register the "status" subresource for the resource object.
+// Handlers implementing rest.Getter and rest.Updater are wrapped by rest.NewManagedFieldsStorage, so that they
+// support server-side apply and a "status" subresource updating the status of the resource through the handler,
+// unless the wrapper would hide one of their verbs.
 func (ws *WardleServer) WithResourceAndHandler(obj resource.Object, sp rest.StorageProvider) *WardleServer {
 	gvr := obj.GetGroupVersionResource()
 	ws.schemeBuilder.Register(resource.AddToScheme(obj))
+	sp = rest.WithManagedFields(obj, sp)
 	defer func() {
 		// automatically create status subresource if the object implements the status interface
 		ws.withSubResourceIfExists(obj, sp)
@@ -405,17 +633,24 @@ func (ws *WardleServer) forGroupVersionResource(
 
 // forGroupVersionSubResource manually registers storageProvider for a specific subresource.
 func (ws *WardleServer) forGroupVersionSubResource(
-	gvr schema.GroupVersionResource, parentProvider rest.StorageProvider, subResourceProvider rest.StorageProvider) {
+	gvr schema.GroupVersionResource, parentProvider rest.StorageProvider, subResourceProvider rest.StorageProvider,
+	newStorage subResourceStorageFunc) {
 	isSubResource := strings.Contains(gvr.Resource, "/")
 	if !isSubResource {
 		klog.Fatalf("Expected status subresource but received %v/%v/%v", gvr.Group, gvr.Version, gvr.Resource)
 	}
+	// share the storage of the parent resource, e.g. for custom handlers notifying their watchers on updates
+	parentGR := schema.GroupResource{Group: gvr.Group, Resource: strings.SplitN(gvr.Resource, "/", 2)[0]}
+	if s, found := ws.storageProvider[parentGR]; found {
+		parentProvider = s.Get
+	}
 
 	// add the API with its storageProvider for subresource
 	ws.APIs[gvr] = (&subResourceStorageProvider{
 		subResourceGVR:             gvr,
 		parentStorageProvider:      parentProvider,
 		subResourceStorageProvider: subResourceProvider,
+		newStorage:                 newStorage,
 	}).Get
 }
 
@@ -439,11 +674,18 @@ func (ws *WardleServer) withSubResourceIfExists(obj resource.Object, parentStora
 	// automatically create status subresource if the object implements the status interface
 	if _, ok := obj.(resource.ObjectWithStatusSubResource); ok {
 		statusGVR := parentGVR.GroupVersion().WithResource(parentGVR.Resource + "/status")
-		ws.forGroupVersionSubResource(statusGVR, parentStorageProvider, nil)
+		ws.forGroupVersionSubResource(statusGVR, parentStorageProvider, nil, newStatusSubResourceStorage)
 	}
-	if _, ok := obj.(resource.ObjectWithScaleSubResource); ok {
+	// automatically create scale subresource if the object implements either of the scale interfaces
+	if sc, err := newScaler(obj); err != nil {
+		ws.errs = append(ws.errs, fmt.Errorf("invalid scale subresource of %v: %w", parentGVR, err))
+	} else if sc != nil {
 		subResourceGVR := parentGVR.GroupVersion().WithResource(parentGVR.Resource + "/scale")
-		ws.forGroupVersionSubResource(subResourceGVR, parentStorageProvider, nil)
+		ws.forGroupVersionSubResource(subResourceGVR, parentStorageProvider, nil, newScaleSubResourceStorageFunc(sc))
+	}
+	if fieldencryption.HasEncryptedFields(obj) {
+		subResourceGVR := parentGVR.GroupVersion().WithResource(parentGVR.Resource + "/" + fieldencryption.SubResource)
+		ws.forGroupVersionSubResource(subResourceGVR, parentStorageProvider, nil, newDecryptedSubResourceStorage)
 	}
 	if sgs, ok := obj.(resource.ObjectWithArbitrarySubResource); ok {
 		for _, sub := range sgs.GetArbitrarySubResources() {
@@ -452,7 +694,34 @@ func (ws *WardleServer) withSubResourceIfExists(obj resource.Object, parentStora
 			ws.forGroupVersionSubResource(subResourceGVR, parentStorageProvider, rest.ParentStaticHandlerProvider{
 				Storage:        sub,
 				ParentProvider: parentStorageProvider,
-			}.Get)
+			}.Get, newArbitrarySubResourceStorage)
+		}
+	}
+	if sgs, ok := obj.(resource.ObjectWithTypedSubResource); ok {
+		for _, sub := range sgs.GetTypedSubResources() {
+			ws.withTypedSubResource(parentGVR, sub, parentStorageProvider)
+		}
+	}
+}
+
+// withTypedSubResource registers the kinds, OpenAPI definitions and storage of a typed subresource.
+func (ws *WardleServer) withTypedSubResource(
+	parentGVR schema.GroupVersionResource, sub resource.TypedSubResource, parentStorageProvider rest.StorageProvider) {
+	gv := parentGVR.GroupVersion()
+	ws.schemeBuilder.Register(func(scheme *runtime.Scheme) error {
+		for _, obj := range []runtime.Object{sub.NewRequest(), sub.NewResponse()} {
+			// kinds may be shared by several subresources, or be registered already, e.g. metav1.Status
+			if _, _, err := scheme.ObjectKinds(obj); err == nil {
+				continue
+			}
+			scheme.AddKnownTypes(gv, obj)
 		}
+		return nil
+	})
+	if defs, ok := sub.(resource.SubResourceOpenAPIDefinitions); ok {
+		ws.openAPIDefinitions = append(ws.openAPIDefinitions, defs.GetOpenAPIDefinitions)
 	}
+
+	subResourceGVR := gv.WithResource(parentGVR.Resource + "/" + sub.SubResourceName())
+	ws.forGroupVersionSubResource(subResourceGVR, parentStorageProvider, nil, newTypedSubResourceStorageFunc(sub))
 }
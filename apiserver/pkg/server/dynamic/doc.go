@@ -0,0 +1,26 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package dynamic serves the resources defined by ResourceDefinitions.  A ResourceDefinition is the kes
+// counterpart of a CustomResourceDefinition: creating one serves a new resource, backed by unstructured objects
+// in a registry.Store, without compiling or registering Go types.  Updating or deleting the definition installs
+// or uninstalls the handlers of the resource and updates the discovery documents of the apiserver.
+package dynamic
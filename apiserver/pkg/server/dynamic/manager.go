@@ -0,0 +1,618 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dynamic
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/discovery"
+	discoveryendpoint "k8s.io/apiserver/pkg/endpoints/discovery/aggregated"
+	"k8s.io/apiserver/pkg/endpoints/handlers"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/generic"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
+)
+
+// groupPriority is the priority of the groups defined at runtime in the aggregated discovery.
+const groupPriority = 1000
+
+var (
+	verbs       = []string{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"}
+	statusVerbs = []string{"get", "patch", "update"}
+	patchTypes  = []string{string(types.JSONPatchType), string(types.MergePatchType), string(types.ApplyPatchType)}
+)
+
+// Config holds the dependencies of the Manager.
+type Config struct {
+	// RESTOptionsGetter returns the storage options of the ResourceDefinitions, shared by the defined resources.
+	RESTOptionsGetter generic.RESTOptionsGetter
+	Admission         admission.Interface
+	Authorizer        authorizer.Authorizer
+	// Serializer encodes the discovery documents and the errors not specific to a defined resource.
+	Serializer runtime.NegotiatedSerializer
+
+	DiscoveryGroupManager discovery.GroupManager
+	// AggregatedDiscoveryGroupManager is nil if the aggregated discovery is disabled.
+	AggregatedDiscoveryGroupManager discoveryendpoint.ResourceManager
+
+	// ReservedGroups are the groups served by the apiserver itself, which cannot be defined.
+	ReservedGroups sets.Set[string]
+
+	MinRequestTimeout   time.Duration
+	MaxRequestBodyBytes int64
+}
+
+// Manager installs the handlers of the resources defined by the ResourceDefinitions and serves them under
+// /apis.  A definition is established once its resource is served; the Established condition explains why a
+// definition is not.
+type Manager struct {
+	config *Config
+	mapper runtime.EquivalentResourceRegistry
+
+	lock sync.RWMutex
+	// resources holds the served resources by name of their definition
+	resources map[string]*servedResource
+	// groups holds the versions published in the discovery by group
+	groups map[string]sets.Set[string]
+	// destroyed is set once the manager is destroyed, after which no resource is served
+	destroyed bool
+
+	definitions cache.Store
+	status      registryrest.Updater
+	queue       workqueue.RateLimitingInterface
+}
+
+// NewManager returns a Manager serving no resource until it runs.
+func NewManager(c *Config) *Manager {
+	return &Manager{
+		config:    c,
+		mapper:    runtime.NewEquivalentResourceRegistry(),
+		resources: map[string]*servedResource{},
+		groups:    map[string]sets.Set[string]{},
+		queue: workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(),
+			workqueue.RateLimitingQueueConfig{Name: "resource_definitions"}),
+	}
+}
+
+// Run watches the ResourceDefinitions of definitions and installs their resources, until stopCh is closed.
+// The Established condition of the definitions is updated through status.  The served resources are
+// destroyed once Run returns, unless the manager is destroyed before.
+func (m *Manager) Run(stopCh <-chan struct{}, definitions *genericregistry.Store, status registryrest.Updater) {
+	defer utilruntime.HandleCrash()
+	defer m.queue.ShutDown()
+	defer m.Destroy()
+
+	m.status = status
+	ctx := genericapirequest.WithNamespace(genericapirequest.NewContext(), metav1.NamespaceNone)
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			internalOptions := &metainternalversion.ListOptions{}
+			if err := metainternalversion.Convert_v1_ListOptions_To_internalversion_ListOptions(&options, internalOptions, nil); err != nil {
+				return nil, err
+			}
+			return definitions.List(ctx, internalOptions)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			internalOptions := &metainternalversion.ListOptions{}
+			if err := metainternalversion.Convert_v1_ListOptions_To_internalversion_ListOptions(&options, internalOptions, nil); err != nil {
+				return nil, err
+			}
+			w, err := definitions.Watch(ctx, internalOptions)
+			if err != nil {
+				return nil, err
+			}
+			// the watch cache sends the objects wrapped for caching their serializations
+			return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+				if obj, ok := e.Object.(runtime.CacheableObject); ok {
+					e.Object = obj.GetObject()
+				}
+				return e, true
+			}), nil
+		},
+	}
+	enqueue := func(obj interface{}) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			utilruntime.HandleError(err)
+			return
+		}
+		m.queue.Add(key)
+	}
+	store, controller := cache.NewInformer(lw, &v1alpha1.ResourceDefinition{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, obj interface{}) { enqueue(obj) },
+		DeleteFunc: enqueue,
+	})
+	m.definitions = store
+
+	go controller.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, controller.HasSynced) {
+		return
+	}
+	go wait.Until(m.runWorker, time.Second, stopCh)
+
+	<-stopCh
+}
+
+func (m *Manager) runWorker() {
+	for m.processNextItem() {
+	}
+}
+
+func (m *Manager) processNextItem() bool {
+	key, quit := m.queue.Get()
+	if quit {
+		return false
+	}
+	defer m.queue.Done(key)
+
+	if err := m.sync(key.(string)); err != nil {
+		utilruntime.HandleError(fmt.Errorf("syncing ResourceDefinition %q: %w", key, err))
+		m.queue.AddRateLimited(key)
+		return true
+	}
+	m.queue.Forget(key)
+	return true
+}
+
+// sync installs, reinstalls or uninstalls the resource of the definition name.
+func (m *Manager) sync(name string) error {
+	obj, exists, err := m.definitions.GetByKey(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		m.uninstall(name)
+		return nil
+	}
+	def := obj.(*v1alpha1.ResourceDefinition)
+	if !def.DeletionTimestamp.IsZero() {
+		m.uninstall(name)
+		return nil
+	}
+
+	if reason, message := m.conflict(def); reason != "" {
+		m.uninstall(name)
+		return m.setEstablished(def, metav1.ConditionFalse, reason, message)
+	}
+
+	m.lock.RLock()
+	served := m.resources[name]
+	m.lock.RUnlock()
+	if served == nil || !apiequality.Semantic.DeepEqual(served.definition.Spec, def.Spec) {
+		r, err := newServedResource(def.DeepCopy(), m.config, m.mapper)
+		if err != nil {
+			m.uninstall(name)
+			return m.setEstablished(def, metav1.ConditionFalse, "InstallFailed", err.Error())
+		}
+		m.install(name, r)
+	}
+	return m.setEstablished(def, metav1.ConditionTrue, "InstallSucceeded", "the resource is served")
+}
+
+// conflict returns why the resource of def cannot be served, if it cannot.
+func (m *Manager) conflict(def *v1alpha1.ResourceDefinition) (reason, message string) {
+	if m.config.ReservedGroups.Has(def.Spec.Group) {
+		return "ReservedGroup", fmt.Sprintf("the group %s is served by the apiserver", def.Spec.Group)
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for name, r := range m.resources {
+		spec := r.definition.Spec
+		if name == def.Name || spec.Group != def.Spec.Group {
+			continue
+		}
+		if spec.Names.Kind == def.Spec.Names.Kind || spec.Names.ListKind == def.Spec.Names.ListKind {
+			return "KindConflict", fmt.Sprintf("the kind %s is already defined by %s", def.Spec.Names.Kind, name)
+		}
+	}
+	return "", ""
+}
+
+// install serves r in place of the previous resource of the definition name.
+func (m *Manager) install(name string, r *servedResource) {
+	m.lock.Lock()
+	if m.destroyed {
+		m.lock.Unlock()
+		r.destroy()
+		return
+	}
+	old := m.resources[name]
+	m.resources[name] = r
+	m.lock.Unlock()
+
+	if old != nil {
+		old.destroy()
+		if old.definition.Spec.Group != r.definition.Spec.Group {
+			m.updateDiscovery(old.definition.Spec.Group)
+		}
+	}
+	m.updateDiscovery(r.definition.Spec.Group)
+	klog.V(2).InfoS("Serving defined resource", "resourceDefinition", name)
+}
+
+// uninstall stops serving the resource of the definition name.  The stored objects are kept, and served again
+// once the resource is defined again.
+func (m *Manager) uninstall(name string) {
+	m.lock.Lock()
+	old := m.resources[name]
+	delete(m.resources, name)
+	m.lock.Unlock()
+
+	if old == nil {
+		return
+	}
+	old.destroy()
+	m.updateDiscovery(old.definition.Spec.Group)
+	klog.V(2).InfoS("Stopped serving defined resource", "resourceDefinition", name)
+}
+
+// Destroy stops serving every resource and releases their storage, e.g. when the server shuts down.  A sync
+// still in progress doesn't serve its resource anymore.
+func (m *Manager) Destroy() {
+	m.lock.Lock()
+	m.destroyed = true
+	resources := m.resources
+	m.resources = map[string]*servedResource{}
+	m.lock.Unlock()
+
+	for _, r := range resources {
+		r.destroy()
+	}
+}
+
+// setEstablished updates the Established condition of def, unless it is already up to date.
+func (m *Manager) setEstablished(def *v1alpha1.ResourceDefinition, status metav1.ConditionStatus, reason, message string) error {
+	condition := metav1.Condition{
+		Type:               v1alpha1.Established,
+		Status:             status,
+		ObservedGeneration: def.Generation,
+		Reason:             reason,
+		Message:            message,
+	}
+	if current := meta.FindStatusCondition(def.Status.Conditions, v1alpha1.Established); current != nil &&
+		current.Status == condition.Status && current.Reason == condition.Reason &&
+		current.Message == condition.Message && current.ObservedGeneration == condition.ObservedGeneration {
+		return nil
+	}
+
+	updated := def.DeepCopy()
+	meta.SetStatusCondition(&updated.Status.Conditions, condition)
+	_, _, err := m.status.Update(genericapirequest.WithNamespace(genericapirequest.NewContext(), metav1.NamespaceNone), def.Name, registryrest.DefaultUpdatedObjectInfo(updated),
+		registryrest.ValidateAllObjectFunc, registryrest.ValidateAllObjectUpdateFunc, false, &metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// servedVersions returns the versions of the group served by a resource, the most preferred first.
+func (m *Manager) servedVersions(group string) []string {
+	versions := sets.New[string]()
+	for _, r := range m.resources {
+		if r.definition.Spec.Group != group {
+			continue
+		}
+		for v := range r.scopes {
+			versions.Insert(v)
+		}
+	}
+	list := versions.UnsortedList()
+	sort.Slice(list, func(i, j int) bool {
+		return version.CompareKubeAwareVersionStrings(list[i], list[j]) > 0
+	})
+	return list
+}
+
+// updateDiscovery publishes the served versions of group in the discovery documents.
+func (m *Manager) updateDiscovery(group string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	versions := m.servedVersions(group)
+	published := m.groups[group]
+	if len(versions) == 0 {
+		delete(m.groups, group)
+		m.config.DiscoveryGroupManager.RemoveGroup(group)
+	} else {
+		m.groups[group] = sets.New(versions...)
+		m.config.DiscoveryGroupManager.AddGroup(m.apiGroup(group, versions))
+	}
+
+	aggregated := m.config.AggregatedDiscoveryGroupManager
+	if aggregated == nil {
+		return
+	}
+	for v := range published {
+		if !m.groups[group].Has(v) {
+			aggregated.RemoveGroupVersion(metav1.GroupVersion{Group: group, Version: v})
+		}
+	}
+	for i, v := range versions {
+		aggregated.AddGroupVersion(group, apidiscoveryv2.APIVersionDiscovery{
+			Version:   v,
+			Resources: m.aggregatedResources(group, v),
+			Freshness: apidiscoveryv2.DiscoveryFreshnessCurrent,
+		})
+		aggregated.SetGroupVersionPriority(metav1.GroupVersion{Group: group, Version: v}, groupPriority, len(versions)-i)
+	}
+}
+
+// apiGroup returns the discovery document of group.
+func (m *Manager) apiGroup(group string, versions []string) metav1.APIGroup {
+	apiGroup := metav1.APIGroup{Name: group}
+	for _, v := range versions {
+		apiGroup.Versions = append(apiGroup.Versions, metav1.GroupVersionForDiscovery{
+			GroupVersion: schema.GroupVersion{Group: group, Version: v}.String(),
+			Version:      v,
+		})
+	}
+	apiGroup.PreferredVersion = apiGroup.Versions[0]
+	return apiGroup
+}
+
+// apiResources returns the resources of the version of group, in the discovery document of the version.
+func (m *Manager) apiResources(group, v string) []metav1.APIResource {
+	var resources []metav1.APIResource
+	for _, r := range m.resourcesOf(group, v) {
+		names := r.definition.Spec.Names
+		namespaced := r.definition.Spec.Scope == v1alpha1.NamespaceScoped
+		storageVersion := r.definition.Spec.StorageVersion().Name
+		resources = append(resources, metav1.APIResource{
+			Name:               names.Plural,
+			SingularName:       names.Singular,
+			Namespaced:         namespaced,
+			Kind:               names.Kind,
+			Verbs:              verbs,
+			ShortNames:         names.ShortNames,
+			Categories:         names.Categories,
+			StorageVersionHash: discovery.StorageVersionHash(group, storageVersion, names.Kind),
+		})
+		if r.statusScopes[v] != nil {
+			resources = append(resources, metav1.APIResource{
+				Name:       names.Plural + "/status",
+				Namespaced: namespaced,
+				Kind:       names.Kind,
+				Verbs:      statusVerbs,
+			})
+		}
+	}
+	return resources
+}
+
+// aggregatedResources returns the resources of the version of group, in the aggregated discovery document.
+func (m *Manager) aggregatedResources(group, v string) []apidiscoveryv2.APIResourceDiscovery {
+	var resources []apidiscoveryv2.APIResourceDiscovery
+	for _, r := range m.resourcesOf(group, v) {
+		names := r.definition.Spec.Names
+		kind := &metav1.GroupVersionKind{Group: group, Version: v, Kind: names.Kind}
+		scope := apidiscoveryv2.ScopeCluster
+		if r.definition.Spec.Scope == v1alpha1.NamespaceScoped {
+			scope = apidiscoveryv2.ScopeNamespace
+		}
+		resource := apidiscoveryv2.APIResourceDiscovery{
+			Resource:         names.Plural,
+			ResponseKind:     kind,
+			Scope:            scope,
+			SingularResource: names.Singular,
+			Verbs:            verbs,
+			ShortNames:       names.ShortNames,
+			Categories:       names.Categories,
+		}
+		if r.statusScopes[v] != nil {
+			resource.Subresources = append(resource.Subresources, apidiscoveryv2.APISubresourceDiscovery{
+				Subresource:  "status",
+				ResponseKind: kind,
+				Verbs:        statusVerbs,
+			})
+		}
+		resources = append(resources, resource)
+	}
+	return resources
+}
+
+// resourcesOf returns the resources serving the version of group, sorted by name.
+func (m *Manager) resourcesOf(group, v string) []*servedResource {
+	var resources []*servedResource
+	for _, r := range m.resources {
+		if r.definition.Spec.Group == group && r.scopes[v] != nil {
+			resources = append(resources, r)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].definition.Spec.Names.Plural < resources[j].definition.Spec.Names.Plural
+	})
+	return resources
+}
+
+// lookup returns the resource of group with the plural name.
+func (m *Manager) lookup(group, plural string) *servedResource {
+	for _, r := range m.resources {
+		if r.definition.Spec.Group == group && r.definition.Spec.Names.Plural == plural {
+			return r
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the requests of the defined resources and the discovery documents of their groups.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	info, ok := genericapirequest.RequestInfoFrom(req.Context())
+	if !ok {
+		responsewriters.ErrorNegotiated(apierrors.NewInternalError(fmt.Errorf("no RequestInfo found in the context")),
+			m.config.Serializer, schema.GroupVersion{}, w, req)
+		return
+	}
+	if !info.IsResourceRequest {
+		m.serveDiscovery(w, req, info)
+		return
+	}
+
+	m.lock.RLock()
+	r := m.lookup(info.APIGroup, info.Resource)
+	m.lock.RUnlock()
+	if r == nil || r.scopes[info.APIVersion] == nil {
+		http.NotFound(w, req)
+		return
+	}
+	namespaced := r.definition.Spec.Scope == v1alpha1.NamespaceScoped
+	if !namespaced && len(info.Namespace) != 0 {
+		http.NotFound(w, req)
+		return
+	}
+
+	var handler http.HandlerFunc
+	switch info.Subresource {
+	case "":
+		handler = m.resourceHandler(r, r.scopes[info.APIVersion], info.Verb)
+	case "status":
+		if scope := r.statusScopes[info.APIVersion]; scope != nil {
+			handler = m.statusHandler(r, scope, info.Verb)
+		} else {
+			http.NotFound(w, req)
+			return
+		}
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if handler == nil {
+		err := apierrors.NewMethodNotSupported(schema.GroupResource{Group: info.APIGroup, Resource: info.Resource}, info.Verb)
+		responsewriters.ErrorNegotiated(err, m.config.Serializer, schema.GroupVersion{Group: info.APIGroup, Version: info.APIVersion}, w, req)
+		return
+	}
+	handler.ServeHTTP(w, req)
+}
+
+// resourceHandler returns the handler of the verb on the resource, nil if the verb is not supported.
+func (m *Manager) resourceHandler(r *servedResource, scope *handlers.RequestScope, verb string) http.HandlerFunc {
+	admit := m.config.Admission
+	switch verb {
+	case "get":
+		return handlers.GetResource(r.storage, scope)
+	case "list":
+		return handlers.ListResource(r.storage, r.storage, scope, false, m.config.MinRequestTimeout)
+	case "watch":
+		return handlers.ListResource(r.storage, r.storage, scope, true, m.config.MinRequestTimeout)
+	case "create":
+		return handlers.CreateResource(r.storage, scope, admit)
+	case "update":
+		return handlers.UpdateResource(r.storage, scope, admit)
+	case "patch":
+		return handlers.PatchResource(r.storage, scope, admit, patchTypes)
+	case "delete":
+		return handlers.DeleteResource(r.storage, true, scope, admit)
+	case "deletecollection":
+		return handlers.DeleteCollection(r.storage, true, scope, admit)
+	}
+	return nil
+}
+
+// statusHandler returns the handler of the verb on the status of the resource, nil if the verb is not supported.
+func (m *Manager) statusHandler(r *servedResource, scope *handlers.RequestScope, verb string) http.HandlerFunc {
+	admit := m.config.Admission
+	switch verb {
+	case "get":
+		return handlers.GetResource(r.status, scope)
+	case "update":
+		return handlers.UpdateResource(r.status, scope, admit)
+	case "patch":
+		return handlers.PatchResource(r.status, scope, admit, patchTypes)
+	}
+	return nil
+}
+
+// serveDiscovery serves the discovery documents of the groups and versions of the defined resources, at
+// /apis/<group> and /apis/<group>/<version>.
+func (m *Manager) serveDiscovery(w http.ResponseWriter, req *http.Request, info *genericapirequest.RequestInfo) {
+	parts := splitPath(info.Path)
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "apis" {
+		http.NotFound(w, req)
+		return
+	}
+	group := parts[1]
+
+	m.lock.RLock()
+	versions := m.servedVersions(group)
+	if len(versions) == 0 {
+		m.lock.RUnlock()
+		http.NotFound(w, req)
+		return
+	}
+	if len(parts) == 2 {
+		apiGroup := m.apiGroup(group, versions)
+		m.lock.RUnlock()
+		discovery.NewAPIGroupHandler(m.config.Serializer, apiGroup).ServeHTTP(w, req)
+		return
+	}
+	resources := m.apiResources(group, parts[2])
+	m.lock.RUnlock()
+	if len(resources) == 0 {
+		http.NotFound(w, req)
+		return
+	}
+	gv := schema.GroupVersion{Group: group, Version: parts[2]}
+	discovery.NewAPIVersionHandler(m.config.Serializer, gv, discovery.APIResourceListerFunc(func() []metav1.APIResource {
+		return resources
+	})).ServeHTTP(w, req)
+}
+
+// splitPath returns the segments of path.
+func splitPath(path string) []string {
+	var parts []string
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+var _ http.Handler = &Manager{}
@@ -0,0 +1,323 @@
+package dynamic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/endpoints/discovery"
+	discoveryendpoint "k8s.io/apiserver/pkg/endpoints/discovery/aggregated"
+	"k8s.io/apiserver/pkg/endpoints/handlers"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/generic"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/server/storage"
+)
+
+func newTestManager() *Manager {
+	codecs := serializer.NewCodecFactory(newTypedScheme())
+	return NewManager(&Config{
+		Serializer:                      codecs,
+		DiscoveryGroupManager:           discovery.NewRootAPIsHandler(discovery.DefaultAddresses{DefaultAddress: "localhost"}, codecs),
+		AggregatedDiscoveryGroupManager: discoveryendpoint.NewResourceManager("apis"),
+		ReservedGroups:                  sets.New("sample.k8s.com"),
+	})
+}
+
+// newTestResource returns a served resource without storage, serving versions with the status subresource
+// enabled for statusVersions.
+func newTestResource(plural, kind string, scope v1alpha1.ResourceScope, versions []string, statusVersions ...string) *servedResource {
+	r := &servedResource{
+		definition: &v1alpha1.ResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: plural + ".example.com"},
+			Spec: v1alpha1.ResourceDefinitionSpec{
+				Group: "example.com",
+				Names: v1alpha1.ResourceDefinitionNames{Plural: plural, Singular: kind, Kind: kind, ListKind: kind + "List"},
+				Scope: scope,
+			},
+		},
+		scopes:       map[string]*handlers.RequestScope{},
+		statusScopes: map[string]*handlers.RequestScope{},
+	}
+	for i, v := range versions {
+		r.definition.Spec.Versions = append(r.definition.Spec.Versions, v1alpha1.ResourceDefinitionVersion{Name: v, Served: true, Storage: i == 0})
+		r.scopes[v] = &handlers.RequestScope{}
+	}
+	for _, v := range statusVersions {
+		r.statusScopes[v] = &handlers.RequestScope{}
+	}
+	return r
+}
+
+func serve(h http.Handler, info *genericapirequest.RequestInfo, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, info.Path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	req = req.WithContext(genericapirequest.WithRequestInfo(req.Context(), info))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestManagerDiscovery(t *testing.T) {
+	m := newTestManager()
+	m.resources["widgets.example.com"] = newTestResource("widgets", "Widget", v1alpha1.NamespaceScoped, []string{"v1", "v1beta1"}, "v1")
+	m.resources["gadgets.example.com"] = newTestResource("gadgets", "Gadget", v1alpha1.ClusterScoped, []string{"v1"})
+	m.updateDiscovery("example.com")
+
+	t.Run("the group should be published with the preferred version first", func(t *testing.T) {
+		w := serve(m.config.DiscoveryGroupManager, &genericapirequest.RequestInfo{Path: "/apis"}, "")
+		groups := &metav1.APIGroupList{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), groups))
+		assert.Len(t, groups.Groups, 1)
+		assert.Equal(t, "example.com/v1", groups.Groups[0].PreferredVersion.GroupVersion)
+		assert.Len(t, groups.Groups[0].Versions, 2)
+
+		w = serve(m, &genericapirequest.RequestInfo{Path: "/apis/example.com"}, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		group := &metav1.APIGroup{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), group))
+		assert.Equal(t, "v1", group.PreferredVersion.Version)
+	})
+	t.Run("the resources of a version should be published", func(t *testing.T) {
+		w := serve(m, &genericapirequest.RequestInfo{Path: "/apis/example.com/v1"}, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		list := &metav1.APIResourceList{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), list))
+		var names []string
+		for _, r := range list.APIResources {
+			names = append(names, r.Name)
+		}
+		assert.Equal(t, []string{"gadgets", "widgets", "widgets/status"}, names)
+		assert.False(t, list.APIResources[0].Namespaced)
+		assert.True(t, list.APIResources[1].Namespaced)
+
+		w = serve(m, &genericapirequest.RequestInfo{Path: "/apis/example.com/v1beta1"}, "")
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), list))
+		assert.Len(t, list.APIResources, 1)
+	})
+	t.Run("the versions should be published in the aggregated discovery", func(t *testing.T) {
+		w := serve(m.config.AggregatedDiscoveryGroupManager, &genericapirequest.RequestInfo{Path: "/apis"},
+			"application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList")
+		groups := &apidiscoveryv2.APIGroupDiscoveryList{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), groups))
+		assert.Len(t, groups.Items, 1)
+		assert.Len(t, groups.Items[0].Versions, 2)
+		assert.Equal(t, "v1", groups.Items[0].Versions[0].Version)
+		assert.Equal(t, apidiscoveryv2.ScopeCluster, groups.Items[0].Versions[0].Resources[0].Scope)
+		assert.Len(t, groups.Items[0].Versions[0].Resources[1].Subresources, 1)
+	})
+	t.Run("versions no longer served should be removed", func(t *testing.T) {
+		delete(m.resources, "widgets.example.com")
+		m.updateDiscovery("example.com")
+		w := serve(m, &genericapirequest.RequestInfo{Path: "/apis/example.com/v1beta1"}, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = serve(m.config.AggregatedDiscoveryGroupManager, &genericapirequest.RequestInfo{Path: "/apis"},
+			"application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList")
+		groups := &apidiscoveryv2.APIGroupDiscoveryList{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), groups))
+		assert.Len(t, groups.Items[0].Versions, 1)
+	})
+	t.Run("groups no longer served should be removed", func(t *testing.T) {
+		delete(m.resources, "gadgets.example.com")
+		m.updateDiscovery("example.com")
+		w := serve(m, &genericapirequest.RequestInfo{Path: "/apis/example.com"}, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = serve(m.config.DiscoveryGroupManager, &genericapirequest.RequestInfo{Path: "/apis"}, "")
+		groups := &metav1.APIGroupList{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), groups))
+		assert.Empty(t, groups.Groups)
+	})
+}
+
+func TestManagerConflict(t *testing.T) {
+	m := newTestManager()
+	m.resources["widgets.example.com"] = newTestResource("widgets", "Widget", v1alpha1.NamespaceScoped, []string{"v1"})
+
+	t.Run("the groups of the apiserver should be rejected", func(t *testing.T) {
+		def := newTestResource("flunders", "Flunder", v1alpha1.NamespaceScoped, []string{"v1"}).definition
+		def.Spec.Group = "sample.k8s.com"
+		reason, _ := m.conflict(def)
+		assert.Equal(t, "ReservedGroup", reason)
+	})
+	t.Run("kinds defined by another definition should be rejected", func(t *testing.T) {
+		reason, _ := m.conflict(newTestResource("widgetz", "Widget", v1alpha1.NamespaceScoped, []string{"v1"}).definition)
+		assert.Equal(t, "KindConflict", reason)
+	})
+	t.Run("redefining a resource should be accepted", func(t *testing.T) {
+		reason, _ := m.conflict(newTestResource("widgets", "Widget", v1alpha1.ClusterScoped, []string{"v2"}).definition)
+		assert.Empty(t, reason)
+	})
+}
+
+func TestManagerServeHTTP(t *testing.T) {
+	m := newTestManager()
+	m.resources["gadgets.example.com"] = newTestResource("gadgets", "Gadget", v1alpha1.ClusterScoped, []string{"v1"})
+
+	for _, tc := range []struct {
+		name string
+		info *genericapirequest.RequestInfo
+		code int
+	}{
+		{"unknown resources should not be found", &genericapirequest.RequestInfo{IsResourceRequest: true,
+			Path: "/apis/example.com/v1/widgets", APIGroup: "example.com", APIVersion: "v1", Resource: "widgets", Verb: "list"}, http.StatusNotFound},
+		{"unserved versions should not be found", &genericapirequest.RequestInfo{IsResourceRequest: true,
+			Path: "/apis/example.com/v2/gadgets", APIGroup: "example.com", APIVersion: "v2", Resource: "gadgets", Verb: "list"}, http.StatusNotFound},
+		{"cluster scoped resources should not be found in namespaces", &genericapirequest.RequestInfo{IsResourceRequest: true,
+			Path: "/apis/example.com/v1/namespaces/default/gadgets", APIGroup: "example.com", APIVersion: "v1", Namespace: "default",
+			Resource: "gadgets", Verb: "list"}, http.StatusNotFound},
+		{"disabled status subresources should not be found", &genericapirequest.RequestInfo{IsResourceRequest: true,
+			Path: "/apis/example.com/v1/gadgets/g/status", APIGroup: "example.com", APIVersion: "v1", Resource: "gadgets",
+			Name: "g", Subresource: "status", Verb: "get"}, http.StatusNotFound},
+		{"unsupported verbs should be rejected", &genericapirequest.RequestInfo{IsResourceRequest: true,
+			Path: "/apis/example.com/v1/gadgets/g", APIGroup: "example.com", APIVersion: "v1", Resource: "gadgets",
+			Name: "g", Verb: "proxy"}, http.StatusMethodNotAllowed},
+		{"unknown paths should not be found", &genericapirequest.RequestInfo{Path: "/apis/example.com/v1/extra/path"}, http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.code, serve(m, tc.info, "").Code)
+		})
+	}
+	t.Run("requests without RequestInfo should fail", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/apis/example.com", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestManagerSync(t *testing.T) {
+	m := newTestManager()
+	memory := storage.NewMemory()
+	m.config.RESTOptionsGetter = restOptionsGetter(func(gr schema.GroupResource) (generic.RESTOptions, error) {
+		return generic.RESTOptions{
+			StorageConfig:  storagebackend.NewDefaultConfig("/registry", nil).ForResource(gr),
+			Decorator:      memory.Decorator()(generic.UndecoratedStorage),
+			ResourcePrefix: gr.String(),
+		}, nil
+	})
+	t.Cleanup(m.Destroy)
+	m.definitions = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	status := &fakeStatus{definitions: m.definitions}
+	m.status = status
+
+	established := func(t *testing.T, name string) *metav1.Condition {
+		obj, exists, err := m.definitions.GetByKey(name)
+		assert.NoError(t, err)
+		if !assert.True(t, exists) {
+			return nil
+		}
+		return meta.FindStatusCondition(obj.(*v1alpha1.ResourceDefinition).Status.Conditions, v1alpha1.Established)
+	}
+
+	t.Run("a definition should be served and established", func(t *testing.T) {
+		assert.NoError(t, m.definitions.Add(newTestResource("widgets", "Widget", v1alpha1.NamespaceScoped, []string{"v1"}).definition))
+		assert.NoError(t, m.sync("widgets.example.com"))
+		if condition := established(t, "widgets.example.com"); assert.NotNil(t, condition) {
+			assert.Equal(t, metav1.ConditionTrue, condition.Status)
+			assert.Equal(t, "InstallSucceeded", condition.Reason)
+		}
+		assert.NotNil(t, m.resources["widgets.example.com"])
+		assert.Equal(t, http.StatusOK, serve(m, &genericapirequest.RequestInfo{Path: "/apis/example.com/v1"}, "").Code)
+	})
+	t.Run("an unchanged definition should neither be reinstalled nor updated", func(t *testing.T) {
+		served, updates := m.resources["widgets.example.com"], status.updates
+		assert.NoError(t, m.sync("widgets.example.com"))
+		assert.Same(t, served, m.resources["widgets.example.com"])
+		assert.Equal(t, updates, status.updates)
+	})
+	t.Run("a changed spec should reinstall the resource", func(t *testing.T) {
+		served := m.resources["widgets.example.com"]
+		obj, _, _ := m.definitions.GetByKey("widgets.example.com")
+		def := obj.(*v1alpha1.ResourceDefinition).DeepCopy()
+		def.Generation++
+		def.Spec.Versions = append(def.Spec.Versions, v1alpha1.ResourceDefinitionVersion{Name: "v2", Served: true})
+		assert.NoError(t, m.definitions.Update(def))
+
+		assert.NoError(t, m.sync("widgets.example.com"))
+		assert.NotSame(t, served, m.resources["widgets.example.com"])
+		assert.NotNil(t, m.resources["widgets.example.com"].scopes["v2"])
+		assert.Equal(t, http.StatusOK, serve(m, &genericapirequest.RequestInfo{Path: "/apis/example.com/v2"}, "").Code)
+		if condition := established(t, "widgets.example.com"); assert.NotNil(t, condition) {
+			assert.Equal(t, def.Generation, condition.ObservedGeneration)
+		}
+	})
+	t.Run("a definition of a reserved group should not be established", func(t *testing.T) {
+		def := newTestResource("flunders", "Flunder", v1alpha1.NamespaceScoped, []string{"v1"}).definition
+		def.Name, def.Spec.Group = "flunders.sample.k8s.com", "sample.k8s.com"
+		assert.NoError(t, m.definitions.Add(def))
+		assert.NoError(t, m.sync(def.Name))
+		if condition := established(t, def.Name); assert.NotNil(t, condition) {
+			assert.Equal(t, metav1.ConditionFalse, condition.Status)
+			assert.Equal(t, "ReservedGroup", condition.Reason)
+		}
+		assert.Nil(t, m.resources[def.Name])
+	})
+	t.Run("a definition of a defined kind should not be established", func(t *testing.T) {
+		def := newTestResource("widgetz", "Widget", v1alpha1.NamespaceScoped, []string{"v1"}).definition
+		assert.NoError(t, m.definitions.Add(def))
+		assert.NoError(t, m.sync(def.Name))
+		if condition := established(t, def.Name); assert.NotNil(t, condition) {
+			assert.Equal(t, metav1.ConditionFalse, condition.Status)
+			assert.Equal(t, "KindConflict", condition.Reason)
+		}
+		assert.Nil(t, m.resources[def.Name])
+	})
+	t.Run("a deleted definition should no longer be served", func(t *testing.T) {
+		obj, _, _ := m.definitions.GetByKey("widgets.example.com")
+		assert.NoError(t, m.definitions.Delete(obj))
+		assert.NoError(t, m.sync("widgets.example.com"))
+		assert.Nil(t, m.resources["widgets.example.com"])
+		assert.Equal(t, http.StatusNotFound, serve(m, &genericapirequest.RequestInfo{Path: "/apis/example.com"}, "").Code)
+	})
+}
+
+type restOptionsGetter func(gr schema.GroupResource) (generic.RESTOptions, error)
+
+func (f restOptionsGetter) GetRESTOptions(gr schema.GroupResource) (generic.RESTOptions, error) {
+	return f(gr)
+}
+
+// fakeStatus updates the definitions of the store, counting the updates.
+type fakeStatus struct {
+	definitions cache.Store
+	updates     int
+}
+
+func (f *fakeStatus) New() runtime.Object {
+	return &v1alpha1.ResourceDefinition{}
+}
+
+func (f *fakeStatus) Update(ctx context.Context, name string, objInfo registryrest.UpdatedObjectInfo, _ registryrest.ValidateObjectFunc,
+	_ registryrest.ValidateObjectUpdateFunc, _ bool, _ *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	obj, exists, err := f.definitions.GetByKey(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists {
+		return nil, false, apierrors.NewNotFound(v1alpha1.Resource("resourcedefinitions"), name)
+	}
+	updated, err := objInfo.UpdatedObject(ctx, obj.(runtime.Object))
+	if err != nil {
+		return nil, false, err
+	}
+	f.updates++
+	return updated, false, f.definitions.Update(updated)
+}
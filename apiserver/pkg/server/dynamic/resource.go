@@ -0,0 +1,259 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dynamic
+
+import (
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/versioning"
+	"k8s.io/apimachinery/pkg/util/managedfields"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/endpoints/handlers"
+	"k8s.io/apiserver/pkg/registry/generic"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	"k8s.io/apiserver/pkg/storage/names"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+	"github.com/vine-io/kes/apiserver/pkg/server/rest"
+)
+
+// servedResource holds the storage and the request scopes of the served versions of a ResourceDefinition.
+type servedResource struct {
+	definition *v1alpha1.ResourceDefinition
+
+	storage *genericregistry.Store
+	// status is the storage of the status subresource, nil if no version enables it
+	status *genericregistry.Store
+
+	// scopes holds the request scope of each served version
+	scopes map[string]*handlers.RequestScope
+	// statusScopes holds the request scope of the status subresource of each version enabling it
+	statusScopes map[string]*handlers.RequestScope
+}
+
+// newServedResource returns the storage and request scopes of the resource defined by def.
+func newServedResource(def *v1alpha1.ResourceDefinition, c *Config, mapper runtime.EquivalentResourceRegistry) (*servedResource, error) {
+	group, kindNames := def.Spec.Group, def.Spec.Names
+	storageVersion := def.Spec.StorageVersion()
+	if storageVersion == nil {
+		return nil, fmt.Errorf("no storage version")
+	}
+	hub := schema.GroupVersion{Group: group, Version: storageVersion.Name}
+	gr := schema.GroupResource{Group: group, Resource: kindNames.Plural}
+
+	var versions []schema.GroupVersion
+	for _, v := range def.Spec.Versions {
+		versions = append(versions, schema.GroupVersion{Group: group, Version: v.Name})
+	}
+	typedScheme := newTypedScheme(versions...)
+	typer := unstructuredTyper{delegate: typedScheme}
+	creater := unstructuredCreater{delegate: typedScheme, group: group}
+	converter := versionConverter{delegate: runtime.UnsafeObjectConvertor(typedScheme), versions: sets.New(versions...)}
+	defaulter := schemaDefaulter{delegate: typedScheme, defaulters: map[schema.GroupVersion]*rest.SchemaDefaulter{}}
+	s := &strategy{
+		ObjectTyper:    typer,
+		NameGenerator:  names.SimpleNameGenerator,
+		namespaced:     def.Spec.Scope == v1alpha1.NamespaceScoped,
+		storageVersion: hub,
+		validators:     map[schema.GroupVersion]*rest.SchemaValidator{},
+		statusVersions: sets.New[schema.GroupVersion](),
+	}
+	for i, v := range def.Spec.Versions {
+		gv := versions[i]
+		openAPISchema, err := v.GetSchema()
+		if err != nil {
+			return nil, fmt.Errorf("schema of version %s: %w", v.Name, err)
+		}
+		if openAPISchema != nil {
+			if s.validators[gv], err = rest.NewSchemaValidatorForSchema(openAPISchema); err != nil {
+				return nil, fmt.Errorf("compiling the validation rules of version %s: %w", v.Name, err)
+			}
+			if defaulter.defaulters[gv], err = rest.NewSchemaDefaulter(openAPISchema); err != nil {
+				return nil, fmt.Errorf("default values of version %s: %w", v.Name, err)
+			}
+		} else {
+			s.validators[gv] = nil
+		}
+		if v.Subresources != nil && v.Subresources.Status != nil {
+			s.statusVersions.Insert(gv)
+		}
+	}
+
+	serializer := negotiatedSerializer{creater: creater, typer: typer, converter: converter, defaulter: defaulter}
+	storageCodec := versioning.NewCodec(unstructured.UnstructuredJSONScheme, unstructured.UnstructuredJSONScheme,
+		converter, creater, typer, defaulter, hub, hub, "kesDynamicStorage")
+	r := &servedResource{
+		definition:   def,
+		scopes:       map[string]*handlers.RequestScope{},
+		statusScopes: map[string]*handlers.RequestScope{},
+	}
+
+	tableConvertor, err := rest.NewTableConvertor(gr, printerColumns(storageVersion))
+	if err != nil {
+		return nil, err
+	}
+	store := &genericregistry.Store{
+		NewFunc: func() runtime.Object {
+			u := &unstructured.Unstructured{}
+			u.SetGroupVersionKind(hub.WithKind(kindNames.Kind))
+			return u
+		},
+		NewListFunc: func() runtime.Object {
+			l := &unstructured.UnstructuredList{}
+			l.SetGroupVersionKind(hub.WithKind(kindNames.ListKind))
+			return l
+		},
+		PredicateFunc:             s.match,
+		DefaultQualifiedResource:  gr,
+		SingularQualifiedResource: schema.GroupResource{Group: group, Resource: kindNames.Singular},
+		CreateStrategy:            s,
+		UpdateStrategy:            s,
+		DeleteStrategy:            s,
+		ResetFieldsStrategy:       s,
+		TableConvertor:            tableConvertor,
+		StorageVersioner:          hub,
+	}
+	options := &generic.StoreOptions{
+		RESTOptions: &codecRESTOptionsGetter{RESTOptionsGetter: c.RESTOptionsGetter, codec: storageCodec, encodeVersioner: hub},
+		AttrFunc:    s.getAttrs,
+	}
+	if err := store.CompleteWithOptions(options); err != nil {
+		return nil, err
+	}
+	r.storage = store
+
+	if s.statusVersions.Len() != 0 {
+		statusStore := *store
+		status := statusStrategy{strategy: s}
+		statusStore.CreateStrategy = nil
+		statusStore.DeleteStrategy = nil
+		statusStore.UpdateStrategy = status
+		statusStore.ResetFieldsStrategy = status
+		r.status = &statusStore
+	}
+
+	for i, v := range def.Spec.Versions {
+		if !v.Served {
+			continue
+		}
+		gv := versions[i]
+		tableConvertor, err := rest.NewTableConvertor(gr, printerColumns(&def.Spec.Versions[i]))
+		if err != nil {
+			return nil, err
+		}
+		scope := &handlers.RequestScope{
+			Namer: handlers.ContextBasedNaming{
+				Namer:         meta.NewAccessor(),
+				ClusterScoped: !s.namespaced,
+			},
+			Serializer:               serializer,
+			ParameterCodec:           metav1.ParameterCodec,
+			StandardSerializers:      serializer.SupportedMediaTypes(),
+			Creater:                  creater,
+			Convertor:                converter,
+			Defaulter:                defaulter,
+			Typer:                    typer,
+			UnsafeConvertor:          converter,
+			Authorizer:               c.Authorizer,
+			EquivalentResourceMapper: mapper,
+			TableConvertor:           tableConvertor,
+			Resource:                 gv.WithResource(kindNames.Plural),
+			Kind:                     gv.WithKind(kindNames.Kind),
+			MetaGroupVersion:         metav1.SchemeGroupVersion,
+			HubGroupVersion:          hub,
+			MaxRequestBodyBytes:      c.MaxRequestBodyBytes,
+		}
+		if scope.FieldManager, err = managedfields.NewDefaultCRDFieldManager(managedfields.NewDeducedTypeConverter(),
+			converter, defaulter, creater, scope.Kind, hub, "", s.GetResetFields()); err != nil {
+			return nil, err
+		}
+		r.scopes[v.Name] = scope
+		mapper.RegisterKindFor(gr.WithVersion(v.Name), "", scope.Kind)
+
+		if !s.statusVersions.Has(gv) {
+			continue
+		}
+		statusScope := *scope
+		statusScope.Subresource = "status"
+		if statusScope.FieldManager, err = managedfields.NewDefaultCRDFieldManager(managedfields.NewDeducedTypeConverter(),
+			converter, defaulter, creater, scope.Kind, hub, "status", r.status.ResetFieldsStrategy.GetResetFields()); err != nil {
+			return nil, err
+		}
+		r.statusScopes[v.Name] = &statusScope
+		mapper.RegisterKindFor(gr.WithVersion(v.Name), "status", scope.Kind)
+	}
+	return r, nil
+}
+
+// destroy releases the storage of the resource, ending its watches.
+func (r *servedResource) destroy() {
+	r.storage.DestroyFunc()
+}
+
+// printerColumns returns the printer columns of the version.
+func printerColumns(v *v1alpha1.ResourceDefinitionVersion) []resource.PrinterColumn {
+	if len(v.AdditionalPrinterColumns) == 0 {
+		return nil
+	}
+	columns := make([]resource.PrinterColumn, 0, len(v.AdditionalPrinterColumns)+1)
+	for _, col := range v.AdditionalPrinterColumns {
+		columns = append(columns, resource.PrinterColumn{
+			Name:        col.Name,
+			Type:        col.Type,
+			Format:      col.Format,
+			Description: col.Description,
+			Priority:    col.Priority,
+			JSONPath:    col.JSONPath,
+		})
+	}
+	return append(columns, resource.PrinterColumn{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"})
+}
+
+// codecRESTOptionsGetter returns the storage options of the ResourceDefinitions, rewritten to store the objects
+// of a resource with codec under its own prefix. The storage factory only knows the groups of the scheme, which
+// the groups defined at runtime are not part of.
+type codecRESTOptionsGetter struct {
+	generic.RESTOptionsGetter
+	codec           runtime.Codec
+	encodeVersioner runtime.GroupVersioner
+}
+
+func (g *codecRESTOptionsGetter) GetRESTOptions(gr schema.GroupResource) (generic.RESTOptions, error) {
+	opts, err := g.RESTOptionsGetter.GetRESTOptions(v1alpha1.Resource("resourcedefinitions"))
+	if err != nil {
+		return opts, err
+	}
+	config := *opts.StorageConfig
+	config.Codec = g.codec
+	config.EncodeVersioner = g.encodeVersioner
+	config.GroupResource = gr
+	opts.StorageConfig = &config
+	opts.ResourcePrefix = "/" + path.Join(gr.Group, gr.Resource)
+	return opts, nil
+}
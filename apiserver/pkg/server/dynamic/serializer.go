@@ -0,0 +1,233 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dynamic
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/runtime/serializer/versioning"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/rest"
+)
+
+// newTypedScheme returns the scheme of the typed objects served along the versions of a resource, such as
+// metav1.Status and metav1.WatchEvent.  Each resource has its own scheme, so it's never changed while serving.
+func newTypedScheme(versions ...schema.GroupVersion) *runtime.Scheme {
+	s := runtime.NewScheme()
+	metav1.AddToGroupVersion(s, schema.GroupVersion{Version: "v1"})
+	s.AddUnversionedTypes(schema.GroupVersion{Version: "v1"},
+		&metav1.Status{},
+		&metav1.APIVersions{},
+		&metav1.APIGroupList{},
+		&metav1.APIGroup{},
+		&metav1.APIResourceList{},
+	)
+	for _, gv := range versions {
+		metav1.AddToGroupVersion(s, gv)
+	}
+	return s
+}
+
+// unstructuredTyper returns the kind of unstructured objects from their content, and delegates the typed
+// objects to the scheme.
+type unstructuredTyper struct {
+	delegate runtime.ObjectTyper
+}
+
+func (t unstructuredTyper) ObjectKinds(obj runtime.Object) ([]schema.GroupVersionKind, bool, error) {
+	if _, ok := obj.(runtime.Unstructured); !ok {
+		return t.delegate.ObjectKinds(obj)
+	}
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if len(gvk.Kind) == 0 {
+		return nil, false, runtime.NewMissingKindErr("object has no kind field ")
+	}
+	if len(gvk.Version) == 0 {
+		return nil, false, runtime.NewMissingVersionErr("object has no apiVersion field")
+	}
+	return []schema.GroupVersionKind{gvk}, false, nil
+}
+
+func (t unstructuredTyper) Recognizes(gvk schema.GroupVersionKind) bool {
+	return true
+}
+
+// unstructuredCreater creates unstructured objects of the served kinds, and delegates the other kinds to the
+// scheme.
+type unstructuredCreater struct {
+	delegate runtime.ObjectCreater
+	group    string
+}
+
+func (c unstructuredCreater) New(kind schema.GroupVersionKind) (runtime.Object, error) {
+	if kind.Group != c.group {
+		return c.delegate.New(kind)
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(kind)
+	return u, nil
+}
+
+// versionConverter converts the objects of a resource between its versions.  The versions share the same
+// fields, so converting only changes the apiVersion of the objects.  Typed objects are converted by the scheme.
+type versionConverter struct {
+	delegate runtime.ObjectConvertor
+	versions sets.Set[schema.GroupVersion]
+}
+
+func (c versionConverter) Convert(in, out, context interface{}) error {
+	u, ok := in.(*unstructured.Unstructured)
+	if !ok {
+		return c.delegate.Convert(in, out, context)
+	}
+	uOut, ok := out.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unable to convert unstructured object to %T", out)
+	}
+	converted, err := c.ConvertToVersion(u, uOut.GroupVersionKind().GroupVersion())
+	if err != nil {
+		return err
+	}
+	uOut.SetUnstructuredContent(converted.(*unstructured.Unstructured).UnstructuredContent())
+	return nil
+}
+
+func (c versionConverter) ConvertToVersion(in runtime.Object, target runtime.GroupVersioner) (runtime.Object, error) {
+	switch in := in.(type) {
+	case *unstructured.Unstructured:
+		gvk, err := c.targetKind(in.GroupVersionKind(), target)
+		if err != nil {
+			return nil, err
+		}
+		out := in.DeepCopy()
+		out.SetGroupVersionKind(gvk)
+		return out, nil
+	case *unstructured.UnstructuredList:
+		gvk, err := c.targetKind(in.GroupVersionKind(), target)
+		if err != nil {
+			return nil, err
+		}
+		out := in.DeepCopy()
+		out.SetGroupVersionKind(gvk)
+		for i := range out.Items {
+			itemGVK, err := c.targetKind(out.Items[i].GroupVersionKind(), target)
+			if err != nil {
+				return nil, err
+			}
+			out.Items[i].SetGroupVersionKind(itemGVK)
+		}
+		return out, nil
+	}
+	return c.delegate.ConvertToVersion(in, target)
+}
+
+func (c versionConverter) ConvertFieldLabel(gvk schema.GroupVersionKind, label, value string) (string, string, error) {
+	switch label {
+	case "metadata.name", "metadata.namespace":
+		return label, value, nil
+	}
+	return "", "", fmt.Errorf("field label not supported: %s", label)
+}
+
+// targetKind returns the kind in the target version, which must be served.
+func (c versionConverter) targetKind(kind schema.GroupVersionKind, target runtime.GroupVersioner) (schema.GroupVersionKind, error) {
+	gvk, ok := target.KindForGroupVersionKinds([]schema.GroupVersionKind{kind})
+	if !ok {
+		return schema.GroupVersionKind{}, fmt.Errorf("%v is unstructured and is not suitable for converting to %q", kind, target)
+	}
+	if !c.versions.Has(gvk.GroupVersion()) {
+		return schema.GroupVersionKind{}, fmt.Errorf("request to convert %v to unsupported version %v", kind, gvk.GroupVersion())
+	}
+	return gvk, nil
+}
+
+// schemaDefaulter applies the default values of the schema of each version to the unstructured objects of the
+// version, and delegates the typed objects to the scheme.
+type schemaDefaulter struct {
+	delegate   runtime.ObjectDefaulter
+	defaulters map[schema.GroupVersion]*rest.SchemaDefaulter
+}
+
+func (d schemaDefaulter) Default(obj runtime.Object) {
+	switch obj := obj.(type) {
+	case *unstructured.Unstructured:
+		d.defaulters[obj.GroupVersionKind().GroupVersion()].Default(obj)
+	case *unstructured.UnstructuredList:
+		for i := range obj.Items {
+			d.Default(&obj.Items[i])
+		}
+	default:
+		d.delegate.Default(obj)
+	}
+}
+
+// negotiatedSerializer serializes the unstructured objects of a resource as JSON or YAML.  The decoded
+// objects are defaulted and converted to the requested version.
+type negotiatedSerializer struct {
+	creater   runtime.ObjectCreater
+	typer     runtime.ObjectTyper
+	converter runtime.ObjectConvertor
+	defaulter runtime.ObjectDefaulter
+}
+
+var _ runtime.NegotiatedSerializer = negotiatedSerializer{}
+
+func (s negotiatedSerializer) SupportedMediaTypes() []runtime.SerializerInfo {
+	return []runtime.SerializerInfo{
+		{
+			MediaType:        runtime.ContentTypeJSON,
+			MediaTypeType:    "application",
+			MediaTypeSubType: "json",
+			EncodesAsText:    true,
+			Serializer:       json.NewSerializerWithOptions(json.DefaultMetaFactory, s.creater, s.typer, json.SerializerOptions{}),
+			PrettySerializer: json.NewSerializerWithOptions(json.DefaultMetaFactory, s.creater, s.typer, json.SerializerOptions{Pretty: true}),
+			StrictSerializer: json.NewSerializerWithOptions(json.DefaultMetaFactory, s.creater, s.typer, json.SerializerOptions{Strict: true}),
+			StreamSerializer: &runtime.StreamSerializerInfo{
+				EncodesAsText: true,
+				Serializer:    json.NewSerializerWithOptions(json.DefaultMetaFactory, s.creater, s.typer, json.SerializerOptions{}),
+				Framer:        json.Framer,
+			},
+		},
+		{
+			MediaType:        runtime.ContentTypeYAML,
+			MediaTypeType:    "application",
+			MediaTypeSubType: "yaml",
+			EncodesAsText:    true,
+			Serializer:       json.NewSerializerWithOptions(json.DefaultMetaFactory, s.creater, s.typer, json.SerializerOptions{Yaml: true}),
+			StrictSerializer: json.NewSerializerWithOptions(json.DefaultMetaFactory, s.creater, s.typer, json.SerializerOptions{Yaml: true, Strict: true}),
+		},
+	}
+}
+
+func (s negotiatedSerializer) EncoderForVersion(encoder runtime.Encoder, gv runtime.GroupVersioner) runtime.Encoder {
+	return versioning.NewCodec(encoder, nil, s.converter, s.creater, s.typer, s.defaulter, gv, nil, "kesDynamicSerializer")
+}
+
+func (s negotiatedSerializer) DecoderToVersion(decoder runtime.Decoder, gv runtime.GroupVersioner) runtime.Decoder {
+	return versioning.NewCodec(nil, decoder, s.converter, s.creater, s.typer, s.defaulter, nil, gv, "kesDynamicSerializer")
+}
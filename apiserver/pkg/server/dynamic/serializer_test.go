@@ -0,0 +1,124 @@
+package dynamic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/rest"
+)
+
+var (
+	widgetV1      = schema.GroupVersion{Group: "example.com", Version: "v1"}
+	widgetV1beta1 = schema.GroupVersion{Group: "example.com", Version: "v1beta1"}
+)
+
+func newWidgetSerializer(t *testing.T) negotiatedSerializer {
+	typedScheme := newTypedScheme(widgetV1, widgetV1beta1)
+	defaulter, err := rest.NewSchemaDefaulter(&spec.Schema{SchemaProps: spec.SchemaProps{
+		Type: []string{"object"},
+		Properties: map[string]spec.Schema{
+			"spec": {SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"size": {SchemaProps: spec.SchemaProps{Type: []string{"integer"}, Default: 3}},
+				},
+			}},
+		},
+	}})
+	assert.NoError(t, err)
+	return negotiatedSerializer{
+		creater:   unstructuredCreater{delegate: typedScheme, group: widgetV1.Group},
+		typer:     unstructuredTyper{delegate: typedScheme},
+		converter: versionConverter{delegate: typedScheme, versions: sets.New(widgetV1, widgetV1beta1)},
+		defaulter: schemaDefaulter{delegate: typedScheme, defaulters: map[schema.GroupVersion]*rest.SchemaDefaulter{
+			widgetV1beta1: defaulter,
+		}},
+	}
+}
+
+func newWidget(gv schema.GroupVersion, spec map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	u.SetGroupVersionKind(gv.WithKind("Widget"))
+	u.SetName("w")
+	return u
+}
+
+func TestVersionConverter(t *testing.T) {
+	c := versionConverter{delegate: newTypedScheme(widgetV1, widgetV1beta1), versions: sets.New(widgetV1, widgetV1beta1)}
+
+	t.Run("objects should be converted by changing their version", func(t *testing.T) {
+		in := newWidget(widgetV1beta1, map[string]interface{}{"size": int64(1)})
+		out, err := c.ConvertToVersion(in, widgetV1)
+		assert.NoError(t, err)
+		assert.Equal(t, newWidget(widgetV1, map[string]interface{}{"size": int64(1)}), out)
+		assert.Equal(t, widgetV1beta1, in.GroupVersionKind().GroupVersion())
+	})
+	t.Run("lists should be converted with their items", func(t *testing.T) {
+		in := &unstructured.UnstructuredList{Object: map[string]interface{}{}}
+		in.SetGroupVersionKind(widgetV1beta1.WithKind("WidgetList"))
+		in.Items = []unstructured.Unstructured{*newWidget(widgetV1beta1, nil)}
+		out, err := c.ConvertToVersion(in, widgetV1)
+		assert.NoError(t, err)
+		assert.Equal(t, widgetV1.WithKind("WidgetList"), out.GetObjectKind().GroupVersionKind())
+		assert.Equal(t, widgetV1.WithKind("Widget"), out.(*unstructured.UnstructuredList).Items[0].GroupVersionKind())
+	})
+	t.Run("converting to other versions should fail", func(t *testing.T) {
+		_, err := c.ConvertToVersion(newWidget(widgetV1, nil), schema.GroupVersion{Group: "example.com", Version: "v2"})
+		assert.Error(t, err)
+	})
+	t.Run("typed objects should be converted by the scheme", func(t *testing.T) {
+		out, err := c.ConvertToVersion(&metav1.Status{Status: metav1.StatusSuccess}, schema.GroupVersion{Version: "v1"})
+		assert.NoError(t, err)
+		assert.Equal(t, metav1.StatusSuccess, out.(*metav1.Status).Status)
+	})
+	t.Run("only the name and namespace field labels should be supported", func(t *testing.T) {
+		_, _, err := c.ConvertFieldLabel(widgetV1.WithKind("Widget"), "metadata.name", "w")
+		assert.NoError(t, err)
+		_, _, err = c.ConvertFieldLabel(widgetV1.WithKind("Widget"), "spec.size", "1")
+		assert.Error(t, err)
+	})
+}
+
+func TestNegotiatedSerializer(t *testing.T) {
+	s := newWidgetSerializer(t)
+	info, ok := runtime.SerializerInfoForMediaType(s.SupportedMediaTypes(), runtime.ContentTypeJSON)
+	assert.True(t, ok)
+
+	t.Run("objects should be defaulted in their version", func(t *testing.T) {
+		decoder := s.DecoderToVersion(info.Serializer, widgetV1)
+		obj, _, err := decoder.Decode([]byte(`{"apiVersion":"example.com/v1beta1","kind":"Widget","metadata":{"name":"w"},"spec":{}}`), nil, &unstructured.Unstructured{})
+		assert.NoError(t, err)
+		assert.Equal(t, newWidget(widgetV1beta1, map[string]interface{}{"size": int64(3)}), obj)
+	})
+	t.Run("objects should be converted to the version of the target", func(t *testing.T) {
+		decoder := s.DecoderToVersion(info.Serializer, widgetV1)
+		obj, _, err := decoder.Decode([]byte(`{"apiVersion":"example.com/v1beta1","kind":"Widget","metadata":{"name":"w"},"spec":{}}`), nil, newWidget(widgetV1, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, newWidget(widgetV1, map[string]interface{}{"size": int64(3)}), obj)
+	})
+	t.Run("versions without schema should not be defaulted", func(t *testing.T) {
+		decoder := s.DecoderToVersion(info.Serializer, widgetV1)
+		obj, _, err := decoder.Decode([]byte(`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w"},"spec":{}}`), nil, &unstructured.Unstructured{})
+		assert.NoError(t, err)
+		assert.Equal(t, newWidget(widgetV1, map[string]interface{}{}), obj)
+	})
+	t.Run("objects should be encoded in the requested version", func(t *testing.T) {
+		encoder := s.EncoderForVersion(info.Serializer, widgetV1beta1)
+		data, err := runtime.Encode(encoder, newWidget(widgetV1, map[string]interface{}{"size": int64(1)}))
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"apiVersion":"example.com/v1beta1","kind":"Widget","metadata":{"name":"w"},"spec":{"size":1}}`, string(data))
+	})
+	t.Run("watch events should be encoded", func(t *testing.T) {
+		encoder := s.EncoderForVersion(info.Serializer, widgetV1)
+		data, err := runtime.Encode(encoder, &metav1.WatchEvent{Type: "ADDED", Object: runtime.RawExtension{Raw: []byte(`{}`)}})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"type":"ADDED","object":{}}`, string(data))
+	})
+}
@@ -0,0 +1,199 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dynamic
+
+import (
+	"context"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/names"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/rest"
+)
+
+// strategy implements the behavior of the objects of a defined resource, like the strategy of custom
+// resources: the objects are validated against the schema of the requested version, and the generation is
+// incremented on changes outside of the metadata and status.
+type strategy struct {
+	runtime.ObjectTyper
+	names.NameGenerator
+
+	namespaced bool
+	// storageVersion is the version of the objects in the storage, used for requests without version
+	storageVersion schema.GroupVersion
+	// validators holds the SchemaValidator of each version, nil for versions without schema
+	validators map[schema.GroupVersion]*rest.SchemaValidator
+	// statusVersions are the versions whose status is updated by the status subresource
+	statusVersions sets.Set[schema.GroupVersion]
+}
+
+func (s *strategy) NamespaceScoped() bool {
+	return s.namespaced
+}
+
+// PrepareForCreate clears the status if the status subresource is enabled, and sets the generation.
+func (s *strategy) PrepareForCreate(ctx context.Context, obj runtime.Object) {
+	u := obj.(*unstructured.Unstructured)
+	if s.statusVersions.Has(s.version(ctx)) {
+		delete(u.Object, "status")
+	}
+	u.SetGeneration(1)
+}
+
+// PrepareForUpdate keeps the status if the status subresource is enabled, and increments the generation on
+// changes outside of the metadata and status.
+func (s *strategy) PrepareForUpdate(ctx context.Context, obj, old runtime.Object) {
+	u, oldU := obj.(*unstructured.Unstructured), old.(*unstructured.Unstructured)
+	if s.statusVersions.Has(s.version(ctx)) {
+		if status, ok := oldU.Object["status"]; ok {
+			u.Object["status"] = runtime.DeepCopyJSONValue(status)
+		} else {
+			delete(u.Object, "status")
+		}
+	}
+	if !apiequality.Semantic.DeepEqual(withoutMetadataAndStatus(u), withoutMetadataAndStatus(oldU)) {
+		u.SetGeneration(oldU.GetGeneration() + 1)
+	}
+}
+
+func (s *strategy) Validate(ctx context.Context, obj runtime.Object) field.ErrorList {
+	return s.validators[s.version(ctx)].Validate(obj)
+}
+
+func (s *strategy) ValidateUpdate(ctx context.Context, obj, old runtime.Object) field.ErrorList {
+	return s.validators[s.version(ctx)].ValidateUpdate(obj, old)
+}
+
+// version returns the requested version.  The objects are converted to the storage version before reaching
+// the strategy, and converting only changes their apiVersion, so they keep the fields of the requested version.
+func (s *strategy) version(ctx context.Context) schema.GroupVersion {
+	if info, ok := genericapirequest.RequestInfoFrom(ctx); ok && info.APIGroup == s.storageVersion.Group {
+		gv := schema.GroupVersion{Group: info.APIGroup, Version: info.APIVersion}
+		if _, ok := s.validators[gv]; ok {
+			return gv
+		}
+	}
+	return s.storageVersion
+}
+
+func (s *strategy) WarningsOnCreate(context.Context, runtime.Object) []string {
+	return nil
+}
+
+func (s *strategy) WarningsOnUpdate(context.Context, runtime.Object, runtime.Object) []string {
+	return nil
+}
+
+func (s *strategy) Canonicalize(runtime.Object) {}
+
+func (s *strategy) AllowCreateOnUpdate() bool {
+	return false
+}
+
+func (s *strategy) AllowUnconditionalUpdate() bool {
+	return false
+}
+
+// GetResetFields returns the status of the versions with the status subresource, reset by updates of the
+// resource.
+func (s *strategy) GetResetFields() map[fieldpath.APIVersion]*fieldpath.Set {
+	return s.resetFields(fieldpath.MakePathOrDie("status"))
+}
+
+func (s *strategy) resetFields(paths ...fieldpath.Path) map[fieldpath.APIVersion]*fieldpath.Set {
+	fields := map[fieldpath.APIVersion]*fieldpath.Set{}
+	for gv := range s.statusVersions {
+		fields[fieldpath.APIVersion(gv.String())] = fieldpath.NewSet(paths...)
+	}
+	return fields
+}
+
+// match is the filter used by the storage to watch the objects matching the selectors.
+func (s *strategy) match(label labels.Selector, field fields.Selector) storage.SelectionPredicate {
+	return storage.SelectionPredicate{
+		Label:    label,
+		Field:    field,
+		GetAttrs: s.getAttrs,
+	}
+}
+
+// getAttrs returns the labels and the selectable fields of obj.
+func (s *strategy) getAttrs(obj runtime.Object) (labels.Set, fields.Set, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	fieldSet := fields.Set{"metadata.name": accessor.GetName()}
+	if s.namespaced {
+		fieldSet["metadata.namespace"] = accessor.GetNamespace()
+	}
+	return accessor.GetLabels(), fieldSet, nil
+}
+
+// statusStrategy implements the behavior of the status subresource of a defined resource, which only updates
+// the status.
+type statusStrategy struct {
+	*strategy
+}
+
+// PrepareForUpdate keeps everything but the status of the object, and the managed fields tracking the update.
+func (s statusStrategy) PrepareForUpdate(_ context.Context, obj, old runtime.Object) {
+	u, oldU := obj.(*unstructured.Unstructured), old.(*unstructured.Unstructured)
+	status, hasStatus := u.Object["status"]
+	managedFields := u.GetManagedFields()
+	u.Object = runtime.DeepCopyJSON(oldU.Object)
+	u.SetManagedFields(managedFields)
+	if hasStatus {
+		u.Object["status"] = status
+	} else {
+		delete(u.Object, "status")
+	}
+}
+
+// GetResetFields returns the metadata and spec, reset by updates of the status subresource.
+func (s statusStrategy) GetResetFields() map[fieldpath.APIVersion]*fieldpath.Set {
+	return s.resetFields(fieldpath.MakePathOrDie("metadata"), fieldpath.MakePathOrDie("spec"))
+}
+
+// withoutMetadataAndStatus returns the content of u without the metadata and status.
+func withoutMetadataAndStatus(u *unstructured.Unstructured) map[string]interface{} {
+	content := make(map[string]interface{}, len(u.Object))
+	for k, v := range u.Object {
+		switch k {
+		case "metadata", "status":
+		default:
+			content[k] = v
+		}
+	}
+	return content
+}
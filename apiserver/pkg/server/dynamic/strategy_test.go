@@ -0,0 +1,134 @@
+package dynamic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/rest"
+)
+
+func newWidgetStrategy(t *testing.T) *strategy {
+	validator, err := rest.NewSchemaValidatorForSchema(&spec.Schema{SchemaProps: spec.SchemaProps{
+		Type: []string{"object"},
+		Properties: map[string]spec.Schema{
+			"spec": {SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"size": {SchemaProps: spec.SchemaProps{Type: []string{"integer"}, Maximum: ptrFloat(10)}},
+				},
+			}},
+		},
+	}})
+	assert.NoError(t, err)
+	return &strategy{
+		namespaced:     true,
+		storageVersion: widgetV1,
+		validators:     map[schema.GroupVersion]*rest.SchemaValidator{widgetV1: validator, widgetV1beta1: nil},
+		statusVersions: sets.New(widgetV1),
+	}
+}
+
+func ptrFloat(f float64) *float64 {
+	return &f
+}
+
+func withStatus(u *unstructured.Unstructured, status map[string]interface{}) *unstructured.Unstructured {
+	u.Object["status"] = status
+	return u
+}
+
+func requestContext(gv schema.GroupVersion) context.Context {
+	return genericapirequest.WithRequestInfo(context.Background(), &genericapirequest.RequestInfo{
+		IsResourceRequest: true,
+		APIGroup:          gv.Group,
+		APIVersion:        gv.Version,
+		Resource:          "widgets",
+	})
+}
+
+func TestStrategy(t *testing.T) {
+	s := newWidgetStrategy(t)
+
+	t.Run("the status should be cleared on create with the status subresource", func(t *testing.T) {
+		u := withStatus(newWidget(widgetV1, map[string]interface{}{}), map[string]interface{}{"ready": true})
+		s.PrepareForCreate(requestContext(widgetV1), u)
+		assert.NotContains(t, u.Object, "status")
+		assert.Equal(t, int64(1), u.GetGeneration())
+	})
+	t.Run("the status should be kept on create without the status subresource", func(t *testing.T) {
+		u := withStatus(newWidget(widgetV1beta1, map[string]interface{}{}), map[string]interface{}{"ready": true})
+		s.PrepareForCreate(requestContext(widgetV1beta1), u)
+		assert.Contains(t, u.Object, "status")
+	})
+	t.Run("the status should be kept on update with the status subresource", func(t *testing.T) {
+		old := withStatus(newWidget(widgetV1, map[string]interface{}{"size": int64(1)}), map[string]interface{}{"ready": true})
+		old.SetGeneration(1)
+		u := withStatus(newWidget(widgetV1, map[string]interface{}{"size": int64(1)}), map[string]interface{}{"ready": false})
+		u.SetGeneration(1)
+		s.PrepareForUpdate(requestContext(widgetV1), u, old)
+		assert.Equal(t, map[string]interface{}{"ready": true}, u.Object["status"])
+		assert.Equal(t, int64(1), u.GetGeneration())
+	})
+	t.Run("the generation should be incremented on spec changes", func(t *testing.T) {
+		old := newWidget(widgetV1, map[string]interface{}{"size": int64(1)})
+		old.SetGeneration(1)
+		u := newWidget(widgetV1, map[string]interface{}{"size": int64(2)})
+		u.SetGeneration(1)
+		s.PrepareForUpdate(requestContext(widgetV1), u, old)
+		assert.Equal(t, int64(2), u.GetGeneration())
+
+		u = newWidget(widgetV1, map[string]interface{}{"size": int64(1)})
+		u.SetGeneration(1)
+		u.SetLabels(map[string]string{"a": "b"})
+		s.PrepareForUpdate(requestContext(widgetV1), u, old)
+		assert.Equal(t, int64(1), u.GetGeneration())
+	})
+	t.Run("objects should be validated against the schema of the requested version", func(t *testing.T) {
+		u := newWidget(widgetV1, map[string]interface{}{"size": int64(11)})
+		assert.Len(t, s.Validate(requestContext(widgetV1), u), 1)
+		assert.Empty(t, s.Validate(requestContext(widgetV1beta1), u))
+		assert.Len(t, s.Validate(context.Background(), u), 1)
+	})
+	t.Run("the status should be reset for the versions with the status subresource", func(t *testing.T) {
+		fields := s.GetResetFields()
+		assert.Len(t, fields, 1)
+		assert.Contains(t, fields, fieldpathVersion(widgetV1))
+	})
+}
+
+func TestStatusStrategy(t *testing.T) {
+	s := statusStrategy{strategy: newWidgetStrategy(t)}
+
+	t.Run("only the status should be updated", func(t *testing.T) {
+		old := withStatus(newWidget(widgetV1, map[string]interface{}{"size": int64(1)}), map[string]interface{}{"ready": false})
+		old.SetGeneration(1)
+		u := withStatus(newWidget(widgetV1, map[string]interface{}{"size": int64(2)}), map[string]interface{}{"ready": true})
+		u.SetLabels(map[string]string{"a": "b"})
+		s.PrepareForUpdate(requestContext(widgetV1), u, old)
+		assert.Equal(t, map[string]interface{}{"size": int64(1)}, u.Object["spec"])
+		assert.Equal(t, map[string]interface{}{"ready": true}, u.Object["status"])
+		assert.Empty(t, u.GetLabels())
+		assert.Equal(t, int64(1), u.GetGeneration())
+	})
+	t.Run("the metadata and spec should be reset", func(t *testing.T) {
+		set := s.GetResetFields()[fieldpathVersion(widgetV1)]
+		assert.True(t, set.Has(fieldpathPath("spec")))
+		assert.False(t, set.Has(fieldpathPath("status")))
+	})
+}
+
+func fieldpathVersion(gv schema.GroupVersion) fieldpath.APIVersion {
+	return fieldpath.APIVersion(gv.String())
+}
+
+func fieldpathPath(name string) fieldpath.Path {
+	return fieldpath.MakePathOrDie(name)
+}
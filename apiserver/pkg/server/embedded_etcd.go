@@ -0,0 +1,285 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/raft/v3"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+
+	"github.com/vine-io/kes/apiserver/pkg/etcd"
+)
+
+// embeddedEtcdMaxAppliedIndexLag is the number of committed entries the embedded etcd member may have left to apply
+// before the server isn't ready, the gap at which the member starts rejecting requests as too many.
+const embeddedEtcdMaxAppliedIndexLag = 5000
+
+// embeddedEtcdDefragMetric is the etcd gauge set while the backend of the member is defragmented.
+const embeddedEtcdDefragMetric = "etcd_disk_defrag_inflight"
+
+// embeddedEtcdMetricPrefixes are the prefixes of the metrics of the embedded etcd member: its server, storage, raft
+// and gRPC server metrics.  The go and process metrics of the default registry are served by the registry of the
+// server already.
+var embeddedEtcdMetricPrefixes = []string{"etcd_", "grpc_server_", "os_fd_"}
+
+var registerEmbeddedEtcdMetricsOnce sync.Once
+
+// registerEmbeddedEtcdMetrics serves the metrics of the embedded etcd member on the /metrics endpoint of the server.
+// The metrics of etcd are global, they are registered once whatever the number of members started.
+func registerEmbeddedEtcdMetrics() {
+	registerEmbeddedEtcdMetricsOnce.Do(func() {
+		legacyregistry.RawMustRegister(newEmbeddedEtcdCollector(prometheus.DefaultGatherer))
+	})
+}
+
+// embeddedEtcdMonitor tracks the state of the embedded etcd member, reported by the health checks of the server.
+type embeddedEtcdMonitor struct {
+	etcd *etcd.Etcd
+	// defragInProgress returns true if the backend is being defragmented.
+	defragInProgress func() bool
+	// closeEtcd stops the member, which may only be done once.
+	closeEtcd func()
+
+	mu  sync.Mutex
+	err error
+	// closing is set once the member is being closed along with the server, which isn't a failure.
+	closing bool
+	// stopped is closed when the member has stopped, with err as the reason.
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// newEmbeddedEtcdMonitor returns a monitor of the member, watching for it to stop.
+func newEmbeddedEtcdMonitor(e *etcd.Etcd) *embeddedEtcdMonitor {
+	m := &embeddedEtcdMonitor{
+		etcd:             e,
+		defragInProgress: defragInProgress,
+		closeEtcd:        e.Close,
+		stopped:          make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// run waits for the member to stop.  As etcd itself does, an error serving the clients or the peers is fatal.
+func (m *embeddedEtcdMonitor) run() {
+	var err error
+	select {
+	case err = <-m.etcd.Err():
+	case <-m.etcd.Server.StopNotify():
+	}
+	if err == nil {
+		err = errors.New("etcd member stopped")
+	}
+
+	m.mu.Lock()
+	m.err = err
+	closing := m.closing
+	m.mu.Unlock()
+	if closing {
+		klog.InfoS("Embedded etcd member stopped")
+	} else {
+		klog.ErrorS(err, "Embedded etcd member failed")
+	}
+	close(m.stopped)
+}
+
+// Close stops the member, once the server has released its storage.  It returns once the member has stopped and
+// synced its WAL, so that a restart doesn't have to repair it.
+func (m *embeddedEtcdMonitor) Close() {
+	m.closeOnce.Do(func() {
+		m.mu.Lock()
+		m.closing = true
+		m.mu.Unlock()
+
+		klog.InfoS("Closing the embedded etcd member")
+		m.closeEtcd()
+		<-m.stopped
+	})
+}
+
+// Err returns the reason the member stopped, nil if it's running.
+func (m *embeddedEtcdMonitor) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// LiveCheck returns the check failing once the member has stopped.
+func (m *embeddedEtcdMonitor) LiveCheck() healthz.HealthChecker {
+	return healthz.NamedCheck("etcd-member", func(_ *http.Request) error {
+		return m.Err()
+	})
+}
+
+// ReadyCheck returns the check failing while the member can't serve requests: it has stopped, has no leader, is
+// too far behind applying the committed entries, has raised a NOSPACE or CORRUPT alarm, or is being defragmented.
+func (m *embeddedEtcdMonitor) ReadyCheck() healthz.HealthChecker {
+	return healthz.NamedCheck("etcd-member-ready", func(_ *http.Request) error {
+		if err := m.Err(); err != nil {
+			return err
+		}
+
+		var errs []string
+		s := m.etcd.Server
+		if s.Lead() == raft.None {
+			errs = append(errs, "no leader")
+		}
+		if committed, applied := s.CommittedIndex(), s.AppliedIndex(); committed > applied+embeddedEtcdMaxAppliedIndexLag {
+			errs = append(errs, fmt.Sprintf("applied index %d is %d entries behind the committed index %d",
+				applied, committed-applied, committed))
+		}
+		for _, alarm := range s.Alarms() {
+			if alarm.Alarm == pb.AlarmType_NOSPACE || alarm.Alarm == pb.AlarmType_CORRUPT {
+				errs = append(errs, fmt.Sprintf("%s alarm raised", alarm.Alarm))
+			}
+		}
+		if m.defragInProgress() {
+			errs = append(errs, "defragmentation in progress")
+		}
+		if len(errs) != 0 {
+			return errors.New(strings.Join(errs, ", "))
+		}
+		return nil
+	})
+}
+
+// defragInProgress returns true if the gauge of the defragmentation is set.  etcd registers its metrics with the
+// default prometheus registry, which is only gathered for the gauge.
+func defragInProgress() bool {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return false
+	}
+	for _, family := range families {
+		if family.GetName() != embeddedEtcdDefragMetric {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetGauge().GetValue() != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stopOnEmbeddedEtcdFailure returns a channel closed when stopCh is closed or the embedded etcd member stops, so
+// the server shuts down rather than failing every request, and a function returning the failure of the member
+// once the server has stopped, if it's the reason the server stopped.
+func (ws *WardleServer) stopOnEmbeddedEtcdFailure(stopCh <-chan struct{}) (<-chan struct{}, func() error) {
+	m := ws.embedEtcdMonitor
+	if m == nil {
+		return stopCh, func() error { return nil }
+	}
+
+	stop := make(chan struct{})
+	var failed error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(stop)
+		select {
+		case <-stopCh:
+		case <-m.stopped:
+			failed = fmt.Errorf("embedded etcd: %w", m.Err())
+		}
+	}()
+	return stop, func() error {
+		<-done
+		return failed
+	}
+}
+
+// embeddedEtcdCollector serves the metrics of the embedded etcd member along with the metrics of the server.  etcd
+// registers its metrics with the default prometheus registry, which the server doesn't serve: the collector gathers
+// them from the registry every time the metrics of the server are collected.
+type embeddedEtcdCollector struct {
+	gatherer prometheus.Gatherer
+}
+
+// newEmbeddedEtcdCollector returns a collector of the metrics of the embedded etcd gathered by the gatherer.
+func newEmbeddedEtcdCollector(gatherer prometheus.Gatherer) *embeddedEtcdCollector {
+	return &embeddedEtcdCollector{gatherer: gatherer}
+}
+
+// Describe describes no metric, the collector is unchecked: the metrics of etcd are known once gathered.
+func (c *embeddedEtcdCollector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect sends the metrics of the embedded etcd member.
+func (c *embeddedEtcdCollector) Collect(ch chan<- prometheus.Metric) {
+	families, err := c.gatherer.Gather()
+	if err != nil {
+		// the families gathered are still served
+		klog.V(4).InfoS("Failed to gather the metrics of the embedded etcd", "err", err)
+	}
+	for _, family := range families {
+		if !isEmbeddedEtcdMetric(family.GetName()) {
+			continue
+		}
+		desc := prometheus.NewDesc(family.GetName(), family.GetHelp(), nil, nil)
+		for _, metric := range family.GetMetric() {
+			ch <- &gatheredMetric{desc: desc, metric: metric}
+		}
+	}
+}
+
+// isEmbeddedEtcdMetric returns true if the metric is one of the embedded etcd member.
+func isEmbeddedEtcdMetric(name string) bool {
+	for _, prefix := range embeddedEtcdMetricPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// gatheredMetric is a metric gathered from a registry, collected again by another.
+type gatheredMetric struct {
+	desc   *prometheus.Desc
+	metric *dto.Metric
+}
+
+func (m *gatheredMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *gatheredMetric) Write(out *dto.Metric) error {
+	out.Label = m.metric.Label
+	out.Counter = m.metric.Counter
+	out.Gauge = m.metric.Gauge
+	out.Histogram = m.metric.Histogram
+	out.Summary = m.metric.Summary
+	out.Untyped = m.metric.Untyped
+	out.TimestampMs = m.metric.TimestampMs
+	return nil
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/stretchr/testify/assert"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+
+	"github.com/vine-io/kes/apiserver/pkg/etcd"
+)
+
+// startEmbeddedEtcd starts an etcd member, and returns it with a function closing it.
+func startEmbeddedEtcd(t *testing.T) (*etcd.Etcd, func()) {
+	freeURL := func() url.URL {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer l.Close()
+		return url.URL{Scheme: "http", Host: l.Addr().String()}
+	}
+
+	cfg := etcd.NewConfig()
+	cfg.Dir = t.TempDir()
+	clientURL, peerURL := freeURL(), freeURL()
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := etcd.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var once sync.Once
+	closeEtcd := func() { once.Do(e.Close) }
+	t.Cleanup(closeEtcd)
+	<-e.Server.ReadyNotify()
+	return e, closeEtcd
+}
+
+func TestEmbeddedEtcdMonitor(t *testing.T) {
+	e, closeEtcd := startEmbeddedEtcd(t)
+	m := newEmbeddedEtcdMonitor(e)
+	ws := &WardleServer{embedEtcdMonitor: m}
+	stopCh := make(chan struct{})
+	stop, failure := ws.stopOnEmbeddedEtcdFailure(stopCh)
+
+	t.Run("running", func(t *testing.T) {
+		assert.NoError(t, m.LiveCheck().Check(nil))
+		assert.NoError(t, m.ReadyCheck().Check(nil))
+		assert.False(t, defragInProgress())
+	})
+
+	t.Run("alarm", func(t *testing.T) {
+		alarm := func(action pb.AlarmRequest_AlarmAction) {
+			_, err := e.Server.Alarm(context.Background(), &pb.AlarmRequest{
+				Action:   action,
+				MemberID: uint64(e.Server.ID()),
+				Alarm:    pb.AlarmType_NOSPACE,
+			})
+			assert.NoError(t, err)
+		}
+
+		alarm(pb.AlarmRequest_ACTIVATE)
+		assert.NoError(t, m.LiveCheck().Check(nil))
+		assert.EqualError(t, m.ReadyCheck().Check(nil), "NOSPACE alarm raised")
+		alarm(pb.AlarmRequest_DEACTIVATE)
+		assert.NoError(t, m.ReadyCheck().Check(nil))
+	})
+
+	t.Run("defrag", func(t *testing.T) {
+		m.defragInProgress = func() bool { return true }
+		defer func() { m.defragInProgress = defragInProgress }()
+		assert.EqualError(t, m.ReadyCheck().Check(nil), "defragmentation in progress")
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		closeEtcd()
+		select {
+		case <-stop:
+		case <-time.After(10 * time.Second):
+			t.Fatal("server not stopped")
+		}
+		assert.Error(t, m.LiveCheck().Check(nil))
+		assert.Error(t, m.ReadyCheck().Check(nil))
+		assert.ErrorContains(t, failure(), "embedded etcd")
+	})
+
+	t.Run("no member", func(t *testing.T) {
+		stopCh := make(chan struct{})
+		stop, failure := (&WardleServer{}).stopOnEmbeddedEtcdFailure(stopCh)
+		close(stopCh)
+		<-stop
+		assert.NoError(t, failure())
+	})
+}
+
+func TestEmbeddedEtcdMonitorClose(t *testing.T) {
+	e, closeEtcd := startEmbeddedEtcd(t)
+	m := newEmbeddedEtcdMonitor(e)
+	m.closeEtcd = closeEtcd
+	ws := &WardleServer{embedEtcdMonitor: m}
+	stopCh := make(chan struct{})
+	stop, failure := ws.stopOnEmbeddedEtcdFailure(stopCh)
+
+	// the server stops first, then closes the member along with its storage
+	close(stopCh)
+	<-stop
+	m.Close()
+	select {
+	case <-m.stopped:
+	default:
+		t.Fatal("member not stopped")
+	}
+	assert.NoError(t, failure())
+	assert.Error(t, m.LiveCheck().Check(nil))
+
+	// closing again is a no-op
+	m.Close()
+}
+
+func TestEmbeddedEtcdCollector(t *testing.T) {
+	// the registry of etcd, which has the go metrics too
+	etcdRegistry := prometheus.NewRegistry()
+	etcdRegistry.MustRegister(collectors.NewGoCollector())
+	proposals := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "etcd_server_proposals_committed_total",
+		Help: "The total number of consensus proposals committed.",
+	})
+	requests := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "grpc_server_handling_seconds",
+		Help: "Histogram of response latency of gRPC.",
+	}, []string{"grpc_method"})
+	etcdRegistry.MustRegister(proposals, requests)
+	proposals.Add(3)
+	requests.WithLabelValues("Range").Observe(0.1)
+
+	// the registry of the server
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), newEmbeddedEtcdCollector(etcdRegistry))
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	gathered := map[string]int{}
+	for _, family := range families {
+		gathered[family.GetName()] = len(family.GetMetric())
+		switch family.GetName() {
+		case "etcd_server_proposals_committed_total":
+			assert.Equal(t, 3.0, family.GetMetric()[0].GetCounter().GetValue())
+		case "grpc_server_handling_seconds":
+			metric := family.GetMetric()[0]
+			assert.Equal(t, "Range", metric.GetLabel()[0].GetValue())
+			assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+		}
+	}
+	assert.Equal(t, 1, gathered["etcd_server_proposals_committed_total"])
+	assert.Equal(t, 1, gathered["grpc_server_handling_seconds"])
+	assert.Equal(t, 1, gathered["go_goroutines"])
+}
@@ -44,12 +44,15 @@ import (
 
 	"github.com/vine-io/kes/apiserver/pkg/server/registry"
 	"github.com/vine-io/kes/apiserver/pkg/server/storage"
+	"github.com/vine-io/kes/apiserver/pkg/server/storage/fieldencryption"
 )
 
 type EtcdOptions struct {
 	StorageConfig                           storagebackend.Config
 	EncryptionProviderConfigFilepath        string
 	EncryptionProviderConfigAutomaticReload bool
+	// FieldEncryptionKeyFile is the path to the key file used to encrypt fields tagged `kes:"encrypted"`.
+	FieldEncryptionKeyFile string
 
 	EtcdServersOverrides []string
 
@@ -69,6 +72,18 @@ type EtcdOptions struct {
 	// SkipHealthEndpoints, when true, causes the Apply methods to not set up health endpoints.
 	// This allows multiple invocations of the Apply methods without duplication of said endpoints.
 	SkipHealthEndpoints bool
+
+	// EnableStorageLatencyMetrics records the latency of every storage operation per resource when the server
+	// serves metrics.  On by default.
+	EnableStorageLatencyMetrics bool
+	// EnableStorageTracing creates a span for every storage operation of traced requests.  Off by default.
+	EnableStorageTracing bool
+	// StorageWriteQPS limits the writes per second to the storage of each resource, 0 disables the limit.
+	StorageWriteQPS   float64
+	StorageWriteBurst int
+	// StorageDecorators are applied to the storage of every resource after the built-in decorators.
+	// Use storage.ForResources to decorate only some resources.
+	StorageDecorators []storage.Decorator
 }
 
 var storageTypes = sets.NewString(
@@ -83,6 +98,9 @@ func NewEtcdOptions(backendConfig *storagebackend.Config) *EtcdOptions {
 		EnableGarbageCollection: true,
 		EnableWatchCache:        true,
 		DefaultWatchCacheSize:   100,
+
+		EnableStorageLatencyMetrics: true,
+		StorageWriteBurst:           100,
 	}
 	options.StorageConfig.CountMetricPollPeriod = time.Minute
 	return options
@@ -127,6 +145,14 @@ func (s *EtcdOptions) Validate() []error {
 		allErrors = append(allErrors, fmt.Errorf("--encryption-provider-config-automatic-reload must be set with --encryption-provider-config"))
 	}
 
+	if s.StorageWriteQPS < 0 {
+		allErrors = append(allErrors, fmt.Errorf("--storage-write-qps must not be negative"))
+	}
+
+	if s.StorageWriteQPS > 0 && s.StorageWriteBurst < 1 {
+		allErrors = append(allErrors, fmt.Errorf("--storage-write-burst must be positive when --storage-write-qps is set"))
+	}
+
 	if s.DefaultStorageMediaType != "" && !storageMediaTypes.Has(s.DefaultStorageMediaType) {
 		allErrors = append(allErrors, fmt.Errorf("--storage-media-type %q invalid, allowed values: %s", s.DefaultStorageMediaType, strings.Join(sets.List(storageMediaTypes), ", ")))
 	}
@@ -200,6 +226,10 @@ func (s *EtcdOptions) AddFlags(fs *pflag.FlagSet) {
 		"Determines if the file set by --encryption-provider-config should be automatically reloaded if the disk contents change. "+
 			"Setting this to true disables the ability to uniquely identify distinct KMS plugins via the API server healthz endpoints.")
 
+	fs.StringVar(&s.FieldEncryptionKeyFile, "field-encryption-key-file", s.FieldEncryptionKeyFile,
+		"The file containing the keys used to encrypt resource fields tagged with `kes:\"encrypted\"`. "+
+			"The first key encrypts new values, the others are only used for decryption.")
+
 	fs.DurationVar(&s.StorageConfig.CompactionInterval, "etcd-compaction-interval", s.StorageConfig.CompactionInterval,
 		"The interval of compaction requests. If 0, the compaction request from apiserver is disabled.")
 
@@ -215,6 +245,19 @@ func (s *EtcdOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.DurationVar(&s.StorageConfig.ReadycheckTimeout, "etcd-readycheck-timeout", s.StorageConfig.ReadycheckTimeout,
 		"The timeout to use when checking etcd readiness")
 
+	fs.BoolVar(&s.EnableStorageLatencyMetrics, "storage-latency-metrics", s.EnableStorageLatencyMetrics,
+		"Record the latency of every storage operation per resource in kes_storage_operation_duration_seconds "+
+			"when metrics are served.")
+
+	fs.BoolVar(&s.EnableStorageTracing, "storage-tracing", s.EnableStorageTracing,
+		"Create a span for every storage operation of traced requests.")
+
+	fs.Float64Var(&s.StorageWriteQPS, "storage-write-qps", s.StorageWriteQPS,
+		"Maximum writes per second to the storage of each resource. 0 disables the limit.")
+
+	fs.IntVar(&s.StorageWriteBurst, "storage-write-burst", s.StorageWriteBurst,
+		"Maximum burst of writes to the storage of each resource when --storage-write-qps is set.")
+
 	fs.Int64Var(&s.StorageConfig.LeaseManagerConfig.ReuseDurationSeconds, "lease-reuse-duration-seconds", s.StorageConfig.LeaseManagerConfig.ReuseDurationSeconds,
 		"The time in seconds that each lease is reused. A lower value could avoid large number of objects reusing the same lease. Notice that a too small value may cause performance problems at storage layer.")
 }
@@ -252,7 +295,23 @@ func (s *EtcdOptions) ApplyWithStorageFactoryTo(factory serverstorage.StorageFac
 
 	metrics.SetStorageMonitorGetter(monitorGetter(factory))
 
-	c.RESTOptionsGetter = s.CreateRESTOptionsGetter(factory, c.ResourceTransformers)
+	var envelope *fieldencryption.Envelope
+	if len(s.FieldEncryptionKeyFile) != 0 {
+		keys, err := fieldencryption.LoadKeyFile(s.FieldEncryptionKeyFile)
+		if err != nil {
+			return err
+		}
+		envelope = fieldencryption.NewEnvelope(keys)
+		factory = &fieldencryption.StorageFactory{Delegate: factory, Envelope: envelope}
+	}
+
+	getter := s.CreateRESTOptionsGetter(factory, c.ResourceTransformers)
+	if f, ok := getter.(*StorageFactoryRestOptionsFactory); ok {
+		f.FieldEnvelope = envelope
+		// the latency is recorded only if it's served on /metrics
+		f.Options.EnableStorageLatencyMetrics = s.EnableStorageLatencyMetrics && c.EnableMetrics
+	}
+	c.RESTOptionsGetter = getter
 	return nil
 }
 
@@ -383,6 +442,14 @@ func (s *EtcdOptions) addEtcdHealthEndpoint(c *server.Config) error {
 type StorageFactoryRestOptionsFactory struct {
 	Options        EtcdOptions
 	StorageFactory serverstorage.StorageFactory
+	// FieldEnvelope decrypts encrypted fields, nil if field encryption is disabled.
+	FieldEnvelope *fieldencryption.Envelope
+}
+
+var _ fieldencryption.EnvelopeGetter = &StorageFactoryRestOptionsFactory{}
+
+func (f *StorageFactoryRestOptionsFactory) FieldEncryptionEnvelope() *fieldencryption.Envelope {
+	return f.FieldEnvelope
 }
 
 func (f *StorageFactoryRestOptionsFactory) GetRESTOptions(resource schema.GroupResource) (generic.RESTOptions, error) {
@@ -418,10 +485,26 @@ func (f *StorageFactoryRestOptionsFactory) GetRESTOptions(resource schema.GroupR
 			ret.Decorator = registry.StorageWithCacher()
 		}
 	}
+	ret.Decorator = storage.WithStorageDecorators(ret.Decorator, f.Options.storageDecorators()...)
 
 	return ret, nil
 }
 
+// storageDecorators returns the built-in decorators enabled by the options followed by the custom decorators.
+func (s *EtcdOptions) storageDecorators() []storage.Decorator {
+	var decorators []storage.Decorator
+	if s.EnableStorageTracing {
+		decorators = append(decorators, storage.WithTracing())
+	}
+	if s.EnableStorageLatencyMetrics {
+		decorators = append(decorators, storage.WithLatencyMetrics())
+	}
+	if s.StorageWriteQPS > 0 {
+		decorators = append(decorators, storage.WithWriteRateLimit(s.StorageWriteQPS, s.StorageWriteBurst))
+	}
+	return append(decorators, s.StorageDecorators...)
+}
+
 // ParseWatchCacheSizes turns a list of cache size values into a map of group resources
 // to requested sizes.
 func ParseWatchCacheSizes(cacheSizes []string) (map[schema.GroupResource]int, error) {
@@ -0,0 +1,193 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+// inProcessHost is the host of the in-process client config.  The requests never leave the process, so it's only
+// used to build the URLs.
+const inProcessHost = "http://kes.inprocess"
+
+// InProcessConfig returns a client config sending the requests straight to the handler chain of the
+// GenericAPIServer, without TLS, serialization over a connection or a listener.  The requests carry the bearer
+// token of the LoopbackClientConfig, so they're authenticated, authorized and admitted like any other request,
+// as the privileged loopback user unless the config impersonates another user.
+//
+// The config may be used with the generated clientset, e.g. versioned.NewForConfig(ws.InProcessConfig()), as
+// soon as New returns.
+func (ws *WardleServer) InProcessConfig() *restclient.Config {
+	cfg := &restclient.Config{}
+	if loopback := ws.GenericAPIServer.LoopbackClientConfig; loopback != nil {
+		cfg = restclient.CopyConfig(loopback)
+	}
+	cfg.Host = inProcessHost
+	// a custom transport can't be combined with TLS options
+	cfg.TLSClientConfig = restclient.TLSClientConfig{}
+	cfg.Dial = nil
+	cfg.Proxy = nil
+	cfg.WrapTransport = nil
+	cfg.Transport = &inProcessTransport{handler: ws.GenericAPIServer.Handler}
+	return cfg
+}
+
+// inProcessTransport is an http.RoundTripper serving the requests with a handler, in the process of the client.
+// The response is returned once the handler writes the status, and its body is streamed from the handler, so
+// that watches work as over a connection.
+type inProcessTransport struct {
+	handler http.Handler
+}
+
+var _ http.RoundTripper = &inProcessTransport{}
+
+func (t *inProcessTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	r := req.Clone(ctx)
+	r.RequestURI = req.URL.RequestURI()
+	r.RemoteAddr = "127.0.0.1:0"
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	if r.Host == "" {
+		r.Host = req.URL.Host
+	}
+
+	pr, pw := io.Pipe()
+	w := &inProcessResponseWriter{
+		header: http.Header{},
+		body:   pw,
+		ready:  make(chan struct{}),
+		done:   ctx.Done(),
+	}
+	go func() {
+		defer func() {
+			// the client has read the whole body, see io.Pipe
+			defer cancel()
+			if p := recover(); p != nil {
+				// like net/http, a panic aborts the response, e.g. http.ErrAbortHandler on timeouts
+				w.abort(fmt.Errorf("in-process handler panicked: %v", p))
+				_ = pw.CloseWithError(fmt.Errorf("in-process handler panicked: %v", p))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_ = pw.Close()
+		}()
+		t.handler.ServeHTTP(w, r)
+	}()
+
+	<-w.ready
+	if w.err != nil {
+		cancel()
+		return nil, w.err
+	}
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.sent,
+		Body:          &inProcessBody{PipeReader: pr, cancel: cancel},
+		ContentLength: -1,
+		Request:       req,
+	}
+	if length, err := strconv.ParseInt(w.sent.Get("Content-Length"), 10, 64); err == nil {
+		resp.ContentLength = length
+	}
+	return resp, nil
+}
+
+// inProcessBody cancels the request when the client closes the body, e.g. to stop a watch.
+type inProcessBody struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (b *inProcessBody) Close() error {
+	b.cancel()
+	return b.PipeReader.Close()
+}
+
+// inProcessResponseWriter writes the body of the response to a pipe read by the client.
+type inProcessResponseWriter struct {
+	header http.Header
+	body   *io.PipeWriter
+	done   <-chan struct{}
+
+	once   sync.Once
+	ready  chan struct{}
+	status int
+	sent   http.Header
+	err    error
+}
+
+var _ http.ResponseWriter = &inProcessResponseWriter{}
+var _ http.Flusher = &inProcessResponseWriter{}
+var _ http.CloseNotifier = &inProcessResponseWriter{}
+
+func (w *inProcessResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *inProcessResponseWriter) WriteHeader(status int) {
+	w.once.Do(func() {
+		w.status = status
+		w.sent = w.header.Clone()
+		close(w.ready)
+	})
+}
+
+func (w *inProcessResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// Flush sends the status to the client, the body is never buffered.
+func (w *inProcessResponseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+// CloseNotify implements http.CloseNotifier, still used by the handlers of the apiserver.
+func (w *inProcessResponseWriter) CloseNotify() <-chan bool {
+	closed := make(chan bool, 1)
+	go func() {
+		<-w.done
+		closed <- true
+	}()
+	return closed
+}
+
+// abort fails the request if the status wasn't sent yet.
+func (w *inProcessResponseWriter) abort(err error) {
+	w.once.Do(func() {
+		w.err = err
+		close(w.ready)
+	})
+}
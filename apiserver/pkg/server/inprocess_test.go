@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInProcessTransport(t *testing.T) {
+	t.Run("response", func(t *testing.T) {
+		transport := &inProcessTransport{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "/apis/sample.k8s.com/v1alpha1/flunders?limit=1", r.RequestURI)
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(body)
+		})}
+
+		req, _ := http.NewRequest(http.MethodPost, inProcessHost+"/apis/sample.k8s.com/v1alpha1/flunders?limit=1",
+			strings.NewReader(`{"kind":"Flunder"}`))
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"kind":"Flunder"}`, string(body))
+		assert.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("no body", func(t *testing.T) {
+		transport := &inProcessTransport{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+
+		req, _ := http.NewRequest(http.MethodGet, inProcessHost+"/healthz", nil)
+		resp, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Empty(t, body)
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		stopped := make(chan struct{})
+		transport := &inProcessTransport{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer close(stopped)
+			w.(http.Flusher).Flush()
+			for i := 0; ; i++ {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+				if _, err := w.Write([]byte("event\n")); err != nil {
+					return
+				}
+			}
+		})}
+
+		req, _ := http.NewRequest(http.MethodGet, inProcessHost+"/apis/sample.k8s.com/v1alpha1/flunders?watch=true", nil)
+		resp, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		lines := bufio.NewScanner(resp.Body)
+		for i := 0; i < 3; i++ {
+			assert.True(t, lines.Scan())
+			assert.Equal(t, "event", lines.Text())
+		}
+
+		// closing the body stops the handler
+		assert.NoError(t, resp.Body.Close())
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the handler wasn't stopped")
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		transport := &inProcessTransport{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})}
+
+		req, _ := http.NewRequest(http.MethodGet, inProcessHost+"/healthz", nil)
+		_, err := transport.RoundTrip(req)
+		assert.ErrorContains(t, err, "panicked")
+	})
+}
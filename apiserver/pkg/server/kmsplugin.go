@@ -0,0 +1,163 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+	kmsservice "k8s.io/kms/pkg/service"
+
+	"github.com/vine-io/kes/apiserver/pkg/kmsplugin"
+)
+
+// KMSPluginOptions contains the options of the kms-plugin command.
+type KMSPluginOptions struct {
+	// ListenAddr is the unix socket the plugin listens on, with or without the unix:// scheme.
+	ListenAddr     string
+	KeyFile        string
+	Timeout        time.Duration
+	ReloadInterval time.Duration
+}
+
+// NewCommandKMSPlugin returns the command running the local KMS v2 plugin.
+func NewCommandKMSPlugin(out io.Writer, stopCh <-chan struct{}) *cobra.Command {
+	o := &KMSPluginOptions{
+		ListenAddr:     "unix:///tmp/kes-kms.sock",
+		Timeout:        3 * time.Second,
+		ReloadInterval: time.Minute,
+	}
+	cmd := &cobra.Command{
+		Use:   "kms-plugin",
+		Short: "Run a local KMS v2 plugin for encryption at rest",
+		Long: "Serve the KMS v2 API on a unix socket, wrapping data encryption keys with the AES keys of --key-file. " +
+			"Point a kms provider of --encryption-provider-config with apiVersion v2 at --listen-addr to use it.",
+		RunE: func(c *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				select {
+				case <-stopCh:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			return o.Run(ctx)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&o.ListenAddr, "listen-addr", o.ListenAddr, "The unix socket to serve the KMS v2 API on.")
+	flags.StringVar(&o.KeyFile, "key-file", o.KeyFile, "The file containing the key encryption keys, the first key is the primary key.")
+	flags.DurationVar(&o.Timeout, "timeout", o.Timeout, "The gRPC connection timeout.")
+	flags.DurationVar(&o.ReloadInterval, "reload-interval", o.ReloadInterval, "How often the key file is checked for rotated keys.")
+
+	cmd.AddCommand(newCommandKMSPluginRotate(out))
+	return cmd
+}
+
+func newCommandKMSPluginRotate(out io.Writer) *cobra.Command {
+	var keyFile, name string
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Add a new primary key to the KMS plugin key file",
+		Long: "Generate a new key and add it as the primary key of --key-file, creating the file if it does not exist. " +
+			"Older keys are kept for decryption.",
+		RunE: func(c *cobra.Command, args []string) error {
+			if keyFile == "" {
+				return fmt.Errorf("--key-file must be specified")
+			}
+			name, err := kmsplugin.RotateKeyFile(keyFile, name)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "added primary key %q to %s\n", name, keyFile)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&keyFile, "key-file", keyFile, "The key file to add the key to.")
+	cmd.Flags().StringVar(&name, "name", name, "The name of the new key, defaults to a name based on the current time.")
+	return cmd
+}
+
+// Validate validates KMSPluginOptions
+func (o *KMSPluginOptions) Validate() error {
+	if o.KeyFile == "" {
+		return fmt.Errorf("--key-file must be specified")
+	}
+	if o.socketPath() == "" {
+		return fmt.Errorf("--listen-addr must be specified")
+	}
+	if o.ReloadInterval <= 0 {
+		return fmt.Errorf("--reload-interval must be positive")
+	}
+	return nil
+}
+
+func (o *KMSPluginOptions) socketPath() string {
+	return strings.TrimPrefix(o.ListenAddr, "unix://")
+}
+
+// Run serves the plugin until ctx is done.
+func (o *KMSPluginOptions) Run(ctx context.Context) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	svc, err := kmsplugin.NewService(o.KeyFile)
+	if err != nil {
+		return err
+	}
+	go svc.Run(ctx, o.ReloadInterval)
+
+	socket := o.socketPath()
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return err
+	}
+	// remove the socket left behind by a previous run
+	if err := os.Remove(socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	server := kmsservice.NewGRPCService(socket, o.Timeout, svc)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+	klog.InfoS("KMS plugin listening", "addr", o.ListenAddr, "keyFile", o.KeyFile)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		server.Shutdown()
+		return nil
+	}
+}
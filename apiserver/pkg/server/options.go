@@ -20,24 +20,57 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"time"
 
 	"github.com/spf13/cobra"
+	apiextensionsv1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
 	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/etcd"
 	generatedOpenapi "github.com/vine-io/kes/apiserver/pkg/generated/openapi"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
 	"k8s.io/apiserver/pkg/endpoints/openapi"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
 )
 
 // change: apiserver-runtime
 //const defaultEtcdPathPrefix = "/registry/wardle.example.com"
 
+// defaultShutdownWatchTerminationGracePeriod is the default time the server waits for its watches to drain.
+const defaultShutdownWatchTerminationGracePeriod = 10 * time.Second
+
 // WardleServerOptions contains state for master/api server
+//
+// The server configures neither authentication nor authorization: every request is allowed by an always-allow
+// authorizer, which some handlers require, e.g. server-side apply creating an object.
 type WardleServerOptions struct {
 	RecommendedOptions *RecommendedOptions
 
+	// Resources are the resources served in addition to the ResourceDefinitions, the sample resources by
+	// default.  Their group versions are stored by the storage codec.
+	Resources []resource.Object
+	// OpenAPIDefinitions returns the definitions of the Resources, unless generated along with the definitions
+	// of kes.
+	OpenAPIDefinitions openapicommon.GetOpenAPIDefinitions
+	// ServerFns are applied to the server by RunWardleServer before it runs, e.g. to register the controllers
+	// of a controller.Manager.
+	ServerFns []func(ws *WardleServer) error
+	// EmbeddedEtcd is the config of the etcd started along with the server, storing its data in "_output" by
+	// default, and serving its metrics on the /metrics endpoint of the server.  The server uses the etcd of
+	// --etcd-servers only if nil.
+	EmbeddedEtcd *etcd.Config
+
+	// ShutdownDelayDuration is the time the server keeps serving requests once it's asked to stop, e.g. for the
+	// load balancers to stop sending it requests.
+	ShutdownDelayDuration time.Duration
+	// ShutdownWatchTerminationGracePeriod is the time the server waits for its watches to drain on shutdown, before
+	// its storage is released.  The watches end right away, the grace period paces the clients reconnecting.
+	ShutdownWatchTerminationGracePeriod time.Duration
+
 	StdOut io.Writer
 	StdErr io.Writer
 }
@@ -46,13 +79,20 @@ type WardleServerOptions struct {
 func NewWardleServerOptions(out, errOut io.Writer) *WardleServerOptions {
 	// change: apiserver-runtime
 
+	embeddedEtcd := etcd.NewConfig()
+	embeddedEtcd.Dir = "_output"
+
 	o := &WardleServerOptions{
+		Resources:    append([]resource.Object{}, v1alpha1.ResourceBuilder...),
+		EmbeddedEtcd: embeddedEtcd,
+
+		ShutdownWatchTerminationGracePeriod: defaultShutdownWatchTerminationGracePeriod,
 
 		StdOut: out,
 		StdErr: errOut,
 	}
 
-	versions := []schema.GroupVersion{v1alpha1.SchemeGroupVersion}
+	versions := o.groupVersions()
 	o.RecommendedOptions = NewRecommendedOptions(
 		getEctdPath(),
 		Codecs.LegacyCodec(versions...),
@@ -70,10 +110,31 @@ func NewWardleServerOptions(out, errOut io.Writer) *WardleServerOptions {
 	return o
 }
 
+// groupVersions returns the group versions of the Resources followed by the group version of the
+// ResourceDefinitions.
+func (o *WardleServerOptions) groupVersions() []schema.GroupVersion {
+	var versions []schema.GroupVersion
+	seen := map[schema.GroupVersion]bool{}
+	for _, obj := range append(o.Resources, &apiextensionsv1alpha1.ResourceDefinition{}) {
+		gv := obj.GetGroupVersionResource().GroupVersion()
+		if !seen[gv] {
+			seen[gv] = true
+			versions = append(versions, gv)
+		}
+	}
+	return versions
+}
+
 // Validate validates WardleServerOptions
 func (o WardleServerOptions) Validate(args []string) error {
 	errors := make([]error, 0)
 	errors = append(errors, o.RecommendedOptions.Validate()...)
+	if o.ShutdownDelayDuration < 0 {
+		errors = append(errors, fmt.Errorf("--shutdown-delay-duration can not be negative value"))
+	}
+	if o.ShutdownWatchTerminationGracePeriod < 0 {
+		errors = append(errors, fmt.Errorf("--shutdown-watch-termination-grace-period can not be negative value"))
+	}
 	return utilerrors.NewAggregate(errors)
 }
 
@@ -94,6 +155,11 @@ func (o *WardleServerOptions) Config() (*Config, error) {
 	// TODO: this should be reverted after rebasing sample-apiserver onto https://github.com/kubernetes/kubernetes/pull/101106
 	if o.RecommendedOptions.Etcd != nil {
 		//o.RecommendedOptions.Etcd.StorageConfig.Paging = utilfeature.DefaultFeatureGate.Enabled(features.APIListChunking)
+
+		// the Resources may have changed since the options were created
+		versions := o.groupVersions()
+		o.RecommendedOptions.Etcd.StorageConfig.Codec = Codecs.LegacyCodec(versions...)
+		o.RecommendedOptions.Etcd.StorageConfig.EncodeVersioner = schema.GroupVersions(versions)
 	}
 
 	serverConfig := genericapiserver.NewRecommendedConfig(Codecs)
@@ -103,6 +169,13 @@ func (o *WardleServerOptions) Config() (*Config, error) {
 	if err := o.RecommendedOptions.ApplyTo(serverConfig); err != nil {
 		return nil, err
 	}
+	// authorization isn't configured, so unconfigured authorization means always-allow: set the authorizer
+	// explicitly, as the handlers refuse some requests without one, e.g. server-side apply creating an object
+	if serverConfig.Authorization.Authorizer == nil {
+		serverConfig.Authorization.Authorizer = authorizerfactory.NewAlwaysAllowAuthorizer()
+	}
+	serverConfig.ShutdownDelayDuration = o.ShutdownDelayDuration
+	serverConfig.ShutdownWatchTerminationGracePeriod = o.ShutdownWatchTerminationGracePeriod
 
 	name, version, defs := "sample", "v1.0.0", generatedOpenapi.GetOpenAPIDefinitions
 	serverConfig.OpenAPIV3Config = genericapiserver.DefaultOpenAPIV3Config(defs, openapi.NewDefinitionNamer(Scheme))
@@ -117,21 +190,30 @@ func (o *WardleServerOptions) Config() (*Config, error) {
 
 	config := &Config{
 		GenericConfig: serverConfig,
-		ExtraConfig:   ExtraConfig{},
+		ExtraConfig: ExtraConfig{
+			Resources:          o.Resources,
+			OpenAPIDefinitions: o.OpenAPIDefinitions,
+			EmbeddedEtcd:       o.EmbeddedEtcd,
+		},
 	}
 	return config, nil
 }
 
-// RunWardleServer starts a new WardleServer given WardleServerOptions
-func (o WardleServerOptions) RunWardleServer(stopCh <-chan struct{}) error {
+// NewServer returns the WardleServer configured by the WardleServerOptions, with the ServerFns applied.
+func (o WardleServerOptions) NewServer() (*WardleServer, error) {
 	config, err := o.Config()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	wardleServer, err := config.Complete().New()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for _, fn := range o.ServerFns {
+		if err := fn(wardleServer); err != nil {
+			return nil, err
+		}
 	}
 
 	wardleServer.GenericAPIServer.AddPostStartHookOrDie("start-sample-server-informers", func(context genericapiserver.PostStartHookContext) error {
@@ -141,7 +223,21 @@ func (o WardleServerOptions) RunWardleServer(stopCh <-chan struct{}) error {
 		return nil
 	})
 
-	return wardleServer.GenericAPIServer.PrepareRun().Run(stopCh)
+	return wardleServer, nil
+}
+
+// RunWardleServer starts a new WardleServer given WardleServerOptions
+func (o WardleServerOptions) RunWardleServer(stopCh <-chan struct{}) error {
+	wardleServer, err := o.NewServer()
+	if err != nil {
+		return err
+	}
+
+	stopCh, embeddedEtcdFailure := wardleServer.stopOnEmbeddedEtcdFailure(stopCh)
+	if err := wardleServer.GenericAPIServer.PrepareRun().Run(stopCh); err != nil {
+		return err
+	}
+	return embeddedEtcdFailure()
 }
 
 // NewCommandStartWardleServer provides a CLI handler for 'start master' command
@@ -165,6 +261,13 @@ func NewCommandStartWardleServer(o *WardleServerOptions, stopCh <-chan struct{})
 
 	flags := cmd.Flags()
 	o.RecommendedOptions.AddFlags(flags)
+	flags.DurationVar(&o.ShutdownDelayDuration, "shutdown-delay-duration", o.ShutdownDelayDuration, ""+
+		"Time to delay the termination. During that time the server keeps serving requests normally. The endpoint "+
+		"/readyz fails meanwhile, so that the load balancers stop sending it requests.")
+	flags.DurationVar(&o.ShutdownWatchTerminationGracePeriod, "shutdown-watch-termination-grace-period",
+		o.ShutdownWatchTerminationGracePeriod, ""+
+			"Time the server waits for the active watches to drain on shutdown, before releasing its storage and "+
+			"closing the embedded etcd. Zero doesn't wait for them.")
 	utilfeature.DefaultMutableFeatureGate.AddFlag(flags)
 
 	return cmd
@@ -113,9 +113,9 @@ func (o *RecommendedOptions) ApplyTo(config *server.RecommendedConfig) error {
 	//if err := o.Authorization.ApplyTo(&config.Config.Authorization); err != nil {
 	//	return err
 	//}
-	//if err := o.Audit.ApplyTo(&config.Config); err != nil {
-	//	return err
-	//}
+	if err := o.Audit.ApplyTo(&config.Config); err != nil {
+		return err
+	}
 	//if err := o.CoreAPI.ApplyTo(config); err != nil {
 	//	return err
 	//}
@@ -0,0 +1,144 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+)
+
+// ReencryptOptions contains the options of the reencrypt command.
+type ReencryptOptions struct {
+	Kubeconfig string
+	Master     string
+	// Resources lists the resources to rewrite in the resource.version.group format.
+	Resources []string
+
+	StdOut io.Writer
+}
+
+// NewCommandReencrypt returns the command rewriting every object of the given resources, so that fields encrypted
+// with a rotated out key are re-encrypted with the primary key of --field-encryption-key-file.
+func NewCommandReencrypt(out io.Writer, stopCh <-chan struct{}) *cobra.Command {
+	o := &ReencryptOptions{StdOut: out}
+	cmd := &cobra.Command{
+		Use:   "reencrypt",
+		Short: "Re-encrypt encrypted fields with the primary key",
+		Long: "Rewrite every object of the given resources so that fields encrypted with an older key " +
+			"are re-encrypted with the primary key of the running apiserver. Once the command succeeds " +
+			"older keys may be removed from the field encryption key file.",
+		RunE: func(c *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				select {
+				case <-stopCh:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			return o.Run(ctx)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "Path to the kubeconfig file of the apiserver.")
+	flags.StringVar(&o.Master, "master", o.Master, "The address of the apiserver, overrides any value in kubeconfig.")
+	flags.StringSliceVar(&o.Resources, "resources", o.Resources,
+		"The resources to re-encrypt in the resource.version.group format, e.g. flunders.v1alpha1.sample.k8s.com")
+
+	return cmd
+}
+
+// Run rewrites every object of the resources.
+func (o *ReencryptOptions) Run(ctx context.Context) error {
+	if len(o.Resources) == 0 {
+		return fmt.Errorf("--resources must be specified")
+	}
+	gvrs := make([]schema.GroupVersionResource, 0, len(o.Resources))
+	for _, r := range o.Resources {
+		gvr, _ := schema.ParseResourceArg(r)
+		if gvr == nil {
+			return fmt.Errorf("invalid resource %q, must be of format resource.version.group", r)
+		}
+		gvrs = append(gvrs, *gvr)
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags(o.Master, o.Kubeconfig)
+	if err != nil {
+		return err
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, gvr := range gvrs {
+		count, err := o.reencrypt(ctx, client.Resource(gvr))
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt %s: %w", gvr.GroupResource(), err)
+		}
+		fmt.Fprintf(o.StdOut, "%s: re-encrypted %d objects\n", gvr.GroupResource(), count)
+	}
+	return nil
+}
+
+func (o *ReencryptOptions) reencrypt(ctx context.Context, client dynamic.NamespaceableResourceInterface) (int, error) {
+	list, err := client.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := range list.Items {
+		item := &list.Items[i]
+		ri := dynamic.ResourceInterface(client)
+		if ns := item.GetNamespace(); ns != "" {
+			ri = client.Namespace(ns)
+		}
+		// writing the object back is enough, the apiserver re-encrypts values of older keys on every write
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			obj, err := ri.Get(ctx, item.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			_, err = ri.Update(ctx, obj, metav1.UpdateOptions{})
+			return err
+		})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return count, fmt.Errorf("%s/%s: %w", item.GetNamespace(), item.GetName(), err)
+		}
+		count++
+	}
+	return count, nil
+}
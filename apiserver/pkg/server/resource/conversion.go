@@ -0,0 +1,214 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Hub marks the version of a resource that all other versions of the resource convert through, the same as the
+// hub of a conversion webhook.  The hub is usually the storage version.
+type Hub interface {
+	Object
+	// Hub is a marker method.
+	Hub()
+}
+
+// Convertible is implemented by the versions of a resource other than its Hub, called spokes.  A spoke only
+// converts to and from the hub, conversions between spokes go through the hub.
+type Convertible interface {
+	Object
+	// ConvertTo overwrites hub with the equal form of the spoke.
+	ConvertTo(hub Hub) error
+	// ConvertFrom overwrites the spoke with the equal form of hub.
+	ConvertFrom(hub Hub) error
+}
+
+// HubVersions describes the versions of a kind converting through a hub.
+type HubVersions struct {
+	GroupKind schema.GroupKind
+	// Hub is the type of the hub.
+	Hub reflect.Type
+	// Spokes are the types of the versions other than the hub, by version.
+	Spokes map[string]reflect.Type
+}
+
+// DiscoverHubVersions returns the kinds registered in s with a Hub, sorted by group and kind.  It fails if a kind
+// has several hubs, or spokes not implementing Convertible.
+func DiscoverHubVersions(s *runtime.Scheme) ([]HubVersions, error) {
+	types := map[schema.GroupKind]map[string]reflect.Type{}
+	for gvk, t := range s.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal {
+			continue
+		}
+		if types[gvk.GroupKind()] == nil {
+			types[gvk.GroupKind()] = map[string]reflect.Type{}
+		}
+		types[gvk.GroupKind()][gvk.Version] = t
+	}
+
+	var hubs []HubVersions
+	for gk, versions := range types {
+		hv := HubVersions{GroupKind: gk, Spokes: map[string]reflect.Type{}}
+		for version, t := range versions {
+			if _, ok := reflect.New(t).Interface().(Hub); ok {
+				if hv.Hub != nil && hv.Hub != t {
+					return nil, fmt.Errorf("%v has several hubs: %v and %v", gk, hv.Hub, t)
+				}
+				hv.Hub = t
+				continue
+			}
+			hv.Spokes[version] = t
+		}
+		if hv.Hub == nil {
+			continue
+		}
+		for version, t := range hv.Spokes {
+			if t == hv.Hub {
+				// e.g. the hub served under several versions
+				delete(hv.Spokes, version)
+				continue
+			}
+			if _, ok := reflect.New(t).Interface().(Convertible); !ok {
+				return nil, fmt.Errorf("version %v of %v must implement resource.Convertible to convert through the hub %v", version, gk, hv.Hub)
+			}
+		}
+		hubs = append(hubs, hv)
+	}
+	sort.Slice(hubs, func(i, j int) bool {
+		return hubs[i].GroupKind.String() < hubs[j].GroupKind.String()
+	})
+	return hubs, nil
+}
+
+// AddHubConversionsToScheme registers the conversions between every pair of versions of the kinds with a Hub
+// registered in s, and between their lists.  It must be added to the scheme after the resources.
+func AddHubConversionsToScheme(s *runtime.Scheme) error {
+	hubs, err := DiscoverHubVersions(s)
+	if err != nil {
+		return err
+	}
+	for _, hv := range hubs {
+		versions := []reflect.Type{hv.Hub}
+		for _, t := range hv.Spokes {
+			versions = append(versions, t)
+		}
+		for _, from := range versions {
+			for _, to := range versions {
+				if from == to {
+					continue
+				}
+				if err := s.AddConversionFunc(reflect.New(from).Interface(), reflect.New(to).Interface(), hv.convert); err != nil {
+					return err
+				}
+			}
+		}
+		if err := addListConversions(s, hv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convert converts a version of the kind to another through the hub.
+func (hv HubVersions) convert(from, to interface{}, _ conversion.Scope) error {
+	hub, ok := from.(Hub)
+	if !ok {
+		hub = reflect.New(hv.Hub).Interface().(Hub)
+		if err := from.(Convertible).ConvertTo(hub); err != nil {
+			return err
+		}
+	}
+	if reflect.TypeOf(to).Elem() == hv.Hub {
+		reflect.ValueOf(to).Elem().Set(reflect.ValueOf(hub).Elem())
+		return nil
+	}
+	return to.(Convertible).ConvertFrom(hub)
+}
+
+// addListConversions registers the conversions between the lists of every pair of versions of the kind.  Lists
+// are found by their kind, e.g. FooList for Foo.
+func addListConversions(s *runtime.Scheme, hv HubVersions) error {
+	listKind := hv.GroupKind.Kind + "List"
+	var lists []reflect.Type
+	for gvk, t := range s.AllKnownTypes() {
+		if gvk.Group == hv.GroupKind.Group && gvk.Kind == listKind && gvk.Version != runtime.APIVersionInternal {
+			lists = append(lists, t)
+		}
+	}
+	for _, from := range lists {
+		for _, to := range lists {
+			if from == to {
+				continue
+			}
+			if err := s.AddConversionFunc(reflect.New(from).Interface(), reflect.New(to).Interface(), func(in, out interface{}, _ conversion.Scope) error {
+				return convertList(s, in.(runtime.Object), out.(runtime.Object))
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// convertList converts the list meta and each item of in to out.
+func convertList(s *runtime.Scheme, in, out runtime.Object) error {
+	inList, err := meta.ListAccessor(in)
+	if err != nil {
+		return err
+	}
+	outList, err := meta.ListAccessor(out)
+	if err != nil {
+		return err
+	}
+	outList.SetResourceVersion(inList.GetResourceVersion())
+	outList.SetContinue(inList.GetContinue())
+	outList.SetRemainingItemCount(inList.GetRemainingItemCount())
+	outList.SetSelfLink(inList.GetSelfLink())
+
+	items, err := meta.ExtractList(in)
+	if err != nil {
+		return err
+	}
+	itemsPtr, err := meta.GetItemsPtr(out)
+	if err != nil {
+		return err
+	}
+	itemType := reflect.TypeOf(itemsPtr).Elem().Elem()
+	converted := make([]runtime.Object, 0, len(items))
+	for _, item := range items {
+		outItem := reflect.New(itemType).Interface().(runtime.Object)
+		if err := s.Convert(item, outItem, nil); err != nil {
+			return fmt.Errorf("converting %s: %w", strings.TrimPrefix(reflect.TypeOf(item).String(), "*"), err)
+		}
+		converted = append(converted, outItem)
+	}
+	return meta.SetList(out, converted)
+}
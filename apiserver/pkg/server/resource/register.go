@@ -18,6 +18,7 @@ import (
 // AddToScheme will also register the objects under the "__internal" group version for each object that
 // returns true for IsInternalVersion.
 // AddToScheme will register the defaulting function if it implements the Defaulter inteface.
+// Versions implementing Convertible are converted through their Hub, see AddHubConversionsToScheme.
 func AddToScheme(objs ...Object) func(s *runtime.Scheme) error {
 	return func(s *runtime.Scheme) error {
 		for i := range objs {
@@ -28,10 +29,12 @@ func AddToScheme(objs ...Object) func(s *runtime.Scheme) error {
 					Group:   obj.GetGroupVersionResource().Group,
 					Version: runtime.APIVersionInternal,
 				}, obj.New(), obj.NewList())
+			} else if _, ok := obj.(Convertible); ok {
+				// conversions through the hub are registered by AddHubConversionsToScheme
 			} else {
 				multiVersionObj, ok := obj.(MultiVersionObject)
 				if !ok {
-					return fmt.Errorf("resource should implement MultiVersionObject if it's not storage-version")
+					return fmt.Errorf("resource should implement MultiVersionObject or Convertible if it's not storage-version")
 				}
 				// registering conversion functions to scheme instance
 				storageVersionObj := multiVersionObj.NewStorageVersionObject()
@@ -57,7 +60,9 @@ func AddToScheme(objs ...Object) func(s *runtime.Scheme) error {
 					s.AddKnownTypes(obj.GetGroupVersionResource().GroupVersion(), statusObj)
 				}
 			}
-			if _, ok := obj.(ObjectWithScaleSubResource); ok {
+			_, hasScale := obj.(ObjectWithScaleSubResource)
+			_, hasScalePaths := obj.(ObjectWithScalePaths)
+			if hasScale || hasScalePaths {
 				if !s.Recognizes(autoscalingv1.SchemeGroupVersion.WithKind("Scale")) {
 					if err := autoscalingv1.AddToScheme(s); err != nil {
 						return err
@@ -78,3 +83,13 @@ func AddToScheme(objs ...Object) func(s *runtime.Scheme) error {
 		return nil
 	}
 }
+
+// Builder collects the resources of an API package, like runtime.SchemeBuilder collects the functions adding
+// types to a scheme.  apiserver-runtime-gen generates the ResourceBuilder of a package and registers the types
+// marked with +kes:resource with it.
+type Builder []Object
+
+// Register adds the resources to the builder.
+func (b *Builder) Register(objs ...Object) {
+	*b = append(*b, objs...)
+}
@@ -50,6 +50,8 @@ type Canonicalizer interface {
 // Converter functions are called to convert the request version of the object to the handler version --
 // e.g. if a v1beta1 object is created, and the handler uses a v1alpha1 version, then the v1beta1 will be converted
 // to a v1alpha1 before the handler is called.
+//
+// Deprecated: implement resource.Hub on the storage version and resource.Convertible on the other versions.
 type Converter interface {
 	// ConvertFromInternal converts an internal version of the object to this object's version
 	ConvertFromInternal(internal interface{})
@@ -98,3 +100,47 @@ type Validater interface {
 type ValidateUpdater interface {
 	ValidateUpdate(ctx context.Context, obj runtime.Object) field.ErrorList
 }
+
+// FinishFunc is returned by BeginCreater and BeginUpdater to complete the operation.  success is true
+// if the object was written to storage, and false if the write failed or was rejected and any
+// side effects of the Begin hook should be rolled back.
+type FinishFunc func(ctx context.Context, success bool)
+
+// BeginCreater functions are invoked after an object has been validated but before it is written to storage
+// during creation.  Returning an error aborts the create.  The returned FinishFunc is always invoked once the
+// write completes, and before AfterCreate.
+//
+// BeginCreater is only invoked for the type that is the storage version type.
+type BeginCreater interface {
+	BeginCreate(ctx context.Context, options *metav1.CreateOptions) (FinishFunc, error)
+}
+
+// AfterCreater functions are invoked on the stored object after it has been successfully created.
+//
+// AfterCreater is only invoked for the type that is the storage version type.
+type AfterCreater interface {
+	AfterCreate(options *metav1.CreateOptions)
+}
+
+// BeginUpdater functions are invoked after an object has been validated but before it is written to storage
+// during update.  old is the object currently in storage.  Returning an error aborts the update.  The returned
+// FinishFunc is always invoked once the write completes, and before AfterUpdate.
+//
+// BeginUpdater is only invoked for the type that is the storage version type.
+type BeginUpdater interface {
+	BeginUpdate(ctx context.Context, old runtime.Object, options *metav1.UpdateOptions) (FinishFunc, error)
+}
+
+// AfterUpdater functions are invoked on the stored object after it has been successfully updated.
+//
+// AfterUpdater is only invoked for the type that is the storage version type.
+type AfterUpdater interface {
+	AfterUpdate(options *metav1.UpdateOptions)
+}
+
+// AfterDeleter functions are invoked on the deleted object after it has been removed from storage.
+//
+// AfterDeleter is only invoked for the type that is the storage version type.
+type AfterDeleter interface {
+	AfterDelete(options *metav1.DeleteOptions)
+}
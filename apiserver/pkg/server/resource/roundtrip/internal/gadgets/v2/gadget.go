@@ -0,0 +1,70 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package v2 is the hub version of the gadgets of the roundtrip tests.
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Gadget is the hub.
+type Gadget struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+	Size  int
+	Color string
+}
+
+func (g *Gadget) Hub() {}
+
+func (g *Gadget) DeepCopyObject() runtime.Object {
+	out := *g
+	g.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+func (g *Gadget) GetObjectMeta() *metav1.ObjectMeta { return &g.ObjectMeta }
+func (g *Gadget) NamespaceScoped() bool             { return true }
+func (g *Gadget) New() runtime.Object               { return &Gadget{} }
+func (g *Gadget) NewList() runtime.Object           { return &GadgetList{} }
+func (g *Gadget) IsStorageVersion() bool            { return true }
+
+func (g *Gadget) GetGroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: "test.kes.io", Version: "v2", Resource: "gadgets"}
+}
+
+type GadgetList struct {
+	metav1.TypeMeta
+	metav1.ListMeta
+	Items []Gadget
+}
+
+func (l *GadgetList) DeepCopyObject() runtime.Object {
+	out := &GadgetList{TypeMeta: l.TypeMeta}
+	l.ListMeta.DeepCopyInto(&out.ListMeta)
+	for i := range l.Items {
+		out.Items = append(out.Items, *l.Items[i].DeepCopyObject().(*Gadget))
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package roundtrip tests the conversions of resources converting through a hub.
+package roundtrip
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+// DefaultIterations is the number of objects fuzzed for each spoke.
+const DefaultIterations = 20
+
+// RoundTripTestForScheme fuzzes every spoke of the kinds with a resource.Hub registered in scheme, converts it
+// to the hub and back and fails t if the result differs from the fuzzed object.  The conversions must have been
+// registered with resource.AddHubConversionsToScheme.  fuzzingFuncs are added to the fuzzer functions of the
+// object meta, e.g. to fill fields a spoke can't represent in the hub.
+func RoundTripTestForScheme(t *testing.T, scheme *runtime.Scheme, fuzzingFuncs ...fuzzer.FuzzerFuncs) {
+	t.Helper()
+
+	hubs, err := resource.DiscoverHubVersions(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hubs) == 0 {
+		t.Fatal("no kind with a hub is registered in the scheme")
+	}
+
+	seed := rand.Int63()
+	funcs := fuzzer.MergeFuzzerFuncs(append([]fuzzer.FuzzerFuncs{metafuzzer.Funcs}, fuzzingFuncs...)...)
+	f := fuzzer.FuzzerFor(funcs, rand.NewSource(seed), serializer.NewCodecFactory(scheme))
+	for _, hv := range hubs {
+		for version, spoke := range hv.Spokes {
+			t.Run(hv.GroupKind.WithVersion(version).String(), func(t *testing.T) {
+				for i := 0; i < DefaultIterations; i++ {
+					roundTrip(t, scheme, f, spoke, hv.Hub, seed)
+				}
+			})
+		}
+	}
+}
+
+// roundTrip converts a fuzzed spoke to hub and back.
+func roundTrip(t *testing.T, scheme *runtime.Scheme, f *fuzz.Fuzzer, spoke, hub reflect.Type, seed int64) {
+	t.Helper()
+
+	original := reflect.New(spoke).Interface().(runtime.Object)
+	f.Fuzz(original)
+	// the kind is set by the serializer, not by conversions
+	original.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+
+	in := original.DeepCopyObject()
+	h := reflect.New(hub).Interface()
+	if err := scheme.Convert(in, h, nil); err != nil {
+		t.Fatalf("converting %v to the hub %v (seed %d): %v", spoke, hub, seed, err)
+	}
+	out := reflect.New(spoke).Interface().(runtime.Object)
+	if err := scheme.Convert(h, out, nil); err != nil {
+		t.Fatalf("converting the hub %v to %v (seed %d): %v", hub, spoke, seed, err)
+	}
+	out.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+
+	if !apiequality.Semantic.DeepEqual(original, in) {
+		t.Fatalf("converting %v to the hub mutated the input (seed %d):\n%s", spoke, seed, cmp.Diff(original, in))
+	}
+	if !apiequality.Semantic.DeepEqual(original, out) {
+		t.Fatalf("%v changed through the hub %v (seed %d):\n%s", spoke, hub, seed, cmp.Diff(original, out))
+	}
+}
@@ -0,0 +1,73 @@
+package roundtrip
+
+import (
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+	v1 "github.com/vine-io/kes/apiserver/pkg/server/resource/roundtrip/internal/gadgets/v1"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource/roundtrip/internal/gadgets/v1beta1"
+	v2 "github.com/vine-io/kes/apiserver/pkg/server/resource/roundtrip/internal/gadgets/v2"
+)
+
+func TestRoundTripTestForScheme(t *testing.T) {
+	RoundTripTestForScheme(t, newScheme(t), func(_ runtimeserializer.CodecFactory) []interface{} {
+		return []interface{}{
+			func(g *v1beta1.Gadget, c fuzz.Continue) {
+				c.FuzzNoCustom(g)
+				g.Dimensions = []int{c.Int()}
+			},
+		}
+	})
+}
+
+func TestAddHubConversionsToScheme(t *testing.T) {
+	scheme := newScheme(t)
+
+	t.Run("spokes should convert to each other through the hub", func(t *testing.T) {
+		in := &v1.Gadget{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Size: 3, Colour: "red"}
+		out := &v1beta1.Gadget{}
+		assert.NoError(t, scheme.Convert(in, out, nil))
+		assert.Equal(t, &v1beta1.Gadget{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Dimensions: []int{3}, Colour: "red"}, out)
+	})
+	t.Run("storage version should convert through the internal version", func(t *testing.T) {
+		in := &v1.Gadget{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Size: 3, Colour: "red"}
+		out, err := scheme.ConvertToVersion(in, schema.GroupVersion{Group: "test.kes.io", Version: runtime.APIVersionInternal})
+		assert.NoError(t, err)
+		assert.Equal(t, &v2.Gadget{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Size: 3, Color: "red"}, out)
+	})
+	t.Run("lists should convert item by item", func(t *testing.T) {
+		in := &v2.GadgetList{
+			ListMeta: metav1.ListMeta{ResourceVersion: "7"},
+			Items:    []v2.Gadget{{Size: 1, Color: "blue"}, {Size: 2}},
+		}
+		out := &v1.GadgetList{}
+		assert.NoError(t, scheme.Convert(in, out, nil))
+		assert.Equal(t, "7", out.ResourceVersion)
+		assert.Equal(t, []v1.Gadget{{Size: 1, Colour: "blue"}, {Size: 2}}, out.Items)
+	})
+	t.Run("spoke without Convertible should be rejected", func(t *testing.T) {
+		scheme := runtime.NewScheme()
+		scheme.AddKnownTypeWithName(gadgetGV("v2").WithKind("Gadget"), &v2.Gadget{})
+		scheme.AddKnownTypeWithName(gadgetGV("v1").WithKind("Gadget"), &metav1.Status{})
+		assert.Error(t, resource.AddHubConversionsToScheme(scheme))
+	})
+}
+
+// newScheme registers the gadgets with resource.AddToScheme and their conversions through the hub.
+func newScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, resource.AddToScheme(&v2.Gadget{}, &v1.Gadget{}, &v1beta1.Gadget{})(scheme))
+	assert.NoError(t, resource.AddHubConversionsToScheme(scheme))
+	return scheme
+}
+
+func gadgetGV(version string) schema.GroupVersion {
+	return schema.GroupVersion{Group: "test.kes.io", Version: version}
+}
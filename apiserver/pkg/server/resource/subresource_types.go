@@ -17,17 +17,22 @@ limitations under the License.
 package resource
 
 import (
+	"context"
 	"net/url"
 
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/kube-openapi/pkg/common"
 
 	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcerest"
 )
 
 // SubResource defines interface for registering arbitrary subresource to the parent resource.
 type SubResource interface {
+	// SubResourceName returns the name of the subresource, e.g. "status" for the path
+	// /apis/group/version/resources/name/status.
 	SubResourceName() string
-	// TODO: fill the details for this interface.
 }
 
 // StatusSubResource defines required methods for implementing a status subresource.
@@ -61,3 +66,73 @@ type GetterUpdaterSubResource interface {
 type QueryParameterObject interface {
 	ConvertFromUrlValues(values *url.Values) error
 }
+
+// SubResourceVerb is a verb served by a TypedSubResource.
+type SubResourceVerb string
+
+const (
+	// SubResourceGet serves GET requests with the object returned by SubResourceGetter.
+	SubResourceGet SubResourceVerb = "get"
+	// SubResourceUpdate serves PUT requests with SubResourceUpdater.  Requires SubResourceGet.
+	SubResourceUpdate SubResourceVerb = "update"
+	// SubResourcePatch serves PATCH requests with SubResourceUpdater.  The apiserver serves patch whenever
+	// update is served and vice versa, so both verbs have the same effect.  Requires SubResourceGet.
+	SubResourcePatch SubResourceVerb = "patch"
+	// SubResourceCreate serves POST requests with SubResourceCreater, e.g. for eviction or binding style
+	// subresources.
+	SubResourceCreate SubResourceVerb = "create"
+)
+
+// TypedSubResource declares a subresource by its request and response kinds, its verbs and its strategy.
+// Unlike an ArbitrarySubResource it doesn't implement rest.Storage: the apiserver builds the storage from the
+// declaration, on top of the storage of the parent resource.
+//
+// The strategy is defined by implementing SubResourceGetter, SubResourceUpdater, SubResourceCreater and
+// SubResourceValidater, as required by the verbs.  The request and response kinds are registered with the
+// group version of the parent resource.
+type TypedSubResource interface {
+	SubResource
+	// SubResourceVerbs returns the verbs served by the subresource.
+	SubResourceVerbs() []SubResourceVerb
+	// NewRequest returns a new instance of the kind sent with create, update and patch requests.
+	NewRequest() runtime.Object
+	// NewResponse returns a new instance of the kind returned by the subresource.  Update and patch requests
+	// apply to the response kind, so it must be the request kind if either verb is served.
+	NewResponse() runtime.Object
+}
+
+// ObjectWithTypedSubResource defines an interface for getting typed subresources from a resource.
+type ObjectWithTypedSubResource interface {
+	Object
+	GetTypedSubResources() []TypedSubResource
+}
+
+// SubResourceGetter returns the subresource of a parent object, as an instance of the response kind.
+type SubResourceGetter interface {
+	GetSubResource(ctx context.Context, parent Object) (runtime.Object, error)
+}
+
+// SubResourceUpdater applies the request of an update or patch to a copy of the parent object, which is then
+// stored.  Fields of the parent not modified by UpdateSubResource are kept as they are, including the status.
+type SubResourceUpdater interface {
+	UpdateSubResource(ctx context.Context, parent Object, request runtime.Object) error
+}
+
+// SubResourceCreater handles create requests.  parent is a copy of the current parent object.  If update is
+// true the modified parent is stored, as for a binding.  Otherwise the parent is left as is and the request
+// may act on the parent storage available from rest.GetParentStorage, e.g. to delete it for an eviction.
+type SubResourceCreater interface {
+	CreateSubResource(ctx context.Context, parent Object, request runtime.Object) (response runtime.Object, update bool, err error)
+}
+
+// SubResourceValidater validates the request of a create, update or patch before it's handled.
+type SubResourceValidater interface {
+	ValidateSubResource(ctx context.Context, parent Object, request runtime.Object) field.ErrorList
+}
+
+// SubResourceOpenAPIDefinitions provides the OpenAPI definitions of the request and response kinds of a
+// TypedSubResource, keyed by their Go type names.  Not required if the definitions are generated along with
+// the definitions of the parent resource.
+type SubResourceOpenAPIDefinitions interface {
+	GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition
+}
@@ -90,6 +90,53 @@ type ObjectWithScaleSubResource interface {
 	GetScale() (scaleSubResource *autoscalingv1.Scale)
 }
 
+// ScalePaths declares where the scale sub-resource reads and writes the replicas and label selector of a resource,
+// the same as the scale sub-resource of a CustomResourceDefinition.  Paths are JSON paths such as ".spec.replicas".
+type ScalePaths struct {
+	// SpecReplicasPath is the path of the desired replicas.  Required, must be under .spec.
+	SpecReplicasPath string
+	// StatusReplicasPath is the path of the observed replicas.  Required, must be under .status.
+	StatusReplicasPath string
+	// LabelSelectorPath is the path of the label selector of the replicas, returned as the status selector of the
+	// scale.  The value must be a serialized label selector or a metav1.LabelSelector.  Optional, must be under
+	// .spec or .status.
+	LabelSelectorPath string
+}
+
+// ObjectWithScalePaths defines an interface for declaring the scale sub-resource of a resource by the paths of
+// its replicas.  Unlike ObjectWithScaleSubResource, no conversion to and from autoscalingv1.Scale is required.
+type ObjectWithScalePaths interface {
+	Object
+	GetScalePaths() ScalePaths
+}
+
+// PrinterColumn declares a column printed by `kubectl get` for a resource, the same as the additional printer
+// columns of a CustomResourceDefinition.  A Name column is always printed first.
+type PrinterColumn struct {
+	// Name is the header of the column.  Required.
+	Name string
+	// Type is the OpenAPI type of the column: integer, number, string, boolean or date.  Dates are printed as
+	// the time elapsed since the value.  Required.
+	Type string
+	// Format is the optional OpenAPI format of the column, e.g. "name" for the primary identifier.
+	Format string
+	// Description is a human readable description of the column.
+	Description string
+	// Priority is the importance of the column.  Columns with a priority greater than 0 are only printed by
+	// `kubectl get -o wide`.
+	Priority int32
+	// JSONPath is the simple JSON path evaluated against each object to produce the value, e.g. ".spec.replicas".
+	// Required.
+	JSONPath string
+}
+
+// ObjectWithPrinterColumns defines an interface for declaring the columns printed by `kubectl get` instead of
+// implementing a TableConvertor.  Resources without printer columns print their name and age.
+type ObjectWithPrinterColumns interface {
+	Object
+	GetPrinterColumns() []PrinterColumn
+}
+
 // ObjectWithArbitrarySubResource defines an interface for plumbing arbitrary sub-resources for a resource.
 type ObjectWithArbitrarySubResource interface {
 	Object
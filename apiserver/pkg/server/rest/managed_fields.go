@@ -0,0 +1,390 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package rest
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/registry/generic"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+// WithManagedFields returns a StorageProvider wrapping the request handler of sp with NewManagedFieldsStorage.
+func WithManagedFields(obj resource.Object, sp StorageProvider) StorageProvider {
+	return func(scheme *runtime.Scheme, optsGetter generic.RESTOptionsGetter) (rest.Storage, error) {
+		storage, err := sp(scheme, optsGetter)
+		if err != nil {
+			return nil, err
+		}
+		s := &DefaultStrategy{Object: obj, ObjectTyper: scheme, OpenAPIDefinitions: openAPIDefinitionsFrom(optsGetter)}
+		return NewManagedFieldsStorage(obj, storage, s), nil
+	}
+}
+
+// NewManagedFieldsStorage wraps a custom request handler implementing rest.Getter and rest.Updater so that
+// managed fields and server-side apply behave the same as for the etcd backed storage.  The apiserver tracks
+// field ownership for every handler, but relies on the storage to:
+//
+//   - assign a uid and creation timestamp to new objects, without which every apply is treated as a create
+//     and ownership of the existing fields is lost.
+//   - pass an empty object rather than nil to the update of an object that does not exist yet.
+//   - keep the status of an ObjectWithStatusSubResource on updates of the resource, and report the reset
+//     fields of s so that appliers of the resource and of its status subresource don't conflict.
+//
+// Handlers implementing rest.StandardStorage keep their list, watch, create and delete verbs, handlers only
+// implementing rest.Getter and rest.Updater keep their get, update and patch verbs.  The etcd backed storage,
+// handlers not implementing rest.Getter and rest.Updater, and handlers implementing an interface the wrapper
+// would hide, e.g. rest.Creater without rest.Lister or rest.Connecter, are returned unchanged.
+func NewManagedFieldsStorage(obj resource.Object, storage rest.Storage, s Strategy) rest.Storage {
+	if _, ok := storage.(*genericregistry.Store); ok {
+		return storage
+	}
+	getter, isGetter := storage.(rest.Getter)
+	updater, isUpdater := storage.(rest.Updater)
+	if !isGetter || !isUpdater {
+		return storage
+	}
+
+	m := &managedFieldsStorage{
+		obj:      obj,
+		storage:  storage,
+		getter:   getter,
+		updater:  updater,
+		strategy: s,
+	}
+	if r, ok := s.(rest.ResetFieldsStrategy); ok {
+		m.resetFields = r.GetResetFields()
+	}
+	var wrapped rest.Storage = m
+	if std, ok := storage.(rest.StandardStorage); ok {
+		wrapped = &managedFieldsStandardStorage{managedFieldsStorage: m, standard: std}
+	}
+	// the apiserver serves the verbs and metadata of the interfaces a storage implements, none may be lost
+	for _, implements := range storageInterfaces {
+		if implements(storage) && !implements(wrapped) {
+			return storage
+		}
+	}
+	return wrapped
+}
+
+// storageInterfaces report whether a storage implements each of the optional interfaces the apiserver checks
+// besides rest.Getter and rest.Updater.
+var storageInterfaces = []func(rest.Storage) bool{
+	func(s rest.Storage) bool { _, ok := s.(rest.Creater); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.NamedCreater); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.Lister); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.Watcher); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.GracefulDeleter); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.MayReturnFullObjectDeleter); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.CollectionDeleter); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.GetterWithOptions); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.Connecter); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.Redirector); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.StorageMetadata); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.KindProvider); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.ShortNamesProvider); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.CategoriesProvider); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.SingularNameProvider); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.GroupVersionKindProvider); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.GroupVersionAcceptor); return ok },
+	func(s rest.Storage) bool { _, ok := s.(rest.StorageVersionProvider); return ok },
+}
+
+// NewManagedFieldsStatusStorage returns the storage of the status subresource of a request handler wrapped by
+// NewManagedFieldsStorage.  Updates only change the status of the stored object.
+func NewManagedFieldsStatusStorage(parentStorage rest.Storage) (rest.Storage, error) {
+	var parent *managedFieldsStorage
+	switch s := parentStorage.(type) {
+	case *managedFieldsStorage:
+		parent = s
+	case *managedFieldsStandardStorage:
+		parent = s.managedFieldsStorage
+	default:
+		return nil, fmt.Errorf("%T is not wrapped by NewManagedFieldsStorage", parentStorage)
+	}
+	if _, ok := parent.obj.(resource.ObjectWithStatusSubResource); !ok {
+		return nil, fmt.Errorf("%T does not implement resource.ObjectWithStatusSubResource", parent.obj)
+	}
+	s := &managedFieldsStatusStorage{parent: parent}
+	if r, ok := parent.strategy.(StatusResetFieldsStrategy); ok {
+		s.resetFields = r.GetStatusResetFields()
+	}
+	return s, nil
+}
+
+type managedFieldsStorage struct {
+	obj         resource.Object
+	storage     rest.Storage
+	getter      rest.Getter
+	updater     rest.Updater
+	strategy    Strategy
+	resetFields map[fieldpath.APIVersion]*fieldpath.Set
+}
+
+var _ rest.Getter = &managedFieldsStorage{}
+var _ rest.Updater = &managedFieldsStorage{}
+var _ rest.Scoper = &managedFieldsStorage{}
+var _ rest.TableConvertor = &managedFieldsStorage{}
+var _ rest.ResetFieldsStrategy = &managedFieldsStorage{}
+var _ rest.ShortNamesProvider = &managedFieldsStorage{}
+var _ rest.CategoriesProvider = &managedFieldsStorage{}
+var _ rest.SingularNameProvider = &managedFieldsStorage{}
+
+func (s *managedFieldsStorage) New() runtime.Object {
+	return s.storage.New()
+}
+
+func (s *managedFieldsStorage) Destroy() {
+	s.storage.Destroy()
+}
+
+// NamespaceScoped returns the scope of the handler, or of the resource if the handler doesn't declare it.
+func (s *managedFieldsStorage) NamespaceScoped() bool {
+	if scoper, ok := s.storage.(rest.Scoper); ok {
+		return scoper.NamespaceScoped()
+	}
+	return s.obj.NamespaceScoped()
+}
+
+func (s *managedFieldsStorage) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	if c, ok := s.storage.(rest.TableConvertor); ok {
+		return c.ConvertToTable(ctx, object, tableOptions)
+	}
+	return rest.NewDefaultTableConvertor(s.obj.GetGroupVersionResource().GroupResource()).ConvertToTable(ctx, object, tableOptions)
+}
+
+// ShortNames returns the short names of the handler, if any.
+func (s *managedFieldsStorage) ShortNames() []string {
+	if p, ok := s.storage.(rest.ShortNamesProvider); ok {
+		return p.ShortNames()
+	}
+	return nil
+}
+
+// Categories returns the categories of the handler, if any.
+func (s *managedFieldsStorage) Categories() []string {
+	if p, ok := s.storage.(rest.CategoriesProvider); ok {
+		return p.Categories()
+	}
+	return nil
+}
+
+// GetSingularName returns the singular name of the handler, which the apiserver requires to install it.
+func (s *managedFieldsStorage) GetSingularName() string {
+	if p, ok := s.storage.(rest.SingularNameProvider); ok {
+		return p.GetSingularName()
+	}
+	return ""
+}
+
+func (s *managedFieldsStorage) GetResetFields() map[fieldpath.APIVersion]*fieldpath.Set {
+	return s.resetFields
+}
+
+func (s *managedFieldsStorage) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	return s.getter.Get(ctx, name, options)
+}
+
+func (s *managedFieldsStorage) Update(
+	ctx context.Context,
+	name string,
+	objInfo rest.UpdatedObjectInfo,
+	createValidation rest.ValidateObjectFunc,
+	updateValidation rest.ValidateObjectUpdateFunc,
+	forceAllowCreate bool,
+	options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	objInfo = &managedFieldsObjectInfo{
+		UpdatedObjectInfo: objInfo,
+		newFunc:           s.storage.New,
+		prepare:           s.prepareForUpdate,
+	}
+	return s.updater.Update(ctx, name, objInfo, createValidation, updateValidation, forceAllowCreate, options)
+}
+
+// prepareForUpdate keeps the status of the stored object, the same as DefaultStrategy.PrepareForUpdate.
+func (s *managedFieldsStorage) prepareForUpdate(obj, old runtime.Object) (runtime.Object, error) {
+	if v, ok := obj.(resource.ObjectWithStatusSubResource); ok {
+		old.(resource.ObjectWithStatusSubResource).GetStatus().CopyTo(v)
+	}
+	return obj, nil
+}
+
+// managedFieldsStandardStorage is a managedFieldsStorage keeping the verbs of a rest.StandardStorage.
+type managedFieldsStandardStorage struct {
+	*managedFieldsStorage
+	standard rest.StandardStorage
+}
+
+var _ rest.StandardStorage = &managedFieldsStandardStorage{}
+
+func (s *managedFieldsStandardStorage) NewList() runtime.Object {
+	return s.standard.NewList()
+}
+
+func (s *managedFieldsStandardStorage) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	return s.standard.List(ctx, options)
+}
+
+func (s *managedFieldsStandardStorage) Watch(ctx context.Context, options *metainternalversion.ListOptions) (watch.Interface, error) {
+	return s.standard.Watch(ctx, options)
+}
+
+func (s *managedFieldsStandardStorage) Create(
+	ctx context.Context,
+	obj runtime.Object,
+	createValidation rest.ValidateObjectFunc,
+	options *metav1.CreateOptions) (runtime.Object, error) {
+	objectMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	rest.FillObjectMetaSystemFields(objectMeta)
+	return s.standard.Create(ctx, obj, createValidation, options)
+}
+
+func (s *managedFieldsStandardStorage) Delete(
+	ctx context.Context,
+	name string,
+	deleteValidation rest.ValidateObjectFunc,
+	options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	return s.standard.Delete(ctx, name, deleteValidation, options)
+}
+
+func (s *managedFieldsStandardStorage) DeleteCollection(
+	ctx context.Context,
+	deleteValidation rest.ValidateObjectFunc,
+	options *metav1.DeleteOptions,
+	listOptions *metainternalversion.ListOptions) (runtime.Object, error) {
+	return s.standard.DeleteCollection(ctx, deleteValidation, options, listOptions)
+}
+
+// managedFieldsStatusStorage updates the status of the objects of a managedFieldsStorage.
+type managedFieldsStatusStorage struct {
+	parent      *managedFieldsStorage
+	resetFields map[fieldpath.APIVersion]*fieldpath.Set
+}
+
+var _ rest.Getter = &managedFieldsStatusStorage{}
+var _ rest.Updater = &managedFieldsStatusStorage{}
+var _ rest.ResetFieldsStrategy = &managedFieldsStatusStorage{}
+
+func (s *managedFieldsStatusStorage) New() runtime.Object {
+	return s.parent.New()
+}
+
+func (s *managedFieldsStatusStorage) Destroy() {}
+
+func (s *managedFieldsStatusStorage) GetResetFields() map[fieldpath.APIVersion]*fieldpath.Set {
+	return s.resetFields
+}
+
+func (s *managedFieldsStatusStorage) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	return s.parent.Get(ctx, name, options)
+}
+
+func (s *managedFieldsStatusStorage) Update(
+	ctx context.Context,
+	name string,
+	objInfo rest.UpdatedObjectInfo,
+	createValidation rest.ValidateObjectFunc,
+	updateValidation rest.ValidateObjectUpdateFunc,
+	_ bool,
+	options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	objInfo = &managedFieldsObjectInfo{
+		UpdatedObjectInfo: objInfo,
+		newFunc:           s.parent.New,
+		prepare:           prepareForStatusUpdate,
+	}
+	// the status of an object that doesn't exist can't be updated
+	return s.parent.updater.Update(ctx, name, objInfo, createValidation, updateValidation, false, options)
+}
+
+// prepareForStatusUpdate returns the stored object with the status, system fields and managed fields of obj.
+func prepareForStatusUpdate(obj, old runtime.Object) (runtime.Object, error) {
+	updated := old.DeepCopyObject()
+	obj.(resource.ObjectWithStatusSubResource).GetStatus().CopyTo(updated.(resource.ObjectWithStatusSubResource))
+
+	objectMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	updatedMeta, err := meta.Accessor(updated)
+	if err != nil {
+		return nil, err
+	}
+	updatedMeta.SetUID(objectMeta.GetUID())
+	updatedMeta.SetCreationTimestamp(objectMeta.GetCreationTimestamp())
+	updatedMeta.SetManagedFields(objectMeta.GetManagedFields())
+	updatedMeta.SetResourceVersion(objectMeta.GetResourceVersion())
+	return updated, nil
+}
+
+// managedFieldsObjectInfo completes the object returned by an UpdatedObjectInfo the way genericregistry.Store
+// does before it is written by a custom handler.
+type managedFieldsObjectInfo struct {
+	rest.UpdatedObjectInfo
+	newFunc func() runtime.Object
+	// prepare is invoked with the updated and the stored object when the object exists
+	prepare func(obj, old runtime.Object) (runtime.Object, error)
+}
+
+func (i *managedFieldsObjectInfo) UpdatedObject(ctx context.Context, old runtime.Object) (runtime.Object, error) {
+	exists := old != nil
+	if !exists {
+		old = i.newFunc()
+	}
+	obj, err := i.UpdatedObjectInfo.UpdatedObject(ctx, old)
+	if err != nil {
+		return nil, err
+	}
+	objectMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	oldMeta, err := meta.Accessor(old)
+	if err != nil {
+		return nil, err
+	}
+
+	// objects written before they were wrapped have no uid yet
+	if !exists || len(oldMeta.GetUID()) == 0 {
+		rest.FillObjectMetaSystemFields(objectMeta)
+	} else {
+		objectMeta.SetUID(oldMeta.GetUID())
+		objectMeta.SetCreationTimestamp(oldMeta.GetCreationTimestamp())
+	}
+	if !exists || i.prepare == nil {
+		return obj, nil
+	}
+	return i.prepare(obj, old)
+}
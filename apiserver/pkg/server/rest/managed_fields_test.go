@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+func TestNewManagedFieldsStorage(t *testing.T) {
+	strategy := &DefaultStrategy{Object: &widget{}, ObjectTyper: widgetScheme(), OpenAPIDefinitions: widgetDefinitions}
+
+	t.Run("etcd backed storage and handlers without updates should be unchanged", func(t *testing.T) {
+		store := &genericregistry.Store{}
+		assert.Same(t, store, NewManagedFieldsStorage(&widget{}, store, strategy))
+		getter := &widgetGetter{}
+		assert.Same(t, getter, NewManagedFieldsStorage(&widget{}, getter, strategy))
+	})
+	t.Run("handlers whose verbs the wrapper would hide should be unchanged", func(t *testing.T) {
+		creater := &widgetCreater{}
+		assert.Same(t, creater, NewManagedFieldsStorage(&widget{}, creater, strategy))
+	})
+	t.Run("the names of the handler should be kept", func(t *testing.T) {
+		storage := NewManagedFieldsStorage(&widget{}, &widgetHandler{}, strategy)
+		assert.Equal(t, "widget", storage.(rest.SingularNameProvider).GetSingularName())
+		assert.Equal(t, []string{"wd"}, storage.(rest.ShortNamesProvider).ShortNames())
+		assert.Nil(t, storage.(rest.CategoriesProvider).Categories())
+	})
+	t.Run("updates should assign and keep system fields", func(t *testing.T) {
+		handler := &widgetHandler{}
+		storage := NewManagedFieldsStorage(&widget{}, handler, strategy).(rest.Updater)
+		_, isLister := storage.(rest.Lister)
+		assert.False(t, isLister)
+
+		_, _, err := storage.Update(context.TODO(), "a", rest.DefaultUpdatedObjectInfo(&widget{Spec: "v1"}), nil, nil, true, &metav1.UpdateOptions{})
+		assert.NoError(t, err)
+		created := handler.obj.DeepCopyObject().(*widget)
+		assert.NotEmpty(t, created.UID)
+		assert.False(t, created.CreationTimestamp.IsZero())
+
+		_, _, err = storage.Update(context.TODO(), "a", rest.DefaultUpdatedObjectInfo(&widget{Spec: "v2"}), nil, nil, false, &metav1.UpdateOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", handler.obj.Spec)
+		assert.Equal(t, created.UID, handler.obj.UID)
+		assert.Equal(t, created.CreationTimestamp, handler.obj.CreationTimestamp)
+	})
+	t.Run("status should only be updated through the status subresource", func(t *testing.T) {
+		handler := &widgetHandler{obj: &widget{
+			ObjectMeta: metav1.ObjectMeta{Name: "a", UID: "uid"},
+			Spec:       "v1",
+			Status:     widgetStatus{Phase: "Pending"},
+		}}
+		storage := NewManagedFieldsStorage(&widget{}, handler, strategy)
+		status, err := NewManagedFieldsStatusStorage(storage)
+		assert.NoError(t, err)
+
+		// the reset fields are those of the strategy, for every version
+		assert.Equal(t, strategy.GetResetFields(), storage.(rest.ResetFieldsStrategy).GetResetFields())
+		assert.Equal(t, strategy.GetStatusResetFields(), status.(rest.ResetFieldsStrategy).GetResetFields())
+		for _, gv := range []fieldpath.APIVersion{"test.kes.io/v1", "test.kes.io/v2"} {
+			assert.True(t, storage.(rest.ResetFieldsStrategy).GetResetFields()[gv].Has(fieldpath.MakePathOrDie("status")))
+			assert.True(t, status.(rest.ResetFieldsStrategy).GetResetFields()[gv].Has(fieldpath.MakePathOrDie("spec")))
+		}
+
+		_, _, err = storage.(rest.Updater).Update(context.TODO(), "a", rest.DefaultUpdatedObjectInfo(&widget{
+			Spec: "v2", Status: widgetStatus{Phase: "Running"},
+		}), nil, nil, false, &metav1.UpdateOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", handler.obj.Spec)
+		assert.Equal(t, "Pending", handler.obj.Status.Phase)
+
+		_, _, err = status.(rest.Updater).Update(context.TODO(), "a", rest.DefaultUpdatedObjectInfo(&widget{
+			Spec: "v3", Status: widgetStatus{Phase: "Running"},
+		}), nil, nil, false, &metav1.UpdateOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", handler.obj.Spec)
+		assert.Equal(t, "Running", handler.obj.Status.Phase)
+		assert.Equal(t, "uid", string(handler.obj.UID))
+	})
+}
+
+var widgetGVR = schema.GroupVersionResource{Group: "test.kes.io", Version: "v1", Resource: "widgets"}
+
+type widget struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+	Spec   string
+	Status widgetStatus
+}
+
+type widgetStatus struct {
+	Phase string
+}
+
+func (w *widget) DeepCopyObject() runtime.Object {
+	out := *w
+	w.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+func (w *widget) GetObjectMeta() *metav1.ObjectMeta                    { return &w.ObjectMeta }
+func (w *widget) NamespaceScoped() bool                                { return false }
+func (w *widget) New() runtime.Object                                  { return &widget{} }
+func (w *widget) NewList() runtime.Object                              { return &widget{} }
+func (w *widget) GetGroupVersionResource() schema.GroupVersionResource { return widgetGVR }
+func (w *widget) IsStorageVersion() bool                               { return true }
+func (w *widget) GetStatus() resource.StatusSubResource                { return w.Status }
+
+func (s widgetStatus) SubResourceName() string { return "status" }
+func (s widgetStatus) CopyTo(parent resource.ObjectWithStatusSubResource) {
+	parent.(*widget).Status = s
+}
+
+type widgetGetter struct{}
+
+func (g *widgetGetter) New() runtime.Object { return &widget{} }
+func (g *widgetGetter) Destroy()            {}
+func (g *widgetGetter) Get(context.Context, string, *metav1.GetOptions) (runtime.Object, error) {
+	return &widget{}, nil
+}
+
+func (g *widgetGetter) GetSingularName() string { return "widget" }
+func (g *widgetGetter) ShortNames() []string    { return []string{"wd"} }
+
+// widgetCreater is a widgetHandler also creating widgets, without listing them.
+type widgetCreater struct {
+	widgetHandler
+}
+
+func (c *widgetCreater) Create(_ context.Context, obj runtime.Object, _ rest.ValidateObjectFunc, _ *metav1.CreateOptions) (runtime.Object, error) {
+	c.obj = obj.(*widget)
+	return obj, nil
+}
+
+// widgetHandler stores a single widget, passing nil to UpdatedObject when it doesn't exist like filepathREST.
+type widgetHandler struct {
+	widgetGetter
+	obj *widget
+}
+
+func (h *widgetHandler) Get(context.Context, string, *metav1.GetOptions) (runtime.Object, error) {
+	return h.obj.DeepCopyObject(), nil
+}
+
+func (h *widgetHandler) Update(ctx context.Context, _ string, objInfo rest.UpdatedObjectInfo, _ rest.ValidateObjectFunc,
+	_ rest.ValidateObjectUpdateFunc, _ bool, _ *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	var old runtime.Object
+	if h.obj != nil {
+		old = h.obj.DeepCopyObject()
+	}
+	obj, err := objInfo.UpdatedObject(ctx, old)
+	if err != nil {
+		return nil, false, err
+	}
+	h.obj = obj.(*widget)
+	return obj, old == nil, nil
+}
@@ -0,0 +1,114 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package rest
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/registry/rest"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
+	openapiutil "k8s.io/kube-openapi/pkg/util"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+// OpenAPIDefinitionsGetter is implemented by the RESTOptionsGetter passed to a StorageProvider when the
+// apiserver serves OpenAPI definitions.  DefaultStrategy derives the reset fields of resources from them.
+type OpenAPIDefinitionsGetter interface {
+	OpenAPIDefinitions() openapicommon.GetOpenAPIDefinitions
+}
+
+// StatusResetFieldsStrategy is implemented by strategies declaring the fields reset by the status subresource.
+type StatusResetFieldsStrategy interface {
+	GetStatusResetFields() map[fieldpath.APIVersion]*fieldpath.Set
+}
+
+var _ rest.ResetFieldsStrategy = DefaultStrategy{}
+var _ StatusResetFieldsStrategy = DefaultStrategy{}
+
+// openAPIDefinitionsFrom returns the OpenAPI definitions exposed by optsGetter, if any.
+func openAPIDefinitionsFrom(optsGetter generic.RESTOptionsGetter) openapicommon.GetOpenAPIDefinitions {
+	if g, ok := optsGetter.(OpenAPIDefinitionsGetter); ok {
+		return g.OpenAPIDefinitions()
+	}
+	return nil
+}
+
+// GetResetFields returns the status of each version of a resource implementing
+// resource.ObjectWithStatusSubResource, which is only written through the status subresource.
+func (d DefaultStrategy) GetResetFields() map[fieldpath.APIVersion]*fieldpath.Set {
+	return d.resetFields("status")
+}
+
+// GetStatusResetFields returns the spec of each version of a resource implementing
+// resource.ObjectWithStatusSubResource, which is not written through the status subresource.
+func (d DefaultStrategy) GetStatusResetFields() map[fieldpath.APIVersion]*fieldpath.Set {
+	return d.resetFields("spec")
+}
+
+// resetFields returns field for every version of the resource whose OpenAPI schema has it as a top level
+// property.  Versions without a schema have no reset fields.
+func (d DefaultStrategy) resetFields(field string) map[fieldpath.APIVersion]*fieldpath.Set {
+	if _, ok := d.Object.(resource.ObjectWithStatusSubResource); !ok || d.ObjectTyper == nil || d.OpenAPIDefinitions == nil {
+		return nil
+	}
+	gvks, _, err := d.ObjectTyper.ObjectKinds(d.Object)
+	if err != nil || len(gvks) == 0 {
+		return nil
+	}
+
+	// all versions of the kind share the storage
+	t := reflect.TypeOf(d.Object)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	types := map[schema.GroupVersionKind]reflect.Type{gvks[0]: t}
+	if s, ok := d.ObjectTyper.(interface {
+		AllKnownTypes() map[schema.GroupVersionKind]reflect.Type
+	}); ok {
+		for gvk, t := range s.AllKnownTypes() {
+			if gvk.GroupKind() == gvks[0].GroupKind() {
+				types[gvk] = t
+			}
+		}
+	}
+
+	definitions := d.OpenAPIDefinitions(func(path string) spec.Ref {
+		return spec.MustCreateRef(path)
+	})
+	fields := map[fieldpath.APIVersion]*fieldpath.Set{}
+	for gvk, t := range types {
+		definition, ok := definitions[openapiutil.GetCanonicalTypeName(reflect.New(t).Interface())]
+		if !ok {
+			continue
+		}
+		if _, ok := definition.Schema.Properties[field]; !ok {
+			continue
+		}
+		fields[fieldpath.APIVersion(gvk.GroupVersion().String())] = fieldpath.NewSet(fieldpath.MakePathOrDie(field))
+	}
+	return fields
+}
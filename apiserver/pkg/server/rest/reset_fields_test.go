@@ -0,0 +1,52 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+)
+
+func TestDefaultStrategyResetFields(t *testing.T) {
+	scheme := widgetScheme()
+	definitions := widgetDefinitions
+
+	t.Run("reset fields should be derived for every version from the schema", func(t *testing.T) {
+		s := DefaultStrategy{Object: &widget{}, ObjectTyper: scheme, OpenAPIDefinitions: definitions}
+		for _, gv := range []fieldpath.APIVersion{"test.kes.io/v1", "test.kes.io/v2"} {
+			assert.True(t, s.GetResetFields()[gv].Equals(fieldpath.NewSet(fieldpath.MakePathOrDie("status"))), gv)
+			assert.True(t, s.GetStatusResetFields()[gv].Equals(fieldpath.NewSet(fieldpath.MakePathOrDie("spec"))), gv)
+		}
+	})
+	t.Run("resources without a status subresource or schema should reset nothing", func(t *testing.T) {
+		assert.Empty(t, DefaultStrategy{Object: &v1alpha1.Flunder{}, ObjectTyper: scheme, OpenAPIDefinitions: definitions}.GetResetFields())
+		assert.Empty(t, DefaultStrategy{Object: &widget{}, ObjectTyper: scheme}.GetResetFields())
+		empty := func(openapicommon.ReferenceCallback) map[string]openapicommon.OpenAPIDefinition { return nil }
+		assert.Empty(t, DefaultStrategy{Object: &widget{}, ObjectTyper: scheme, OpenAPIDefinitions: empty}.GetResetFields())
+	})
+}
+
+// widgetScheme returns a scheme serving widgets in the versions v1 and v2.
+func widgetScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	v1 := widgetGVR.GroupVersion()
+	v2 := v1
+	v2.Version = "v2"
+	scheme.AddKnownTypeWithName(v1.WithKind("Widget"), &widget{})
+	scheme.AddKnownTypeWithName(v2.WithKind("Widget"), &widget{})
+	return scheme
+}
+
+// widgetDefinitions returns the OpenAPI definition of widgets, with a spec and a status.
+func widgetDefinitions(openapicommon.ReferenceCallback) map[string]openapicommon.OpenAPIDefinition {
+	return map[string]openapicommon.OpenAPIDefinition{
+		"github.com/vine-io/kes/apiserver/pkg/server/rest.widget": {Schema: spec.Schema{SchemaProps: spec.SchemaProps{
+			Properties: map[string]spec.Schema{"spec": {}, "status": {}},
+		}}},
+	}
+}
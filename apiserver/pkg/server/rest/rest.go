@@ -17,6 +17,7 @@ limitations under the License.
 package rest
 
 import (
+	"context"
 	"fmt"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -29,18 +30,13 @@ import (
 	"k8s.io/apiserver/pkg/registry/rest"
 
 	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcestrategy"
 )
 
 // New returns a new etcd backed request handler for the resource.
 func New(obj resource.Object) StorageProvider {
 	return func(scheme *runtime.Scheme, optsGetter generic.RESTOptionsGetter) (rest.Storage, error) {
-		gvr := obj.GetGroupVersionResource()
-		s := &DefaultStrategy{
-			Object:         obj,
-			ObjectTyper:    scheme,
-			TableConvertor: rest.NewDefaultTableConvertor(gvr.GroupResource()),
-		}
-		return newStore(scheme, obj.New, obj.NewList, gvr, s, optsGetter, nil)
+		return newDefaultStore(scheme, obj, optsGetter, nil)
 	}
 }
 
@@ -58,17 +54,34 @@ type StoreFn func(*runtime.Scheme, *genericregistry.Store, *generic.StoreOptions
 // NewWithFn returns a new etcd backed request handler, applying the StoreFn to the Store.
 func NewWithFn(obj resource.Object, fn StoreFn) StorageProvider {
 	return func(scheme *runtime.Scheme, optsGetter generic.RESTOptionsGetter) (rest.Storage, error) {
-		gvr := obj.GetGroupVersionResource()
-		s := &DefaultStrategy{
-			Object:         obj,
-			ObjectTyper:    scheme,
-			TableConvertor: rest.NewDefaultTableConvertor(gvr.GroupResource()),
-		}
-		return newStore(scheme, obj.New, obj.NewList, gvr, s, optsGetter, fn)
+		return newDefaultStore(scheme, obj, optsGetter, fn)
 	}
 }
 
+// newDefaultStore returns a Store of obj using the DefaultStrategy, with the table convertor, the OpenAPI
+// definitions and the schema validator of obj, and the lifecycle hooks implemented by obj.
+func newDefaultStore(scheme *runtime.Scheme, obj resource.Object, optsGetter generic.RESTOptionsGetter, fn StoreFn) (*genericregistry.Store, error) {
+	tableConvertor, err := tableConvertorFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	definitions := openAPIDefinitionsFrom(optsGetter)
+	schemaValidator, err := NewSchemaValidator(obj, definitions)
+	if err != nil {
+		return nil, err
+	}
+	s := &DefaultStrategy{
+		Object:             obj,
+		ObjectTyper:        scheme,
+		TableConvertor:     tableConvertor,
+		OpenAPIDefinitions: definitions,
+		SchemaValidator:    schemaValidator,
+	}
+	return newStore(scheme, obj.New, obj.NewList, obj.GetGroupVersionResource(), s, optsGetter, fn)
+}
+
 // newStore returns a RESTStorage object that will work against API services.
+// Lifecycle hooks implemented by the object are registered before fn is applied, so fn may override them.
 func newStore(
 	scheme *runtime.Scheme,
 	single, list func() runtime.Object,
@@ -86,6 +99,11 @@ func newStore(
 		DeleteStrategy:            s,
 		StorageVersioner:          gvr.GroupVersion(),
 	}
+	if r, ok := s.(rest.ResetFieldsStrategy); ok {
+		store.ResetFieldsStrategy = r
+	}
+
+	setLifecycleHooks(store, single())
 
 	options := &generic.StoreOptions{RESTOptions: optsGetter, AttrFunc: GetAttrs}
 	if fn != nil {
@@ -97,6 +115,46 @@ func newStore(
 	return store, nil
 }
 
+// setLifecycleHooks registers the Store hooks for each resourcestrategy lifecycle interface implemented by obj.
+// The hooks are invoked on the object being written, so obj is only used to detect the implemented interfaces.
+func setLifecycleHooks(store *genericregistry.Store, obj runtime.Object) {
+	if _, ok := obj.(resourcestrategy.BeginCreater); ok {
+		store.BeginCreate = func(ctx context.Context, obj runtime.Object, options *metav1.CreateOptions) (genericregistry.FinishFunc, error) {
+			fn, err := obj.(resourcestrategy.BeginCreater).BeginCreate(ctx, options)
+			return finishFunc(fn), err
+		}
+	}
+	if _, ok := obj.(resourcestrategy.AfterCreater); ok {
+		store.AfterCreate = func(obj runtime.Object, options *metav1.CreateOptions) {
+			obj.(resourcestrategy.AfterCreater).AfterCreate(options)
+		}
+	}
+	if _, ok := obj.(resourcestrategy.BeginUpdater); ok {
+		store.BeginUpdate = func(ctx context.Context, obj, old runtime.Object, options *metav1.UpdateOptions) (genericregistry.FinishFunc, error) {
+			fn, err := obj.(resourcestrategy.BeginUpdater).BeginUpdate(ctx, old, options)
+			return finishFunc(fn), err
+		}
+	}
+	if _, ok := obj.(resourcestrategy.AfterUpdater); ok {
+		store.AfterUpdate = func(obj runtime.Object, options *metav1.UpdateOptions) {
+			obj.(resourcestrategy.AfterUpdater).AfterUpdate(options)
+		}
+	}
+	if _, ok := obj.(resourcestrategy.AfterDeleter); ok {
+		store.AfterDelete = func(obj runtime.Object, options *metav1.DeleteOptions) {
+			obj.(resourcestrategy.AfterDeleter).AfterDelete(options)
+		}
+	}
+}
+
+// finishFunc converts fn to a Store FinishFunc, tolerating Begin hooks that have nothing to finish.
+func finishFunc(fn resourcestrategy.FinishFunc) genericregistry.FinishFunc {
+	if fn == nil {
+		return func(context.Context, bool) {}
+	}
+	return genericregistry.FinishFunc(fn)
+}
+
 // GetAttrs returns labels.Set, fields.Set, and error in case the given runtime.Object is not a ObjectMetaProvider
 func GetAttrs(obj runtime.Object) (labels.Set, fields.Set, error) {
 	provider, ok := obj.(resource.Object)
@@ -0,0 +1,209 @@
+package rest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/generic"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcestrategy"
+	"github.com/vine-io/kes/apiserver/pkg/server/storage"
+)
+
+func TestNewLifecycleHooks(t *testing.T) {
+	scheme := runtime.NewScheme()
+	gv := hookedGVR.GroupVersion()
+	scheme.AddKnownTypes(gv, &hooked{}, &hookedList{})
+	metav1.AddToGroupVersion(scheme, gv)
+	codecs := serializer.NewCodecFactory(scheme)
+
+	opts := memoryRESTOptions(codecs.LegacyCodec(gv), hookedGVR.GroupResource())
+	s, err := New(&hooked{})(scheme, opts)
+	assert.NoError(t, err)
+	store := s.(rest.StandardStorage)
+	ctx := genericapirequest.WithNamespace(genericapirequest.NewContext(), "default")
+
+	t.Run("create should invoke the create hooks", func(t *testing.T) {
+		hookCalls.reset()
+		obj := &hooked{ObjectMeta: metav1.ObjectMeta{Name: "hooked", Namespace: "default"}}
+		_, err := store.Create(ctx, obj, nil, &metav1.CreateOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"BeginCreate", "FinishCreate(true)", "AfterCreate"}, hookCalls.get())
+	})
+	t.Run("a failed create should finish unsuccessfully", func(t *testing.T) {
+		hookCalls.reset()
+		obj := &hooked{ObjectMeta: metav1.ObjectMeta{Name: "hooked", Namespace: "default"}}
+		_, err := store.Create(ctx, obj, nil, &metav1.CreateOptions{})
+		assert.Error(t, err)
+		assert.Equal(t, []string{"BeginCreate", "FinishCreate(false)"}, hookCalls.get())
+	})
+	t.Run("update should invoke the update hooks", func(t *testing.T) {
+		hookCalls.reset()
+		got, err := store.Get(ctx, "hooked", &metav1.GetOptions{})
+		assert.NoError(t, err)
+		obj := got.(*hooked)
+		obj.Value = "updated"
+		_, _, err = store.Update(ctx, obj.Name, rest.DefaultUpdatedObjectInfo(obj), nil, nil, false, &metav1.UpdateOptions{})
+		assert.NoError(t, err)
+		// the FinishFunc of BeginUpdate is nil, which must be tolerated
+		assert.Equal(t, []string{"BeginUpdate", "AfterUpdate"}, hookCalls.get())
+	})
+	t.Run("delete should invoke the delete hook", func(t *testing.T) {
+		hookCalls.reset()
+		_, _, err := store.Delete(ctx, "hooked", rest.ValidateAllObjectFunc, &metav1.DeleteOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"AfterDelete"}, hookCalls.get())
+	})
+	t.Run("objects without hooks should leave the store untouched", func(t *testing.T) {
+		store := &genericregistry.Store{}
+		setLifecycleHooks(store, &plain{})
+		assert.Nil(t, store.BeginCreate)
+		assert.Nil(t, store.AfterCreate)
+		assert.Nil(t, store.BeginUpdate)
+		assert.Nil(t, store.AfterUpdate)
+		assert.Nil(t, store.AfterDelete)
+	})
+}
+
+func TestNewWithStrategyValidation(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, v1alpha1.AddToScheme(scheme))
+	codecs := serializer.NewCodecFactory(scheme)
+	flunder := &v1alpha1.Flunder{}
+	gvr := flunder.GetGroupVersionResource()
+
+	// without a SchemaValidator, the type validation alone is enforced
+	opts := memoryRESTOptions(codecs.LegacyCodec(gvr.GroupVersion()), gvr.GroupResource())
+	s, err := NewWithStrategy(flunder, &DefaultStrategy{Object: flunder, ObjectTyper: scheme})(scheme, opts)
+	assert.NoError(t, err)
+	store := s.(rest.Creater)
+	ctx := genericapirequest.WithNamespace(genericapirequest.NewContext(), "default")
+
+	obj := &v1alpha1.Flunder{
+		ObjectMeta: metav1.ObjectMeta{Name: "flunder", Namespace: "default"},
+		Spec:       v1alpha1.FlunderSpec{ReferenceType: "Other"},
+	}
+	_, err = store.Create(ctx, obj, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsInvalid(err))
+	assert.ErrorContains(t, err, "spec.referenceType: Invalid value: \"Other\": must be Flunder or Fischer")
+}
+
+// memoryRESTOptions returns the options of a resource stored in memory with the codec.
+func memoryRESTOptions(codec runtime.Codec, gr schema.GroupResource) generic.RESTOptions {
+	config := storagebackend.NewDefaultConfig("/registry", codec)
+	return generic.RESTOptions{
+		StorageConfig:  config.ForResource(gr),
+		Decorator:      storage.NewMemory().Decorator()(generic.UndecoratedStorage),
+		ResourcePrefix: gr.String(),
+	}
+}
+
+var hookedGVR = schema.GroupVersionResource{Group: "hooks.example.com", Version: "v1", Resource: "hookeds"}
+
+// hookCalls records the hooks invoked on any hooked object, which the store copies.
+var hookCalls recorder
+
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func (r *recorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+type plain struct{}
+
+func (p *plain) GetObjectKind() schema.ObjectKind { return schema.EmptyObjectKind }
+func (p *plain) DeepCopyObject() runtime.Object   { return &plain{} }
+
+type hooked struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Value             string `json:"value,omitempty"`
+}
+
+type hookedList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []hooked `json:"items"`
+}
+
+func (h *hooked) DeepCopyObject() runtime.Object {
+	out := *h
+	h.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+func (h *hooked) GetObjectMeta() *metav1.ObjectMeta                    { return &h.ObjectMeta }
+func (h *hooked) NamespaceScoped() bool                                { return true }
+func (h *hooked) New() runtime.Object                                  { return &hooked{} }
+func (h *hooked) NewList() runtime.Object                              { return &hookedList{} }
+func (h *hooked) GetGroupVersionResource() schema.GroupVersionResource { return hookedGVR }
+func (h *hooked) IsStorageVersion() bool                               { return true }
+
+func (l *hookedList) DeepCopyObject() runtime.Object {
+	out := *l
+	out.Items = make([]hooked, len(l.Items))
+	for i := range l.Items {
+		out.Items[i] = *l.Items[i].DeepCopyObject().(*hooked)
+	}
+	return &out
+}
+
+func (l *hookedList) GetListMeta() *metav1.ListMeta { return &l.ListMeta }
+
+func (h *hooked) BeginCreate(_ context.Context, _ *metav1.CreateOptions) (resourcestrategy.FinishFunc, error) {
+	hookCalls.add("BeginCreate")
+	return func(_ context.Context, success bool) {
+		if success {
+			hookCalls.add("FinishCreate(true)")
+		} else {
+			hookCalls.add("FinishCreate(false)")
+		}
+	}, nil
+}
+
+func (h *hooked) AfterCreate(_ *metav1.CreateOptions) {
+	hookCalls.add("AfterCreate")
+}
+
+// BeginUpdate returns a nil FinishFunc, which must be tolerated.
+func (h *hooked) BeginUpdate(_ context.Context, _ runtime.Object, _ *metav1.UpdateOptions) (resourcestrategy.FinishFunc, error) {
+	hookCalls.add("BeginUpdate")
+	return nil, nil
+}
+
+func (h *hooked) AfterUpdate(_ *metav1.UpdateOptions) {
+	hookCalls.add("AfterUpdate")
+}
+
+func (h *hooked) AfterDelete(_ *metav1.DeleteOptions) {
+	hookCalls.add("AfterDelete")
+}
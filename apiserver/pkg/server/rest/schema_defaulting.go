@@ -0,0 +1,262 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
+	openapiutil "k8s.io/kube-openapi/pkg/util"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcestrategy"
+)
+
+// AddDefaultingFuncs registers the defaulting of every version of the types known to s, replacing the defaulting
+// registered by resource.AddToScheme.  The default values of the OpenAPI schema of the type in getDefinitions are
+// applied first, like the structural defaulting of custom resources, then the Default function of types
+// implementing resourcestrategy.Defaulter.  The scheme applies the defaulting when decoding requests and objects
+// read from storage.
+//
+// The default values are declared on the Go types with the +default marker of openapi-gen.  Typed objects can't
+// tell an absent field from its zero value, so defaults only apply to fields that are omitted when empty.
+func AddDefaultingFuncs(s *runtime.Scheme, getDefinitions openapicommon.GetOpenAPIDefinitions) error {
+	var definitions map[string]openapicommon.OpenAPIDefinition
+	if getDefinitions != nil {
+		definitions = getDefinitions(func(path string) spec.Ref {
+			return spec.MustCreateRef(path)
+		})
+	}
+
+	registered := map[reflect.Type]bool{}
+	for _, t := range s.AllKnownTypes() {
+		if registered[t] {
+			continue
+		}
+		registered[t] = true
+		// the meta types registered in every version, e.g. the watch events, declare no defaults and may
+		// reference runtime.Object, which has no schema
+		if strings.HasPrefix(t.PkgPath(), "k8s.io/apimachinery/") {
+			continue
+		}
+
+		obj := reflect.New(t).Interface()
+		_, isDefaulter := obj.(resourcestrategy.Defaulter)
+		var defaults *defaultsNode
+		if name := openapiutil.GetCanonicalTypeName(obj); definitions != nil {
+			if _, ok := definitions[name]; ok {
+				schema, err := resolveSchema(definitions, name)
+				if err != nil {
+					return err
+				}
+				if defaults, err = newDefaultsNode(schema, true); err != nil {
+					return fmt.Errorf("default values of %s: %w", name, err)
+				}
+			}
+		}
+		if defaults == nil && !isDefaulter {
+			continue
+		}
+		s.AddTypeDefaultingFunc(obj.(runtime.Object), func(obj interface{}) {
+			if defaults != nil {
+				applySchemaDefaults(obj.(runtime.Object), defaults)
+			}
+			if d, ok := obj.(resourcestrategy.Defaulter); ok {
+				d.Default()
+			}
+		})
+	}
+	return nil
+}
+
+// SchemaDefaulter applies the default values of an OpenAPI schema to unstructured objects, e.g. the objects of a
+// version of a ResourceDefinition.  Unlike the defaulting of typed objects, zero default values are applied.
+type SchemaDefaulter struct {
+	defaults *defaultsNode
+}
+
+// NewSchemaDefaulter returns a SchemaDefaulter for the schema s without references.
+func NewSchemaDefaulter(s *spec.Schema) (*SchemaDefaulter, error) {
+	defaults, err := newDefaultsNode(s, false)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaDefaulter{defaults: defaults}, nil
+}
+
+// Default sets the absent fields of obj with a default value.  A nil SchemaDefaulter doesn't change obj.
+func (d *SchemaDefaulter) Default(obj runtime.Unstructured) {
+	if d == nil || d.defaults == nil {
+		return
+	}
+	d.defaults.apply(obj.UnstructuredContent())
+}
+
+// applySchemaDefaults sets the absent fields of obj with a default value.
+func applySchemaDefaults(obj runtime.Object, defaults *defaultsNode) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("defaulting %T: %w", obj, err))
+		return
+	}
+	if !defaults.apply(u) {
+		return
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, obj); err != nil {
+		utilruntime.HandleError(fmt.Errorf("defaulting %T: %w", obj, err))
+	}
+}
+
+// defaultsNode holds the default values of the properties of a schema, and the children of the schema with
+// default values.  For typed objects, zero default values, which openapi-gen declares for fields without
+// omitempty, are ignored as they don't change the objects.
+type defaultsNode struct {
+	defaults             map[string]interface{}
+	properties           map[string]*defaultsNode
+	additionalProperties *defaultsNode
+	items                *defaultsNode
+	// declared holds the properties of the schema when it also has additional properties
+	declared map[string]bool
+}
+
+// newDefaultsNode returns the default values of s, or nil if it has none.  Zero default values are ignored if
+// skipZero is true.
+func newDefaultsNode(s *spec.Schema, skipZero bool) (*defaultsNode, error) {
+	n := &defaultsNode{}
+	empty := true
+	for name, prop := range s.Properties {
+		prop := prop
+		if prop.Default != nil && !(skipZero && isZeroDefault(prop.Default)) {
+			def, err := jsonValue(prop.Default)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if n.defaults == nil {
+				n.defaults = map[string]interface{}{}
+			}
+			n.defaults[name] = def
+			empty = false
+		}
+		child, err := newDefaultsNode(&prop, skipZero)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if child != nil {
+			if n.properties == nil {
+				n.properties = map[string]*defaultsNode{}
+			}
+			n.properties[name] = child
+			empty = false
+		}
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		child, err := newDefaultsNode(s.AdditionalProperties.Schema, skipZero)
+		if err != nil {
+			return nil, fmt.Errorf("additionalProperties: %w", err)
+		}
+		n.additionalProperties = child
+		empty = empty && child == nil
+		if child != nil {
+			n.declared = map[string]bool{}
+			for name := range s.Properties {
+				n.declared[name] = true
+			}
+		}
+	}
+	if s.Items != nil && s.Items.Schema != nil {
+		child, err := newDefaultsNode(s.Items.Schema, skipZero)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		n.items = child
+		empty = empty && child == nil
+	}
+	if empty {
+		return nil, nil
+	}
+	return n, nil
+}
+
+// apply sets the default values absent from v, including in the default values themselves, and returns true
+// if v changed.
+func (n *defaultsNode) apply(v interface{}) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, def := range n.defaults {
+			if value, ok := v[k]; !ok || value == nil {
+				v[k] = runtime.DeepCopyJSONValue(def)
+				changed = true
+			}
+		}
+		for k, value := range v {
+			child, ok := n.properties[k]
+			if !ok && !n.declared[k] {
+				child = n.additionalProperties
+			}
+			if child != nil && child.apply(value) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		if n.items == nil {
+			break
+		}
+		for _, item := range v {
+			if n.items.apply(item) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// jsonValue converts a default value declared in Go to its JSON form.
+func jsonValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := utiljson.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func isZeroDefault(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
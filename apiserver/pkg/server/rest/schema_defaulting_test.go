@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/utils/ptr"
+)
+
+var doohickeyGV = schema.GroupVersion{Group: "test.kes.io", Version: "v1"}
+
+func TestAddDefaultingFuncs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(doohickeyGV.WithKind("Doohickey"), &doohickey{})
+	scheme.AddKnownTypeWithName(doohickeyGV.WithKind("Widget"), &widget{})
+	metav1.AddToGroupVersion(scheme, doohickeyGV)
+	assert.NoError(t, AddDefaultingFuncs(scheme, func(ref openapicommon.ReferenceCallback) map[string]openapicommon.OpenAPIDefinition {
+		defs := doohickeyDefinitions(ref)
+		// the watch event references runtime.Object, which has no definition
+		defs["k8s.io/apimachinery/pkg/apis/meta/v1.InternalEvent"] = openapicommon.OpenAPIDefinition{Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type:       []string{"object"},
+				Properties: map[string]spec.Schema{"Object": {SchemaProps: spec.SchemaProps{Ref: ref("k8s.io/apimachinery/pkg/runtime.Object")}}},
+			},
+		}}
+		return defs
+	}))
+
+	t.Run("schema defaults should be applied before the Defaulter", func(t *testing.T) {
+		d := &doohickey{Spec: doohickeySpec{Ports: []doohickeyPort{{Name: "a"}, {Name: "b", Protocol: "UDP"}}}}
+		scheme.Default(d)
+		assert.Equal(t, doohickeySpec{
+			Replicas: ptr.To[int32](1),
+			Mode:     "fast",
+			Ports:    []doohickeyPort{{Name: "a", Protocol: "TCP"}, {Name: "b", Protocol: "UDP"}},
+			Summary:  "fast x1",
+		}, d.Spec)
+	})
+	t.Run("set values should be kept", func(t *testing.T) {
+		d := &doohickey{Spec: doohickeySpec{Replicas: ptr.To[int32](0), Mode: "slow"}}
+		scheme.Default(d)
+		assert.Equal(t, doohickeySpec{Replicas: ptr.To[int32](0), Mode: "slow", Summary: "slow x0"}, d.Spec)
+	})
+	t.Run("defaults should be applied when decoding", func(t *testing.T) {
+		decoder := serializer.NewCodecFactory(scheme).UniversalDecoder(doohickeyGV)
+		obj, _, err := decoder.Decode([]byte(`{"apiVersion":"test.kes.io/v1","kind":"Doohickey","spec":{"ports":[{"name":"a"}]}}`), nil, &doohickey{})
+		assert.NoError(t, err)
+		assert.Equal(t, "fast x1", obj.(*doohickey).Spec.Summary)
+		assert.Equal(t, "TCP", obj.(*doohickey).Spec.Ports[0].Protocol)
+	})
+	t.Run("types without defaults should not be defaulted", func(t *testing.T) {
+		w := &widget{Spec: "a"}
+		scheme.Default(w)
+		assert.Equal(t, &widget{Spec: "a"}, w)
+	})
+}
+
+type doohickey struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              doohickeySpec `json:"spec"`
+}
+
+type doohickeySpec struct {
+	Replicas *int32          `json:"replicas,omitempty"`
+	Mode     string          `json:"mode,omitempty"`
+	Ports    []doohickeyPort `json:"ports,omitempty"`
+	Summary  string          `json:"summary,omitempty"`
+}
+
+type doohickeyPort struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+func (d *doohickey) DeepCopyObject() runtime.Object {
+	out := *d
+	d.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if d.Spec.Replicas != nil {
+		out.Spec.Replicas = ptr.To(*d.Spec.Replicas)
+	}
+	out.Spec.Ports = append([]doohickeyPort(nil), d.Spec.Ports...)
+	return &out
+}
+
+// Default summarizes the spec, relying on the schema defaults.
+func (d *doohickey) Default() {
+	d.Spec.Summary = fmt.Sprintf("%s x%d", d.Spec.Mode, *d.Spec.Replicas)
+}
+
+func doohickeyDefinitions(ref openapicommon.ReferenceCallback) map[string]openapicommon.OpenAPIDefinition {
+	return map[string]openapicommon.OpenAPIDefinition{
+		"github.com/vine-io/kes/apiserver/pkg/server/rest.doohickey": {Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					// zero defaults are ignored
+					"spec": {SchemaProps: spec.SchemaProps{Default: map[string]interface{}{}, Ref: ref("github.com/vine-io/kes/apiserver/pkg/server/rest.doohickeySpec")}},
+				},
+			},
+		}},
+		"github.com/vine-io/kes/apiserver/pkg/server/rest.doohickeySpec": {Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"replicas": {SchemaProps: spec.SchemaProps{Type: []string{"integer"}, Default: 1}},
+					"mode":     {SchemaProps: spec.SchemaProps{Type: []string{"string"}, Default: "fast"}},
+					"ports": {SchemaProps: spec.SchemaProps{Type: []string{"array"}, Items: &spec.SchemaOrArray{Schema: &spec.Schema{
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"object"},
+							Properties: map[string]spec.Schema{
+								"name":     {SchemaProps: spec.SchemaProps{Type: []string{"string"}, Default: ""}},
+								"protocol": {SchemaProps: spec.SchemaProps{Type: []string{"string"}, Default: "TCP"}},
+							},
+						},
+					}}}},
+				},
+			},
+		}},
+	}
+}
@@ -0,0 +1,514 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package rest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/version"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	apiservercel "k8s.io/apiserver/pkg/cel"
+	"k8s.io/apiserver/pkg/cel/common"
+	"k8s.io/apiserver/pkg/cel/environment"
+	"k8s.io/apiserver/pkg/cel/library"
+	"k8s.io/apiserver/pkg/cel/openapi"
+	"k8s.io/apiserver/pkg/cel/openapi/resolver"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
+	openapiutil "k8s.io/kube-openapi/pkg/util"
+	openapierrors "k8s.io/kube-openapi/pkg/validation/errors"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+)
+
+// SchemaValidator validates objects against the OpenAPI schema of their type, as the apiserver validates custom
+// resources: the structural constraints of the schema (required, enum, pattern, minimum and maximum, lengths
+// and item counts) and the CEL rules declared with x-kubernetes-validations.  Rules referring to oldSelf are
+// transition rules, only evaluated on update.
+//
+// The constraints are declared on the Go types with the markers of openapi-gen, e.g.
+// +k8s:validation:maximum=10 or +k8s:validation:cel[0]:rule="self.minReplicas <= self.maxReplicas".
+//
+// The metadata is not validated against the schema, it is validated by the generic registry.
+type SchemaValidator struct {
+	schema *spec.Schema
+	rules  *ruleNode
+}
+
+// NewSchemaValidator returns a SchemaValidator for the type of obj from its definition in getDefinitions, or
+// nil if the type has no definition.  It fails if a CEL rule of the schema doesn't compile.
+func NewSchemaValidator(obj runtime.Object, getDefinitions openapicommon.GetOpenAPIDefinitions) (*SchemaValidator, error) {
+	if getDefinitions == nil {
+		return nil, nil
+	}
+	definitions := getDefinitions(func(path string) spec.Ref {
+		return spec.MustCreateRef(path)
+	})
+	name := openapiutil.GetCanonicalTypeName(obj)
+	if _, ok := definitions[name]; !ok {
+		return nil, nil
+	}
+	s, err := resolveSchema(definitions, name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := NewSchemaValidatorForSchema(s)
+	if err != nil {
+		return nil, fmt.Errorf("compiling the validation rules of %s: %w", name, err)
+	}
+	return v, nil
+}
+
+// NewSchemaValidatorForSchema returns a SchemaValidator for the objects of the schema s without references, e.g.
+// the schema of a version of a ResourceDefinition.  The apiVersion, kind and metadata properties of s are
+// ignored.  It fails if a CEL rule of the schema doesn't compile.
+func NewSchemaValidatorForSchema(s *spec.Schema) (*SchemaValidator, error) {
+	schema := *s
+	schema.Properties = make(map[string]spec.Schema, len(s.Properties))
+	for name, prop := range s.Properties {
+		switch name {
+		case "apiVersion", "kind", "metadata":
+		default:
+			schema.Properties[name] = prop
+		}
+	}
+
+	c := &ruleCompiler{}
+	rules, err := c.compile(common.WithTypeAndObjectMeta(s), true)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaValidator{schema: &schema, rules: rules}, nil
+}
+
+// resolveSchema returns the schema of the definition name with the references replaced by their definitions.
+func resolveSchema(definitions map[string]openapicommon.OpenAPIDefinition, name string) (*spec.Schema, error) {
+	s, err := resolver.PopulateRefs(func(ref string) (*spec.Schema, bool) {
+		definition, ok := definitions[ref]
+		if !ok {
+			return nil, false
+		}
+		s := definition.Schema
+		return &s, true
+	}, name)
+	if err != nil {
+		return nil, fmt.Errorf("resolving the schema of %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Validate validates obj on create.  A nil SchemaValidator accepts every object.
+func (v *SchemaValidator) Validate(obj runtime.Object) field.ErrorList {
+	return v.validate(obj, nil)
+}
+
+// ValidateUpdate validates obj replacing old.
+func (v *SchemaValidator) ValidateUpdate(obj, old runtime.Object) field.ErrorList {
+	return v.validate(obj, old)
+}
+
+func (v *SchemaValidator) validate(obj, old runtime.Object) field.ErrorList {
+	if v == nil {
+		return field.ErrorList{}
+	}
+	u, err := toUnstructured(obj)
+	if err != nil {
+		return field.ErrorList{field.InternalError(nil, err)}
+	}
+
+	allErrs := schemaErrors(validate.NewSchemaValidator(v.schema, nil, "", strfmt.Default).Validate(u).Errors)
+	if v.rules != nil {
+		var oldU map[string]interface{}
+		if old != nil {
+			if oldU, err = toUnstructured(old); err != nil {
+				return append(allErrs, field.InternalError(nil, err))
+			}
+		}
+		allErrs = append(allErrs, v.rules.validate(nil, u, oldU, old != nil)...)
+	}
+	return allErrs
+}
+
+// toUnstructured returns the JSON form of obj, without the null values of fields without omitempty which a
+// client could not have sent.  The content of unstructured objects is copied.
+func toUnstructured(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		content := runtime.DeepCopyJSON(u.UnstructuredContent())
+		pruneNulls(content)
+		return content, nil
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	pruneNulls(u)
+	return u, nil
+}
+
+func pruneNulls(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if value == nil {
+				delete(v, k)
+				continue
+			}
+			pruneNulls(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			pruneNulls(value)
+		}
+	}
+}
+
+// schemaErrors converts the errors of the OpenAPI validation to field errors.
+func schemaErrors(errs []error) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, err := range errs {
+		switch err := err.(type) {
+		case *openapierrors.CompositeError:
+			allErrs = append(allErrs, schemaErrors(err.Errors)...)
+		case *openapierrors.Validation:
+			fldPath := fieldPathFor(err.Name)
+			switch err.Code() {
+			case openapierrors.RequiredFailCode:
+				allErrs = append(allErrs, field.Required(fldPath, ""))
+			case openapierrors.EnumFailCode:
+				values := make([]string, 0, len(err.Values))
+				for _, v := range err.Values {
+					values = append(values, fmt.Sprint(v))
+				}
+				allErrs = append(allErrs, field.NotSupported(fldPath, err.Value, values))
+			case openapierrors.TooLongFailCode:
+				max, _ := err.Valid.(int64)
+				allErrs = append(allErrs, field.TooLongMaxLength(fldPath, err.Value, int(max)))
+			case openapierrors.MaxItemsFailCode:
+				max, _ := err.Valid.(int64)
+				actual, _ := err.Value.(int64)
+				allErrs = append(allErrs, field.TooMany(fldPath, int(actual), int(max)))
+			case openapierrors.UniqueFailCode:
+				allErrs = append(allErrs, field.Duplicate(fldPath, err.Value))
+			default:
+				allErrs = append(allErrs, field.Invalid(fldPath, err.Value, schemaErrorMessage(err)))
+			}
+		default:
+			allErrs = append(allErrs, field.Invalid(nil, nil, err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// schemaErrorMessage returns the message of err without the field name, which is in the field path.
+func schemaErrorMessage(err *openapierrors.Validation) string {
+	msg := err.Error()
+	for _, prefix := range []string{err.Name + " in " + err.In + " ", err.Name + " "} {
+		if strings.HasPrefix(msg, prefix) {
+			return strings.TrimPrefix(msg, prefix)
+		}
+	}
+	return msg
+}
+
+// fieldPathFor parses the path of the OpenAPI validation errors, e.g. spec.items[0].name.
+func fieldPathFor(name string) *field.Path {
+	var fldPath *field.Path
+	if name == "" || name == "." {
+		return fldPath
+	}
+	for _, part := range strings.Split(name, ".") {
+		child, indexes, _ := strings.Cut(part, "[")
+		if fldPath == nil {
+			fldPath = field.NewPath(child)
+		} else {
+			fldPath = fldPath.Child(child)
+		}
+		if indexes == "" {
+			continue
+		}
+		for _, index := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				fldPath = fldPath.Key(index)
+				continue
+			}
+			fldPath = fldPath.Index(i)
+		}
+	}
+	return fldPath
+}
+
+// ruleNode holds the compiled rules of a schema and of its children with rules.
+type ruleNode struct {
+	schema               *spec.Schema
+	rules                []compiledRule
+	properties           map[string]*ruleNode
+	additionalProperties *ruleNode
+	items                *ruleNode
+}
+
+type compiledRule struct {
+	rule    common.ValidationRule
+	program cel.Program
+	// transition is true for rules referring to oldSelf
+	transition bool
+}
+
+type ruleCompiler struct {
+	envSet *environment.EnvSet
+	types  int
+}
+
+// compile returns the rules of s and its children, or nil if there are none.
+func (c *ruleCompiler) compile(s *spec.Schema, root bool) (*ruleNode, error) {
+	n := &ruleNode{schema: s}
+	empty := true
+	for name, prop := range s.Properties {
+		prop := prop
+		child, err := c.compile(&prop, false)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if child != nil {
+			if n.properties == nil {
+				n.properties = map[string]*ruleNode{}
+			}
+			n.properties[name] = child
+			empty = false
+		}
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		child, err := c.compile(s.AdditionalProperties.Schema, false)
+		if err != nil {
+			return nil, fmt.Errorf("additionalProperties: %w", err)
+		}
+		n.additionalProperties = child
+		empty = empty && child == nil
+	}
+	if s.Items != nil && s.Items.Schema != nil {
+		child, err := c.compile(s.Items.Schema, false)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		n.items = child
+		empty = empty && child == nil
+	}
+
+	rules := (&openapi.Schema{Schema: s}).XValidations()
+	if len(rules) == 0 {
+		if empty {
+			return nil, nil
+		}
+		return n, nil
+	}
+	env, declType, err := c.env(s, root)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		compiled, err := compileRule(env, declType, rule)
+		if err != nil {
+			return nil, err
+		}
+		n.rules = append(n.rules, compiled)
+	}
+	return n, nil
+}
+
+// env returns the environment of the rules of s, declaring self and oldSelf with the type of s.
+func (c *ruleCompiler) env(s *spec.Schema, root bool) (*cel.Env, *apiservercel.DeclType, error) {
+	if c.envSet == nil {
+		c.envSet = environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion())
+	}
+	declType := common.SchemaDeclType(&openapi.Schema{Schema: s}, root)
+	if declType == nil {
+		return nil, nil, fmt.Errorf("rules are not supported on the type of the schema")
+	}
+	c.types++
+	declType = declType.MaybeAssignTypeName(fmt.Sprintf("selfType%d", c.types))
+	envSet, err := c.envSet.Extend(environment.VersionedOptions{
+		IntroducedVersion: version.MajorMinor(1, 0),
+		EnvOptions: []cel.EnvOption{
+			cel.Variable("self", declType.CelType()),
+			cel.Variable("oldSelf", declType.CelType()),
+		},
+		DeclTypes: []*apiservercel.DeclType{declType},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	env, err := envSet.Env(environment.StoredExpressions)
+	return env, declType, err
+}
+
+func compileRule(env *cel.Env, declType *apiservercel.DeclType, rule common.ValidationRule) (compiledRule, error) {
+	ast, issues := env.Compile(rule.Rule())
+	if issues != nil && issues.Err() != nil {
+		return compiledRule{}, fmt.Errorf("rule %q: %w", rule.Rule(), issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType {
+		return compiledRule{}, fmt.Errorf("rule %q must evaluate to a bool", rule.Rule())
+	}
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		return compiledRule{}, err
+	}
+	compiled := compiledRule{rule: rule}
+	for _, ref := range checked.ReferenceMap {
+		if ref.Name == "oldSelf" {
+			compiled.transition = true
+		}
+	}
+	compiled.program, err = env.Program(ast,
+		cel.CostLimit(celconfig.PerCallLimit),
+		cel.CostTracking(&library.CostEstimator{}),
+		cel.InterruptCheckFrequency(celconfig.CheckFrequency),
+	)
+	if err != nil {
+		return compiledRule{}, fmt.Errorf("rule %q: %w", rule.Rule(), err)
+	}
+	return compiled, nil
+}
+
+// validate evaluates the rules against obj and old, the value in the object being replaced.
+func (n *ruleNode) validate(fldPath *field.Path, obj, old interface{}, hasOld bool) field.ErrorList {
+	if obj == nil {
+		return nil
+	}
+	allErrs := field.ErrorList{}
+	if len(n.rules) > 0 {
+		activation := map[string]interface{}{"self": common.UnstructuredToVal(obj, &openapi.Schema{Schema: n.schema})}
+		if hasOld {
+			activation["oldSelf"] = common.UnstructuredToVal(old, &openapi.Schema{Schema: n.schema})
+		}
+		for _, r := range n.rules {
+			if r.transition && !hasOld {
+				continue
+			}
+			rulePath := fldPath
+			if p := r.rule.FieldPath(); p != "" {
+				rulePath = appendFieldPath(fldPath, p)
+			}
+			out, _, err := r.program.Eval(activation)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(rulePath, schemaType(n.schema), fmt.Sprintf("rule %q: %v", r.rule.Rule(), err)))
+				continue
+			}
+			if out != types.True {
+				allErrs = append(allErrs, field.Invalid(rulePath, schemaType(n.schema), ruleMessage(r.rule)))
+			}
+		}
+	}
+
+	switch obj := obj.(type) {
+	case map[string]interface{}:
+		oldMap, _ := old.(map[string]interface{})
+		for k, v := range obj {
+			child := n.properties[k]
+			if child == nil && n.schema.Properties != nil {
+				if _, ok := n.schema.Properties[k]; ok {
+					continue
+				}
+			}
+			if child == nil {
+				child = n.additionalProperties
+			}
+			if child == nil {
+				continue
+			}
+			oldV, ok := oldMap[k]
+			allErrs = append(allErrs, child.validate(fldPath.Child(k), v, oldV, hasOld && ok)...)
+		}
+	case []interface{}:
+		if n.items == nil {
+			break
+		}
+		oldItems := correlatedItems(n.schema, old)
+		for i, v := range obj {
+			oldV, ok := oldItems[mapKey(n.schema, v)]
+			allErrs = append(allErrs, n.items.validate(fldPath.Index(i), v, oldV, hasOld && ok && oldItems != nil)...)
+		}
+	}
+	return allErrs
+}
+
+// correlatedItems indexes the items of the old value of a list of type map by their keys.  Items of other lists
+// are not correlated, so their transition rules are not evaluated.
+func correlatedItems(s *spec.Schema, old interface{}) map[string]interface{} {
+	items, ok := old.([]interface{})
+	if !ok || len((&openapi.Schema{Schema: s}).XListMapKeys()) == 0 {
+		return nil
+	}
+	indexed := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		indexed[mapKey(s, item)] = item
+	}
+	return indexed
+}
+
+// mapKey returns the key of an item of a list of type map.
+func mapKey(s *spec.Schema, item interface{}) string {
+	m, _ := item.(map[string]interface{})
+	var key []string
+	for _, k := range (&openapi.Schema{Schema: s}).XListMapKeys() {
+		key = append(key, fmt.Sprintf("%v", m[k]))
+	}
+	return strings.Join(key, "/")
+}
+
+// appendFieldPath appends the JSON path of a rule, e.g. .spec.replicas or .labels['name'].
+func appendFieldPath(fldPath *field.Path, p string) *field.Path {
+	for _, part := range strings.Split(strings.TrimPrefix(p, "."), ".") {
+		child, key, _ := strings.Cut(part, "[")
+		if child != "" {
+			if fldPath == nil {
+				fldPath = field.NewPath(child)
+			} else {
+				fldPath = fldPath.Child(child)
+			}
+		}
+		if key != "" {
+			fldPath = fldPath.Key(strings.Trim(key, "]'"))
+		}
+	}
+	return fldPath
+}
+
+func ruleMessage(rule common.ValidationRule) string {
+	if rule.Message() != "" {
+		return rule.Message()
+	}
+	return fmt.Sprintf("failed rule: %s", rule.Rule())
+}
+
+func schemaType(s *spec.Schema) string {
+	if len(s.Type) == 0 {
+		return ""
+	}
+	return s.Type[0]
+}
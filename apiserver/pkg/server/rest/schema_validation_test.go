@@ -0,0 +1,208 @@
+package rest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	generatedopenapi "github.com/vine-io/kes/apiserver/pkg/generated/openapi"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	v, err := NewSchemaValidator(&gizmo{}, gizmoDefinitions(nil))
+	assert.NoError(t, err)
+	assert.NotNil(t, v)
+
+	t.Run("valid object should be accepted", func(t *testing.T) {
+		assert.Empty(t, v.Validate(newGizmo()))
+	})
+	t.Run("schema constraints should be enforced", func(t *testing.T) {
+		g := newGizmo()
+		g.Spec.Mode = ""
+		g.Spec.Size = 11
+		g.Spec.Name = "Gizmo"
+		g.Spec.Tags = []string{"a", "b", "c"}
+		assert.ElementsMatch(t, []string{
+			"spec.mode: Required value",
+			"spec.size: Invalid value: 11: should be less than or equal to 10",
+			"spec.name: Invalid value: \"Gizmo\": should match '^[a-z]+$'",
+			"spec.tags: Too many: 3: must have at most 2 items",
+		}, errorStrings(v.Validate(g)))
+
+		g = newGizmo()
+		g.Spec.Mode = "turbo"
+		assert.Equal(t, []string{`spec.mode: Unsupported value: "turbo": supported values: "fast", "slow"`}, errorStrings(v.Validate(g)))
+	})
+	t.Run("rules should be evaluated on their schema", func(t *testing.T) {
+		g := newGizmo()
+		g.Name = "widget"
+		g.Spec.Mode = "slow"
+		g.Spec.Size = 7
+		g.Spec.Ports[0].Port = 0
+		assert.ElementsMatch(t, []string{
+			`<nil>: Invalid value: "object": failed rule: self.metadata.name.startsWith('g')`,
+			`spec.size: Invalid value: "object": slow gizmos must be smaller than 5`,
+			`spec.ports[0]: Invalid value: "object": failed rule: self.port > 0`,
+		}, errorStrings(v.Validate(g)))
+	})
+	t.Run("transition rules should only be evaluated against correlated old values", func(t *testing.T) {
+		old := newGizmo()
+		g := newGizmo()
+		g.Spec.Ports[0].Port = 8443
+		g.Spec.Ports = append(g.Spec.Ports, gizmoPort{Name: "metrics", Port: 9090})
+		assert.Empty(t, v.Validate(g))
+		assert.Equal(t, []string{`spec.ports[0]: Invalid value: "object": port is immutable`}, errorStrings(v.ValidateUpdate(g, old)))
+	})
+	t.Run("strategy should validate the schema before the type", func(t *testing.T) {
+		g := newGizmo()
+		g.Spec.Mode = ""
+		s := DefaultStrategy{Object: &gizmo{}, SchemaValidator: v}
+		assert.Len(t, s.Validate(context.TODO(), g), 1)
+		assert.Len(t, s.ValidateUpdate(context.TODO(), g, newGizmo()), 1)
+	})
+	t.Run("types without a schema should not be validated", func(t *testing.T) {
+		v, err := NewSchemaValidator(&widget{}, gizmoDefinitions(nil))
+		assert.NoError(t, err)
+		assert.Nil(t, v)
+		assert.Empty(t, v.Validate(&widget{}))
+
+		v, err = NewSchemaValidator(&gizmo{}, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, v)
+	})
+	t.Run("invalid rules should fail", func(t *testing.T) {
+		_, err := NewSchemaValidator(&gizmo{}, gizmoDefinitions([]interface{}{map[string]interface{}{"rule": "self.missing > 0"}}))
+		assert.ErrorContains(t, err, "self.missing > 0")
+		_, err = NewSchemaValidator(&gizmo{}, gizmoDefinitions([]interface{}{map[string]interface{}{"rule": "self.size"}}))
+		assert.ErrorContains(t, err, "must evaluate to a bool")
+	})
+}
+
+func TestFieldPathFor(t *testing.T) {
+	assert.Nil(t, fieldPathFor(""))
+	assert.Equal(t, "spec", fieldPathFor("spec").String())
+	assert.Equal(t, "spec.items[0].name", fieldPathFor("spec.items[0].name").String())
+	assert.Equal(t, "spec.matrix[1][2]", fieldPathFor("spec.matrix[1][2]").String())
+}
+
+func errorStrings(errs field.ErrorList) []string {
+	var s []string
+	for _, err := range errs {
+		s = append(s, err.Error())
+	}
+	return s
+}
+
+type gizmo struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              gizmoSpec `json:"spec"`
+}
+
+type gizmoSpec struct {
+	Size  int64       `json:"size"`
+	Mode  string      `json:"mode,omitempty"`
+	Name  string      `json:"name,omitempty"`
+	Tags  []string    `json:"tags"`
+	Ports []gizmoPort `json:"ports,omitempty"`
+}
+
+type gizmoPort struct {
+	Name string `json:"name"`
+	Port int64  `json:"port"`
+}
+
+func (g *gizmo) DeepCopyObject() runtime.Object {
+	out := *g
+	g.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec.Tags = append([]string(nil), g.Spec.Tags...)
+	out.Spec.Ports = append([]gizmoPort(nil), g.Spec.Ports...)
+	return &out
+}
+
+func newGizmo() *gizmo {
+	return &gizmo{
+		ObjectMeta: metav1.ObjectMeta{Name: "gizmo"},
+		Spec: gizmoSpec{
+			Size:  3,
+			Mode:  "fast",
+			Name:  "gizmo",
+			Ports: []gizmoPort{{Name: "https", Port: 443}},
+		},
+	}
+}
+
+// gizmoDefinitions returns the definitions of gizmo, with specRules added to the rules of its spec.
+func gizmoDefinitions(specRules []interface{}) openapicommon.GetOpenAPIDefinitions {
+	return func(ref openapicommon.ReferenceCallback) map[string]openapicommon.OpenAPIDefinition {
+		minimum, maximum := 1.0, 10.0
+		maxItems := int64(2)
+		rules := func(rules ...interface{}) spec.VendorExtensible {
+			return spec.VendorExtensible{Extensions: spec.Extensions{"x-kubernetes-validations": rules}}
+		}
+		port := spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type:     []string{"object"},
+				Required: []string{"name", "port"},
+				Properties: map[string]spec.Schema{
+					"name": *spec.StringProperty(),
+					"port": *spec.Int64Property(),
+				},
+			},
+			VendorExtensible: rules(
+				map[string]interface{}{"rule": "self.port > 0"},
+				map[string]interface{}{"rule": "self.port == oldSelf.port", "message": "port is immutable"},
+			),
+		}
+		return map[string]openapicommon.OpenAPIDefinition{
+			"github.com/vine-io/kes/apiserver/pkg/server/rest.gizmo": {Schema: spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Type: []string{"object"},
+					Properties: map[string]spec.Schema{
+						"spec": {SchemaProps: spec.SchemaProps{Ref: ref("github.com/vine-io/kes/apiserver/pkg/server/rest.gizmoSpec")}},
+					},
+				},
+				VendorExtensible: rules(map[string]interface{}{"rule": "self.metadata.name.startsWith('g')"}),
+			}},
+			"github.com/vine-io/kes/apiserver/pkg/server/rest.gizmoSpec": {Schema: spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Type:     []string{"object"},
+					Required: []string{"mode"},
+					Properties: map[string]spec.Schema{
+						"size": {SchemaProps: spec.SchemaProps{Type: []string{"integer"}, Format: "int64", Minimum: &minimum, Maximum: &maximum}},
+						"mode": {SchemaProps: spec.SchemaProps{Type: []string{"string"}, Enum: []interface{}{"fast", "slow"}}},
+						"name": {SchemaProps: spec.SchemaProps{Type: []string{"string"}, Pattern: "^[a-z]+$"}},
+						"tags": {SchemaProps: spec.SchemaProps{Type: []string{"array"}, MaxItems: &maxItems, Items: &spec.SchemaOrArray{Schema: spec.StringProperty()}}},
+						"ports": {
+							SchemaProps: spec.SchemaProps{Type: []string{"array"}, Items: &spec.SchemaOrArray{Schema: &port}},
+							VendorExtensible: spec.VendorExtensible{Extensions: spec.Extensions{
+								"x-kubernetes-list-type":     "map",
+								"x-kubernetes-list-map-keys": []interface{}{"name"},
+							}},
+						},
+					},
+				},
+				VendorExtensible: rules(append([]interface{}{map[string]interface{}{
+					"rule": "!has(self.mode) || self.mode != 'slow' || self.size < 5", "message": "slow gizmos must be smaller than 5", "fieldPath": ".size",
+				}}, specRules...)...),
+			}},
+		}
+	}
+}
+
+func TestSchemaValidatorGeneratedDefinitions(t *testing.T) {
+	v, err := NewSchemaValidator(&v1alpha1.Flunder{}, generatedopenapi.GetOpenAPIDefinitions)
+	assert.NoError(t, err)
+
+	f := &v1alpha1.Flunder{ObjectMeta: metav1.ObjectMeta{Name: "a"}}
+	assert.Empty(t, v.Validate(f))
+	f.Spec.ReferenceType = "Other"
+	assert.Equal(t, []string{`spec.referenceType: Unsupported value: "Other": supported values: "Fischer", "Flunder"`}, errorStrings(v.Validate(f)))
+}
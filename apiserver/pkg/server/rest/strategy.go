@@ -27,6 +27,7 @@ import (
 	"k8s.io/apiserver/pkg/registry/rest"
 	"k8s.io/apiserver/pkg/storage"
 	"k8s.io/apiserver/pkg/storage/names"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
 
 	"github.com/vine-io/kes/apiserver/pkg/server/resource"
 	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcestrategy"
@@ -52,6 +53,10 @@ type DefaultStrategy struct {
 	Object runtime.Object
 	runtime.ObjectTyper
 	TableConvertor rest.TableConvertor
+	// OpenAPIDefinitions are the definitions of the resource types, used to derive the reset fields.
+	OpenAPIDefinitions openapicommon.GetOpenAPIDefinitions
+	// SchemaValidator validates the resource against its OpenAPI schema, if not nil.
+	SchemaValidator *SchemaValidator
 }
 
 // GenerateName generates a new name for a resource without one.
@@ -94,12 +99,13 @@ func (DefaultStrategy) PrepareForUpdate(ctx context.Context, obj, old runtime.Ob
 	}
 }
 
-// Validate calls the Validate function on obj if supported, otherwise does nothing.
-func (DefaultStrategy) Validate(ctx context.Context, obj runtime.Object) field.ErrorList {
+// Validate validates obj against its OpenAPI schema and calls the Validate function on obj if supported.
+func (d DefaultStrategy) Validate(ctx context.Context, obj runtime.Object) field.ErrorList {
+	allErrs := d.SchemaValidator.Validate(obj)
 	if v, ok := obj.(resourcestrategy.Validater); ok {
-		return v.Validate(ctx)
+		allErrs = append(allErrs, v.Validate(ctx)...)
 	}
-	return field.ErrorList{}
+	return allErrs
 }
 
 // AllowCreateOnUpdate is used by the Store
@@ -131,12 +137,14 @@ func (DefaultStrategy) Canonicalize(obj runtime.Object) {
 	}
 }
 
-// ValidateUpdate calls the ValidateUpdate function on obj if supported, otherwise does nothing.
-func (DefaultStrategy) ValidateUpdate(ctx context.Context, obj, old runtime.Object) field.ErrorList {
+// ValidateUpdate validates obj against its OpenAPI schema and calls the ValidateUpdate function on obj if
+// supported.
+func (d DefaultStrategy) ValidateUpdate(ctx context.Context, obj, old runtime.Object) field.ErrorList {
+	allErrs := d.SchemaValidator.ValidateUpdate(obj, old)
 	if v, ok := obj.(resourcestrategy.ValidateUpdater); ok {
-		return v.ValidateUpdate(ctx, old)
+		allErrs = append(allErrs, v.ValidateUpdate(ctx, old)...)
 	}
-	return field.ErrorList{}
+	return allErrs
 }
 
 // Match is the filter used by the generic etcd backend to watch events
@@ -0,0 +1,355 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/apimachinery/pkg/util/httpstream/wsstream"
+	"k8s.io/apimachinery/pkg/util/remotecommand"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+const (
+	// DefaultStreamIdleTimeout is the time after which an exec connection without traffic is closed.
+	DefaultStreamIdleTimeout = 4 * time.Hour
+	// DefaultStreamCreationTimeout is the time a SPDY client has to create its streams.
+	DefaultStreamCreationTimeout = remotecommand.DefaultStreamCreationTimeout
+)
+
+// execProtocols are the remote command protocols served by ExecHandler, in order of preference.  Both
+// report exit codes on the error stream; v5 adds a CLOSE signal for half-closing stdin over WebSockets.
+var execProtocols = []string{remotecommand.StreamProtocolV5Name, remotecommand.StreamProtocolV4Name}
+
+// TerminalSize is the size of the terminal of a TTY exec session.
+type TerminalSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// Streams are the streams attached to an exec session.  Streams not requested by the client are nil.
+type Streams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Resize receives the terminal size changes of a TTY session.  It is closed when the client stops
+	// sending them.
+	Resize <-chan TerminalSize
+}
+
+// ExecFunc runs the command described by opts for the resource named name and returns once it exits.
+// ctx is cancelled when the client goes away.  Returning an ExitError reports the exit code to the client.
+type ExecFunc func(ctx context.Context, name string, opts *ExecOptions, streams Streams) error
+
+// ExitError is an error of a command that exited with a non-zero exit code.
+type ExitError interface {
+	error
+	ExitStatus() int
+}
+
+// ExecHandler is a http.Handler for the Connect method of an exec subresource.  It upgrades the request to
+// a WebSocket or SPDY connection speaking the v5.channel.k8s.io or v4.channel.k8s.io protocol, so that
+// clients such as kubectl exec can attach to the command run by Exec.
+type ExecHandler struct {
+	// Name is the name of the resource the command runs for.
+	Name string
+	// Options are the decoded connect options.
+	Options *ExecOptions
+	// Exec runs the command.
+	Exec ExecFunc
+	// Responder receives the errors occurring before the connection is upgraded.
+	Responder registryrest.Responder
+
+	IdleTimeout           time.Duration
+	StreamCreationTimeout time.Duration
+}
+
+// NewExecHandler returns an ExecHandler running exec with the default timeouts.
+func NewExecHandler(name string, opts *ExecOptions, exec ExecFunc, responder registryrest.Responder) *ExecHandler {
+	return &ExecHandler{
+		Name:                  name,
+		Options:               opts,
+		Exec:                  exec,
+		Responder:             responder,
+		IdleTimeout:           DefaultStreamIdleTimeout,
+		StreamCreationTimeout: DefaultStreamCreationTimeout,
+	}
+}
+
+// execStreams are the server side streams of an upgraded connection.
+type execStreams struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	errors io.Writer
+	resize io.Reader
+}
+
+func (h *ExecHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	opts := h.Options
+	if opts == nil || (!opts.Stdin && !opts.Stdout && !opts.Stderr) {
+		h.Responder.Error(apierrors.NewBadRequest("you must specify at least one of stdin, stdout, stderr"))
+		return
+	}
+
+	switch {
+	case wsstream.IsWebSocketRequest(req):
+		h.serveWebSocket(w, req)
+	case httpstream.IsUpgradeRequest(req) && len(req.Header.Values(httpstream.HeaderProtocolVersion)) > 0:
+		h.serveSPDY(w, req)
+	default:
+		h.Responder.Error(apierrors.NewBadRequest("exec requires a WebSocket or SPDY upgrade request"))
+	}
+}
+
+func (h *ExecHandler) serveWebSocket(w http.ResponseWriter, req *http.Request) {
+	opts := h.Options
+	channels := make([]wsstream.ChannelType, remotecommand.StreamResize+1)
+	channels[remotecommand.StreamStdIn] = channelType(opts.Stdin, wsstream.ReadChannel)
+	channels[remotecommand.StreamStdOut] = channelType(opts.Stdout, wsstream.WriteChannel)
+	channels[remotecommand.StreamStdErr] = channelType(opts.Stderr && !opts.TTY, wsstream.WriteChannel)
+	channels[remotecommand.StreamErr] = wsstream.WriteChannel
+	channels[remotecommand.StreamResize] = channelType(opts.TTY, wsstream.ReadChannel)
+
+	protocols := map[string]wsstream.ChannelProtocolConfig{}
+	for _, protocol := range execProtocols {
+		protocols[protocol] = wsstream.ChannelProtocolConfig{Binary: true, Channels: channels}
+	}
+	conn := wsstream.NewConn(protocols)
+	conn.SetIdleTimeout(h.IdleTimeout)
+	_, rwc, err := conn.Open(w, req)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("unable to upgrade exec request for %q: %w", h.Name, err))
+		return
+	}
+	defer conn.Close()
+
+	streams := &execStreams{errors: rwc[remotecommand.StreamErr]}
+	if opts.Stdin {
+		streams.stdin = rwc[remotecommand.StreamStdIn]
+	}
+	if opts.Stdout {
+		streams.stdout = rwc[remotecommand.StreamStdOut]
+	}
+	if opts.Stderr && !opts.TTY {
+		streams.stderr = rwc[remotecommand.StreamStdErr]
+	}
+	if opts.TTY {
+		streams.resize = rwc[remotecommand.StreamResize]
+	}
+
+	h.run(req.Context(), streams)
+}
+
+func channelType(enabled bool, t wsstream.ChannelType) wsstream.ChannelType {
+	if enabled {
+		return t
+	}
+	return wsstream.IgnoreChannel
+}
+
+type streamAndReply struct {
+	httpstream.Stream
+	replySent <-chan struct{}
+}
+
+func (h *ExecHandler) serveSPDY(w http.ResponseWriter, req *http.Request) {
+	if _, err := httpstream.Handshake(req, w, execProtocols); err != nil {
+		// the handshake has already written the response
+		return
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	streamCh := make(chan streamAndReply)
+	upgrader := spdy.NewResponseUpgrader()
+	conn := upgrader.UpgradeResponse(w, req, func(stream httpstream.Stream, replySent <-chan struct{}) error {
+		select {
+		case streamCh <- streamAndReply{Stream: stream, replySent: replySent}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	// the upgrader has already written the response if the upgrade failed
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetIdleTimeout(h.IdleTimeout)
+
+	go func() {
+		select {
+		case <-conn.CloseChan():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	streams, err := h.waitForSPDYStreams(ctx, streamCh)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("unable to create exec streams for %q: %w", h.Name, err))
+		return
+	}
+	h.run(ctx, streams)
+}
+
+// waitForSPDYStreams collects the streams the client creates for the requested options.
+func (h *ExecHandler) waitForSPDYStreams(ctx context.Context, streamCh <-chan streamAndReply) (*execStreams, error) {
+	opts := h.Options
+	expected := 1
+	for _, requested := range []bool{opts.Stdin, opts.Stdout, opts.Stderr && !opts.TTY, opts.TTY} {
+		if requested {
+			expected++
+		}
+	}
+
+	timeout := time.NewTimer(h.StreamCreationTimeout)
+	defer timeout.Stop()
+
+	streams := &execStreams{}
+	var replies []<-chan struct{}
+	for received := 0; received < expected; received++ {
+		select {
+		case s := <-streamCh:
+			streamType := s.Headers().Get(corev1.StreamType)
+			switch {
+			case streamType == corev1.StreamTypeError && streams.errors == nil:
+				streams.errors = s
+			case streamType == corev1.StreamTypeStdin && opts.Stdin && streams.stdin == nil:
+				streams.stdin = s
+			case streamType == corev1.StreamTypeStdout && opts.Stdout && streams.stdout == nil:
+				streams.stdout = s
+			case streamType == corev1.StreamTypeStderr && opts.Stderr && !opts.TTY && streams.stderr == nil:
+				streams.stderr = s
+			case streamType == corev1.StreamTypeResize && opts.TTY && streams.resize == nil:
+				streams.resize = s
+			default:
+				return nil, fmt.Errorf("unexpected stream of type %q", streamType)
+			}
+			replies = append(replies, s.replySent)
+		case <-timeout.C:
+			return nil, fmt.Errorf("timed out waiting for the client to create streams")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	for _, replySent := range replies {
+		select {
+		case <-replySent:
+		case <-timeout.C:
+			return nil, fmt.Errorf("timed out waiting for stream replies to be sent")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return streams, nil
+}
+
+// run executes the command on the upgraded streams and reports its result on the error stream.
+func (h *ExecHandler) run(ctx context.Context, s *execStreams) {
+	streams := Streams{
+		Stdin:  s.stdin,
+		Stdout: s.stdout,
+		Stderr: s.stderr,
+	}
+	if s.resize != nil {
+		resize := make(chan TerminalSize)
+		go decodeResize(ctx, s.resize, resize)
+		streams.Resize = resize
+	}
+
+	err := h.Exec(ctx, h.Name, h.Options, streams)
+	if err := writeExecStatus(s.errors, err); err != nil {
+		utilruntime.HandleError(fmt.Errorf("unable to write exec status for %q: %w", h.Name, err))
+	}
+}
+
+// decodeResize sends the terminal sizes encoded as JSON on r to ch until r ends or ctx is done.
+func decodeResize(ctx context.Context, r io.Reader, ch chan<- TerminalSize) {
+	defer close(ch)
+	decoder := json.NewDecoder(r)
+	for {
+		size := TerminalSize{}
+		if err := decoder.Decode(&size); err != nil {
+			return
+		}
+		select {
+		case ch <- size:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// writeExecStatus writes the metav1.Status expected by v4 and v5 clients for the result of an exec.
+func writeExecStatus(w io.Writer, err error) error {
+	status := &metav1.Status{Status: metav1.StatusSuccess}
+	if err != nil {
+		var exitErr ExitError
+		var statusErr apierrors.APIStatus
+		switch {
+		case errors.As(err, &exitErr) && exitErr.ExitStatus() != 0:
+			status = &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Reason:  remotecommand.NonZeroExitCodeReason,
+				Message: fmt.Sprintf("command terminated with non-zero exit code: %v", err),
+				Details: &metav1.StatusDetails{
+					Causes: []metav1.StatusCause{{
+						Type:    remotecommand.ExitCodeCauseType,
+						Message: strconv.Itoa(exitErr.ExitStatus()),
+					}},
+				},
+			}
+		case errors.As(err, &statusErr):
+			s := statusErr.Status()
+			status = &s
+		default:
+			s := apierrors.NewInternalError(err).Status()
+			status = &s
+		}
+	}
+	status.Kind = "Status"
+	status.APIVersion = "v1"
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/remotecommand"
+)
+
+func TestExecOptions(t *testing.T) {
+	t.Run("query parameters should be decoded", func(t *testing.T) {
+		opts := &ExecOptions{}
+		values := url.Values{"command": {"sh", "-c", "true"}, "stdout": {"true"}, "stderr": {"true"}, "tty": {"true"}}
+		assert.NoError(t, opts.ConvertFromUrlValues(&values))
+		assert.Equal(t, []string{"sh", "-c", "true"}, opts.Command)
+		assert.True(t, opts.Stdout)
+		assert.False(t, opts.Stderr, "stderr is merged into stdout by a tty")
+	})
+	t.Run("at least one stream should be required", func(t *testing.T) {
+		values := url.Values{"command": {"true"}}
+		assert.Error(t, (&ExecOptions{}).ConvertFromUrlValues(&values))
+	})
+}
+
+type exitError int
+
+func (e exitError) Error() string   { return "exit status" }
+func (e exitError) ExitStatus() int { return int(e) }
+
+func TestExecHandlerWebSocket(t *testing.T) {
+	echo := func(_ context.Context, name string, opts *ExecOptions, streams Streams) error {
+		data, err := io.ReadAll(streams.Stdin)
+		if err != nil {
+			return err
+		}
+		if _, err := streams.Stdout.Write([]byte(name + ":" + strings.ToUpper(string(data)))); err != nil {
+			return err
+		}
+		return exitError(3)
+	}
+	opts := &ExecOptions{Command: []string{"upper"}, Stdin: true, Stdout: true}
+	server := httptest.NewServer(NewExecHandler("agent", opts, echo, &fakeResponder{t: t}))
+	defer server.Close()
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http"), server.URL)
+	assert.NoError(t, err)
+	config.Protocol = []string{remotecommand.StreamProtocolV5Name}
+	ws, err := websocket.DialConfig(config)
+	assert.NoError(t, err)
+	defer ws.Close()
+
+	assert.NoError(t, websocket.Message.Send(ws, append([]byte{remotecommand.StreamStdIn}, "hello"...)))
+	assert.NoError(t, websocket.Message.Send(ws, []byte{remotecommand.StreamClose, remotecommand.StreamStdIn}))
+
+	var stdout string
+	status := &metav1.Status{}
+	for status.Status == "" {
+		var frame []byte
+		if !assert.NoError(t, websocket.Message.Receive(ws, &frame)) {
+			return
+		}
+		switch frame[0] {
+		case remotecommand.StreamStdOut:
+			stdout += string(frame[1:])
+		case remotecommand.StreamErr:
+			assert.NoError(t, json.Unmarshal(frame[1:], status))
+		}
+	}
+	assert.Equal(t, "agent:HELLO", stdout)
+	assert.Equal(t, metav1.StatusFailure, status.Status)
+	assert.Equal(t, remotecommand.NonZeroExitCodeReason, status.Reason)
+	assert.Equal(t, "3", status.Details.Causes[0].Message)
+}
+
+func TestExecHandlerRejectsPlainRequests(t *testing.T) {
+	responder := &fakeResponder{t: t}
+	handler := NewExecHandler("agent", &ExecOptions{Stdout: true}, nil, responder)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/exec", nil))
+	assert.Error(t, responder.err)
+}
@@ -0,0 +1,273 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+)
+
+// LogStreamer writes the logs of a resource to w honoring opts.  StreamLogs returns once the logs end, ctx
+// is done or writing to w fails.
+type LogStreamer interface {
+	StreamLogs(ctx context.Context, w io.Writer, opts *LogOptions) error
+}
+
+// NewLogHandler returns a http.Handler for the Connect method of a log subresource.  The logs of s are
+// streamed as chunked text/plain and flushed after every write so that followers see lines immediately.
+// Errors returned by s before anything was written are sent to responder.
+func NewLogHandler(s LogStreamer, opts *LogOptions, responder registryrest.Responder) http.Handler {
+	if opts == nil {
+		opts = &LogOptions{}
+	}
+	return &logHandler{streamer: s, opts: opts, responder: responder}
+}
+
+type logHandler struct {
+	streamer  LogStreamer
+	opts      *LogOptions
+	responder registryrest.Responder
+}
+
+func (h *logHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	fw := &flushWriter{w: w}
+	if flusher, ok := w.(http.Flusher); ok {
+		fw.flusher = flusher
+	}
+	var out io.Writer = fw
+	if h.opts.LimitBytes != nil {
+		out = &limitWriter{w: fw, remaining: *h.opts.LimitBytes}
+	}
+
+	err := h.streamer.StreamLogs(req.Context(), out, h.opts)
+	if err == nil || errors.Is(err, errLimitReached) {
+		if !fw.written {
+			fw.writeHeader()
+		}
+		return
+	}
+	if !fw.written {
+		h.responder.Error(err)
+	}
+}
+
+// flushWriter writes the response header on the first write and flushes every write.
+type flushWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	written bool
+}
+
+func (fw *flushWriter) writeHeader() {
+	fw.written = true
+	fw.w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fw.w.Header().Set("X-Content-Type-Options", "nosniff")
+	fw.w.WriteHeader(http.StatusOK)
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	if !fw.written {
+		fw.writeHeader()
+	}
+	n, err := fw.w.Write(p)
+	if fw.flusher != nil {
+		fw.flusher.Flush()
+	}
+	return n, err
+}
+
+var errLimitReached = errors.New("the log limit has been reached")
+
+// limitWriter truncates the output after the given number of bytes and fails every later write.
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if lw.remaining <= 0 {
+		return 0, errLimitReached
+	}
+	if int64(len(p)) > lw.remaining {
+		n, err := lw.w.Write(p[:lw.remaining])
+		lw.remaining -= int64(n)
+		if err == nil {
+			err = errLimitReached
+		}
+		return n, err
+	}
+	n, err := lw.w.Write(p)
+	lw.remaining -= int64(n)
+	return n, err
+}
+
+// LogBuffer is a LogStreamer keeping the most recent lines written to it in memory, e.g. the output of a
+// remote agent copied with io.Copy.  Followers are notified of new lines until the buffer is closed.
+type LogBuffer struct {
+	maxLines int
+	now      func() time.Time
+
+	mu sync.Mutex
+	// lines are the retained lines, oldest first.  Every line ends with a newline.
+	lines []logLine
+	// first is the sequence number of lines[0]
+	first int64
+	// partial is the last written line until its newline is written
+	partial []byte
+	// changed is closed and replaced whenever lines are added or the buffer is closed
+	changed chan struct{}
+	closed  bool
+}
+
+type logLine struct {
+	time time.Time
+	data []byte
+}
+
+var _ LogStreamer = &LogBuffer{}
+
+// NewLogBuffer returns a LogBuffer retaining at most maxLines lines.
+func NewLogBuffer(maxLines int) *LogBuffer {
+	if maxLines < 1 {
+		maxLines = 1
+	}
+	return &LogBuffer{
+		maxLines: maxLines,
+		now:      time.Now,
+		changed:  make(chan struct{}),
+	}
+}
+
+// Write implements io.Writer.  A line is visible to readers once its newline has been written.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	data := p
+	added := false
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := append(b.partial, data[:i+1]...)
+		b.partial = nil
+		b.appendLine(line)
+		added = true
+		data = data[i+1:]
+	}
+	b.partial = append(b.partial, data...)
+	if added {
+		b.notify()
+	}
+	return len(p), nil
+}
+
+// Close ends the streams of all followers.  An unterminated last line is flushed with a trailing newline.
+func (b *LogBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	if len(b.partial) > 0 {
+		b.appendLine(append(b.partial, '\n'))
+		b.partial = nil
+	}
+	b.closed = true
+	b.notify()
+	return nil
+}
+
+func (b *LogBuffer) appendLine(data []byte) {
+	b.lines = append(b.lines, logLine{time: b.now(), data: data})
+	if len(b.lines) > b.maxLines {
+		dropped := len(b.lines) - b.maxLines
+		b.lines = append([]logLine(nil), b.lines[dropped:]...)
+		b.first += int64(dropped)
+	}
+}
+
+func (b *LogBuffer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// StreamLogs implements LogStreamer
+func (b *LogBuffer) StreamLogs(ctx context.Context, w io.Writer, opts *LogOptions) error {
+	if opts == nil {
+		opts = &LogOptions{}
+	}
+
+	b.mu.Lock()
+	next := b.first
+	if opts.TailLines != nil {
+		// negative tails write no lines, as a tail of 0 does
+		tail := max(*opts.TailLines, 0)
+		if int64(len(b.lines)) > tail {
+			next = b.first + int64(len(b.lines)) - tail
+		}
+	}
+	b.mu.Unlock()
+
+	for {
+		b.mu.Lock()
+		// lines dropped while a slow follower was writing are skipped
+		if next < b.first {
+			next = b.first
+		}
+		pending := b.lines[next-b.first:]
+		changed, closed := b.changed, b.closed
+		b.mu.Unlock()
+
+		for _, line := range pending {
+			if opts.Timestamps {
+				if _, err := io.WriteString(w, line.time.UTC().Format(time.RFC3339Nano)+" "); err != nil {
+					return err
+				}
+			}
+			if _, err := w.Write(line.data); err != nil {
+				return err
+			}
+			next++
+		}
+
+		if !opts.Follow || closed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
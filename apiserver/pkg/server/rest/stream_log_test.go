@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestLogOptions(t *testing.T) {
+	t.Run("query parameters should be decoded", func(t *testing.T) {
+		opts := &LogOptions{}
+		values := url.Values{"follow": {"true"}, "tailLines": {"10"}, "limitBytes": {"64"}}
+		assert.NoError(t, opts.ConvertFromUrlValues(&values))
+		assert.True(t, opts.Follow)
+		assert.False(t, opts.Timestamps)
+		assert.Equal(t, int64(10), *opts.TailLines)
+		assert.Equal(t, int64(64), *opts.LimitBytes)
+	})
+	t.Run("invalid query parameters should be rejected", func(t *testing.T) {
+		for _, values := range []url.Values{
+			{"follow": {"maybe"}},
+			{"tailLines": {"-1"}},
+			{"limitBytes": {"0"}},
+		} {
+			assert.Error(t, (&LogOptions{}).ConvertFromUrlValues(&values), values.Encode())
+		}
+	})
+}
+
+func TestLogBuffer(t *testing.T) {
+	t.Run("only the most recent lines should be retained", func(t *testing.T) {
+		b := NewLogBuffer(3)
+		fmt.Fprint(b, "1\n2\n3\n4\n5")
+		assert.Equal(t, "2\n3\n4\n", serveLogs(t, b, &LogOptions{}))
+		b.Close()
+		assert.Equal(t, "4\n5\n", serveLogs(t, b, &LogOptions{TailLines: int64Ptr(2)}))
+	})
+	t.Run("negative tails should write no lines", func(t *testing.T) {
+		b := NewLogBuffer(3)
+		fmt.Fprint(b, "1\n2\n")
+		b.Close()
+		assert.Equal(t, "", serveLogs(t, b, &LogOptions{TailLines: int64Ptr(-1)}))
+		assert.Equal(t, "", serveLogs(t, b, &LogOptions{TailLines: int64Ptr(0)}))
+	})
+	t.Run("output should stop at the byte limit", func(t *testing.T) {
+		b := NewLogBuffer(10)
+		fmt.Fprint(b, "hello\nworld\n")
+		assert.Equal(t, "hello\nwo", serveLogs(t, b, &LogOptions{LimitBytes: int64Ptr(8)}))
+	})
+	t.Run("followers should receive new lines until the buffer is closed", func(t *testing.T) {
+		b := NewLogBuffer(10)
+		fmt.Fprint(b, "old\n")
+		done := make(chan string)
+		go func() {
+			done <- serveLogs(t, b, &LogOptions{Follow: true, TailLines: int64Ptr(0)})
+		}()
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(b, "new\nlast")
+		b.Close()
+		select {
+		case out := <-done:
+			assert.Equal(t, "new\nlast\n", out)
+		case <-time.After(5 * time.Second):
+			t.Fatal("follower did not return after the buffer was closed")
+		}
+	})
+	t.Run("followers should return when the request ends", func(t *testing.T) {
+		b := NewLogBuffer(10)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, b.StreamLogs(ctx, httptest.NewRecorder(), &LogOptions{Follow: true}))
+	})
+}
+
+func serveLogs(t *testing.T, s LogStreamer, opts *LogOptions) string {
+	w := httptest.NewRecorder()
+	NewLogHandler(s, opts, &fakeResponder{t: t}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/log", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	return w.Body.String()
+}
+
+func int64Ptr(i int64) *int64 { return &i }
+
+type fakeResponder struct {
+	t   *testing.T
+	err error
+}
+
+func (r *fakeResponder) Object(statusCode int, obj runtime.Object) {
+	r.t.Errorf("unexpected object %d: %v", statusCode, obj)
+}
+
+func (r *fakeResponder) Error(err error) { r.err = err }
@@ -0,0 +1,172 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+// LogOptions are the connect options of a log subresource served by NewLogHandler.
+// They are decoded from the query parameters follow, tailLines, limitBytes and timestamps.
+type LogOptions struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Follow keeps the stream open and writes new lines as they are produced.
+	Follow bool `json:"follow,omitempty"`
+	// TailLines limits the output to the given number of most recent lines.  All lines are written if nil.
+	TailLines *int64 `json:"tailLines,omitempty"`
+	// LimitBytes ends the stream once the given number of bytes has been written.
+	LimitBytes *int64 `json:"limitBytes,omitempty"`
+	// Timestamps prefixes every line with the RFC3339 time it was produced.
+	Timestamps bool `json:"timestamps,omitempty"`
+}
+
+var _ runtime.Object = &LogOptions{}
+var _ resource.QueryParameterObject = &LogOptions{}
+
+// DeepCopyObject implements runtime.Object
+func (o *LogOptions) DeepCopyObject() runtime.Object {
+	if o == nil {
+		return nil
+	}
+	out := *o
+	if o.TailLines != nil {
+		tail := *o.TailLines
+		out.TailLines = &tail
+	}
+	if o.LimitBytes != nil {
+		limit := *o.LimitBytes
+		out.LimitBytes = &limit
+	}
+	return &out
+}
+
+// ConvertFromUrlValues implements resource.QueryParameterObject
+func (o *LogOptions) ConvertFromUrlValues(values *url.Values) error {
+	var err error
+	if o.Follow, err = boolParameter(values, "follow"); err != nil {
+		return err
+	}
+	if o.Timestamps, err = boolParameter(values, "timestamps"); err != nil {
+		return err
+	}
+	if o.TailLines, err = int64Parameter(values, "tailLines"); err != nil {
+		return err
+	}
+	if o.TailLines != nil && *o.TailLines < 0 {
+		return fmt.Errorf("tailLines must be greater than or equal to 0")
+	}
+	if o.LimitBytes, err = int64Parameter(values, "limitBytes"); err != nil {
+		return err
+	}
+	if o.LimitBytes != nil && *o.LimitBytes < 1 {
+		return fmt.Errorf("limitBytes must be greater than 0")
+	}
+	return nil
+}
+
+// ExecOptions are the connect options of an exec subresource served by NewExecHandler.
+// They are decoded from the query parameters command, stdin, stdout, stderr and tty used by kubectl exec.
+type ExecOptions struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Command is the command to run and its arguments.
+	Command []string `json:"command,omitempty"`
+	// Stdin attaches the standard input of the command.
+	Stdin bool `json:"stdin,omitempty"`
+	// Stdout attaches the standard output of the command.
+	Stdout bool `json:"stdout,omitempty"`
+	// Stderr attaches the standard error of the command.  It is ignored when TTY is set.
+	Stderr bool `json:"stderr,omitempty"`
+	// TTY allocates a terminal for the command, whose size is sent by the client.
+	TTY bool `json:"tty,omitempty"`
+}
+
+var _ runtime.Object = &ExecOptions{}
+var _ resource.QueryParameterObject = &ExecOptions{}
+
+// DeepCopyObject implements runtime.Object
+func (o *ExecOptions) DeepCopyObject() runtime.Object {
+	if o == nil {
+		return nil
+	}
+	out := *o
+	if o.Command != nil {
+		out.Command = append([]string(nil), o.Command...)
+	}
+	return &out
+}
+
+// ConvertFromUrlValues implements resource.QueryParameterObject
+func (o *ExecOptions) ConvertFromUrlValues(values *url.Values) error {
+	o.Command = (*values)["command"]
+	for name, field := range map[string]*bool{
+		"stdin":  &o.Stdin,
+		"stdout": &o.Stdout,
+		"stderr": &o.Stderr,
+		"tty":    &o.TTY,
+	} {
+		value, err := boolParameter(values, name)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	if o.TTY {
+		o.Stderr = false
+	}
+	if !o.Stdin && !o.Stdout && !o.Stderr {
+		return fmt.Errorf("you must specify at least one of stdin, stdout, stderr")
+	}
+	return nil
+}
+
+func boolParameter(values *url.Values, name string) (bool, error) {
+	value := values.Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+	return b, nil
+}
+
+func int64Parameter(values *url.Values, name string) (*int64, error) {
+	value := values.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+	return &i, nil
+}
@@ -0,0 +1,199 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metatable "k8s.io/apimachinery/pkg/api/meta/table"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+var printerColumnTypes = sets.NewString("integer", "number", "string", "boolean", "date")
+
+var swaggerMetadataDescriptions = metav1.ObjectMeta{}.SwaggerDoc()
+
+// NewTableConvertor returns a TableConvertor printing the name of each object followed by the given columns.
+// It returns the default TableConvertor, printing the name and age, if there are no columns.
+func NewTableConvertor(gr schema.GroupResource, columns []resource.PrinterColumn) (rest.TableConvertor, error) {
+	if len(columns) == 0 {
+		return rest.NewDefaultTableConvertor(gr), nil
+	}
+
+	c := &printerColumnsTableConvertor{
+		headers: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: swaggerMetadataDescriptions["name"]},
+		},
+	}
+	names := sets.NewString()
+	for i, col := range columns {
+		if col.Name == "" || names.Has(col.Name) {
+			return nil, fmt.Errorf("printer column %d of %s must have a unique name, got %q", i, gr, col.Name)
+		}
+		names.Insert(col.Name)
+		if !printerColumnTypes.Has(col.Type) {
+			return nil, fmt.Errorf("printer column %q of %s has unsupported type %q, must be one of %v", col.Name, gr, col.Type, printerColumnTypes.List())
+		}
+		if col.Priority < 0 {
+			return nil, fmt.Errorf("printer column %q of %s must have a non-negative priority", col.Name, gr)
+		}
+		path := jsonpath.New(col.Name)
+		if err := path.Parse(fmt.Sprintf("{%s}", col.JSONPath)); err != nil {
+			return nil, fmt.Errorf("printer column %q of %s has invalid JSON path %q: %w", col.Name, gr, col.JSONPath, err)
+		}
+		path.AllowMissingKeys(true)
+
+		c.headers = append(c.headers, metav1.TableColumnDefinition{
+			Name:        col.Name,
+			Type:        col.Type,
+			Format:      col.Format,
+			Description: col.Description,
+			Priority:    col.Priority,
+		})
+		c.columns = append(c.columns, path)
+	}
+	return c, nil
+}
+
+// tableConvertorFor returns the TableConvertor for the printer columns declared by obj.
+func tableConvertorFor(obj resource.Object) (rest.TableConvertor, error) {
+	gr := obj.GetGroupVersionResource().GroupResource()
+	if o, ok := obj.(resource.ObjectWithPrinterColumns); ok {
+		return NewTableConvertor(gr, o.GetPrinterColumns())
+	}
+	return rest.NewDefaultTableConvertor(gr), nil
+}
+
+// printerColumnsTableConvertor converts objects to tables the same way as the custom resource handler of the
+// apiextensions apiserver.
+type printerColumnsTableConvertor struct {
+	headers []metav1.TableColumnDefinition
+	columns []*jsonpath.JSONPath
+}
+
+var _ rest.TableConvertor = &printerColumnsTableConvertor{}
+
+func (c *printerColumnsTableConvertor) ConvertToTable(ctx context.Context, obj runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	table := &metav1.Table{}
+	opt, ok := tableOptions.(*metav1.TableOptions)
+	if !ok || !opt.NoHeaders {
+		table.ColumnDefinitions = c.headers
+	}
+
+	if m, err := meta.ListAccessor(obj); err == nil {
+		table.ResourceVersion = m.GetResourceVersion()
+		table.Continue = m.GetContinue()
+		table.RemainingItemCount = m.GetRemainingItemCount()
+	} else if m, err := meta.CommonAccessor(obj); err == nil {
+		table.ResourceVersion = m.GetResourceVersion()
+	}
+
+	var err error
+	buf := &bytes.Buffer{}
+	table.Rows, err = metatable.MetaToTableRow(obj, func(obj runtime.Object, m metav1.Object, name, age string) ([]interface{}, error) {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		cells := make([]interface{}, 1, 1+len(c.columns))
+		cells[0] = name
+		for i, column := range c.columns {
+			results, err := column.FindResults(content)
+			if err != nil || len(results) == 0 || len(results[0]) == 0 {
+				cells = append(cells, nil)
+				continue
+			}
+
+			headerType := c.headers[i+1].Type
+			value := results[0][0].Interface()
+			if headerType == "string" {
+				buf.Reset()
+				if err := column.PrintResults(buf, results[0]); err != nil {
+					cells = append(cells, nil)
+					continue
+				}
+				cells = append(cells, buf.String())
+				continue
+			}
+			cells = append(cells, cellForJSONValue(headerType, value))
+		}
+		return cells, nil
+	})
+	return table, err
+}
+
+// cellForJSONValue converts a value found by a JSON path to the cell of a column of the given type.  Values not
+// matching the type are printed as empty cells.
+func cellForJSONValue(headerType string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch headerType {
+	case "integer":
+		switch typed := value.(type) {
+		case int64:
+			return typed
+		case float64:
+			return int64(typed)
+		case json.Number:
+			if i64, err := typed.Int64(); err == nil {
+				return i64
+			}
+		}
+	case "number":
+		switch typed := value.(type) {
+		case int64:
+			return float64(typed)
+		case float64:
+			return typed
+		case json.Number:
+			if f, err := typed.Float64(); err == nil {
+				return f
+			}
+		}
+	case "boolean":
+		if b, ok := value.(bool); ok {
+			return b
+		}
+	case "date":
+		if typed, ok := value.(string); ok {
+			var timestamp metav1.Time
+			if err := timestamp.UnmarshalQueryParameter(typed); err != nil {
+				return "<invalid>"
+			}
+			return metatable.ConvertToHumanReadableDateType(timestamp)
+		}
+	}
+	return nil
+}
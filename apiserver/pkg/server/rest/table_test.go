@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+func TestNewTableConvertor(t *testing.T) {
+	gr := schema.GroupResource{Group: "test", Resource: "things"}
+
+	t.Run("invalid columns should be rejected", func(t *testing.T) {
+		for _, columns := range [][]resource.PrinterColumn{
+			{{Type: "string", JSONPath: ".spec"}},
+			{{Name: "A", Type: "string", JSONPath: ".a"}, {Name: "A", Type: "string", JSONPath: ".b"}},
+			{{Name: "A", Type: "object", JSONPath: ".a"}},
+			{{Name: "A", Type: "string", JSONPath: ".a", Priority: -1}},
+			{{Name: "A", Type: "string", JSONPath: ".a["}},
+		} {
+			_, err := NewTableConvertor(gr, columns)
+			assert.Error(t, err, "%v", columns)
+		}
+	})
+	t.Run("objects and lists should be printed with the declared columns", func(t *testing.T) {
+		c, err := tableConvertorFor(&v1alpha1.Flunder{})
+		assert.NoError(t, err)
+
+		flunder := v1alpha1.Flunder{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "a",
+				ResourceVersion:   "7",
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-26 * time.Hour)),
+			},
+			Spec: v1alpha1.FlunderSpec{ReferenceType: v1alpha1.FischerReferenceType, FischerReference: "f"},
+		}
+		table, err := c.ConvertToTable(context.TODO(), &flunder, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "7", table.ResourceVersion)
+		assert.Equal(t, []string{"Name", "Reference-Type", "Flunder", "Fischer", "Age"}, columnNames(table))
+		assert.Equal(t, []interface{}{"a", "Fischer", nil, "f", "26h"}, table.Rows[0].Cells)
+
+		list := &v1alpha1.FlunderList{
+			ListMeta: metav1.ListMeta{ResourceVersion: "8", Continue: "next"},
+			Items:    []v1alpha1.Flunder{flunder, {ObjectMeta: metav1.ObjectMeta{Name: "b"}}},
+		}
+		table, err = c.ConvertToTable(context.TODO(), list, &metav1.TableOptions{NoHeaders: true})
+		assert.NoError(t, err)
+		assert.Empty(t, table.ColumnDefinitions)
+		assert.Equal(t, "8", table.ResourceVersion)
+		assert.Equal(t, "next", table.Continue)
+		assert.Len(t, table.Rows, 2)
+		assert.Equal(t, []interface{}{"b", nil, nil, nil, nil}, table.Rows[1].Cells)
+	})
+	t.Run("cells should be converted to the column type", func(t *testing.T) {
+		assert.Equal(t, int64(3), cellForJSONValue("integer", float64(3)))
+		assert.Equal(t, float64(3), cellForJSONValue("number", int64(3)))
+		assert.Equal(t, true, cellForJSONValue("boolean", true))
+		assert.Nil(t, cellForJSONValue("boolean", "true"))
+		assert.Equal(t, "<invalid>", cellForJSONValue("date", "yesterday"))
+	})
+}
+
+func columnNames(table *metav1.Table) []string {
+	var names []string
+	for _, c := range table.ColumnDefinitions {
+		names = append(names, c.Name)
+	}
+	return names
+}
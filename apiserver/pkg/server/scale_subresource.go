@@ -0,0 +1,207 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+// scaler converts between an object and its scale subresource.
+type scaler interface {
+	GetScale(obj runtime.Object) (*autoscalingv1.Scale, error)
+	SetScale(obj runtime.Object, scale *autoscalingv1.Scale) error
+}
+
+// newScaler returns the scaler of obj, or nil if obj has no scale subresource.
+func newScaler(obj resource.Object) (scaler, error) {
+	if o, ok := obj.(resource.ObjectWithScalePaths); ok {
+		return newPathScaler(o.GetScalePaths())
+	}
+	if _, ok := obj.(resource.ObjectWithScaleSubResource); ok {
+		return objectScaler{}, nil
+	}
+	return nil, nil
+}
+
+// objectScaler converts objects implementing resource.ObjectWithScaleSubResource.
+type objectScaler struct{}
+
+func (objectScaler) GetScale(obj runtime.Object) (*autoscalingv1.Scale, error) {
+	o, ok := obj.(resource.ObjectWithScaleSubResource)
+	if !ok {
+		return nil, fmt.Errorf("not a valid parent object, does it implement resource.ObjectWithScaleSubResource interface?")
+	}
+	return o.GetScale(), nil
+}
+
+func (objectScaler) SetScale(obj runtime.Object, scale *autoscalingv1.Scale) error {
+	o, ok := obj.(resource.ObjectWithScaleSubResource)
+	if !ok {
+		return fmt.Errorf("not a valid parent object, does it implement resource.ObjectWithScaleSubResource interface?")
+	}
+	o.SetScale(scale)
+	return nil
+}
+
+// pathScaler converts objects by the paths declared with resource.ObjectWithScalePaths.
+type pathScaler struct {
+	specReplicas   []string
+	statusReplicas []string
+	labelSelector  []string
+}
+
+func newPathScaler(paths resource.ScalePaths) (*pathScaler, error) {
+	s := &pathScaler{}
+	var err error
+	if s.specReplicas, err = parseScalePath(paths.SpecReplicasPath, "spec"); err != nil {
+		return nil, fmt.Errorf("invalid SpecReplicasPath: %w", err)
+	}
+	if s.statusReplicas, err = parseScalePath(paths.StatusReplicasPath, "status"); err != nil {
+		return nil, fmt.Errorf("invalid StatusReplicasPath: %w", err)
+	}
+	if len(paths.LabelSelectorPath) != 0 {
+		if s.labelSelector, err = parseScalePath(paths.LabelSelectorPath, "spec", "status"); err != nil {
+			return nil, fmt.Errorf("invalid LabelSelectorPath: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// parseScalePath splits a JSON path such as ".spec.replicas" into its fields.  The path must be below one of roots.
+func parseScalePath(path string, roots ...string) ([]string, error) {
+	if !strings.HasPrefix(path, ".") {
+		return nil, fmt.Errorf("%q must be a JSON path starting with '.'", path)
+	}
+	fields := strings.Split(strings.TrimPrefix(path, "."), ".")
+	for _, f := range fields {
+		if len(f) == 0 || strings.ContainsAny(f, "[]*") {
+			return nil, fmt.Errorf("%q must be a simple JSON path without array or wildcard fields", path)
+		}
+	}
+	for _, root := range roots {
+		if len(fields) > 1 && fields[0] == root {
+			return fields, nil
+		}
+	}
+	return nil, fmt.Errorf("%q must be under .%s", path, strings.Join(roots, " or ."))
+}
+
+func (s *pathScaler) GetScale(obj runtime.Object) (*autoscalingv1.Scale, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	scale := &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              accessor.GetName(),
+			Namespace:         accessor.GetNamespace(),
+			UID:               accessor.GetUID(),
+			ResourceVersion:   accessor.GetResourceVersion(),
+			CreationTimestamp: accessor.GetCreationTimestamp(),
+		},
+	}
+	if scale.Spec.Replicas, err = nestedReplicas(u, s.specReplicas); err != nil {
+		return nil, err
+	}
+	if scale.Status.Replicas, err = nestedReplicas(u, s.statusReplicas); err != nil {
+		return nil, err
+	}
+	if len(s.labelSelector) != 0 {
+		if scale.Status.Selector, err = nestedSelector(u, s.labelSelector); err != nil {
+			return nil, err
+		}
+	}
+	return scale, nil
+}
+
+func (s *pathScaler) SetScale(obj runtime.Object, scale *autoscalingv1.Scale) error {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(u, int64(scale.Spec.Replicas), s.specReplicas...); err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u, obj)
+}
+
+// nestedReplicas returns the replicas at fields, 0 if unset.
+func nestedReplicas(u map[string]interface{}, fields []string) (int32, error) {
+	v, found, err := unstructured.NestedFieldNoCopy(u, fields...)
+	if err != nil || !found || v == nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case int64:
+		return int32(n), nil
+	case float64:
+		return int32(n), nil
+	}
+	return 0, fmt.Errorf(".%s is of type %T, expected an integer", strings.Join(fields, "."), v)
+}
+
+// nestedSelector returns the label selector at fields in its serialized form, empty if unset.
+func nestedSelector(u map[string]interface{}, fields []string) (string, error) {
+	v, found, err := unstructured.NestedFieldNoCopy(u, fields...)
+	if err != nil || !found || v == nil {
+		return "", err
+	}
+	switch selector := v.(type) {
+	case string:
+		return selector, nil
+	case map[string]interface{}:
+		ls := &metav1.LabelSelector{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selector, ls); err != nil {
+			return "", err
+		}
+		s, err := metav1.LabelSelectorAsSelector(ls)
+		if err != nil {
+			return "", err
+		}
+		return s.String(), nil
+	}
+	return "", fmt.Errorf(".%s is of type %T, expected a label selector", strings.Join(fields, "."), v)
+}
+
+// validateScale validates a scale sent to the scale subresource.
+func validateScale(scale *autoscalingv1.Scale) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if scale.Spec.Replicas < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "replicas"), scale.Spec.Replicas, "must be greater than or equal to 0"))
+	}
+	return allErrs
+}
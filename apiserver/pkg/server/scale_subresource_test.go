@@ -0,0 +1,96 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+type replicated struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec struct {
+		Replicas int32                 `json:"replicas"`
+		Selector *metav1.LabelSelector `json:"selector,omitempty"`
+		Image    string                `json:"image"`
+	} `json:"spec"`
+	Status struct {
+		Replicas int32  `json:"replicas"`
+		Selector string `json:"selector,omitempty"`
+	} `json:"status"`
+}
+
+func (r *replicated) DeepCopyObject() runtime.Object {
+	out := *r
+	r.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec.Selector = r.Spec.Selector.DeepCopy()
+	return &out
+}
+
+func TestPathScaler(t *testing.T) {
+	obj := &replicated{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", ResourceVersion: "7"}}
+	obj.Spec.Replicas = 3
+	obj.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}}
+	obj.Spec.Image = "nginx"
+	obj.Status.Replicas = 2
+	obj.Status.Selector = "app=bar"
+
+	t.Run("scale should be read from the paths", func(t *testing.T) {
+		sc, err := newPathScaler(resource.ScalePaths{
+			SpecReplicasPath:   ".spec.replicas",
+			StatusReplicasPath: ".status.replicas",
+			LabelSelectorPath:  ".spec.selector",
+		})
+		assert.NoError(t, err)
+		scale, err := sc.GetScale(obj)
+		assert.NoError(t, err)
+		assert.Equal(t, "foo", scale.Name)
+		assert.Equal(t, "7", scale.ResourceVersion)
+		assert.Equal(t, int32(3), scale.Spec.Replicas)
+		assert.Equal(t, autoscalingv1.ScaleStatus{Replicas: 2, Selector: "app=foo"}, scale.Status)
+
+		sc, err = newPathScaler(resource.ScalePaths{
+			SpecReplicasPath:   ".spec.replicas",
+			StatusReplicasPath: ".status.replicas",
+			LabelSelectorPath:  ".status.selector",
+		})
+		assert.NoError(t, err)
+		scale, err = sc.GetScale(obj)
+		assert.NoError(t, err)
+		assert.Equal(t, "app=bar", scale.Status.Selector)
+	})
+	t.Run("scale should only write the spec replicas", func(t *testing.T) {
+		sc, err := newPathScaler(resource.ScalePaths{SpecReplicasPath: ".spec.replicas", StatusReplicasPath: ".status.replicas"})
+		assert.NoError(t, err)
+		updated := obj.DeepCopyObject().(*replicated)
+		assert.NoError(t, sc.SetScale(updated, &autoscalingv1.Scale{
+			Spec:   autoscalingv1.ScaleSpec{Replicas: 5},
+			Status: autoscalingv1.ScaleStatus{Replicas: 9},
+		}))
+		assert.Equal(t, int32(5), updated.Spec.Replicas)
+		assert.Equal(t, int32(2), updated.Status.Replicas)
+		assert.Equal(t, "nginx", updated.Spec.Image)
+	})
+	t.Run("invalid paths should be rejected", func(t *testing.T) {
+		for _, paths := range []resource.ScalePaths{
+			{SpecReplicasPath: ".status.replicas", StatusReplicasPath: ".status.replicas"},
+			{SpecReplicasPath: ".spec.replicas", StatusReplicasPath: ".spec.replicas"},
+			{SpecReplicasPath: "spec.replicas", StatusReplicasPath: ".status.replicas"},
+			{SpecReplicasPath: ".spec", StatusReplicasPath: ".status.replicas"},
+			{SpecReplicasPath: ".spec.replicas", StatusReplicasPath: ".status.replicas", LabelSelectorPath: ".metadata.labels"},
+			{SpecReplicasPath: ".spec.items[0]", StatusReplicasPath: ".status.replicas"},
+		} {
+			_, err := newPathScaler(paths)
+			assert.Error(t, err, "%+v", paths)
+		}
+	})
+	t.Run("negative replicas should be invalid", func(t *testing.T) {
+		assert.Len(t, validateScale(&autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: -1}}), 1)
+	})
+}
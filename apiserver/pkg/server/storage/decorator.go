@@ -0,0 +1,225 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Decorator adds behavior to the storage created by next.
+type Decorator func(next generic.StorageDecorator) generic.StorageDecorator
+
+// WithStorageDecorators returns a generic.StorageDecorator creating storage with base, decorated with decorators.
+// The first decorator is the outermost one, i.e. it sees every request first.
+func WithStorageDecorators(base generic.StorageDecorator, decorators ...Decorator) generic.StorageDecorator {
+	for i := len(decorators) - 1; i >= 0; i-- {
+		base = decorators[i](base)
+	}
+	return base
+}
+
+// ForResources returns a Decorator applying decorator only to the storage of the given resources.
+func ForResources(decorator Decorator, resources ...schema.GroupResource) Decorator {
+	return func(next generic.StorageDecorator) generic.StorageDecorator {
+		decorated := decorator(next)
+		return func(
+			config *storagebackend.ConfigForResource,
+			resourcePrefix string,
+			keyFunc func(obj runtime.Object) (string, error),
+			newFunc func() runtime.Object,
+			newListFunc func() runtime.Object,
+			getAttrsFunc storage.AttrFunc,
+			trigger storage.IndexerFuncs,
+			indexers *cache.Indexers) (storage.Interface, factory.DestroyFunc, error) {
+			for _, gr := range resources {
+				if gr == config.GroupResource {
+					return decorated(config, resourcePrefix, keyFunc, newFunc, newListFunc, getAttrsFunc, trigger, indexers)
+				}
+			}
+			return next(config, resourcePrefix, keyFunc, newFunc, newListFunc, getAttrsFunc, trigger, indexers)
+		}
+	}
+}
+
+// Operation is a storage.Interface operation.
+type Operation string
+
+const (
+	OperationCreate Operation = "create"
+	OperationDelete Operation = "delete"
+	OperationWatch  Operation = "watch"
+	OperationGet    Operation = "get"
+	OperationList   Operation = "list"
+	OperationUpdate Operation = "update"
+	OperationCount  Operation = "count"
+)
+
+// IsWrite returns true for operations modifying storage.
+func (o Operation) IsWrite() bool {
+	return o == OperationCreate || o == OperationDelete || o == OperationUpdate
+}
+
+// Interceptor is invoked before every operation on the storage of a resource.  It returns the context to run the
+// operation with and a function invoked with the result of the operation.  If it returns an error the operation
+// fails with that error without being run.
+type Interceptor func(ctx context.Context, op Operation, key string) (context.Context, func(err error), error)
+
+// InterceptorDecorator returns a Decorator running the Interceptor returned by newInterceptor for the resource
+// around every storage operation.  newInterceptor is called once per storage.
+func InterceptorDecorator(newInterceptor func(resource schema.GroupResource) Interceptor) Decorator {
+	return func(next generic.StorageDecorator) generic.StorageDecorator {
+		return func(
+			config *storagebackend.ConfigForResource,
+			resourcePrefix string,
+			keyFunc func(obj runtime.Object) (string, error),
+			newFunc func() runtime.Object,
+			newListFunc func() runtime.Object,
+			getAttrsFunc storage.AttrFunc,
+			trigger storage.IndexerFuncs,
+			indexers *cache.Indexers) (storage.Interface, factory.DestroyFunc, error) {
+			s, d, err := next(config, resourcePrefix, keyFunc, newFunc, newListFunc, getAttrsFunc, trigger, indexers)
+			if err != nil {
+				return s, d, err
+			}
+			return &interceptedStorage{Interface: s, intercept: newInterceptor(config.GroupResource)}, d, nil
+		}
+	}
+}
+
+// Interceptors returns the Interceptors run by the InterceptorDecorators of s, outermost first, along with the
+// storage they decorate.
+func Interceptors(s storage.Interface) ([]Interceptor, storage.Interface) {
+	var interceptors []Interceptor
+	for {
+		is, ok := s.(*interceptedStorage)
+		if !ok {
+			return interceptors, s
+		}
+		interceptors = append(interceptors, is.intercept)
+		s = is.Interface
+	}
+}
+
+// Intercept runs interceptors, outermost first, for an operation made without going through the storage.  The
+// operation must be run with the returned context and its result passed to the returned function, which is not
+// nil.  If an interceptor fails, the interceptors already run are told about the error.
+func Intercept(ctx context.Context, interceptors []Interceptor, op Operation, key string) (context.Context, func(err error), error) {
+	var dones []func(err error)
+	finish := func(err error) {
+		for i := len(dones) - 1; i >= 0; i-- {
+			dones[i](err)
+		}
+	}
+	for _, intercept := range interceptors {
+		next, done, err := intercept(ctx, op, key)
+		if err != nil {
+			finish(err)
+			return ctx, nil, err
+		}
+		ctx = next
+		if done != nil {
+			dones = append(dones, done)
+		}
+	}
+	return ctx, finish, nil
+}
+
+// interceptedStorage runs an Interceptor around every operation of the wrapped storage.
+type interceptedStorage struct {
+	storage.Interface
+	intercept Interceptor
+}
+
+var _ storage.Interface = &interceptedStorage{}
+
+func (s *interceptedStorage) do(ctx context.Context, op Operation, key string, fn func(ctx context.Context) error) error {
+	ctx, done, err := s.intercept(ctx, op, key)
+	if err != nil {
+		return err
+	}
+	err = fn(ctx)
+	if done != nil {
+		done(err)
+	}
+	return err
+}
+
+func (s *interceptedStorage) Create(ctx context.Context, key string, obj, out runtime.Object, ttl uint64) error {
+	return s.do(ctx, OperationCreate, key, func(ctx context.Context) error {
+		return s.Interface.Create(ctx, key, obj, out, ttl)
+	})
+}
+
+func (s *interceptedStorage) Delete(
+	ctx context.Context, key string, out runtime.Object, preconditions *storage.Preconditions,
+	validateDeletion storage.ValidateObjectFunc, cachedExistingObject runtime.Object) error {
+	return s.do(ctx, OperationDelete, key, func(ctx context.Context) error {
+		return s.Interface.Delete(ctx, key, out, preconditions, validateDeletion, cachedExistingObject)
+	})
+}
+
+func (s *interceptedStorage) Watch(ctx context.Context, key string, opts storage.ListOptions) (watch.Interface, error) {
+	var w watch.Interface
+	err := s.do(ctx, OperationWatch, key, func(ctx context.Context) (err error) {
+		w, err = s.Interface.Watch(ctx, key, opts)
+		return err
+	})
+	return w, err
+}
+
+func (s *interceptedStorage) Get(ctx context.Context, key string, opts storage.GetOptions, objPtr runtime.Object) error {
+	return s.do(ctx, OperationGet, key, func(ctx context.Context) error {
+		return s.Interface.Get(ctx, key, opts, objPtr)
+	})
+}
+
+func (s *interceptedStorage) GetList(ctx context.Context, key string, opts storage.ListOptions, listObj runtime.Object) error {
+	return s.do(ctx, OperationList, key, func(ctx context.Context) error {
+		return s.Interface.GetList(ctx, key, opts, listObj)
+	})
+}
+
+func (s *interceptedStorage) GuaranteedUpdate(
+	ctx context.Context, key string, destination runtime.Object, ignoreNotFound bool,
+	preconditions *storage.Preconditions, tryUpdate storage.UpdateFunc, cachedExistingObject runtime.Object) error {
+	return s.do(ctx, OperationUpdate, key, func(ctx context.Context) error {
+		return s.Interface.GuaranteedUpdate(ctx, key, destination, ignoreNotFound, preconditions, tryUpdate, cachedExistingObject)
+	})
+}
+
+func (s *interceptedStorage) Count(key string) (int64, error) {
+	var count int64
+	err := s.do(context.Background(), OperationCount, key, func(ctx context.Context) (err error) {
+		count, err = s.Interface.Count(key)
+		return err
+	})
+	return count, err
+}
@@ -0,0 +1,70 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	compbasemetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	storageOperationLatency = compbasemetrics.NewHistogramVec(
+		&compbasemetrics.HistogramOpts{
+			Namespace: "kes",
+			Subsystem: "storage",
+			Name:      "operation_duration_seconds",
+			Help:      "Storage operation latency in seconds for each resource, operation and result, including the watch cache.",
+			Buckets: []float64{0.005, 0.025, 0.05, 0.1, 0.2, 0.4, 0.6, 0.8, 1.0, 1.25, 1.5, 2, 3,
+				4, 5, 6, 8, 10, 15, 20, 30, 45, 60},
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{"resource", "operation", "result"},
+	)
+
+	registerMetrics sync.Once
+)
+
+// WithLatencyMetrics returns a Decorator recording the latency of every storage operation in the
+// kes_storage_operation_duration_seconds histogram.
+func WithLatencyMetrics() Decorator {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(storageOperationLatency)
+	})
+	return InterceptorDecorator(func(resource schema.GroupResource) Interceptor {
+		name := resource.String()
+		return func(ctx context.Context, op Operation, key string) (context.Context, func(err error), error) {
+			start := time.Now()
+			return ctx, func(err error) {
+				result := "success"
+				if err != nil {
+					result = "error"
+				}
+				storageOperationLatency.WithLabelValues(name, string(op), result).Observe(time.Since(start).Seconds())
+			}, nil
+		}
+	})
+}
@@ -0,0 +1,50 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// WithWriteRateLimit returns a Decorator limiting the creates, updates and deletes of every resource to qps
+// per second with bursts of up to burst writes.  Each resource has its own token bucket.  Writes wait for a
+// token until the request context is done, and fail with a 429 if none becomes available in time.
+func WithWriteRateLimit(qps float64, burst int) Decorator {
+	return InterceptorDecorator(func(resource schema.GroupResource) Interceptor {
+		limiter := rate.NewLimiter(rate.Limit(qps), burst)
+		return func(ctx context.Context, op Operation, key string) (context.Context, func(err error), error) {
+			if !op.IsWrite() {
+				return ctx, nil, nil
+			}
+			if err := limiter.Wait(ctx); err != nil {
+				return ctx, nil, errors.NewTooManyRequests(
+					fmt.Sprintf("storage write rate limit exceeded for %s", resource), 1)
+			}
+			return ctx, nil, nil
+		}
+	})
+}
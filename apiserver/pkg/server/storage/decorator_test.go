@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	"k8s.io/client-go/tools/cache"
+)
+
+var flunders = schema.GroupResource{Group: "sample.k8s.com", Resource: "flunders"}
+
+type fakeStorage struct {
+	storage.Interface
+	creates int
+}
+
+func (f *fakeStorage) Create(ctx context.Context, key string, obj, out runtime.Object, ttl uint64) error {
+	f.creates++
+	return nil
+}
+
+func (f *fakeStorage) Get(ctx context.Context, key string, opts storage.GetOptions, objPtr runtime.Object) error {
+	return nil
+}
+
+func fakeDecorator(s storage.Interface) generic.StorageDecorator {
+	return func(*storagebackend.ConfigForResource, string, func(obj runtime.Object) (string, error), func() runtime.Object,
+		func() runtime.Object, storage.AttrFunc, storage.IndexerFuncs, *cache.Indexers) (storage.Interface, factory.DestroyFunc, error) {
+		return s, func() {}, nil
+	}
+}
+
+func newStorage(t *testing.T, d generic.StorageDecorator, gr schema.GroupResource) storage.Interface {
+	s, _, err := d(&storagebackend.ConfigForResource{GroupResource: gr}, "", nil, nil, nil, nil, nil, nil)
+	assert.NoError(t, err)
+	return s
+}
+
+func recorder(calls *[]string, name string) Decorator {
+	return InterceptorDecorator(func(schema.GroupResource) Interceptor {
+		return func(ctx context.Context, op Operation, key string) (context.Context, func(err error), error) {
+			*calls = append(*calls, name+":"+string(op))
+			return ctx, func(error) { *calls = append(*calls, name+":done") }, nil
+		}
+	})
+}
+
+func TestWithStorageDecorators(t *testing.T) {
+	t.Run("first decorator should be outermost", func(t *testing.T) {
+		var calls []string
+		d := WithStorageDecorators(fakeDecorator(&fakeStorage{}), recorder(&calls, "a"), recorder(&calls, "b"))
+		assert.NoError(t, newStorage(t, d, flunders).Create(context.TODO(), "key", nil, nil, 0))
+		assert.Equal(t, []string{"a:create", "b:create", "b:done", "a:done"}, calls)
+	})
+	t.Run("ForResources should only decorate the given resources", func(t *testing.T) {
+		var calls []string
+		d := WithStorageDecorators(fakeDecorator(&fakeStorage{}), ForResources(recorder(&calls, "a"), flunders))
+		assert.NoError(t, newStorage(t, d, schema.GroupResource{Resource: "fischers"}).Create(context.TODO(), "key", nil, nil, 0))
+		assert.Empty(t, calls)
+		assert.NoError(t, newStorage(t, d, flunders).Create(context.TODO(), "key", nil, nil, 0))
+		assert.Equal(t, []string{"a:create", "a:done"}, calls)
+	})
+	t.Run("write rate limit should only limit writes", func(t *testing.T) {
+		fake := &fakeStorage{}
+		s := newStorage(t, WithStorageDecorators(fakeDecorator(fake), WithWriteRateLimit(0.001, 1)), flunders)
+		assert.NoError(t, s.Create(context.TODO(), "key", nil, nil, 0))
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		err := s.Create(ctx, "key", nil, nil, 0)
+		assert.True(t, errors.IsTooManyRequests(err))
+		assert.Equal(t, 1, fake.creates)
+		assert.NoError(t, s.Get(ctx, "key", storage.GetOptions{}, nil))
+	})
+}
+
+func TestIntercept(t *testing.T) {
+	t.Run("Interceptors should unwrap the interceptor decorators", func(t *testing.T) {
+		var calls []string
+		fake := &fakeStorage{}
+		d := WithStorageDecorators(fakeDecorator(fake), recorder(&calls, "a"), recorder(&calls, "b"))
+		interceptors, s := Interceptors(newStorage(t, d, flunders))
+		assert.Len(t, interceptors, 2)
+		assert.Same(t, fake, s)
+		assert.False(t, IsETCD3(s))
+		assert.True(t, IsETCD3(&etcd3Storage{Interface: fake}))
+
+		_, done, err := Intercept(context.TODO(), interceptors, OperationUpdate, "key")
+		assert.NoError(t, err)
+		done(nil)
+		assert.Equal(t, []string{"a:update", "b:update", "b:done", "a:done"}, calls)
+	})
+	t.Run("a failing interceptor should finish the ones already run", func(t *testing.T) {
+		var calls []string
+		d := WithStorageDecorators(fakeDecorator(&fakeStorage{}), recorder(&calls, "a"), WithWriteRateLimit(0.001, 1))
+		interceptors, _ := Interceptors(newStorage(t, d, flunders))
+		_, done, err := Intercept(context.TODO(), interceptors, OperationCreate, "key")
+		assert.NoError(t, err)
+		done(nil)
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		_, _, err = Intercept(ctx, interceptors, OperationCreate, "key")
+		assert.True(t, errors.IsTooManyRequests(err))
+		assert.Equal(t, []string{"a:create", "a:done", "a:create", "a:done"}, calls)
+	})
+}
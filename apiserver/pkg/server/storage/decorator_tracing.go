@@ -0,0 +1,55 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const instrumentationScope = "github.com/vine-io/kes/apiserver/pkg/server/storage"
+
+// WithTracing returns a Decorator creating an OpenTelemetry span for every storage operation.  Spans are only
+// created for requests which are already traced, e.g. when the apiserver is started with --tracing-config-file.
+func WithTracing() Decorator {
+	return InterceptorDecorator(func(resource schema.GroupResource) Interceptor {
+		return func(ctx context.Context, op Operation, key string) (context.Context, func(err error), error) {
+			ctx, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(instrumentationScope).Start(ctx,
+				"storage."+string(op),
+				trace.WithAttributes(
+					attribute.String("resource", resource.String()),
+					attribute.String("key", key),
+				))
+			return ctx, func(err error) {
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+				}
+				span.End()
+			}, nil
+		}
+	})
+}
@@ -47,6 +47,7 @@ import (
 	genericfeatures "k8s.io/apiserver/pkg/features"
 	"k8s.io/apiserver/pkg/server/egressselector"
 	"k8s.io/apiserver/pkg/storage"
+	cacherstorage "k8s.io/apiserver/pkg/storage/cacher"
 	"k8s.io/apiserver/pkg/storage/etcd3"
 	"k8s.io/apiserver/pkg/storage/etcd3/metrics"
 	"k8s.io/apiserver/pkg/storage/storagebackend"
@@ -82,6 +83,8 @@ func init() {
 	// using the global prometheus registry and using our own wrapped global registry,
 	// we need to explicitly register these metrics to our global registry here.
 	// For reference: https://github.com/kubernetes/kubernetes/pull/81387
+	// change: k8s.io/apiserver/pkg/storage/storagebackend/factory, linked in by the server, registers them already
+	// and registering them twice panics.  They are served by /metrics along with the metrics of the storage.
 	//legacyregistry.RawMustRegister(grpcprom.DefaultClientMetrics)
 	dbMetricsMonitors = make(map[string]struct{})
 
@@ -225,6 +228,12 @@ func newETCD3Check(c storagebackend.Config, timeout time.Duration, stopCh <-chan
 	}, nil
 }
 
+// NewETCD3Client returns a client for the etcd cluster described by the transport, configured the same way
+// as the clients backing the registry storage.  Callers are responsible for closing the client.
+func NewETCD3Client(c storagebackend.TransportConfig) (*clientv3.Client, error) {
+	return newETCD3Client(c)
+}
+
 var newETCD3Client = func(c storagebackend.TransportConfig) (*clientv3.Client, error) {
 	tlsInfo := transport.TLSInfo{
 		CertFile:      c.CertFile,
@@ -398,7 +407,24 @@ func newETCD3Storage(c storagebackend.ConfigForResource, newFunc, newListFunc fu
 	if transformer == nil {
 		transformer = identity.NewEncryptCheckTransformer()
 	}
-	return etcd3.New(client, c.Codec, newFunc, newListFunc, c.Prefix, resourcePrefix, c.GroupResource, transformer, c.LeaseManagerConfig), destroyFunc, nil
+	// change: mark the storage, so that writes made directly to etcd can tell the objects are stored as is
+	s := etcd3.New(client, c.Codec, newFunc, newListFunc, c.Prefix, resourcePrefix, c.GroupResource, transformer, c.LeaseManagerConfig)
+	return &etcd3Storage{Interface: s}, destroyFunc, nil
+}
+
+// etcd3Storage is the storage.Interface created by newETCD3Storage.
+type etcd3Storage struct {
+	storage.Interface
+}
+
+// IsETCD3 returns true if the objects of s are stored in etcd by the etcd3 storage, either directly or behind
+// the watch cache, so that they may be written with plain etcd requests.
+func IsETCD3(s storage.Interface) bool {
+	switch s.(type) {
+	case *etcd3Storage, *cacherstorage.Cacher:
+		return true
+	}
+	return false
 }
 
 // startDBSizeMonitorPerEndpoint starts a loop to monitor etcd database size and update the
@@ -0,0 +1,63 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package fieldencryption
+
+import (
+	"io"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// NewCodec returns a storage codec which encrypts the encrypted fields of objects of resource before encoding
+// them with delegate.  Decoded objects keep their encrypted values, so that plaintext never reaches the
+// watch cache or the responses of the resource endpoints.
+func NewCodec(delegate runtime.Codec, envelope *Envelope, resource schema.GroupResource) runtime.Codec {
+	return &codec{
+		Codec:    delegate,
+		envelope: envelope,
+		resource: resource,
+		id:       runtime.Identifier("fieldencryption(" + resource.String() + "," + string(delegate.Identifier()) + ")"),
+	}
+}
+
+type codec struct {
+	runtime.Codec
+	envelope *Envelope
+	resource schema.GroupResource
+	id       runtime.Identifier
+}
+
+func (c *codec) Encode(obj runtime.Object, w io.Writer) error {
+	if HasEncryptedFields(obj) {
+		// never modify the caller's object
+		obj = obj.DeepCopyObject()
+		if err := c.envelope.EncryptObject(c.resource, obj); err != nil {
+			return err
+		}
+	}
+	return c.Codec.Encode(obj, w)
+}
+
+func (c *codec) Identifier() runtime.Identifier {
+	return c.id
+}
@@ -0,0 +1,32 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package fieldencryption encrypts individual fields of resources at rest.
+//
+// String fields tagged with `kes:"encrypted"` are envelope encrypted before an object is written to storage:
+// every value is sealed with a fresh AES-GCM data key, and the data key is wrapped by a key encryption key
+// provided by a KeyService.  The stored and cached objects only ever hold the ciphertext, so the resource
+// endpoints never return the plaintext.  Callers authorized for the "decrypted" subresource may read the
+// object with its encrypted fields decrypted.
+//
+// Values encrypted with a key other than the primary key are re-encrypted with the primary key whenever
+// the object is written, so rotating keys only requires rewriting every object of the resource.
+package fieldencryption
@@ -0,0 +1,200 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package fieldencryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Prefix marks encrypted field values.
+	Prefix = "enc:kes:v1:"
+
+	separator = ":"
+
+	dekSize = 32
+
+	// SubResource is the name of the subresource returning objects with their encrypted fields decrypted.
+	SubResource = "decrypted"
+)
+
+// Envelope encrypts and decrypts field values with per-value data keys wrapped by a KeyService.
+//
+// Encrypted values have the format "enc:kes:v1:<key id>:<wrapped data key>:<ciphertext>" where the
+// wrapped data key and the ciphertext are base64 encoded.  The ciphertext of a field authenticates the
+// resource, the namespace and name of its object and the path of the field, so that it can't be moved to
+// another object or field.
+type Envelope struct {
+	keys KeyService
+}
+
+// NewEnvelope returns an Envelope wrapping data keys with keys.
+func NewEnvelope(keys KeyService) *Envelope {
+	return &Envelope{keys: keys}
+}
+
+// IsEncrypted returns true if value was produced by EncryptValue.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// EncryptValue encrypts plaintext with a new data key, authenticating additionalData.
+func (e *Envelope) EncryptValue(plaintext string, additionalData []byte) (string, error) {
+	dek := make([]byte, dekSize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(plaintext), additionalData)
+	if err != nil {
+		return "", err
+	}
+	keyID, wrapped, err := e.keys.Wrap(dek)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return Prefix + strings.Join([]string{
+		keyID,
+		base64.StdEncoding.EncodeToString(wrapped),
+		base64.StdEncoding.EncodeToString(ciphertext),
+	}, separator), nil
+}
+
+// DecryptValue decrypts a value produced by EncryptValue with the same additionalData.  Values which are not
+// encrypted are returned as is.
+func (e *Envelope) DecryptValue(value string, additionalData []byte) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	keyID, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	dek, err := e.keys.Unwrap(keyID, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	if len(dek) != dekSize {
+		return "", fmt.Errorf("invalid data key size %d", len(dek))
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, ciphertext, additionalData)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// EncryptObject encrypts the encrypted fields of obj, an object of resource, in place.  Plaintext values are
+// encrypted, and values encrypted with a key other than the primary key are re-encrypted with the primary key.
+// Encrypted values which don't decrypt for their object and field are rejected.
+func (e *Envelope) EncryptObject(resource schema.GroupResource, obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	primary := e.keys.PrimaryKeyID()
+	return walk(reflect.ValueOf(obj), "", func(path string, field reflect.Value) error {
+		value := field.String()
+		if value == "" {
+			return nil
+		}
+		additionalData := fieldAdditionalData(resource, accessor, path)
+		if IsEncrypted(value) {
+			keyID, _, _, err := parse(value)
+			if err != nil {
+				return err
+			}
+			// values of the primary key are decrypted as well, rejecting values moved from other objects or fields
+			plaintext, err := e.DecryptValue(value, additionalData)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if keyID == primary {
+				return nil
+			}
+			value = plaintext
+		}
+		encrypted, err := e.EncryptValue(value, additionalData)
+		if err != nil {
+			return err
+		}
+		field.SetString(encrypted)
+		return nil
+	})
+}
+
+// DecryptObject decrypts the encrypted fields of obj, an object of resource, in place.
+func (e *Envelope) DecryptObject(resource schema.GroupResource, obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	return walk(reflect.ValueOf(obj), "", func(path string, field reflect.Value) error {
+		value, err := e.DecryptValue(field.String(), fieldAdditionalData(resource, accessor, path))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		field.SetString(value)
+		return nil
+	})
+}
+
+// fieldAdditionalData returns the additional data binding the value of the field at path to the object.
+func fieldAdditionalData(resource schema.GroupResource, obj metav1.Object, path string) []byte {
+	return []byte(strings.Join([]string{resource.String(), obj.GetNamespace(), obj.GetName(), path}, "/"))
+}
+
+func parse(value string) (keyID string, wrapped, ciphertext []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, Prefix), separator)
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value")
+	}
+	if wrapped, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	if ciphertext, err = base64.StdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	return parts[0], wrapped, ciphertext, nil
+}
+
+// EnvelopeGetter is implemented by generic.RESTOptionsGetters which are configured with field encryption.
+type EnvelopeGetter interface {
+	// FieldEncryptionEnvelope returns the Envelope used to encrypt fields, or nil if field encryption is disabled.
+	FieldEncryptionEnvelope() *Envelope
+}
@@ -0,0 +1,169 @@
+package fieldencryption
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var widgets = schema.GroupResource{Group: "test.kes.io", Resource: "widgets"}
+
+func newObject(name string, s spec) *object {
+	return &object{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}, Spec: s}
+}
+
+type spec struct {
+	Token   string            `json:"token" kes:"encrypted"`
+	Name    string            `json:"name"`
+	Nested  *spec             `json:"nested,omitempty"`
+	Entries map[string]entry  `json:"entries,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+type entry struct {
+	Secret string `json:"secret" kes:"encrypted"`
+}
+
+type object struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              spec `json:"spec"`
+}
+
+func (o *object) GetObjectKind() schema.ObjectKind { return schema.EmptyObjectKind }
+func (o *object) DeepCopyObject() runtime.Object {
+	out := &object{Spec: o.Spec}
+	o.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if o.Spec.Nested != nil {
+		nested := *o.Spec.Nested
+		out.Spec.Nested = &nested
+	}
+	if o.Spec.Entries != nil {
+		out.Spec.Entries = map[string]entry{}
+		for k, v := range o.Spec.Entries {
+			out.Spec.Entries[k] = v
+		}
+	}
+	return out
+}
+
+func key(name string, b byte) Key {
+	return Key{Name: name, Secret: bytes.Repeat([]byte{b}, 32)}
+}
+
+func TestEnvelope(t *testing.T) {
+	keys, err := NewLocalKeyService(key("key1", 1))
+	assert.NoError(t, err)
+	envelope := NewEnvelope(keys)
+
+	t.Run("values should roundtrip", func(t *testing.T) {
+		encrypted, err := envelope.EncryptValue("s3cret", []byte("a"))
+		assert.NoError(t, err)
+		assert.True(t, IsEncrypted(encrypted))
+		assert.NotContains(t, encrypted, "s3cret")
+
+		decrypted, err := envelope.DecryptValue(encrypted, []byte("a"))
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cret", decrypted)
+
+		_, err = envelope.DecryptValue(encrypted, []byte("b"))
+		assert.Error(t, err)
+	})
+	t.Run("only tagged fields should be encrypted", func(t *testing.T) {
+		obj := newObject("a", spec{
+			Token:   "token",
+			Name:    "name",
+			Nested:  &spec{Token: "nested"},
+			Entries: map[string]entry{"a": {Secret: "entry"}},
+		})
+		assert.True(t, HasEncryptedFields(obj))
+		assert.NoError(t, envelope.EncryptObject(widgets, obj))
+		assert.True(t, IsEncrypted(obj.Spec.Token))
+		assert.True(t, IsEncrypted(obj.Spec.Nested.Token))
+		assert.True(t, IsEncrypted(obj.Spec.Entries["a"].Secret))
+		assert.Equal(t, "name", obj.Spec.Name)
+
+		assert.NoError(t, envelope.DecryptObject(widgets, obj))
+		assert.Equal(t, "token", obj.Spec.Token)
+		assert.Equal(t, "nested", obj.Spec.Nested.Token)
+		assert.Equal(t, "entry", obj.Spec.Entries["a"].Secret)
+	})
+	t.Run("values of the primary key should not be re-encrypted", func(t *testing.T) {
+		obj := newObject("a", spec{Token: "token"})
+		assert.NoError(t, envelope.EncryptObject(widgets, obj))
+		encrypted := obj.Spec.Token
+		assert.NoError(t, envelope.EncryptObject(widgets, obj))
+		assert.Equal(t, encrypted, obj.Spec.Token)
+	})
+	t.Run("rotation should re-encrypt values of older keys", func(t *testing.T) {
+		obj := newObject("a", spec{Token: "token"})
+		assert.NoError(t, envelope.EncryptObject(widgets, obj))
+
+		rotated, err := NewLocalKeyService(key("key2", 2), key("key1", 1))
+		assert.NoError(t, err)
+		rotatedEnvelope := NewEnvelope(rotated)
+		assert.NoError(t, rotatedEnvelope.EncryptObject(widgets, obj))
+		keyID, _, _, err := parse(obj.Spec.Token)
+		assert.NoError(t, err)
+		assert.Equal(t, "key2", keyID)
+
+		assert.Error(t, envelope.DecryptObject(widgets, obj.DeepCopyObject()))
+		assert.NoError(t, rotatedEnvelope.DecryptObject(widgets, obj))
+		assert.Equal(t, "token", obj.Spec.Token)
+	})
+	t.Run("values moved to another object or field should not be decrypted", func(t *testing.T) {
+		obj := newObject("a", spec{Token: "token", Entries: map[string]entry{"a": {Secret: "entry"}}})
+		assert.NoError(t, envelope.EncryptObject(widgets, obj))
+		encrypted := obj.Spec.Token
+
+		other := newObject("b", spec{Token: encrypted})
+		assert.Error(t, envelope.DecryptObject(widgets, other))
+		other = newObject("a", spec{Token: encrypted})
+		other.Namespace = "other"
+		assert.Error(t, envelope.DecryptObject(widgets, other))
+		other = newObject("a", spec{Token: encrypted})
+		assert.Error(t, envelope.DecryptObject(schema.GroupResource{Group: "test.kes.io", Resource: "gadgets"}, other))
+		other = newObject("a", spec{Nested: &spec{Token: encrypted}})
+		assert.Error(t, envelope.DecryptObject(widgets, other))
+		other = newObject("a", spec{Entries: map[string]entry{"a": {Secret: encrypted}}})
+		assert.Error(t, envelope.DecryptObject(widgets, other))
+		assert.Error(t, envelope.EncryptObject(widgets, other))
+
+		// elements of maps and slices share the path of their field
+		other = newObject("a", spec{Entries: map[string]entry{"b": obj.Spec.Entries["a"]}})
+		assert.NoError(t, envelope.DecryptObject(widgets, other))
+		assert.Equal(t, "entry", other.Spec.Entries["b"].Secret)
+	})
+	t.Run("codec should not modify the encoded object", func(t *testing.T) {
+		obj := newObject("a", spec{Token: "token"})
+		var buf bytes.Buffer
+		c := NewCodec(jsonCodec{}, envelope, widgets)
+		assert.NoError(t, c.Encode(obj, &buf))
+		assert.Equal(t, "token", obj.Spec.Token)
+		assert.NotContains(t, buf.String(), `"token":"token"`)
+	})
+}
+
+func TestNewLocalKeyService(t *testing.T) {
+	_, err := NewLocalKeyService()
+	assert.Error(t, err)
+	_, err = NewLocalKeyService(key("a:b", 1))
+	assert.Error(t, err)
+	_, err = NewLocalKeyService(key("a", 1), key("a", 2))
+	assert.Error(t, err)
+	_, err = NewLocalKeyService(Key{Name: "a", Secret: []byte("short")})
+	assert.Error(t, err)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(obj runtime.Object, w io.Writer) error { return json.NewEncoder(w).Encode(obj) }
+func (jsonCodec) Identifier() runtime.Identifier               { return "json" }
+func (jsonCodec) Decode(data []byte, _ *schema.GroupVersionKind, into runtime.Object) (runtime.Object, *schema.GroupVersionKind, error) {
+	return into, nil, json.Unmarshal(data, into)
+}
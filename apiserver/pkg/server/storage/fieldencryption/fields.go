@@ -0,0 +1,159 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package fieldencryption
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// TagName is the struct tag marking fields for encryption, e.g.
+//
+//	Password string `json:"password" kes:"encrypted"`
+//
+// Only string fields may be encrypted.  Tagged fields of nested structs, pointers, slices and maps are found as well.
+const TagName = "kes"
+
+const tagEncrypted = "encrypted"
+
+// fieldCache caches whether a type has encrypted fields.
+var fieldCache sync.Map // map[reflect.Type]bool
+
+// HasEncryptedFields returns true if obj has any field tagged for encryption.
+func HasEncryptedFields(obj interface{}) bool {
+	if obj == nil {
+		return false
+	}
+	return typeHasEncryptedFields(reflect.TypeOf(obj))
+}
+
+func typeHasEncryptedFields(t reflect.Type) bool {
+	if v, ok := fieldCache.Load(t); ok {
+		return v.(bool)
+	}
+	found := hasEncryptedFields(t, map[reflect.Type]bool{})
+	fieldCache.Store(t, found)
+	return found
+}
+
+func hasEncryptedFields(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+
+	found := false
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		found = hasEncryptedFields(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField() && !found; i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if isEncrypted(f) {
+				found = true
+				continue
+			}
+			found = hasEncryptedFields(f.Type, visiting)
+		}
+	}
+	return found
+}
+
+func isEncrypted(f reflect.StructField) bool {
+	if f.Type.Kind() != reflect.String {
+		return false
+	}
+	for _, opt := range strings.Split(f.Tag.Get(TagName), ",") {
+		if opt == tagEncrypted {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn with every settable encrypted string field of v and its path, e.g. ".spec.entries[*].secret".
+// Fields are named by their json names, and elements of slices and maps share the path of their field, so
+// that reordering them keeps their values decryptable.
+func walk(v reflect.Value, path string, fn func(path string, field reflect.Value) error) error {
+	if !v.IsValid() || !typeHasEncryptedFields(v.Type()) {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return walk(v.Elem(), path, fn)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walk(v.Index(i), path+"[*]", fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// map values are not addressable, so copy, rewrite and store them back
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			if err := walk(elem, path+"[*]", fn); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			fieldPath := path
+			if name := jsonName(f); name != "" {
+				fieldPath += "." + name
+			}
+			if isEncrypted(f) {
+				if err := fn(fieldPath, v.Field(i)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := walk(v.Field(i), fieldPath, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonName returns the json name of f, or "" if the fields of f are inlined.
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" && !f.Anonymous {
+		return f.Name
+	}
+	return name
+}
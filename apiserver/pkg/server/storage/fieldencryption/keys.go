@@ -0,0 +1,157 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package fieldencryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// KeyService wraps and unwraps the data keys used to encrypt field values.
+type KeyService interface {
+	// Wrap encrypts the data key with the primary key encryption key and returns the id of that key.
+	Wrap(dek []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped by the key encryption key with the given id.
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+	// PrimaryKeyID returns the id of the key used by Wrap.
+	PrimaryKeyID() string
+}
+
+// Key is a named AES key encryption key.
+type Key struct {
+	// Name identifies the key in encrypted values.  Names must be unique and may not contain ':'.
+	Name string `json:"name"`
+	// Secret is the AES key, which must be 16, 24 or 32 bytes long.  Base64 encoded in key files.
+	Secret []byte `json:"secret"`
+}
+
+// KeyFile is the format of the file passed to --field-encryption-key-file.
+//
+//	keys:
+//	- name: key2
+//	  secret: <base64 encoded 32 byte key>
+//	- name: key1
+//	  secret: <base64 encoded 32 byte key>
+type KeyFile struct {
+	// Keys lists the key encryption keys.  The first key is the primary key used to encrypt new values,
+	// the others are only used to decrypt values written before the primary key was rotated in.
+	Keys []Key `json:"keys"`
+}
+
+type localKeyService struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewLocalKeyService returns a KeyService wrapping data keys with AES-GCM using the given keys.
+// The first key is the primary key.
+func NewLocalKeyService(keys ...Key) (KeyService, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+	s := &localKeyService{primary: keys[0].Name, aeads: map[string]cipher.AEAD{}}
+	for i, k := range keys {
+		if k.Name == "" || strings.Contains(k.Name, separator) {
+			return nil, fmt.Errorf("keys[%d]: name must be non-empty and may not contain %q", i, separator)
+		}
+		if _, found := s.aeads[k.Name]; found {
+			return nil, fmt.Errorf("keys[%d]: duplicate key name %q", i, k.Name)
+		}
+		aead, err := newAEAD(k.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		s.aeads[k.Name] = aead
+	}
+	return s, nil
+}
+
+// LoadKeyFile returns a local KeyService for the keys of the KeyFile at path.
+func LoadKeyFile(path string) (KeyService, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ks, err := ParseKeyFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field encryption key file %q: %w", path, err)
+	}
+	return ks, nil
+}
+
+// ParseKeyFile returns a local KeyService for the keys of the KeyFile data.
+func ParseKeyFile(data []byte) (KeyService, error) {
+	f := &KeyFile{}
+	if err := yaml.UnmarshalStrict(data, f); err != nil {
+		return nil, err
+	}
+	return NewLocalKeyService(f.Keys...)
+}
+
+func (s *localKeyService) Wrap(dek []byte) (string, []byte, error) {
+	sealed, err := seal(s.aeads[s.primary], dek, nil)
+	return s.primary, sealed, err
+}
+
+func (s *localKeyService) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := s.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key encryption key %q", keyID)
+	}
+	return open(aead, wrapped, nil)
+}
+
+func (s *localKeyService) PrimaryKeyID() string {
+	return s.primary
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext, authenticating additionalData, and prefixes the result with a random nonce.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts data produced by seal with the same additionalData.
+func open(aead cipher.AEAD, data, additionalData []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,62 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package fieldencryption
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	serverstorage "k8s.io/apiserver/pkg/server/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+)
+
+var _ serverstorage.StorageFactory = &StorageFactory{}
+
+// StorageFactory wraps the codec of every storage config created by Delegate with the field encryption codec.
+type StorageFactory struct {
+	Delegate serverstorage.StorageFactory
+	Envelope *Envelope
+}
+
+func (f *StorageFactory) NewConfig(resource schema.GroupResource) (*storagebackend.ConfigForResource, error) {
+	config, err := f.Delegate.NewConfig(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	configCopy := *config
+	resourceConfig := configCopy.Config
+	resourceConfig.Codec = NewCodec(resourceConfig.Codec, f.Envelope, resource)
+	configCopy.Config = resourceConfig
+
+	return &configCopy, nil
+}
+
+func (f *StorageFactory) ResourcePrefix(resource schema.GroupResource) string {
+	return f.Delegate.ResourcePrefix(resource)
+}
+
+func (f *StorageFactory) Configs() []storagebackend.Config {
+	return f.Delegate.Configs()
+}
+
+func (f *StorageFactory) Backends() []serverstorage.Backend {
+	return f.Delegate.Backends()
+}
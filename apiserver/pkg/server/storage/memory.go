@@ -0,0 +1,598 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Memory is an in-memory storage backend shared by the storage of every resource, e.g. to run the apiserver in
+// unit tests without an etcd.  Like an etcd, it has a single resource version incremented by every write and
+// keeps the objects encoded by the codec of their resource, so the objects go through the same conversions as
+// with an etcd.  Unlike an etcd, it keeps every event since it was created, so watches never fail with a
+// resource version too old, and it ignores TTLs.
+type Memory struct {
+	mu       sync.Mutex
+	rev      int64
+	values   map[string]memoryValue
+	events   []memoryEvent
+	watchers map[*memoryWatcher]struct{}
+	// storages are the storage of the resources, by group resource.
+	storages map[schema.GroupResource]*memoryStorage
+}
+
+// memoryValue is an encoded object and the revision it was last modified at.
+type memoryValue struct {
+	data []byte
+	rev  int64
+}
+
+// memoryEvent is a write of the Memory.  data is nil if the key was deleted, prevData is nil if it was created.
+type memoryEvent struct {
+	key            string
+	rev            int64
+	data, prevData []byte
+}
+
+// NewMemory returns an empty Memory.
+func NewMemory() *Memory {
+	return &Memory{
+		values:   map[string]memoryValue{},
+		watchers: map[*memoryWatcher]struct{}{},
+		storages: map[schema.GroupResource]*memoryStorage{},
+	}
+}
+
+// Decorator returns a Decorator replacing the storage of every resource by its storage in the Memory.  The
+// storage isn't decorated by the decorators applied before, e.g. it isn't cached.
+func (m *Memory) Decorator() Decorator {
+	return func(generic.StorageDecorator) generic.StorageDecorator {
+		return func(
+			config *storagebackend.ConfigForResource,
+			resourcePrefix string,
+			keyFunc func(obj runtime.Object) (string, error),
+			newFunc func() runtime.Object,
+			newListFunc func() runtime.Object,
+			getAttrsFunc storage.AttrFunc,
+			trigger storage.IndexerFuncs,
+			indexers *cache.Indexers) (storage.Interface, factory.DestroyFunc, error) {
+			s := &memoryStorage{
+				memory:    m,
+				codec:     config.Codec,
+				versioner: storage.APIObjectVersioner{},
+				keyFunc:   keyFunc,
+				newFunc:   newFunc,
+			}
+			m.mu.Lock()
+			m.storages[config.GroupResource] = s
+			m.mu.Unlock()
+			return s, func() {}, nil
+		}
+	}
+}
+
+// Add stores the object as is in the storage of the resource, overwriting any existing object with the same
+// key.  The resource version of the object is ignored.
+func (m *Memory) Add(gr schema.GroupResource, obj runtime.Object) error {
+	m.mu.Lock()
+	s, ok := m.storages[gr]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no storage for %s", gr)
+	}
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return err
+	}
+	obj = obj.DeepCopyObject()
+	if err := s.versioner.PrepareObjectForStorage(obj); err != nil {
+		return err
+	}
+	data, err := runtime.Encode(s.codec, obj)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.write(key, data)
+	return nil
+}
+
+// get returns the value of the key and the current revision.
+func (m *Memory) get(key string) (memoryValue, bool, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	return v, ok, m.rev
+}
+
+// write puts the data at the key, deleting the key if data is nil, and notifies the watchers.  m.mu must be held.
+func (m *Memory) write(key string, data []byte) int64 {
+	m.rev++
+	e := memoryEvent{key: key, rev: m.rev, data: data}
+	if prev, ok := m.values[key]; ok {
+		e.prevData = prev.data
+	}
+	if data == nil {
+		delete(m.values, key)
+	} else {
+		m.values[key] = memoryValue{data: data, rev: m.rev}
+	}
+	m.events = append(m.events, e)
+	for w := range m.watchers {
+		w.enqueue(e)
+	}
+	return m.rev
+}
+
+// memoryStorage is the storage.Interface of a resource in the Memory.
+type memoryStorage struct {
+	memory    *Memory
+	codec     runtime.Codec
+	versioner storage.Versioner
+	keyFunc   func(obj runtime.Object) (string, error)
+	newFunc   func() runtime.Object
+}
+
+var _ storage.Interface = &memoryStorage{}
+
+func (s *memoryStorage) Versioner() storage.Versioner {
+	return s.versioner
+}
+
+func (s *memoryStorage) decode(data []byte, objPtr runtime.Object, rev int64) error {
+	if _, err := conversion.EnforcePtr(objPtr); err != nil {
+		return fmt.Errorf("unable to convert output object to pointer: %v", err)
+	}
+	if _, _, err := s.codec.Decode(data, nil, objPtr); err != nil {
+		return err
+	}
+	return s.versioner.UpdateObject(objPtr, uint64(rev))
+}
+
+func (s *memoryStorage) validateMinimumResourceVersion(minimumResourceVersion string, actualRevision int64) error {
+	if minimumResourceVersion == "" {
+		return nil
+	}
+	minimumRV, err := s.versioner.ParseResourceVersion(minimumResourceVersion)
+	if err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("invalid resource version: %v", err))
+	}
+	if minimumRV > uint64(actualRevision) {
+		return storage.NewTooLargeResourceVersionError(minimumRV, uint64(actualRevision), 0)
+	}
+	return nil
+}
+
+func (s *memoryStorage) Create(ctx context.Context, key string, obj, out runtime.Object, ttl uint64) error {
+	if version, err := s.versioner.ObjectResourceVersion(obj); err == nil && version != 0 {
+		return storage.ErrResourceVersionSetOnCreate
+	}
+	if err := s.versioner.PrepareObjectForStorage(obj); err != nil {
+		return fmt.Errorf("PrepareObjectForStorage failed: %v", err)
+	}
+	data, err := runtime.Encode(s.codec, obj)
+	if err != nil {
+		return err
+	}
+
+	s.memory.mu.Lock()
+	if _, ok := s.memory.values[key]; ok {
+		s.memory.mu.Unlock()
+		return storage.NewKeyExistsError(key, 0)
+	}
+	rev := s.memory.write(key, data)
+	s.memory.mu.Unlock()
+
+	if out != nil {
+		return s.decode(data, out, rev)
+	}
+	return nil
+}
+
+// state returns the object stored at the key decoded into a new instance of the type of v, as its revision and
+// encoded data.  If the key doesn't exist, the object is the zero value and the revision is 0.
+func (s *memoryStorage) state(key string, v reflect.Value, ignoreNotFound bool) (runtime.Object, int64, []byte, error) {
+	obj := reflect.New(v.Type()).Interface().(runtime.Object)
+	value, ok, _ := s.memory.get(key)
+	if !ok {
+		if !ignoreNotFound {
+			return nil, 0, nil, storage.NewKeyNotFoundError(key, 0)
+		}
+		return obj, 0, nil, nil
+	}
+	if err := s.decode(value.data, obj, value.rev); err != nil {
+		return nil, 0, nil, err
+	}
+	return obj, value.rev, value.data, nil
+}
+
+// commit writes the data at the key if the key is still at the revision, returning the new revision.  A nil data
+// deletes the key.
+func (s *memoryStorage) commit(key string, rev int64, data []byte) (int64, bool) {
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+	if s.memory.values[key].rev != rev {
+		return 0, false
+	}
+	return s.memory.write(key, data), true
+}
+
+func (s *memoryStorage) Delete(
+	ctx context.Context, key string, out runtime.Object, preconditions *storage.Preconditions,
+	validateDeletion storage.ValidateObjectFunc, cachedExistingObject runtime.Object) error {
+	v, err := conversion.EnforcePtr(out)
+	if err != nil {
+		return fmt.Errorf("unable to convert output object to pointer: %v", err)
+	}
+	for {
+		obj, rev, data, err := s.state(key, v, false)
+		if err != nil {
+			return err
+		}
+		if preconditions != nil {
+			if err := preconditions.Check(key, obj); err != nil {
+				return err
+			}
+		}
+		if err := validateDeletion(ctx, obj); err != nil {
+			return err
+		}
+		deleteRev, ok := s.commit(key, rev, nil)
+		if !ok {
+			// modified concurrently, retry
+			continue
+		}
+		return s.decode(data, out, deleteRev)
+	}
+}
+
+func (s *memoryStorage) GuaranteedUpdate(
+	ctx context.Context, key string, destination runtime.Object, ignoreNotFound bool,
+	preconditions *storage.Preconditions, tryUpdate storage.UpdateFunc, cachedExistingObject runtime.Object) error {
+	v, err := conversion.EnforcePtr(destination)
+	if err != nil {
+		return fmt.Errorf("unable to convert output object to pointer: %v", err)
+	}
+	for {
+		obj, rev, data, err := s.state(key, v, ignoreNotFound)
+		if err != nil {
+			return err
+		}
+		if err := preconditions.Check(key, obj); err != nil {
+			return err
+		}
+		ret, _, err := tryUpdate(obj, storage.ResponseMeta{ResourceVersion: uint64(rev)})
+		if err != nil {
+			return err
+		}
+		if err := s.versioner.PrepareObjectForStorage(ret); err != nil {
+			return fmt.Errorf("PrepareObjectForStorage failed: %v", err)
+		}
+		newData, err := runtime.Encode(s.codec, ret)
+		if err != nil {
+			return err
+		}
+		if data != nil && bytes.Equal(newData, data) {
+			// nothing changed, don't write
+			return s.decode(data, destination, rev)
+		}
+		newRev, ok := s.commit(key, rev, newData)
+		if !ok {
+			// modified concurrently, retry
+			continue
+		}
+		return s.decode(newData, destination, newRev)
+	}
+}
+
+func (s *memoryStorage) Get(ctx context.Context, key string, opts storage.GetOptions, objPtr runtime.Object) error {
+	value, ok, rev := s.memory.get(key)
+	if err := s.validateMinimumResourceVersion(opts.ResourceVersion, rev); err != nil {
+		return err
+	}
+	if !ok {
+		if opts.IgnoreNotFound {
+			return runtime.SetZeroValue(objPtr)
+		}
+		return storage.NewKeyNotFoundError(key, 0)
+	}
+	return s.decode(value.data, objPtr, value.rev)
+}
+
+// GetList lists the current objects, whatever the resource version of the options: the Memory doesn't keep the
+// previous versions of the objects.
+func (s *memoryStorage) GetList(ctx context.Context, key string, opts storage.ListOptions, listObj runtime.Object) error {
+	listPtr, err := meta.GetItemsPtr(listObj)
+	if err != nil {
+		return err
+	}
+	v, err := conversion.EnforcePtr(listPtr)
+	if err != nil || v.Kind() != reflect.Slice {
+		return fmt.Errorf("need ptr to slice: %v", err)
+	}
+	if opts.Recursive && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	keyPrefix := key
+
+	fromKey := ""
+	if len(opts.Predicate.Continue) > 0 {
+		if len(opts.ResourceVersion) > 0 && opts.ResourceVersion != "0" {
+			return apierrors.NewBadRequest("specifying resource version is not allowed when using continue")
+		}
+		if fromKey, _, err = storage.DecodeContinue(opts.Predicate.Continue, keyPrefix); err != nil {
+			return apierrors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+		}
+	}
+
+	s.memory.mu.Lock()
+	rev := s.memory.rev
+	var keys []string
+	for k := range s.memory.values {
+		if opts.Recursive && strings.HasPrefix(k, key) || !opts.Recursive && k == key {
+			if k >= fromKey {
+				keys = append(keys, k)
+			}
+		}
+	}
+	values := make([]memoryValue, len(keys))
+	sort.Strings(keys)
+	for i, k := range keys {
+		values[i] = s.memory.values[k]
+	}
+	s.memory.mu.Unlock()
+
+	if err := s.validateMinimumResourceVersion(opts.ResourceVersion, rev); err != nil {
+		return err
+	}
+
+	var continueKey string
+	var remaining int64
+	for i, value := range values {
+		if opts.Predicate.Limit > 0 && int64(v.Len()) >= opts.Predicate.Limit {
+			continueKey = keys[i]
+			remaining = int64(len(values) - i)
+			break
+		}
+		obj := reflect.New(v.Type().Elem()).Interface().(runtime.Object)
+		if err := s.decode(value.data, obj, value.rev); err != nil {
+			return err
+		}
+		if matched, err := opts.Predicate.Matches(obj); err == nil && matched {
+			v.Set(reflect.Append(v, reflect.ValueOf(obj).Elem()))
+		}
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	}
+
+	if continueKey == "" {
+		return s.versioner.UpdateList(listObj, uint64(rev), "", nil)
+	}
+	next, err := storage.EncodeContinue(continueKey, keyPrefix, rev)
+	if err != nil {
+		return err
+	}
+	var remainingItemCount *int64
+	if opts.Predicate.Empty() {
+		remainingItemCount = &remaining
+	}
+	return s.versioner.UpdateList(listObj, uint64(rev), next, remainingItemCount)
+}
+
+func (s *memoryStorage) Count(key string) (int64, error) {
+	if !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+	var count int64
+	for k := range s.memory.values {
+		if strings.HasPrefix(k, key) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryStorage) RequestWatchProgress(ctx context.Context) error {
+	return nil
+}
+
+// Watch watches the key, or the keys with the prefix if opts.Recursive.  If the resource version of the options
+// is 0 or empty the current objects are sent first as added, otherwise the events since the resource version are.
+func (s *memoryStorage) Watch(ctx context.Context, key string, opts storage.ListOptions) (watch.Interface, error) {
+	rev, err := s.versioner.ParseResourceVersion(opts.ResourceVersion)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid resource version: %v", err))
+	}
+	if opts.Recursive && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &memoryWatcher{
+		storage:   s,
+		key:       key,
+		recursive: opts.Recursive,
+		predicate: opts.Predicate,
+		result:    make(chan watch.Event),
+		notify:    make(chan struct{}, 1),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	s.memory.mu.Lock()
+	if err := s.validateMinimumResourceVersion(opts.ResourceVersion, s.memory.rev); err != nil {
+		s.memory.mu.Unlock()
+		return nil, err
+	}
+	if rev == 0 {
+		var keys []string
+		for k := range s.memory.values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			value := s.memory.values[k]
+			w.enqueue(memoryEvent{key: k, rev: value.rev, data: value.data})
+		}
+	} else {
+		i := sort.Search(len(s.memory.events), func(i int) bool { return s.memory.events[i].rev > int64(rev) })
+		for _, e := range s.memory.events[i:] {
+			w.enqueue(e)
+		}
+	}
+	s.memory.watchers[w] = struct{}{}
+	s.memory.mu.Unlock()
+
+	go w.run(ctx)
+	return w, nil
+}
+
+// memoryWatcher sends the events of the Memory matching its key and predicate.
+type memoryWatcher struct {
+	storage   *memoryStorage
+	key       string
+	recursive bool
+	predicate storage.SelectionPredicate
+
+	mu     sync.Mutex
+	queue  []memoryEvent
+	notify chan struct{}
+
+	result chan watch.Event
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// enqueue queues the event if it matches the key.  The queue is unbounded, so the Memory is never blocked by a
+// slow watcher.
+func (w *memoryWatcher) enqueue(e memoryEvent) {
+	if w.recursive && !strings.HasPrefix(e.key, w.key) || !w.recursive && e.key != w.key {
+		return
+	}
+	w.mu.Lock()
+	w.queue = append(w.queue, e)
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatcher) run(ctx context.Context) {
+	defer func() {
+		w.storage.memory.mu.Lock()
+		delete(w.storage.memory.watchers, w)
+		w.storage.memory.mu.Unlock()
+		close(w.result)
+		close(w.done)
+	}()
+	for {
+		w.mu.Lock()
+		queue := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+
+		for _, e := range queue {
+			event, ok, err := w.transform(e)
+			if err != nil {
+				event = watch.Event{Type: watch.Error, Object: &apierrors.NewInternalError(err).ErrStatus}
+			} else if !ok {
+				continue
+			}
+			select {
+			case w.result <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-w.notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// transform returns the watch event of the memory event.  As with an etcd, objects modified to match or to no
+// longer match the predicate are sent as added and deleted.
+func (w *memoryWatcher) transform(e memoryEvent) (watch.Event, bool, error) {
+	var cur, prev runtime.Object
+	var curMatches, prevMatches bool
+	if e.data != nil {
+		cur = w.storage.newFunc()
+		if err := w.storage.decode(e.data, cur, e.rev); err != nil {
+			return watch.Event{}, false, err
+		}
+		curMatches, _ = w.predicate.Matches(cur)
+	}
+	if e.prevData != nil {
+		prev = w.storage.newFunc()
+		// the previous object is sent with the revision of its deletion, as with an etcd
+		if err := w.storage.decode(e.prevData, prev, e.rev); err != nil {
+			return watch.Event{}, false, err
+		}
+		prevMatches, _ = w.predicate.Matches(prev)
+	}
+
+	switch {
+	case curMatches && prevMatches:
+		return watch.Event{Type: watch.Modified, Object: cur}, true, nil
+	case curMatches:
+		return watch.Event{Type: watch.Added, Object: cur}, true, nil
+	case prevMatches:
+		return watch.Event{Type: watch.Deleted, Object: prev}, true, nil
+	}
+	return watch.Event{}, false, nil
+}
+
+func (w *memoryWatcher) Stop() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *memoryWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
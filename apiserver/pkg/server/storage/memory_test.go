@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/apis/example"
+	examplev1 "k8s.io/apiserver/pkg/apis/example/v1"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+)
+
+var pods = schema.GroupResource{Group: example.GroupName, Resource: "pods"}
+
+func newMemoryStorage(t *testing.T, m *Memory) storage.Interface {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, example.AddToScheme(scheme))
+	assert.NoError(t, examplev1.AddToScheme(scheme))
+	codec := serializer.NewCodecFactory(scheme).LegacyCodec(examplev1.SchemeGroupVersion)
+
+	d := m.Decorator()(nil)
+	s, _, err := d(&storagebackend.ConfigForResource{Config: storagebackend.Config{Codec: codec}, GroupResource: pods}, "/pods",
+		func(obj runtime.Object) (string, error) { return "/pods/" + obj.(*example.Pod).Name, nil },
+		func() runtime.Object { return &example.Pod{} }, func() runtime.Object { return &example.PodList{} },
+		nil, nil, nil)
+	assert.NoError(t, err)
+	return s
+}
+
+func newPod(name string, labels map[string]string) *example.Pod {
+	return &example.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func labelPredicate(selector string) storage.SelectionPredicate {
+	return storage.SelectionPredicate{
+		Label: labels.SelectorFromSet(labels.Set{"app": selector}),
+		Field: fields.Everything(),
+		GetAttrs: func(obj runtime.Object) (labels.Set, fields.Set, error) {
+			return obj.(*example.Pod).Labels, nil, nil
+		},
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("create and get", func(t *testing.T) {
+		s := newMemoryStorage(t, NewMemory())
+		out := &example.Pod{}
+		assert.NoError(t, s.Create(ctx, "/pods/a", newPod("a", nil), out, 0))
+		assert.Equal(t, "1", out.ResourceVersion)
+		assert.True(t, storage.IsExist(s.Create(ctx, "/pods/a", newPod("a", nil), nil, 0)))
+
+		got := &example.Pod{}
+		assert.NoError(t, s.Get(ctx, "/pods/a", storage.GetOptions{}, got))
+		assert.Equal(t, out, got)
+		assert.True(t, storage.IsNotFound(s.Get(ctx, "/pods/b", storage.GetOptions{}, got)))
+		assert.NoError(t, s.Get(ctx, "/pods/b", storage.GetOptions{IgnoreNotFound: true}, got))
+		assert.Error(t, s.Get(ctx, "/pods/a", storage.GetOptions{ResourceVersion: "2"}, got))
+	})
+
+	t.Run("guaranteed update", func(t *testing.T) {
+		s := newMemoryStorage(t, NewMemory())
+		assert.NoError(t, s.Create(ctx, "/pods/a", newPod("a", nil), nil, 0))
+
+		out := &example.Pod{}
+		err := s.GuaranteedUpdate(ctx, "/pods/a", out, false, nil, func(input runtime.Object, res storage.ResponseMeta) (runtime.Object, *uint64, error) {
+			assert.Equal(t, uint64(1), res.ResourceVersion)
+			pod := input.(*example.Pod)
+			pod.Labels = map[string]string{"app": "a"}
+			return pod, nil, nil
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "2", out.ResourceVersion)
+		assert.Equal(t, "a", out.Labels["app"])
+
+		// unchanged objects aren't written
+		err = s.GuaranteedUpdate(ctx, "/pods/a", out, false, nil, func(input runtime.Object, _ storage.ResponseMeta) (runtime.Object, *uint64, error) {
+			return input, nil, nil
+		}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "2", out.ResourceVersion)
+
+		uid := types.UID("other")
+		err = s.GuaranteedUpdate(ctx, "/pods/a", out, false, &storage.Preconditions{UID: &uid}, nil, nil)
+		assert.True(t, storage.IsInvalidObj(err), "expected invalid object, got %v", err)
+		err = s.GuaranteedUpdate(ctx, "/pods/b", out, false, nil, nil, nil)
+		assert.True(t, storage.IsNotFound(err), "expected not found, got %v", err)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		s := newMemoryStorage(t, NewMemory())
+		assert.NoError(t, s.Create(ctx, "/pods/a", newPod("a", nil), nil, 0))
+
+		rv := "2"
+		out := &example.Pod{}
+		err := s.Delete(ctx, "/pods/a", out, &storage.Preconditions{ResourceVersion: &rv}, storage.ValidateAllObjectFunc, nil)
+		assert.True(t, storage.IsInvalidObj(err), "expected invalid object, got %v", err)
+		assert.NoError(t, s.Delete(ctx, "/pods/a", out, nil, storage.ValidateAllObjectFunc, nil))
+		assert.Equal(t, "a", out.Name)
+		assert.Equal(t, "2", out.ResourceVersion)
+		assert.True(t, storage.IsNotFound(s.Get(ctx, "/pods/a", storage.GetOptions{}, out)))
+	})
+
+	t.Run("list", func(t *testing.T) {
+		s := newMemoryStorage(t, NewMemory())
+		for _, name := range []string{"c", "a", "b"} {
+			assert.NoError(t, s.Create(ctx, "/pods/"+name, newPod(name, map[string]string{"app": name}), nil, 0))
+		}
+
+		list := &example.PodList{}
+		assert.NoError(t, s.GetList(ctx, "/pods", storage.ListOptions{Recursive: true, Predicate: storage.Everything}, list))
+		assert.Equal(t, "3", list.ResourceVersion)
+		if assert.Len(t, list.Items, 3) {
+			assert.Equal(t, "a", list.Items[0].Name)
+		}
+
+		list = &example.PodList{}
+		assert.NoError(t, s.GetList(ctx, "/pods", storage.ListOptions{Recursive: true, Predicate: labelPredicate("b")}, list))
+		if assert.Len(t, list.Items, 1) {
+			assert.Equal(t, "b", list.Items[0].Name)
+		}
+
+		var names []string
+		predicate := storage.Everything
+		predicate.Limit = 2
+		for {
+			list = &example.PodList{}
+			assert.NoError(t, s.GetList(ctx, "/pods", storage.ListOptions{Recursive: true, Predicate: predicate}, list))
+			for _, pod := range list.Items {
+				names = append(names, pod.Name)
+			}
+			if list.Continue == "" {
+				break
+			}
+			predicate.Continue = list.Continue
+		}
+		assert.Equal(t, []string{"a", "b", "c"}, names)
+
+		count, err := s.Count("/pods")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		m := NewMemory()
+		s := newMemoryStorage(t, m)
+		assert.NoError(t, s.Create(ctx, "/pods/a", newPod("a", map[string]string{"app": "a"}), nil, 0))
+
+		// events since the resource version
+		fromRV, err := s.Watch(ctx, "/pods", storage.ListOptions{ResourceVersion: "1", Recursive: true, Predicate: labelPredicate("b")})
+		assert.NoError(t, err)
+		defer fromRV.Stop()
+		// current objects first
+		current, err := s.Watch(ctx, "/pods", storage.ListOptions{ResourceVersion: "0", Recursive: true, Predicate: storage.Everything})
+		assert.NoError(t, err)
+		defer current.Stop()
+
+		assert.NoError(t, s.Create(ctx, "/pods/b", newPod("b", map[string]string{"app": "b"}), nil, 0))
+		assert.NoError(t, m.Add(pods, newPod("b", map[string]string{"app": "c"})))
+		assert.NoError(t, s.Delete(ctx, "/pods/a", &example.Pod{}, nil, storage.ValidateAllObjectFunc, nil))
+
+		expect := func(w watch.Interface, eventType watch.EventType, name, rv string) {
+			t.Helper()
+			select {
+			case e := <-w.ResultChan():
+				assert.Equal(t, eventType, e.Type)
+				assert.Equal(t, name, e.Object.(*example.Pod).Name)
+				assert.Equal(t, rv, e.Object.(*example.Pod).ResourceVersion)
+			case <-time.After(10 * time.Second):
+				t.Fatalf("no %s event", eventType)
+			}
+		}
+		expect(fromRV, watch.Added, "b", "2")
+		// no longer matching the predicate
+		expect(fromRV, watch.Deleted, "b", "3")
+
+		expect(current, watch.Added, "a", "1")
+		expect(current, watch.Added, "b", "2")
+		expect(current, watch.Modified, "b", "3")
+		expect(current, watch.Deleted, "a", "4")
+
+		current.Stop()
+		_, ok := <-current.ResultChan()
+		assert.False(t, ok)
+	})
+}
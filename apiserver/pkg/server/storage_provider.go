@@ -9,6 +9,7 @@ import (
 
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -16,9 +17,11 @@ import (
 	"k8s.io/apiserver/pkg/registry/generic/registry"
 	registryrest "k8s.io/apiserver/pkg/registry/rest"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
 
 	"github.com/vine-io/kes/apiserver/pkg/server/resource"
 	"github.com/vine-io/kes/apiserver/pkg/server/rest"
+	"github.com/vine-io/kes/apiserver/pkg/server/storage/fieldencryption"
 )
 
 // singletonProvider ensures different versions of the same resource share storage
@@ -37,10 +40,19 @@ func (s *singletonProvider) Get(
 	return s.storage, s.err
 }
 
+// subResourceStorageFunc creates the storage of a subresource from the storage of its parent resource and,
+// for subresources providing their own storage, the subresource storage.
+type subResourceStorageFunc func(
+	gvr schema.GroupVersionResource,
+	optsGetter generic.RESTOptionsGetter,
+	parentStorage registryrest.Storage,
+	subResourceStorage registryrest.Storage) (registryrest.Storage, error)
+
 type subResourceStorageProvider struct {
 	subResourceGVR             schema.GroupVersionResource
 	parentStorageProvider      rest.StorageProvider
 	subResourceStorageProvider rest.StorageProvider
+	newStorage                 subResourceStorageFunc
 }
 
 func (s *subResourceStorageProvider) Get(scheme *runtime.Scheme, optsGetter generic.RESTOptionsGetter) (registryrest.Storage, error) {
@@ -57,40 +69,77 @@ func (s *subResourceStorageProvider) Get(scheme *runtime.Scheme, optsGetter gene
 		}
 	}
 
-	// status subresource
-	if strings.HasSuffix(s.subResourceGVR.Resource, "/status") {
-		stdParentStorage, ok := parentStorage.(registryrest.StandardStorage)
-		if !ok {
-			return nil, fmt.Errorf("parent storageProvider for %v/%v/%v must implement rest.StandardStorage",
-				s.subResourceGVR.Group, s.subResourceGVR.Version, s.subResourceGVR.Resource)
+	return s.newStorage(s.subResourceGVR, optsGetter, parentStorage, subResourceStorage)
+}
+
+func parentStorageError(gvr schema.GroupVersionResource, iface string) error {
+	return fmt.Errorf("parent storageProvider for %v/%v/%v must implement %s", gvr.Group, gvr.Version, gvr.Resource, iface)
+}
+
+// newStatusSubResourceStorage creates the storage of the status subresource.
+// Custom request handlers wrapped by rest.NewManagedFieldsStorage get a status subresource updating the status
+// through the handler.
+func newStatusSubResourceStorage(gvr schema.GroupVersionResource, _ generic.RESTOptionsGetter, parentStorage, _ registryrest.Storage) (registryrest.Storage, error) {
+	if _, ok := parentStorage.(*registry.Store); !ok {
+		if storage, err := rest.NewManagedFieldsStatusStorage(parentStorage); err == nil {
+			return storage, nil
 		}
-		return createStatusSubResourceStorage(stdParentStorage)
 	}
-	// scale subresource
-	if strings.HasSuffix(s.subResourceGVR.Resource, "/scale") {
+	stdParentStorage, ok := parentStorage.(registryrest.StandardStorage)
+	if !ok {
+		return nil, parentStorageError(gvr, "rest.StandardStorage")
+	}
+	return createStatusSubResourceStorage(stdParentStorage)
+}
+
+// newScaleSubResourceStorageFunc returns the subResourceStorageFunc creating the storage of the scale subresource.
+func newScaleSubResourceStorageFunc(sc scaler) subResourceStorageFunc {
+	return func(gvr schema.GroupVersionResource, _ generic.RESTOptionsGetter, parentStorage, _ registryrest.Storage) (registryrest.Storage, error) {
 		getter, ok := parentStorage.(registryrest.Getter)
 		if !ok {
-			return nil, fmt.Errorf("parent storageProvider for %v/%v/%v must implement rest.Getter",
-				s.subResourceGVR.Group, s.subResourceGVR.Version, s.subResourceGVR.Resource)
+			return nil, parentStorageError(gvr, "rest.Getter")
 		}
 		updater, ok := parentStorage.(registryrest.Updater)
 		if !ok {
-			return nil, fmt.Errorf("parent storageProvider for %v/%v/%v must implement rest.Updater",
-				s.subResourceGVR.Group, s.subResourceGVR.Version, s.subResourceGVR.Resource)
+			return nil, parentStorageError(gvr, "rest.Updater")
 		}
 		return &scaleSubResourceStorage{
 			parentStorage:        parentStorage,
 			parentStorageGetter:  getter,
 			parentStorageUpdater: updater,
+			scaler:               sc,
 		}, nil
 	}
+}
+
+// newDecryptedSubResourceStorage creates the storage of the subresource returning objects with their encrypted
+// fields decrypted.
+func newDecryptedSubResourceStorage(gvr schema.GroupVersionResource, optsGetter generic.RESTOptionsGetter, parentStorage, _ registryrest.Storage) (registryrest.Storage, error) {
+	getter, ok := parentStorage.(registryrest.Getter)
+	if !ok {
+		return nil, parentStorageError(gvr, "rest.Getter")
+	}
+	var envelope *fieldencryption.Envelope
+	if eg, ok := optsGetter.(fieldencryption.EnvelopeGetter); ok {
+		envelope = eg.FieldEncryptionEnvelope()
+	}
+	return &decryptedSubResourceStorage{
+		parentStorage:       parentStorage,
+		parentStorageGetter: getter,
+		parentResource:      schema.GroupResource{Group: gvr.Group, Resource: strings.SplitN(gvr.Resource, "/", 2)[0]},
+		envelope:            envelope,
+	}, nil
+}
+
+// newArbitrarySubResourceStorage creates the storage of a resource.ArbitrarySubResource, plumbing the parent
+// storage into connectors and getter & updaters.
+func newArbitrarySubResourceStorage(gvr schema.GroupVersionResource, _ generic.RESTOptionsGetter, parentStorage, subResourceStorage registryrest.Storage) (registryrest.Storage, error) {
 	// connector
 	connectorSubResource, isConnector := subResourceStorage.(resource.ConnectorSubResource)
 	if isConnector {
 		getter, ok := parentStorage.(registryrest.Getter)
 		if !ok {
-			return nil, fmt.Errorf("parent storageProvider for %v/%v/%v must implement rest.Getter",
-				s.subResourceGVR.Group, s.subResourceGVR.Version, s.subResourceGVR.Resource)
+			return nil, parentStorageError(gvr, "rest.Getter")
 		}
 		return &connectorSubResourceStorage{
 			parentStorage:          parentStorage,
@@ -112,11 +161,11 @@ func (s *subResourceStorageProvider) Get(scheme *runtime.Scheme, optsGetter gene
 			}, nil
 		}
 		klog.Infof("Parent storageProvider for %v/%v/%v must implement rest.StandardStorage",
-			s.subResourceGVR.Group, s.subResourceGVR.Version, s.subResourceGVR.Resource)
+			gvr.Group, gvr.Version, gvr.Resource)
 	}
 
 	// use the subresource storage directly
-	return s.subResourceStorageProvider(scheme, optsGetter)
+	return subResourceStorage, nil
 }
 
 func createStatusSubResourceStorage(parentStorage registryrest.StandardStorage) (registryrest.Storage, error) {
@@ -127,6 +176,10 @@ func createStatusSubResourceStorage(parentStorage registryrest.StandardStorage)
 	//return parentStore, nil
 	statusStore := *parentStore
 	statusStore.UpdateStrategy = &statusSubResourceStrategy{RESTUpdateStrategy: parentStore.UpdateStrategy}
+	statusStore.ResetFieldsStrategy = nil
+	if r, ok := parentStore.UpdateStrategy.(rest.StatusResetFieldsStrategy); ok {
+		statusStore.ResetFieldsStrategy = statusResetFieldsStrategy{r}
+	}
 	return &statusSubResourceStorage{
 		store: &statusStore,
 	}, nil
@@ -139,6 +192,7 @@ type statusSubResourceStorage struct {
 
 var _ registryrest.Getter = &statusSubResourceStorage{}
 var _ registryrest.Updater = &statusSubResourceStorage{}
+var _ registryrest.ResetFieldsStrategy = &statusSubResourceStorage{}
 
 func (s *statusSubResourceStorage) Get(ctx context.Context, name string, options *v1.GetOptions) (runtime.Object, error) {
 	return s.store.Get(ctx, name, options)
@@ -152,6 +206,11 @@ func (s *statusSubResourceStorage) Destroy() {
 	s.store.Destroy()
 }
 
+// GetResetFields returns the fields which are not written through the status subresource.
+func (s *statusSubResourceStorage) GetResetFields() map[fieldpath.APIVersion]*fieldpath.Set {
+	return s.store.GetResetFields()
+}
+
 func (s *statusSubResourceStorage) Update(ctx context.Context,
 	name string,
 	objInfo registryrest.UpdatedObjectInfo,
@@ -162,6 +221,15 @@ func (s *statusSubResourceStorage) Update(ctx context.Context,
 	return s.store.Update(ctx, name, objInfo, createValidation, updateValidation, forceAllowCreate, options)
 }
 
+// statusResetFieldsStrategy adapts the status reset fields of the parent strategy to the status store.
+type statusResetFieldsStrategy struct {
+	rest.StatusResetFieldsStrategy
+}
+
+func (s statusResetFieldsStrategy) GetResetFields() map[fieldpath.APIVersion]*fieldpath.Set {
+	return s.GetStatusResetFields()
+}
+
 var _ registryrest.RESTUpdateStrategy = &statusSubResourceStrategy{}
 
 // StatusSubResourceStrategy defines a default Strategy for the status subresource.
@@ -259,11 +327,48 @@ func (c *connectorSubResourceStorage) ConnectMethods() []string {
 	return c.subResourceConnector.ConnectMethods()
 }
 
+// decrypted subresource storage
+type decryptedSubResourceStorage struct {
+	parentStorage       registryrest.Storage
+	parentStorageGetter registryrest.Getter
+	parentResource      schema.GroupResource
+	envelope            *fieldencryption.Envelope
+}
+
+var _ registryrest.Getter = &decryptedSubResourceStorage{}
+
+func (d *decryptedSubResourceStorage) New() runtime.Object {
+	return d.parentStorage.New()
+}
+
+func (d *decryptedSubResourceStorage) Destroy() {}
+
+func (d *decryptedSubResourceStorage) Get(ctx context.Context, name string, options *v1.GetOptions) (runtime.Object, error) {
+	obj, err := d.parentStorageGetter.Get(
+		rest.WithParentStorage(ctx, d.parentStorage),
+		name,
+		options)
+	if err != nil {
+		return nil, err
+	}
+	if d.envelope == nil {
+		// field encryption is disabled, values are stored in plaintext
+		return obj, nil
+	}
+	// the parent object may be shared with the watch cache
+	obj = obj.DeepCopyObject()
+	if err := d.envelope.DecryptObject(d.parentResource, obj); err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	return obj, nil
+}
+
 // scale subresource storage
 type scaleSubResourceStorage struct {
 	parentStorage        registryrest.Storage
 	parentStorageGetter  registryrest.Getter
 	parentStorageUpdater registryrest.Updater
+	scaler               scaler
 }
 
 func (s *scaleSubResourceStorage) GroupVersionKind(containingGV schema.GroupVersion) schema.GroupVersionKind {
@@ -288,11 +393,7 @@ func (s *scaleSubResourceStorage) Get(ctx context.Context, name string, options
 	if err != nil {
 		return nil, err
 	}
-	scaleParentObj, ok := parentObj.(resource.ObjectWithScaleSubResource)
-	if !ok {
-		return nil, fmt.Errorf("not a valid parent object, does it implement resource.ObjectWithScaleSubResource interface?")
-	}
-	return scaleParentObj.GetScale(), nil
+	return s.scaler.GetScale(parentObj)
 }
 
 func (s *scaleSubResourceStorage) Update(ctx context.Context,
@@ -305,21 +406,23 @@ func (s *scaleSubResourceStorage) Update(ctx context.Context,
 	updatedObj, updated, err := s.parentStorageUpdater.Update(
 		rest.WithParentStorage(ctx, s.parentStorage),
 		name,
-		&scaleUpdatedObjectInfo{reqObjInfo: objInfo},
-		toScaleCreateValidation(createValidation),
-		toScaleUpdateValidation(updateValidation),
+		&scaleUpdatedObjectInfo{reqObjInfo: objInfo, scaler: s.scaler},
+		s.toScaleCreateValidation(createValidation),
+		s.toScaleUpdateValidation(updateValidation),
 		forceAllowCreate,
 		options)
 	if err != nil {
 		return nil, false, err
 	}
-	return updatedObj.(resource.ObjectWithScaleSubResource).GetScale(), updated, nil
+	scale, err := s.scaler.GetScale(updatedObj)
+	return scale, updated, err
 }
 
 var _ registryrest.UpdatedObjectInfo = &scaleUpdatedObjectInfo{}
 
 type scaleUpdatedObjectInfo struct {
 	reqObjInfo registryrest.UpdatedObjectInfo
+	scaler     scaler
 }
 
 func (s *scaleUpdatedObjectInfo) Preconditions() *v1.Preconditions {
@@ -327,8 +430,10 @@ func (s *scaleUpdatedObjectInfo) Preconditions() *v1.Preconditions {
 }
 
 func (s *scaleUpdatedObjectInfo) UpdatedObject(ctx context.Context, oldObj runtime.Object) (newObj runtime.Object, err error) {
-	oldObjWithScale := oldObj.(resource.ObjectWithScaleSubResource)
-	oldScale := oldObjWithScale.GetScale()
+	oldScale, err := s.scaler.GetScale(oldObj)
+	if err != nil {
+		return nil, err
+	}
 	obj, err := s.reqObjInfo.UpdatedObject(ctx, oldScale)
 	if err != nil {
 		return nil, err
@@ -340,27 +445,55 @@ func (s *scaleUpdatedObjectInfo) UpdatedObject(ctx context.Context, oldObj runti
 	if !ok {
 		return nil, errors.NewBadRequest(fmt.Sprintf("wrong object passed to Scale update: %v", obj))
 	}
-	oldObjWithScale.SetScale(scale)
+	if errs := validateScale(scale); len(errs) > 0 {
+		return nil, errors.NewInvalid(autoscalingv1.SchemeGroupVersion.WithKind("Scale").GroupKind(), scale.Name, errs)
+	}
+
+	newObj = oldObj.DeepCopyObject()
+	if err := s.scaler.SetScale(newObj, scale); err != nil {
+		return nil, err
+	}
 	if len(scale.ResourceVersion) != 0 {
 		// The client provided a resourceVersion precondition.
 		// Set that precondition and return any conflict errors to the client.
-		oldObjWithScale.GetObjectMeta().ResourceVersion = scale.ResourceVersion
+		accessor, err := meta.Accessor(newObj)
+		if err != nil {
+			return nil, err
+		}
+		accessor.SetResourceVersion(scale.ResourceVersion)
 	}
-	return oldObjWithScale, nil
+	return newObj, nil
 }
 
-func toScaleCreateValidation(f registryrest.ValidateObjectFunc) registryrest.ValidateObjectFunc {
+// toScaleCreateValidation validates the scale of the object, rather than the parent object, with admission.
+func (s *scaleSubResourceStorage) toScaleCreateValidation(f registryrest.ValidateObjectFunc) registryrest.ValidateObjectFunc {
+	if f == nil {
+		return nil
+	}
 	return func(ctx context.Context, obj runtime.Object) error {
-		oldObjWithScale := obj.(resource.ObjectWithScaleSubResource)
-		return f(ctx, oldObjWithScale.GetScale())
+		scale, err := s.scaler.GetScale(obj)
+		if err != nil {
+			return err
+		}
+		return f(ctx, scale)
 	}
 }
 
-func toScaleUpdateValidation(f registryrest.ValidateObjectUpdateFunc) registryrest.ValidateObjectUpdateFunc {
+// toScaleUpdateValidation validates the scales of the objects, rather than the parent objects, with admission.
+func (s *scaleSubResourceStorage) toScaleUpdateValidation(f registryrest.ValidateObjectUpdateFunc) registryrest.ValidateObjectUpdateFunc {
+	if f == nil {
+		return nil
+	}
 	return func(ctx context.Context, obj, old runtime.Object) error {
-		oldObjWithScale := old.(resource.ObjectWithScaleSubResource)
-		objWithScale := obj.(resource.ObjectWithScaleSubResource)
-		return f(ctx, objWithScale, oldObjWithScale)
+		newScale, err := s.scaler.GetScale(obj)
+		if err != nil {
+			return err
+		}
+		oldScale, err := s.scaler.GetScale(old)
+		if err != nil {
+			return err
+		}
+		return f(ctx, newScale, oldScale)
 	}
 }
 
@@ -0,0 +1,31 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package transaction implements atomic multi-object writes across kes resources.
+//
+// A Transaction is a list of create, update and delete Items.  Each item is prepared and validated by the
+// strategy of the registry store serving its resource, passed through admission, and then all items are
+// committed in a single etcd transaction guarded by per-object preconditions.  Either every item is written
+// or none is.
+//
+// Transactions are available in-process through Executor.Commit and over HTTP by POSTing a Transaction to
+// /apis/kes.io/v1/transactions.
+package transaction
@@ -0,0 +1,176 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// maxRequestBodyBytes limits the size of a transaction request.
+const maxRequestBodyBytes = 3 * 1024 * 1024
+
+var _ http.Handler = &handler{}
+
+type handler struct {
+	executor   *Executor
+	scheme     *runtime.Scheme
+	codecs     serializer.CodecFactory
+	authorizer authorizer.Authorizer
+}
+
+// NewHandler returns the http.Handler serving Transactions at Path.  If authz is not nil, the requesting
+// user must be authorized for the create, update or delete verb on every item of the transaction.
+func NewHandler(executor *Executor, scheme *runtime.Scheme, codecs serializer.CodecFactory, authz authorizer.Authorizer) http.Handler {
+	return &handler{executor: executor, scheme: scheme, codecs: codecs, authorizer: authz}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		h.error(w, req, apierrors.NewMethodNotSupported(SchemeGroupVersion.WithResource("transactions").GroupResource(), req.Method))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxRequestBodyBytes+1))
+	if err != nil {
+		h.error(w, req, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	if len(body) > maxRequestBodyBytes {
+		h.error(w, req, apierrors.NewRequestEntityTooLargeError(fmt.Sprintf("limit is %d", maxRequestBodyBytes)))
+		return
+	}
+	txn := &Transaction{}
+	if err := json.Unmarshal(body, txn); err != nil {
+		h.error(w, req, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	// remember the version each item was sent in, so it is returned in the same version
+	versions := make([]schema.GroupVersion, len(txn.Items))
+	for i := range txn.Items {
+		item := &txn.Items[i]
+		gr := item.GroupResource()
+		versions[i] = h.preferredVersion(gr)
+		if item.Operation != Delete && len(item.Object.Raw) > 0 {
+			obj, gvk, err := h.codecs.UniversalDecoder().Decode(item.Object.Raw, nil, nil)
+			if err != nil {
+				h.error(w, req, itemError(i, apierrors.NewBadRequest(err.Error())))
+				return
+			}
+			item.Object = runtime.RawExtension{Object: obj}
+			versions[i] = gvk.GroupVersion()
+		}
+		if err := h.authorize(req, item, versions[i]); err != nil {
+			h.error(w, req, itemError(i, err))
+			return
+		}
+	}
+
+	out, err := h.executor.Commit(req.Context(), txn.Items)
+	if err != nil {
+		h.error(w, req, err)
+		return
+	}
+	for i := range out.Items {
+		raw, err := runtime.Encode(h.codecs.LegacyCodec(versions[i]), out.Items[i].Object.Object)
+		if err != nil {
+			h.error(w, req, apierrors.NewInternalError(err))
+			return
+		}
+		out.Items[i].Object = runtime.RawExtension{Raw: raw}
+	}
+	responsewriters.WriteRawJSON(http.StatusOK, out, w)
+}
+
+// authorize checks that the requesting user may perform the item operation.
+func (h *handler) authorize(req *http.Request, item *Item, gv schema.GroupVersion) error {
+	if h.authorizer == nil {
+		return nil
+	}
+	u, ok := genericapirequest.UserFrom(req.Context())
+	if !ok {
+		return apierrors.NewUnauthorized("no user found for request")
+	}
+	namespace, name := item.Namespace, item.Name
+	if item.Object.Object != nil {
+		if accessor, err := meta.Accessor(item.Object.Object); err == nil {
+			if accessor.GetNamespace() != "" {
+				namespace = accessor.GetNamespace()
+			}
+			name = accessor.GetName()
+		}
+	}
+	var verb string
+	switch item.Operation {
+	case Create:
+		verb = "create"
+	case Update:
+		verb = "update"
+	case Delete:
+		verb = "delete"
+	default:
+		return apierrors.NewBadRequest(fmt.Sprintf("unsupported operation %q", item.Operation))
+	}
+	gr := item.GroupResource()
+	attrs := authorizer.AttributesRecord{
+		User:            u,
+		Verb:            verb,
+		Namespace:       namespace,
+		APIGroup:        gr.Group,
+		APIVersion:      gv.Version,
+		Resource:        gr.Resource,
+		Name:            name,
+		ResourceRequest: true,
+	}
+	decision, reason, err := h.authorizer.Authorize(req.Context(), attrs)
+	if decision == authorizer.DecisionAllow {
+		return nil
+	}
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	return apierrors.NewForbidden(gr, name, fmt.Errorf("%s", reason))
+}
+
+// preferredVersion returns the version deleted objects are returned in.
+func (h *handler) preferredVersion(gr schema.GroupResource) schema.GroupVersion {
+	if versions := h.scheme.PrioritizedVersionsForGroup(gr.Group); len(versions) > 0 {
+		return versions[0]
+	}
+	return schema.GroupVersion{Group: gr.Group}
+}
+
+func (h *handler) error(w http.ResponseWriter, req *http.Request, err error) {
+	responsewriters.ErrorNegotiated(err, h.codecs, SchemeGroupVersion, w, req)
+}
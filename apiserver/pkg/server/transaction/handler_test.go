@@ -0,0 +1,70 @@
+package transaction
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+)
+
+func TestHandlerAuthorization(t *testing.T) {
+	env := newEnvironment(t)
+	// alice may only create flunders
+	authz := authorizer.AuthorizerFunc(func(_ context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		if a.GetUser().GetName() == "alice" && a.GetVerb() == "create" && a.GetResource() == "flunders" {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionNoOpinion, "not allowed", nil
+	})
+	h := NewHandler(env.executor, env.scheme, env.codecs, authz)
+	ctx := genericapirequest.WithNamespace(genericapirequest.NewContext(), "default")
+
+	serve := func(u user.Info, objs ...runtime.Object) *httptest.ResponseRecorder {
+		txn := Transaction{}
+		for _, obj := range objs {
+			raw, err := runtime.Encode(env.codecs.LegacyCodec(v1alpha1.SchemeGroupVersion), obj)
+			assert.NoError(t, err)
+			gvr := obj.(interface {
+				GetGroupVersionResource() schema.GroupVersionResource
+			}).GetGroupVersionResource()
+			txn.Items = append(txn.Items, Item{Operation: Create, Resource: gvr.GroupResource().String(), Object: runtime.RawExtension{Raw: raw}})
+		}
+		body, err := json.Marshal(txn)
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(body))
+		if u != nil {
+			req = req.WithContext(genericapirequest.WithUser(req.Context(), u))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("every item should be authorized", func(t *testing.T) {
+		w := serve(&user.DefaultInfo{Name: "alice"}, newFlunder("alice"), newFischer("alice"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "items[1]: ")
+		assert.False(t, env.exists(ctx, flunders, "alice"))
+	})
+	t.Run("authorized transactions should be committed", func(t *testing.T) {
+		w := serve(&user.DefaultInfo{Name: "alice"}, newFlunder("alice"))
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.True(t, env.exists(ctx, flunders, "alice"))
+	})
+	t.Run("anonymous requests should be unauthorized", func(t *testing.T) {
+		w := serve(nil, newFlunder("anonymous"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.False(t, env.exists(ctx, flunders, "anonymous"))
+	})
+}
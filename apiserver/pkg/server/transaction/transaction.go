@@ -0,0 +1,519 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/generic"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	"k8s.io/apiserver/pkg/registry/rest"
+	genericstorage "k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/value"
+	"k8s.io/apiserver/pkg/storage/value/encrypt/identity"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/storage"
+)
+
+// StoreGetter returns the registry store serving the given resource.
+type StoreGetter func(gr schema.GroupResource) (*genericregistry.Store, error)
+
+// Executor commits Transactions against the registry stores of the apiserver.
+//
+// The items are written with a single etcd transaction sent by the Executor itself, bypassing the storage of
+// their stores.  The Interceptors of the storage decorators, e.g. the tracing, the latency metrics and the write
+// rate limit, are run for every item around that transaction.  Resources whose storage is not the etcd3 storage,
+// such as resources kept in Memory or wrapped by decorators which are not InterceptorDecorators, cannot be
+// written in a transaction.
+type Executor struct {
+	scheme     *runtime.Scheme
+	stores     StoreGetter
+	optsGetter generic.RESTOptionsGetter
+	admit      admission.Interface
+	versioner  genericstorage.Versioner
+
+	mu      sync.Mutex
+	clients map[string]*clientv3.Client
+}
+
+// NewExecutor returns an Executor writing through the stores returned by stores.  admit may be nil, in which
+// case no admission plugins are run for transaction items.
+func NewExecutor(scheme *runtime.Scheme, stores StoreGetter, optsGetter generic.RESTOptionsGetter, admit admission.Interface) *Executor {
+	return &Executor{
+		scheme:     scheme,
+		stores:     stores,
+		optsGetter: optsGetter,
+		admit:      admit,
+		versioner:  genericstorage.APIObjectVersioner{},
+		clients:    map[string]*clientv3.Client{},
+	}
+}
+
+// Destroy closes the etcd clients opened by the Executor.
+func (e *Executor) Destroy() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, client := range e.clients {
+		client.Close()
+		delete(e.clients, key)
+	}
+}
+
+// preparedItem holds the storage operation computed for an Item.
+type preparedItem struct {
+	item         *Item
+	store        *genericregistry.Store
+	interceptors []storage.Interceptor
+	key          string
+	obj          runtime.Object
+	cmp          clientv3.Cmp
+	op           clientv3.Op
+	finish       genericregistry.FinishFunc
+}
+
+// Commit validates and admits every item and writes all of them in a single etcd transaction.  On success the
+// Object of each item holds the stored object, and the returned Transaction carries the commit revision.
+//
+// Items are prepared with the create, update and delete strategies of their store, including the lifecycle
+// hooks.  Deletes are immediate: objects with finalizers cannot be deleted in a transaction.
+func (e *Executor) Commit(ctx context.Context, items []Item) (*Transaction, error) {
+	if len(items) == 0 {
+		return nil, apierrors.NewBadRequest("a transaction must contain at least one item")
+	}
+
+	var transport string
+	var client *clientv3.Client
+	prepared := make([]*preparedItem, 0, len(items))
+	keys := map[string]bool{}
+	succeeded := false
+	defer func() {
+		for _, p := range prepared {
+			if p.finish != nil {
+				p.finish(ctx, succeeded)
+			}
+		}
+	}()
+
+	for i := range items {
+		item := &items[i]
+		gr := item.GroupResource()
+		store, err := e.stores(gr)
+		if err != nil {
+			return nil, itemError(i, err)
+		}
+		interceptors, s := storage.Interceptors(store.Storage.Storage)
+		if !storage.IsETCD3(s) {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("items[%d]: %v is not stored in etcd by the etcd3 storage and cannot be written in a transaction", i, gr))
+		}
+		opts, err := e.optsGetter.GetRESTOptions(gr)
+		if err != nil {
+			return nil, itemError(i, err)
+		}
+		t := fmt.Sprintf("%v", opts.StorageConfig.Transport)
+		switch {
+		case client == nil:
+			transport = t
+			if client, err = e.client(opts); err != nil {
+				return nil, apierrors.NewInternalError(err)
+			}
+		case t != transport:
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("items[%d]: %v is not stored in the same etcd cluster as the other items", i, gr))
+		}
+
+		p := &preparedItem{item: item, store: store, interceptors: interceptors}
+		prepared = append(prepared, p)
+		if err := e.prepare(ctx, p, opts); err != nil {
+			return nil, itemError(i, err)
+		}
+		if keys[p.key] {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("items[%d]: %v %q is written more than once", i, gr, p.key))
+		}
+		keys[p.key] = true
+	}
+
+	resp, err := e.txn(ctx, client, prepared)
+	if err != nil {
+		return nil, err
+	}
+	succeeded = true
+
+	out := &Transaction{
+		TypeMeta:        metav1.TypeMeta{APIVersion: SchemeGroupVersion.String(), Kind: "Transaction"},
+		Items:           items,
+		ResourceVersion: fmt.Sprintf("%d", resp.Header.Revision),
+	}
+	for _, p := range prepared {
+		if p.item.Operation != Delete {
+			if err := e.versioner.UpdateObject(p.obj, uint64(resp.Header.Revision)); err != nil {
+				return nil, apierrors.NewInternalError(err)
+			}
+		}
+		p.item.Object = runtime.RawExtension{Object: p.obj}
+	}
+	// run the After hooks once every finish func has been told about the result
+	for _, p := range prepared {
+		if p.finish != nil {
+			p.finish(ctx, true)
+			p.finish = nil
+		}
+	}
+	for _, p := range prepared {
+		switch p.item.Operation {
+		case Create:
+			if p.store.AfterCreate != nil {
+				p.store.AfterCreate(p.obj, &metav1.CreateOptions{})
+			}
+		case Update:
+			if p.store.AfterUpdate != nil {
+				p.store.AfterUpdate(p.obj, &metav1.UpdateOptions{})
+			}
+		case Delete:
+			if p.store.AfterDelete != nil {
+				p.store.AfterDelete(p.obj, &metav1.DeleteOptions{})
+			}
+		}
+	}
+	return out, nil
+}
+
+// txn sends the etcd transaction writing the prepared items, running the interceptors of every item around it.
+func (e *Executor) txn(ctx context.Context, client *clientv3.Client, prepared []*preparedItem) (resp *clientv3.TxnResponse, err error) {
+	txnCtx := ctx
+	for i, p := range prepared {
+		next, done, ierr := storage.Intercept(txnCtx, p.interceptors, operationFor(p.item.Operation), p.key)
+		if ierr != nil {
+			return nil, itemError(i, ierr)
+		}
+		defer func() { done(err) }()
+		txnCtx = next
+	}
+
+	cmps := make([]clientv3.Cmp, 0, len(prepared))
+	ops := make([]clientv3.Op, 0, len(prepared))
+	for _, p := range prepared {
+		cmps = append(cmps, p.cmp)
+		ops = append(ops, p.op)
+	}
+	resp, err = client.KV.Txn(txnCtx).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	if !resp.Succeeded {
+		return nil, apierrors.NewConflict(SchemeGroupVersion.WithResource("transactions").GroupResource(), "",
+			errors.New("one or more objects have been modified; please apply your changes to the latest versions and try again"))
+	}
+	return resp, nil
+}
+
+// operationFor returns the storage operation performed by an item operation.
+func operationFor(op Operation) storage.Operation {
+	switch op {
+	case Create:
+		return storage.OperationCreate
+	case Delete:
+		return storage.OperationDelete
+	}
+	return storage.OperationUpdate
+}
+
+// prepare runs the strategy and admission for the item, and computes its etcd comparison and operation.
+func (e *Executor) prepare(ctx context.Context, p *preparedItem, opts generic.RESTOptions) error {
+	item := p.item
+	store := p.store
+	gvr, gvk, err := e.kindFor(store)
+	if err != nil {
+		return err
+	}
+	userInfo, _ := genericapirequest.UserFrom(ctx)
+	o := admission.NewObjectInterfacesFromScheme(e.scheme)
+
+	switch item.Operation {
+	case Create:
+		obj, accessor, err := e.objectFor(item, store)
+		if err != nil {
+			return err
+		}
+		ctx = genericapirequest.WithNamespace(ctx, accessor.GetNamespace())
+		// init metadata as early as possible, like the registry store
+		rest.FillObjectMetaSystemFields(accessor)
+		attrs := admission.NewAttributesRecord(obj, nil, gvk, accessor.GetNamespace(), accessor.GetName(), gvr, "", admission.Create, &metav1.CreateOptions{}, false, userInfo)
+		if err := e.mutate(ctx, attrs, o); err != nil {
+			return err
+		}
+		if err := rest.BeforeCreate(store.CreateStrategy, ctx, obj); err != nil {
+			return err
+		}
+		// BeforeCreate may have generated the name, so admit with the final attributes
+		attrs = admission.NewAttributesRecord(obj, nil, gvk, accessor.GetNamespace(), accessor.GetName(), gvr, "", admission.Create, &metav1.CreateOptions{}, false, userInfo)
+		if err := e.validate(ctx, attrs, o); err != nil {
+			return err
+		}
+		if store.BeginCreate != nil {
+			if p.finish, err = store.BeginCreate(ctx, obj, &metav1.CreateOptions{}); err != nil {
+				return err
+			}
+		}
+		if p.key, err = e.keyFor(ctx, store, opts, accessor.GetName()); err != nil {
+			return err
+		}
+		data, err := e.encode(ctx, store, opts, p.key, obj)
+		if err != nil {
+			return err
+		}
+		p.obj = obj
+		p.cmp = clientv3.Compare(clientv3.ModRevision(p.key), "=", 0)
+		p.op = clientv3.OpPut(p.key, string(data))
+		return nil
+
+	case Update:
+		obj, accessor, err := e.objectFor(item, store)
+		if err != nil {
+			return err
+		}
+		ctx = genericapirequest.WithNamespace(ctx, accessor.GetNamespace())
+		old, oldAccessor, err := e.current(ctx, item, store, accessor.GetName())
+		if err != nil {
+			return err
+		}
+		if rv := accessor.GetResourceVersion(); rv == "" {
+			if !store.UpdateStrategy.AllowUnconditionalUpdate() {
+				return apierrors.NewInvalid(gvk.GroupKind(), accessor.GetName(), field.ErrorList{
+					field.Invalid(field.NewPath("metadata", "resourceVersion"), "", "must be specified for an update"),
+				})
+			}
+			accessor.SetResourceVersion(oldAccessor.GetResourceVersion())
+		} else if rv != oldAccessor.GetResourceVersion() {
+			return apierrors.NewConflict(gvr.GroupResource(), accessor.GetName(),
+				errors.New(genericregistry.OptimisticLockErrorMsg))
+		}
+		attrs := admission.NewAttributesRecord(obj, old, gvk, accessor.GetNamespace(), accessor.GetName(), gvr, "", admission.Update, &metav1.UpdateOptions{}, false, userInfo)
+		if err := e.mutate(ctx, attrs, o); err != nil {
+			return err
+		}
+		if err := rest.BeforeUpdate(store.UpdateStrategy, ctx, obj, old); err != nil {
+			return err
+		}
+		if err := e.validate(ctx, attrs, o); err != nil {
+			return err
+		}
+		if store.BeginUpdate != nil {
+			if p.finish, err = store.BeginUpdate(ctx, obj, old, &metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+		}
+		if p.key, err = e.keyFor(ctx, store, opts, accessor.GetName()); err != nil {
+			return err
+		}
+		data, err := e.encode(ctx, store, opts, p.key, obj)
+		if err != nil {
+			return err
+		}
+		revision, err := e.versioner.ParseResourceVersion(oldAccessor.GetResourceVersion())
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		p.obj = obj
+		p.cmp = clientv3.Compare(clientv3.ModRevision(p.key), "=", int64(revision))
+		p.op = clientv3.OpPut(p.key, string(data))
+		return nil
+
+	case Delete:
+		if item.Name == "" {
+			return apierrors.NewBadRequest("name is required for deletes")
+		}
+		ctx = genericapirequest.WithNamespace(ctx, item.Namespace)
+		old, oldAccessor, err := e.current(ctx, item, store, item.Name)
+		if err != nil {
+			return err
+		}
+		if len(oldAccessor.GetFinalizers()) > 0 {
+			return apierrors.NewBadRequest(fmt.Sprintf("%v %q has finalizers and cannot be deleted in a transaction", gvr.GroupResource(), item.Name))
+		}
+		if _, _, err := rest.BeforeDelete(store.DeleteStrategy, ctx, old, &metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		attrs := admission.NewAttributesRecord(nil, old, gvk, item.Namespace, item.Name, gvr, "", admission.Delete, &metav1.DeleteOptions{}, false, userInfo)
+		if err := e.mutate(ctx, attrs, o); err != nil {
+			return err
+		}
+		if err := e.validate(ctx, attrs, o); err != nil {
+			return err
+		}
+		if p.key, err = e.keyFor(ctx, store, opts, item.Name); err != nil {
+			return err
+		}
+		revision, err := e.versioner.ParseResourceVersion(oldAccessor.GetResourceVersion())
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		p.obj = old
+		p.cmp = clientv3.Compare(clientv3.ModRevision(p.key), "=", int64(revision))
+		p.op = clientv3.OpDelete(p.key)
+		return nil
+	}
+	return apierrors.NewBadRequest(fmt.Sprintf("unsupported operation %q, must be one of %s, %s or %s", item.Operation, Create, Update, Delete))
+}
+
+// objectFor returns the object of the item, checking it is served by the store.
+func (e *Executor) objectFor(item *Item, store *genericregistry.Store) (runtime.Object, metav1.Object, error) {
+	obj := item.Object.Object
+	if obj == nil {
+		return nil, nil, apierrors.NewBadRequest("object is required for creates and updates")
+	}
+	if expected := store.New(); fmt.Sprintf("%T", expected) != fmt.Sprintf("%T", obj) {
+		return nil, nil, apierrors.NewBadRequest(fmt.Sprintf("object of type %T cannot be stored as %v", obj, store.DefaultQualifiedResource))
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, nil, apierrors.NewBadRequest(err.Error())
+	}
+	if item.Namespace != "" && accessor.GetNamespace() == "" {
+		accessor.SetNamespace(item.Namespace)
+	}
+	return obj, accessor, nil
+}
+
+// current returns the stored object, verifying the item preconditions against it.
+func (e *Executor) current(ctx context.Context, item *Item, store *genericregistry.Store, name string) (runtime.Object, metav1.Object, error) {
+	old, err := store.Get(ctx, name, &metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	accessor, err := meta.Accessor(old)
+	if err != nil {
+		return nil, nil, apierrors.NewInternalError(err)
+	}
+	if pre := item.Preconditions; pre != nil {
+		if pre.UID != nil && *pre.UID != accessor.GetUID() {
+			return nil, nil, apierrors.NewConflict(store.DefaultQualifiedResource, name,
+				fmt.Errorf("precondition failed: UID in precondition: %v, UID in object meta: %v", *pre.UID, accessor.GetUID()))
+		}
+		if pre.ResourceVersion != nil && *pre.ResourceVersion != accessor.GetResourceVersion() {
+			return nil, nil, apierrors.NewConflict(store.DefaultQualifiedResource, name,
+				fmt.Errorf("precondition failed: ResourceVersion in precondition: %v, ResourceVersion in object meta: %v", *pre.ResourceVersion, accessor.GetResourceVersion()))
+		}
+	}
+	return old, accessor, nil
+}
+
+// kindFor returns the storage version resource and kind served by the store.
+func (e *Executor) kindFor(store *genericregistry.Store) (schema.GroupVersionResource, schema.GroupVersionKind, error) {
+	gvks, _, err := e.scheme.ObjectKinds(store.New())
+	if err != nil {
+		return schema.GroupVersionResource{}, schema.GroupVersionKind{}, apierrors.NewInternalError(err)
+	}
+	gvk := gvks[0]
+	if store.StorageVersioner != nil {
+		if target, ok := store.StorageVersioner.KindForGroupVersionKinds(gvks); ok {
+			gvk = target
+		}
+	}
+	return gvk.GroupVersion().WithResource(store.DefaultQualifiedResource.Resource), gvk, nil
+}
+
+// keyFor returns the etcd key of the named object, including the storage prefix.
+func (e *Executor) keyFor(ctx context.Context, store *genericregistry.Store, opts generic.RESTOptions, name string) (string, error) {
+	key, err := store.KeyFunc(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	prefix := path.Join("/", opts.StorageConfig.Prefix)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix + strings.TrimPrefix(key, "/"), nil
+}
+
+// encode serializes obj the same way the etcd3 storage does.
+func (e *Executor) encode(ctx context.Context, store *genericregistry.Store, opts generic.RESTOptions, key string, obj runtime.Object) ([]byte, error) {
+	if err := e.versioner.PrepareObjectForStorage(obj); err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	data, err := runtime.Encode(store.Storage.Codec, obj)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	transformer := opts.StorageConfig.Transformer
+	if transformer == nil {
+		transformer = identity.NewEncryptCheckTransformer()
+	}
+	data, err = transformer.TransformToStorage(ctx, data, value.DefaultContext(key))
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	return data, nil
+}
+
+func (e *Executor) mutate(ctx context.Context, attrs admission.Attributes, o admission.ObjectInterfaces) error {
+	if m, ok := e.admit.(admission.MutationInterface); ok && m.Handles(attrs.GetOperation()) {
+		return m.Admit(ctx, attrs, o)
+	}
+	return nil
+}
+
+func (e *Executor) validate(ctx context.Context, attrs admission.Attributes, o admission.ObjectInterfaces) error {
+	if v, ok := e.admit.(admission.ValidationInterface); ok && v.Handles(attrs.GetOperation()) {
+		return v.Validate(ctx, attrs, o)
+	}
+	return nil
+}
+
+// client returns the etcd client for the transport of opts, creating it on first use.
+func (e *Executor) client(opts generic.RESTOptions) (*clientv3.Client, error) {
+	key := fmt.Sprintf("%v", opts.StorageConfig.Transport)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c, ok := e.clients[key]; ok {
+		return c, nil
+	}
+	c, err := storage.NewETCD3Client(opts.StorageConfig.Transport)
+	if err != nil {
+		return nil, err
+	}
+	e.clients[key] = c
+	return c, nil
+}
+
+// itemError prefixes err with the index of the failed item, preserving its API status.
+func itemError(i int, err error) error {
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		s := status.Status()
+		s.Message = fmt.Sprintf("items[%d]: %s", i, s.Message)
+		return &apierrors.StatusError{ErrStatus: s}
+	}
+	return apierrors.NewInternalError(fmt.Errorf("items[%d]: %w", i, err))
+}
@@ -0,0 +1,389 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/generic"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/etcd"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+	kesrest "github.com/vine-io/kes/apiserver/pkg/server/rest"
+	"github.com/vine-io/kes/apiserver/pkg/server/storage"
+)
+
+func TestItemError(t *testing.T) {
+	t.Run("api errors should keep their status", func(t *testing.T) {
+		err := itemError(2, apierrors.NewNotFound(schema.GroupResource{Resource: "flunders"}, "foo"))
+		assert.True(t, apierrors.IsNotFound(err))
+		assert.Contains(t, err.Error(), "items[2]: ")
+	})
+	t.Run("other errors should become internal errors", func(t *testing.T) {
+		err := itemError(0, errors.New("boom"))
+		assert.Equal(t, int32(http.StatusInternalServerError), err.(apierrors.APIStatus).Status().Code)
+		assert.Contains(t, err.Error(), "items[0]: boom")
+	})
+}
+
+func TestCommitEmpty(t *testing.T) {
+	e := NewExecutor(runtime.NewScheme(), nil, nil, nil)
+	_, err := e.Commit(context.TODO(), nil)
+	assert.True(t, apierrors.IsBadRequest(err))
+}
+
+func TestCommit(t *testing.T) {
+	env := newEnvironment(t)
+	ctx := genericapirequest.WithNamespace(genericapirequest.NewContext(), "default")
+
+	t.Run("items should be committed together across resources", func(t *testing.T) {
+		env.intercepted.reset()
+		out, err := env.executor.Commit(ctx, []Item{
+			{Operation: Create, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: newFlunder("a")}},
+			{Operation: Create, Resource: "fischers.sample.k8s.com", Object: runtime.RawExtension{Object: newFischer("a")}},
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, item := range out.Items {
+			accessor, _ := item.Object.Object.(metav1.Object)
+			assert.Equal(t, out.ResourceVersion, accessor.GetResourceVersion())
+		}
+		assert.True(t, env.exists(ctx, flunders, "a"))
+		assert.True(t, env.exists(ctx, fischers, "a"))
+		// the interceptors of the storage decorators run for every item
+		assert.Equal(t, []string{"create /registry/sample.k8s.com/flunders/default/a", "create /registry/sample.k8s.com/fischers/a"}, env.intercepted.get())
+	})
+
+	t.Run("creates should fail if the object exists", func(t *testing.T) {
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Create, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: newFlunder("b")}},
+			{Operation: Create, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: newFlunder("a")}},
+		})
+		assert.True(t, apierrors.IsConflict(err), "expected conflict, got %v", err)
+		assert.False(t, env.exists(ctx, flunders, "b"))
+	})
+
+	t.Run("updates and deletes should be committed together", func(t *testing.T) {
+		flunder := env.get(ctx, flunders, "a").(*v1alpha1.Flunder)
+		flunder.Spec.FlunderReference = "updated"
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Update, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: flunder}},
+			{Operation: Delete, Resource: "fischers.sample.k8s.com", Name: "a"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "updated", env.get(ctx, flunders, "a").(*v1alpha1.Flunder).Spec.FlunderReference)
+		assert.False(t, env.exists(ctx, fischers, "a"))
+	})
+
+	t.Run("updates of stale objects should conflict", func(t *testing.T) {
+		flunder := env.get(ctx, flunders, "a").(*v1alpha1.Flunder)
+		flunder.ResourceVersion = "1"
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Update, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: flunder}},
+		})
+		assert.True(t, apierrors.IsConflict(err), "expected conflict, got %v", err)
+	})
+
+	t.Run("preconditions should be checked", func(t *testing.T) {
+		uid := types.UID("other")
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Delete, Resource: "flunders.sample.k8s.com", Namespace: "default", Name: "a", Preconditions: &metav1.Preconditions{UID: &uid}},
+		})
+		assert.True(t, apierrors.IsConflict(err), "expected conflict, got %v", err)
+		assert.True(t, env.exists(ctx, flunders, "a"))
+	})
+
+	t.Run("objects modified before the commit should conflict", func(t *testing.T) {
+		flunder := env.get(ctx, flunders, "a").(*v1alpha1.Flunder)
+		flunder.Spec.FlunderReference = "lost"
+		// write the flunder once the transaction has read it
+		env.admission.set(func(a admission.Attributes) error {
+			if a.GetResource().Resource != "flunders" {
+				return nil
+			}
+			concurrent := env.get(ctx, flunders, "a").(*v1alpha1.Flunder)
+			concurrent.Spec.FlunderReference = "concurrent"
+			_, _, err := env.stores[flunders].Update(ctx, "a", rest.DefaultUpdatedObjectInfo(concurrent), nil, nil, false, &metav1.UpdateOptions{})
+			return err
+		})
+		defer env.admission.set(nil)
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Create, Resource: "fischers.sample.k8s.com", Object: runtime.RawExtension{Object: newFischer("b")}},
+			{Operation: Update, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: flunder}},
+		})
+		assert.True(t, apierrors.IsConflict(err), "expected conflict, got %v", err)
+		assert.Equal(t, "concurrent", env.get(ctx, flunders, "a").(*v1alpha1.Flunder).Spec.FlunderReference)
+		assert.False(t, env.exists(ctx, fischers, "b"))
+	})
+
+	t.Run("objects should not be written twice", func(t *testing.T) {
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Create, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: newFlunder("c")}},
+			{Operation: Create, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: newFlunder("c")}},
+		})
+		assert.True(t, apierrors.IsBadRequest(err), "expected bad request, got %v", err)
+		assert.False(t, env.exists(ctx, flunders, "c"))
+	})
+
+	t.Run("admission errors should abort the transaction", func(t *testing.T) {
+		env.admission.set(func(a admission.Attributes) error {
+			if a.GetResource().Resource == "fischers" {
+				return admission.NewForbidden(a, errors.New("denied"))
+			}
+			return nil
+		})
+		defer env.admission.set(nil)
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Create, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: newFlunder("c")}},
+			{Operation: Create, Resource: "fischers.sample.k8s.com", Object: runtime.RawExtension{Object: newFischer("c")}},
+		})
+		assert.True(t, apierrors.IsForbidden(err), "expected forbidden, got %v", err)
+		assert.Contains(t, err.Error(), "items[1]: ")
+		assert.False(t, env.exists(ctx, flunders, "c"))
+		assert.False(t, env.exists(ctx, fischers, "c"))
+	})
+
+	t.Run("validation errors should abort the transaction", func(t *testing.T) {
+		invalid := newFlunder("invalid")
+		invalid.Spec.ReferenceType = "Other"
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Create, Resource: "fischers.sample.k8s.com", Object: runtime.RawExtension{Object: newFischer("c")}},
+			{Operation: Create, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: invalid}},
+		})
+		assert.True(t, apierrors.IsInvalid(err), "expected invalid, got %v", err)
+		assert.False(t, env.exists(ctx, fischers, "c"))
+	})
+
+	t.Run("finish funcs should be told about the result", func(t *testing.T) {
+		var results []bool
+		store := env.stores[fischers]
+		store.BeginCreate = func(context.Context, runtime.Object, *metav1.CreateOptions) (genericregistry.FinishFunc, error) {
+			return func(_ context.Context, success bool) { results = append(results, success) }, nil
+		}
+		defer func() { store.BeginCreate = nil }()
+
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Create, Resource: "fischers.sample.k8s.com", Object: runtime.RawExtension{Object: newFischer("d")}},
+			{Operation: Create, Resource: "flunders.sample.k8s.com", Object: runtime.RawExtension{Object: newFlunder("a")}},
+		})
+		assert.Error(t, err)
+		_, err = env.executor.Commit(ctx, []Item{
+			{Operation: Create, Resource: "fischers.sample.k8s.com", Object: runtime.RawExtension{Object: newFischer("d")}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{false, true}, results)
+	})
+
+	t.Run("resources not stored in etcd should be refused", func(t *testing.T) {
+		_, err := env.executor.Commit(ctx, []Item{
+			{Operation: Create, Resource: "flunders.memory.sample.k8s.com", Object: runtime.RawExtension{Object: newFlunder("e")}},
+		})
+		assert.True(t, apierrors.IsBadRequest(err), "expected bad request, got %v", err)
+		assert.Contains(t, err.Error(), "cannot be written in a transaction")
+	})
+}
+
+var (
+	flunders = v1alpha1.SchemeGroupVersion.WithResource("flunders").GroupResource()
+	fischers = v1alpha1.SchemeGroupVersion.WithResource("fischers").GroupResource()
+	// memoryFlunders are flunders stored in memory
+	memoryFlunders = schema.GroupResource{Group: "memory.sample.k8s.com", Resource: "flunders"}
+)
+
+// environment is an Executor writing the flunders and fischers to an etcd, and the memoryFlunders to memory.
+type environment struct {
+	scheme      *runtime.Scheme
+	codecs      serializer.CodecFactory
+	executor    *Executor
+	stores      map[schema.GroupResource]*genericregistry.Store
+	admission   *fakeAdmission
+	intercepted *calls
+}
+
+func newEnvironment(t *testing.T) *environment {
+	scheme := runtime.NewScheme()
+	// register the storage versions as internal versions, like the apiserver
+	assert.NoError(t, resource.AddToScheme(&v1alpha1.Flunder{}, &v1alpha1.Fischer{})(scheme))
+	metav1.AddToGroupVersion(scheme, v1alpha1.SchemeGroupVersion)
+	env := &environment{
+		scheme:      scheme,
+		codecs:      serializer.NewCodecFactory(scheme),
+		stores:      map[schema.GroupResource]*genericregistry.Store{},
+		admission:   &fakeAdmission{},
+		intercepted: &calls{},
+	}
+
+	endpoint := startEtcd(t)
+	optsGetterFor := func(decorator generic.StorageDecorator) restOptionsGetter {
+		return func(gr schema.GroupResource) (generic.RESTOptions, error) {
+			config := storagebackend.NewDefaultConfig("/registry", env.codecs.LegacyCodec(v1alpha1.SchemeGroupVersion))
+			config.Transport.ServerList = []string{endpoint}
+			return generic.RESTOptions{
+				StorageConfig:  config.ForResource(gr),
+				Decorator:      decorator,
+				ResourcePrefix: gr.Group + "/" + gr.Resource,
+			}, nil
+		}
+	}
+	optsGetter := optsGetterFor(storage.WithStorageDecorators(storage.UndecoratedStorage, storage.InterceptorDecorator(env.intercepted.interceptor)))
+	memoryOptsGetter := optsGetterFor(storage.NewMemory().Decorator()(storage.UndecoratedStorage))
+	for gr, r := range map[schema.GroupResource]struct {
+		obj        resource.Object
+		optsGetter generic.RESTOptionsGetter
+	}{
+		flunders:       {&v1alpha1.Flunder{}, optsGetter},
+		fischers:       {&v1alpha1.Fischer{}, optsGetter},
+		memoryFlunders: {&v1alpha1.Flunder{}, memoryOptsGetter},
+	} {
+		s, err := kesrest.New(r.obj)(scheme, r.optsGetter)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		store := s.(*genericregistry.Store)
+		t.Cleanup(store.Destroy)
+		env.stores[gr] = store
+	}
+
+	env.executor = NewExecutor(scheme, func(gr schema.GroupResource) (*genericregistry.Store, error) {
+		store, ok := env.stores[gr]
+		if !ok {
+			return nil, apierrors.NewBadRequest("unknown resource")
+		}
+		return store, nil
+	}, optsGetter, env.admission)
+	t.Cleanup(env.executor.Destroy)
+	return env
+}
+
+func (env *environment) get(ctx context.Context, gr schema.GroupResource, name string) runtime.Object {
+	obj, err := env.stores[gr].Get(ctx, name, &metav1.GetOptions{})
+	if err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+func (env *environment) exists(ctx context.Context, gr schema.GroupResource, name string) bool {
+	_, err := env.stores[gr].Get(ctx, name, &metav1.GetOptions{})
+	return err == nil
+}
+
+func newFlunder(name string) *v1alpha1.Flunder {
+	return &v1alpha1.Flunder{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       v1alpha1.FlunderSpec{ReferenceType: v1alpha1.FlunderReferenceType, FlunderReference: "other"},
+	}
+}
+
+func newFischer(name string) *v1alpha1.Fischer {
+	return &v1alpha1.Fischer{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+type restOptionsGetter func(gr schema.GroupResource) (generic.RESTOptions, error)
+
+func (f restOptionsGetter) GetRESTOptions(gr schema.GroupResource) (generic.RESTOptions, error) {
+	return f(gr)
+}
+
+// fakeAdmission validates every request with a settable function.
+type fakeAdmission struct {
+	mu       sync.Mutex
+	validate func(a admission.Attributes) error
+}
+
+func (f *fakeAdmission) set(validate func(a admission.Attributes) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.validate = validate
+}
+
+func (f *fakeAdmission) Handles(admission.Operation) bool { return true }
+
+func (f *fakeAdmission) Validate(_ context.Context, a admission.Attributes, _ admission.ObjectInterfaces) error {
+	f.mu.Lock()
+	validate := f.validate
+	f.mu.Unlock()
+	if validate == nil {
+		return nil
+	}
+	return validate(a)
+}
+
+// calls records the write operations intercepted by the storage decorators.
+type calls struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (c *calls) interceptor(schema.GroupResource) storage.Interceptor {
+	return func(ctx context.Context, op storage.Operation, key string) (context.Context, func(err error), error) {
+		if op.IsWrite() {
+			c.mu.Lock()
+			c.calls = append(c.calls, string(op)+" "+key)
+			c.mu.Unlock()
+		}
+		return ctx, nil, nil
+	}
+}
+
+func (c *calls) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+func (c *calls) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = nil
+}
+
+// startEtcd starts an etcd listening on random ports, and returns its client URL.
+func startEtcd(t *testing.T) string {
+	freeURL := func() url.URL {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("error listening: %v", err)
+		}
+		defer l.Close()
+		return url.URL{Scheme: "http", Host: l.Addr().String()}
+	}
+
+	cfg := etcd.NewConfig()
+	cfg.Dir = t.TempDir()
+	clientURL, peerURL := freeURL(), freeURL()
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := etcd.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("error starting etcd: %v", err)
+	}
+	t.Cleanup(e.Close)
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(time.Minute):
+		t.Fatal("etcd not ready")
+	}
+	return clientURL.String()
+}
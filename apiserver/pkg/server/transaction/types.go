@@ -0,0 +1,79 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package transaction
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SchemeGroupVersion is the group version used for transaction requests.
+var SchemeGroupVersion = schema.GroupVersion{Group: "kes.io", Version: "v1"}
+
+// Path is the path at which transactions are served.
+const Path = "/apis/kes.io/v1/transactions"
+
+// Operation is the kind of write performed by an Item.
+type Operation string
+
+const (
+	// Create creates Item.Object, which must not already exist.
+	Create Operation = "Create"
+	// Update replaces the stored object with Item.Object.
+	Update Operation = "Update"
+	// Delete removes the object identified by Item.Namespace and Item.Name.
+	Delete Operation = "Delete"
+)
+
+// Transaction is a list of writes that are committed atomically.
+type Transaction struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Items are the writes to commit.  A transaction may not touch the same object twice.
+	Items []Item `json:"items"`
+
+	// ResourceVersion is the storage revision at which the items were committed.  Set by the server.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// Item is a single write within a Transaction.
+type Item struct {
+	// Operation is the write to perform.
+	Operation Operation `json:"operation"`
+	// Resource is the group qualified resource of the object, e.g. "flunders.sample.k8s.com".
+	Resource string `json:"resource"`
+	// Namespace of the object.  Only required for deletes of namespaced resources.
+	Namespace string `json:"namespace,omitempty"`
+	// Name of the object.  Only required for deletes.
+	Name string `json:"name,omitempty"`
+	// Object is the object to create or update.  On return it holds the object as it was stored, or the
+	// deleted object for deletes.
+	Object runtime.RawExtension `json:"object,omitempty"`
+	// Preconditions must be fulfilled by the stored object before an update or delete is committed.
+	Preconditions *metav1.Preconditions `json:"preconditions,omitempty"`
+}
+
+// GroupResource returns the parsed Resource of the item.
+func (i *Item) GroupResource() schema.GroupResource {
+	return schema.ParseGroupResource(i.Resource)
+}
@@ -0,0 +1,356 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/registry/generic/registry"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+	"github.com/vine-io/kes/apiserver/pkg/server/rest"
+)
+
+// newTypedSubResourceStorageFunc returns the subResourceStorageFunc building the storage of a
+// resource.TypedSubResource.  The storage only implements the interfaces of the declared verbs, which makes
+// the apiserver serve exactly those verbs.
+func newTypedSubResourceStorageFunc(sub resource.TypedSubResource) subResourceStorageFunc {
+	return func(gvr schema.GroupVersionResource, _ generic.RESTOptionsGetter, parentStorage, _ registryrest.Storage) (registryrest.Storage, error) {
+		verbs := sets.New(sub.SubResourceVerbs()...)
+		get := verbs.Has(resource.SubResourceGet)
+		update := verbs.Has(resource.SubResourceUpdate) || verbs.Has(resource.SubResourcePatch)
+		create := verbs.Has(resource.SubResourceCreate)
+
+		s := &typedSubResourceStorage{sub: sub, parentStorage: parentStorage}
+		var ok bool
+		if s.parentGetter, ok = parentStorage.(registryrest.Getter); !ok {
+			return nil, parentStorageError(gvr, "rest.Getter")
+		}
+		if parentStore, ok := parentStorage.(*registry.Store); ok {
+			store := *parentStore
+			store.UpdateStrategy = &typedSubResourceStrategy{RESTUpdateStrategy: parentStore.UpdateStrategy}
+			s.store = &store
+		}
+
+		invalid := func(msg string) error {
+			return fmt.Errorf("subresource %v/%v/%v %s", gvr.Group, gvr.Version, gvr.Resource, msg)
+		}
+		if get || update {
+			if s.getter, ok = sub.(resource.SubResourceGetter); !ok {
+				return nil, invalid("must implement resource.SubResourceGetter to serve get, update or patch")
+			}
+		}
+		if update {
+			if !get {
+				return nil, invalid("must serve get to serve update or patch")
+			}
+			if s.updater, ok = sub.(resource.SubResourceUpdater); !ok {
+				return nil, invalid("must implement resource.SubResourceUpdater to serve update or patch")
+			}
+			if s.store == nil {
+				return nil, parentStorageError(gvr, "*registry.Store to serve update or patch")
+			}
+		}
+		if create {
+			if s.creater, ok = sub.(resource.SubResourceCreater); !ok {
+				return nil, invalid("must implement resource.SubResourceCreater to serve create")
+			}
+		}
+
+		switch {
+		case get && update && create:
+			return &typedGetUpdateCreateStorage{s, typedGetter{s}, typedUpdater{s}, typedCreater{s}}, nil
+		case get && update:
+			return &typedGetUpdateStorage{s, typedGetter{s}, typedUpdater{s}}, nil
+		case get && create:
+			return &typedGetCreateStorage{s, typedGetter{s}, typedCreater{s}}, nil
+		case get:
+			return &typedGetStorage{s, typedGetter{s}}, nil
+		case create:
+			return &typedCreateStorage{s, typedCreater{s}}, nil
+		}
+		return nil, invalid("must serve at least one verb")
+	}
+}
+
+// typedSubResourceStorage is the storage shared by every verb of a typed subresource.
+type typedSubResourceStorage struct {
+	sub           resource.TypedSubResource
+	getter        resource.SubResourceGetter
+	updater       resource.SubResourceUpdater
+	creater       resource.SubResourceCreater
+	parentStorage registryrest.Storage
+	parentGetter  registryrest.Getter
+	// store writes the parent object, nil if the parent storage is not a registry.Store
+	store *registry.Store
+}
+
+var _ registryrest.GroupVersionKindProvider = &typedSubResourceStorage{}
+
+func (s *typedSubResourceStorage) New() runtime.Object {
+	return s.sub.NewRequest()
+}
+
+func (s *typedSubResourceStorage) Destroy() {}
+
+// GroupVersionKind returns the response kind of the subresource.
+func (s *typedSubResourceStorage) GroupVersionKind(containingGV schema.GroupVersion) schema.GroupVersionKind {
+	gvks, _, err := Scheme.ObjectKinds(s.sub.NewResponse())
+	if err != nil || len(gvks) == 0 {
+		return containingGV.WithKind("")
+	}
+	for _, gvk := range gvks {
+		if gvk.GroupVersion() == containingGV {
+			return gvk
+		}
+	}
+	return gvks[0]
+}
+
+func (s *typedSubResourceStorage) validate(ctx context.Context, parent resource.Object, request runtime.Object) error {
+	v, ok := s.sub.(resource.SubResourceValidater)
+	if !ok {
+		return nil
+	}
+	if errs := v.ValidateSubResource(ctx, parent, request); len(errs) > 0 {
+		gk := schema.GroupKind{}
+		if gvks, _, err := Scheme.ObjectKinds(request); err == nil && len(gvks) > 0 {
+			gk = gvks[0].GroupKind()
+		}
+		return errors.NewInvalid(gk, parent.GetObjectMeta().Name, errs)
+	}
+	return nil
+}
+
+func (s *typedSubResourceStorage) getSubResource(ctx context.Context, parent runtime.Object) (runtime.Object, error) {
+	obj, ok := parent.(resource.Object)
+	if !ok {
+		return nil, errors.NewInternalError(fmt.Errorf("parent %T does not implement resource.Object", parent))
+	}
+	return s.getter.GetSubResource(ctx, obj)
+}
+
+type typedGetter struct {
+	s *typedSubResourceStorage
+}
+
+func (g typedGetter) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	ctx = rest.WithParentStorage(ctx, g.s.parentStorage)
+	parent, err := g.s.parentGetter.Get(ctx, name, options)
+	if err != nil {
+		return nil, err
+	}
+	return g.s.getSubResource(ctx, parent)
+}
+
+type typedUpdater struct {
+	s *typedSubResourceStorage
+}
+
+func (u typedUpdater) Update(ctx context.Context,
+	name string,
+	objInfo registryrest.UpdatedObjectInfo,
+	createValidation registryrest.ValidateObjectFunc,
+	updateValidation registryrest.ValidateObjectUpdateFunc,
+	forceAllowCreate bool,
+	options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	ctx = rest.WithParentStorage(ctx, u.s.parentStorage)
+	obj, updated, err := u.s.store.Update(
+		ctx,
+		name,
+		&typedUpdatedObjectInfo{s: u.s, reqObjInfo: objInfo},
+		createValidation,
+		u.toUpdateValidation(updateValidation),
+		false,
+		options)
+	if err != nil {
+		return nil, false, err
+	}
+	response, err := u.s.getSubResource(ctx, obj)
+	return response, updated, err
+}
+
+// toUpdateValidation validates the subresource, rather than the parent object, with admission.
+func (u typedUpdater) toUpdateValidation(f registryrest.ValidateObjectUpdateFunc) registryrest.ValidateObjectUpdateFunc {
+	if f == nil {
+		return nil
+	}
+	return func(ctx context.Context, obj, old runtime.Object) error {
+		newSub, err := u.s.getSubResource(ctx, obj)
+		if err != nil {
+			return err
+		}
+		oldSub, err := u.s.getSubResource(ctx, old)
+		if err != nil {
+			return err
+		}
+		return f(ctx, newSub, oldSub)
+	}
+}
+
+var _ registryrest.UpdatedObjectInfo = &typedUpdatedObjectInfo{}
+
+type typedUpdatedObjectInfo struct {
+	s          *typedSubResourceStorage
+	reqObjInfo registryrest.UpdatedObjectInfo
+}
+
+func (i *typedUpdatedObjectInfo) Preconditions() *metav1.Preconditions {
+	return i.reqObjInfo.Preconditions()
+}
+
+func (i *typedUpdatedObjectInfo) UpdatedObject(ctx context.Context, oldObj runtime.Object) (runtime.Object, error) {
+	oldSub, err := i.s.getSubResource(ctx, oldObj)
+	if err != nil {
+		return nil, err
+	}
+	request, err := i.reqObjInfo.UpdatedObject(ctx, oldSub)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, errors.NewBadRequest("nil update passed to subresource " + i.s.sub.SubResourceName())
+	}
+
+	parent := oldObj.DeepCopyObject().(resource.Object)
+	if err := i.s.validate(ctx, parent, request); err != nil {
+		return nil, err
+	}
+	if err := i.s.updater.UpdateSubResource(ctx, parent, request); err != nil {
+		return nil, err
+	}
+	if accessor, err := meta.Accessor(request); err == nil && len(accessor.GetResourceVersion()) != 0 {
+		// The client provided a resourceVersion precondition.
+		// Set that precondition and return any conflict errors to the client.
+		parent.GetObjectMeta().ResourceVersion = accessor.GetResourceVersion()
+	}
+	return parent, nil
+}
+
+type typedCreater struct {
+	s *typedSubResourceStorage
+}
+
+func (c typedCreater) Create(ctx context.Context,
+	name string,
+	obj runtime.Object,
+	createValidation registryrest.ValidateObjectFunc,
+	options *metav1.CreateOptions) (runtime.Object, error) {
+	ctx = rest.WithParentStorage(ctx, c.s.parentStorage)
+	if createValidation != nil {
+		if err := createValidation(ctx, obj.DeepCopyObject()); err != nil {
+			return nil, err
+		}
+	}
+
+	current, err := c.s.parentGetter.Get(ctx, name, &metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	parent, ok := current.DeepCopyObject().(resource.Object)
+	if !ok {
+		return nil, errors.NewInternalError(fmt.Errorf("parent %T does not implement resource.Object", current))
+	}
+	if err := c.s.validate(ctx, parent, obj); err != nil {
+		return nil, err
+	}
+	response, update, err := c.s.creater.CreateSubResource(ctx, parent, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if update {
+		if c.s.store == nil {
+			return nil, errors.NewInternalError(fmt.Errorf("subresource %s cannot update a parent not stored in a registry.Store",
+				c.s.sub.SubResourceName()))
+		}
+		// the resourceVersion of the parent read above is the precondition of the update
+		_, _, err := c.s.store.Update(ctx, name, registryrest.DefaultUpdatedObjectInfo(parent),
+			registryrest.ValidateAllObjectFunc, registryrest.ValidateAllObjectUpdateFunc, false,
+			&metav1.UpdateOptions{DryRun: options.DryRun, FieldManager: options.FieldManager})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if response == nil {
+		response = &metav1.Status{Status: metav1.StatusSuccess}
+	}
+	return response, nil
+}
+
+var _ registryrest.Getter = &typedGetStorage{}
+var _ registryrest.Patcher = &typedGetUpdateStorage{}
+var _ registryrest.NamedCreater = &typedCreateStorage{}
+
+type typedGetStorage struct {
+	*typedSubResourceStorage
+	typedGetter
+}
+
+type typedGetUpdateStorage struct {
+	*typedSubResourceStorage
+	typedGetter
+	typedUpdater
+}
+
+type typedGetCreateStorage struct {
+	*typedSubResourceStorage
+	typedGetter
+	typedCreater
+}
+
+type typedGetUpdateCreateStorage struct {
+	*typedSubResourceStorage
+	typedGetter
+	typedUpdater
+	typedCreater
+}
+
+type typedCreateStorage struct {
+	*typedSubResourceStorage
+	typedCreater
+}
+
+var _ registryrest.RESTUpdateStrategy = &typedSubResourceStrategy{}
+
+// typedSubResourceStrategy is the update strategy of the parent object for typed subresources.
+type typedSubResourceStrategy struct {
+	registryrest.RESTUpdateStrategy
+}
+
+// AllowCreateOnUpdate returns false, subresources never create their parent.
+func (s *typedSubResourceStrategy) AllowCreateOnUpdate() bool {
+	return false
+}
+
+// PrepareForUpdate does nothing, the updated object is built from the old object by the subresource.
+func (s *typedSubResourceStrategy) PrepareForUpdate(ctx context.Context, obj, old runtime.Object) {}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+	"github.com/vine-io/kes/apiserver/pkg/server/rest"
+)
+
+type fakeParentStorage struct {
+	obj *v1alpha1.Flunder
+}
+
+func (f *fakeParentStorage) New() runtime.Object { return &v1alpha1.Flunder{} }
+func (f *fakeParentStorage) Destroy()            {}
+func (f *fakeParentStorage) Get(context.Context, string, *metav1.GetOptions) (runtime.Object, error) {
+	return f.obj, nil
+}
+
+// reference is a typed subresource exposing the reference of a Flunder.
+type reference struct {
+	verbs   []resource.SubResourceVerb
+	created []string
+}
+
+func (r *reference) SubResourceName() string                      { return "reference" }
+func (r *reference) SubResourceVerbs() []resource.SubResourceVerb { return r.verbs }
+func (r *reference) NewRequest() runtime.Object                   { return &v1alpha1.Flunder{} }
+func (r *reference) NewResponse() runtime.Object                  { return &v1alpha1.Flunder{} }
+
+func (r *reference) GetSubResource(_ context.Context, parent resource.Object) (runtime.Object, error) {
+	return &v1alpha1.Flunder{Spec: parent.(*v1alpha1.Flunder).Spec}, nil
+}
+
+func (r *reference) CreateSubResource(ctx context.Context, parent resource.Object, request runtime.Object) (runtime.Object, bool, error) {
+	if _, ok := rest.GetParentStorageGetter(ctx); !ok {
+		panic("parent storage is not plumbed")
+	}
+	r.created = append(r.created, parent.GetObjectMeta().Name+"/"+request.(*v1alpha1.Flunder).Spec.FlunderReference)
+	return nil, false, nil
+}
+
+func (r *reference) ValidateSubResource(_ context.Context, _ resource.Object, request runtime.Object) field.ErrorList {
+	if request.(*v1alpha1.Flunder).Spec.FlunderReference == "" {
+		return field.ErrorList{field.Required(field.NewPath("spec", "flunderReference"), "")}
+	}
+	return nil
+}
+
+func TestTypedSubResourceStorage(t *testing.T) {
+	gvr := v1alpha1.SchemeGroupVersion.WithResource("flunders/reference")
+	parent := &fakeParentStorage{obj: &v1alpha1.Flunder{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec:       v1alpha1.FlunderSpec{FlunderReference: "bar", ReferenceType: v1alpha1.FlunderReferenceType},
+	}}
+
+	t.Run("storage should only serve the declared verbs", func(t *testing.T) {
+		sub := &reference{verbs: []resource.SubResourceVerb{resource.SubResourceGet}}
+		storage, err := newTypedSubResourceStorageFunc(sub)(gvr, nil, parent, nil)
+		assert.NoError(t, err)
+		_, isUpdater := storage.(registryrest.Updater)
+		_, isCreater := storage.(registryrest.NamedCreater)
+		assert.False(t, isUpdater)
+		assert.False(t, isCreater)
+
+		obj, err := storage.(registryrest.Getter).Get(context.TODO(), "foo", &metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", obj.(*v1alpha1.Flunder).Spec.FlunderReference)
+		assert.Empty(t, obj.(*v1alpha1.Flunder).Name)
+	})
+	t.Run("update should require a registry store", func(t *testing.T) {
+		sub := &reference{verbs: []resource.SubResourceVerb{resource.SubResourceGet, resource.SubResourceUpdate}}
+		_, err := newTypedSubResourceStorageFunc(sub)(gvr, nil, parent, nil)
+		assert.Error(t, err)
+	})
+	t.Run("create should validate and handle the request", func(t *testing.T) {
+		sub := &reference{verbs: []resource.SubResourceVerb{resource.SubResourceCreate}}
+		storage, err := newTypedSubResourceStorageFunc(sub)(gvr, nil, parent, nil)
+		assert.NoError(t, err)
+		_, isGetter := storage.(registryrest.Getter)
+		assert.False(t, isGetter)
+		creater := storage.(registryrest.NamedCreater)
+
+		_, err = creater.Create(context.TODO(), "foo", &v1alpha1.Flunder{}, nil, &metav1.CreateOptions{})
+		assert.Error(t, err)
+
+		request := &v1alpha1.Flunder{Spec: v1alpha1.FlunderSpec{FlunderReference: "baz"}}
+		obj, err := creater.Create(context.TODO(), "foo", request, nil, &metav1.CreateOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, metav1.StatusSuccess, obj.(*metav1.Status).Status)
+		assert.Equal(t, []string{"foo/baz"}, sub.created)
+	})
+}
@@ -0,0 +1,152 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package testing
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	restclient "k8s.io/client-go/rest"
+
+	apiextensionsv1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned"
+	"github.com/vine-io/kes/apiserver/pkg/server"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+	"github.com/vine-io/kes/apiserver/pkg/server/storage"
+)
+
+// Clientset is the clientset of a server running in-process, storing the resources in memory.  Unlike with the
+// generated fake clientset, the requests go through the handlers and the registry.Store of the resources, so
+// they behave as in production: defaulting, PrepareForCreate and PrepareForUpdate, validation, generateName,
+// resource version conflicts, finalizers, the status subresource and server-side apply.
+//
+// The server doesn't serve any port and its post-start hooks aren't run.
+type Clientset struct {
+	versioned.Interface
+	// Config is the in-process client config of the server, e.g. for a dynamic client.
+	Config *restclient.Config
+	// Server is the server.
+	Server *server.WardleServer
+
+	memory    *storage.Memory
+	resources []resource.Object
+}
+
+// NewClientset returns the clientset of a new server serving the resources, and fails the test if the server
+// can't be created.
+func NewClientset(t testing.TB, resources ...resource.Object) *Clientset {
+	t.Helper()
+	return NewClientsetWithOptions(t, Options{Resources: resources})
+}
+
+// NewClientsetWithOptions returns the clientset of a new server configured by the options, and fails the test if
+// the server can't be created.  The server is destroyed when the test completes.
+func NewClientsetWithOptions(t testing.TB, opts Options) *Clientset {
+	t.Helper()
+
+	memory := storage.NewMemory()
+
+	o := server.NewWardleServerOptions(io.Discard, io.Discard)
+	o.Resources = opts.Resources
+	o.OpenAPIDefinitions = opts.OpenAPIDefinitions
+	o.EmbeddedEtcd = nil
+	o.RecommendedOptions.SecureServing.BindPort = 0
+	o.RecommendedOptions.Etcd.SkipHealthEndpoints = true
+	o.RecommendedOptions.Etcd.EnableWatchCache = false
+	o.RecommendedOptions.Etcd.StorageDecorators = append(o.RecommendedOptions.Etcd.StorageDecorators, memory.Decorator())
+
+	if err := o.Complete(); err != nil {
+		t.Fatalf("error completing the options: %v", err)
+	}
+	config, err := o.Config()
+	if err != nil {
+		t.Fatalf("error creating the server config: %v", err)
+	}
+	// the address and the loopback client aren't derived from the secure port as the server doesn't serve any,
+	// the clients send their requests in-process
+	config.GenericConfig.ExternalAddress = "kes.inprocess:80"
+	config.GenericConfig.LoopbackClientConfig = &restclient.Config{}
+	if opts.Admission != nil {
+		config.GenericConfig.AdmissionControl = opts.Admission
+	}
+	ws, err := config.Complete().New()
+	if err != nil {
+		t.Fatalf("error creating the server: %v", err)
+	}
+	t.Cleanup(ws.GenericAPIServer.Destroy)
+	for _, fn := range opts.ServerFns {
+		if err := fn(ws); err != nil {
+			t.Fatalf("error applying the server fns: %v", err)
+		}
+	}
+
+	clientConfig := ws.InProcessConfig()
+	client, err := versioned.NewForConfig(clientConfig)
+	if err != nil {
+		t.Fatalf("error creating the clientset: %v", err)
+	}
+
+	return &Clientset{
+		Interface: client,
+		Config:    clientConfig,
+		Server:    ws,
+		memory:    memory,
+		resources: append(append([]resource.Object{}, opts.Resources...), apiextensionsv1alpha1.ResourceBuilder...),
+	}
+}
+
+// Add stores the objects as they are, without going through the strategies of their resources, like
+// ObjectTracker.Add of the generated fake clientset, e.g. to seed objects with a status.
+func (c *Clientset) Add(objs ...runtime.Object) error {
+	for _, obj := range objs {
+		r, err := c.resourceFor(obj)
+		if err != nil {
+			return err
+		}
+		if err := c.memory.Add(r.GetGroupVersionResource().GroupResource(), obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resourceFor returns the served resource of the kind of obj.
+func (c *Clientset) resourceFor(obj runtime.Object) (resource.Object, error) {
+	kinds, _, err := server.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range c.resources {
+		rKinds, _, err := server.Scheme.ObjectKinds(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, kind := range kinds {
+			if rKinds[0] == kind {
+				return r, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%v isn't served", kinds[0])
+}
@@ -0,0 +1,179 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/admission"
+
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+	samplev1alpha1 "github.com/vine-io/kes/apiserver/pkg/generated/applyconfiguration/sample/v1alpha1"
+)
+
+func TestClientset(t *testing.T) {
+	client := NewClientset(t, v1alpha1.ResourceBuilder...)
+	flunders := client.SampleV1alpha1().Flunders("default")
+	ctx := context.Background()
+
+	t.Run("create", func(t *testing.T) {
+		flunder := &v1alpha1.Flunder{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: "flunder-"},
+			Spec:       v1alpha1.FlunderSpec{ReferenceType: v1alpha1.FlunderReferenceType, FlunderReference: "other"},
+		}
+		created, err := flunders.Create(ctx, flunder, metav1.CreateOptions{})
+		if assert.NoError(t, err) {
+			assert.Regexp(t, "^flunder-", created.Name)
+			assert.NotEmpty(t, created.UID)
+			assert.NotEmpty(t, created.ResourceVersion)
+			assert.False(t, created.CreationTimestamp.IsZero())
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		flunder := &v1alpha1.Flunder{
+			ObjectMeta: metav1.ObjectMeta{Name: "invalid"},
+			Spec:       v1alpha1.FlunderSpec{ReferenceType: v1alpha1.FischerReferenceType},
+		}
+		_, err := flunders.Create(ctx, flunder, metav1.CreateOptions{})
+		assert.True(t, apierrors.IsInvalid(err), "expected invalid error, got %v", err)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		created, err := flunders.Create(ctx, &v1alpha1.Flunder{ObjectMeta: metav1.ObjectMeta{Name: "conflict"}}, metav1.CreateOptions{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		updated := created.DeepCopy()
+		updated.Labels = map[string]string{"updated": "true"}
+		_, err = flunders.Update(ctx, updated, metav1.UpdateOptions{})
+		assert.NoError(t, err)
+		_, err = flunders.Update(ctx, created, metav1.UpdateOptions{})
+		assert.True(t, apierrors.IsConflict(err), "expected conflict error, got %v", err)
+	})
+
+	t.Run("add", func(t *testing.T) {
+		// added objects don't go through the strategy
+		invalid := &v1alpha1.Flunder{
+			ObjectMeta: metav1.ObjectMeta{Name: "added", Namespace: "default"},
+			Spec:       v1alpha1.FlunderSpec{ReferenceType: v1alpha1.FischerReferenceType},
+		}
+		assert.NoError(t, client.Add(invalid))
+		got, err := flunders.Get(ctx, "added", metav1.GetOptions{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, v1alpha1.FischerReferenceType, got.Spec.ReferenceType)
+		}
+		assert.Error(t, client.Add(&metav1.Status{}))
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		list, err := flunders.List(ctx, metav1.ListOptions{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		w, err := flunders.Watch(ctx, metav1.ListOptions{ResourceVersion: list.ResourceVersion})
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer w.Stop()
+
+		_, err = flunders.Create(ctx, &v1alpha1.Flunder{ObjectMeta: metav1.ObjectMeta{Name: "watched"}}, metav1.CreateOptions{})
+		assert.NoError(t, err)
+		assert.NoError(t, flunders.Delete(ctx, "watched", metav1.DeleteOptions{}))
+
+		for _, eventType := range []watch.EventType{watch.Added, watch.Deleted} {
+			select {
+			case e := <-w.ResultChan():
+				assert.Equal(t, eventType, e.Type)
+				assert.Equal(t, "watched", e.Object.(*v1alpha1.Flunder).Name)
+			case <-time.After(10 * time.Second):
+				t.Fatalf("no %s event", eventType)
+			}
+		}
+	})
+}
+
+func TestClientsetApply(t *testing.T) {
+	admit := &recordingAdmission{}
+	client := NewClientsetWithOptions(t, Options{Resources: v1alpha1.ResourceBuilder, Admission: admit})
+	fischers := client.SampleV1alpha1().Fischers()
+	ctx := context.Background()
+
+	t.Run("apply", func(t *testing.T) {
+		applied, err := fischers.Apply(ctx, samplev1alpha1.Fischer("applied").WithDisallowedFlunders("a"),
+			metav1.ApplyOptions{FieldManager: "alice"})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, []string{"a"}, applied.DisallowedFlunders)
+		if assert.Len(t, applied.ManagedFields, 1) {
+			assert.Equal(t, "alice", applied.ManagedFields[0].Manager)
+			assert.Equal(t, metav1.ManagedFieldsOperationApply, applied.ManagedFields[0].Operation)
+			assert.Contains(t, string(applied.ManagedFields[0].FieldsV1.Raw), "f:disallowedFlunders")
+		}
+		// the in-process request went through admission
+		assert.Contains(t, admit.get(), "CREATE fischers applied")
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		_, err := fischers.Apply(ctx, samplev1alpha1.Fischer("applied").WithDisallowedFlunders("b"),
+			metav1.ApplyOptions{FieldManager: "bob"})
+		assert.True(t, apierrors.IsConflict(err), "expected conflict error, got %v", err)
+
+		applied, err := fischers.Apply(ctx, samplev1alpha1.Fischer("applied").WithDisallowedFlunders("b"),
+			metav1.ApplyOptions{FieldManager: "bob", Force: true})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, []string{"b"}, applied.DisallowedFlunders)
+		if assert.Len(t, applied.ManagedFields, 1) {
+			assert.Equal(t, "bob", applied.ManagedFields[0].Manager)
+		}
+		assert.Contains(t, admit.get(), "UPDATE fischers applied")
+	})
+
+	t.Run("apply status", func(t *testing.T) {
+		// fischers have no status subresource
+		_, err := fischers.ApplyStatus(ctx, samplev1alpha1.Fischer("applied").WithStatus(v1alpha1.FischerStatus{}),
+			metav1.ApplyOptions{FieldManager: "alice"})
+		assert.True(t, apierrors.IsNotFound(err), "expected not found error, got %v", err)
+	})
+
+	t.Run("admission", func(t *testing.T) {
+		_, err := fischers.Apply(ctx, samplev1alpha1.Fischer("denied"), metav1.ApplyOptions{FieldManager: "alice"})
+		assert.True(t, apierrors.IsForbidden(err), "expected forbidden error, got %v", err)
+		_, err = fischers.Get(ctx, "denied", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err), "expected not found error, got %v", err)
+	})
+}
+
+// recordingAdmission records the requests it admits, and denies the objects named "denied".
+type recordingAdmission struct {
+	mu       sync.Mutex
+	admitted []string
+}
+
+func (a *recordingAdmission) Handles(admission.Operation) bool { return true }
+
+func (a *recordingAdmission) Validate(_ context.Context, attrs admission.Attributes, _ admission.ObjectInterfaces) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.admitted = append(a.admitted, fmt.Sprintf("%s %s %s", attrs.GetOperation(), attrs.GetResource().Resource, attrs.GetName()))
+	if attrs.GetName() == "denied" {
+		return admission.NewForbidden(attrs, errors.New("denied"))
+	}
+	return nil
+}
+
+func (a *recordingAdmission) get() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.admitted...)
+}
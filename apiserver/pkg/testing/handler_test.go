@@ -0,0 +1,195 @@
+package testing
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/dynamic"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcerest"
+)
+
+func TestCustomHandler(t *testing.T) {
+	client := NewClientsetWithOptions(t, Options{
+		Resources:          []resource.Object{&Note{store: &noteStore{notes: map[string]*Note{}}}},
+		OpenAPIDefinitions: noteDefinitions,
+	})
+	dynamicClient, err := dynamic.NewForConfig(client.Config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	notes := dynamicClient.Resource(noteGVR).Namespace("default")
+	ctx := context.Background()
+
+	t.Run("create", func(t *testing.T) {
+		// the handler isn't a rest.StandardStorage, its create must be served along with get and update
+		created, err := notes.Create(ctx, newNote("a", "hello"), metav1.CreateOptions{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "hello", created.Object["text"])
+
+		got, err := notes.Get(ctx, "a", metav1.GetOptions{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "hello", got.Object["text"])
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		got, err := notes.Get(ctx, "a", metav1.GetOptions{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		got.Object["text"] = "bye"
+		updated, err := notes.Update(ctx, got, metav1.UpdateOptions{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "bye", updated.Object["text"])
+		}
+	})
+}
+
+func newNote(name, text string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": noteGVR.GroupVersion().String(),
+		"kind":       "Note",
+		"metadata":   map[string]interface{}{"name": name},
+		"text":       text,
+	}}
+}
+
+var noteGVR = schema.GroupVersionResource{Group: "test.kes.io", Version: "v1", Resource: "notes"}
+
+var _ resourcerest.Creator = &Note{}
+var _ resourcerest.Getter = &Note{}
+var _ resourcerest.Updater = &Note{}
+
+// Note is a resource served by its own handler, creating, getting and updating the notes of its store.
+type Note struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Text              string `json:"text,omitempty"`
+
+	store *noteStore
+}
+
+type NoteList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Note `json:"items"`
+}
+
+type noteStore struct {
+	mu    sync.Mutex
+	notes map[string]*Note
+}
+
+func (n *Note) DeepCopyObject() runtime.Object {
+	out := *n
+	n.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+func (n *Note) GetObjectMeta() *metav1.ObjectMeta                    { return &n.ObjectMeta }
+func (n *Note) NamespaceScoped() bool                                { return true }
+func (n *Note) New() runtime.Object                                  { return &Note{} }
+func (n *Note) NewList() runtime.Object                              { return &NoteList{} }
+func (n *Note) GetGroupVersionResource() schema.GroupVersionResource { return noteGVR }
+func (n *Note) IsStorageVersion() bool                               { return true }
+func (n *Note) Destroy()                                             {}
+func (n *Note) GetSingularName() string                              { return "note" }
+
+func (l *NoteList) DeepCopyObject() runtime.Object {
+	out := *l
+	out.Items = make([]Note, len(l.Items))
+	for i := range l.Items {
+		out.Items[i] = *l.Items[i].DeepCopyObject().(*Note)
+	}
+	return &out
+}
+
+func (l *NoteList) GetListMeta() *metav1.ListMeta { return &l.ListMeta }
+
+func (n *Note) Create(_ context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, _ *metav1.CreateOptions) (runtime.Object, error) {
+	n.store.mu.Lock()
+	defer n.store.mu.Unlock()
+	created := obj.DeepCopyObject().(*Note)
+	if _, ok := n.store.notes[created.Name]; ok {
+		return nil, apierrors.NewAlreadyExists(noteGVR.GroupResource(), created.Name)
+	}
+	created.ResourceVersion = "1"
+	n.store.notes[created.Name] = created
+	return created.DeepCopyObject(), nil
+}
+
+func (n *Note) Get(_ context.Context, name string, _ *metav1.GetOptions) (runtime.Object, error) {
+	n.store.mu.Lock()
+	defer n.store.mu.Unlock()
+	stored, ok := n.store.notes[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(noteGVR.GroupResource(), name)
+	}
+	return stored.DeepCopyObject(), nil
+}
+
+func (n *Note) Update(ctx context.Context, name string, objInfo rest.UpdatedObjectInfo, _ rest.ValidateObjectFunc,
+	_ rest.ValidateObjectUpdateFunc, _ bool, _ *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	n.store.mu.Lock()
+	defer n.store.mu.Unlock()
+	stored, ok := n.store.notes[name]
+	if !ok {
+		return nil, false, apierrors.NewNotFound(noteGVR.GroupResource(), name)
+	}
+	obj, err := objInfo.UpdatedObject(ctx, stored.DeepCopyObject())
+	if err != nil {
+		return nil, false, err
+	}
+	updated := obj.(*Note)
+	updated.ResourceVersion = "2"
+	n.store.notes[name] = updated
+	return updated.DeepCopyObject(), false, nil
+}
+
+// noteDefinitions returns the OpenAPI definitions of notes.
+func noteDefinitions(ref openapicommon.ReferenceCallback) map[string]openapicommon.OpenAPIDefinition {
+	str := spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"string"}}}
+	return map[string]openapicommon.OpenAPIDefinition{
+		"github.com/vine-io/kes/apiserver/pkg/testing.Note": {
+			Schema: spec.Schema{SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"apiVersion": str,
+					"kind":       str,
+					"metadata":   {SchemaProps: spec.SchemaProps{Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta")}},
+					"text":       str,
+				},
+			}},
+			Dependencies: []string{"k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+		},
+		"github.com/vine-io/kes/apiserver/pkg/testing.NoteList": {
+			Schema: spec.Schema{SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"apiVersion": str,
+					"kind":       str,
+					"metadata":   {SchemaProps: spec.SchemaProps{Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta")}},
+					"items": {SchemaProps: spec.SchemaProps{
+						Type:  []string{"array"},
+						Items: &spec.SchemaOrArray{Schema: &spec.Schema{SchemaProps: spec.SchemaProps{Ref: ref("github.com/vine-io/kes/apiserver/pkg/testing.Note")}}},
+					}},
+				},
+			}},
+			Dependencies: []string{"github.com/vine-io/kes/apiserver/pkg/testing.Note", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+		},
+	}
+}
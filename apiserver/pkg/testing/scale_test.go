@@ -0,0 +1,166 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+func TestScalePaths(t *testing.T) {
+	// no other resource of the server has a scale subresource registering autoscaling/v1 Scale with the scheme
+	client := NewClientsetWithOptions(t, Options{
+		Resources:          []resource.Object{&Replicated{}},
+		OpenAPIDefinitions: replicatedDefinitions,
+	})
+	dynamicClient, err := dynamic.NewForConfig(client.Config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	replicas := dynamicClient.Resource(replicatedGVR).Namespace("default")
+	ctx := context.Background()
+
+	_, err = replicas.Create(ctx, &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": replicatedGVR.GroupVersion().String(),
+		"kind":       "Replicated",
+		"metadata":   map[string]interface{}{"name": "r"},
+		"spec":       map[string]interface{}{"replicas": int64(1)},
+	}}, metav1.CreateOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("get scale", func(t *testing.T) {
+		scale, err := replicas.Get(ctx, "r", metav1.GetOptions{}, "scale")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "autoscaling/v1", scale.GetAPIVersion())
+		assert.Equal(t, "Scale", scale.GetKind())
+		specReplicas, _, _ := unstructured.NestedInt64(scale.Object, "spec", "replicas")
+		assert.Equal(t, int64(1), specReplicas)
+	})
+
+	t.Run("update scale", func(t *testing.T) {
+		scale, err := replicas.Get(ctx, "r", metav1.GetOptions{}, "scale")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, unstructured.SetNestedField(scale.Object, int64(3), "spec", "replicas"))
+		updated, err := replicas.Update(ctx, scale, metav1.UpdateOptions{}, "scale")
+		if !assert.NoError(t, err) {
+			return
+		}
+		specReplicas, _, _ := unstructured.NestedInt64(updated.Object, "spec", "replicas")
+		assert.Equal(t, int64(3), specReplicas)
+
+		got, err := replicas.Get(ctx, "r", metav1.GetOptions{})
+		if assert.NoError(t, err) {
+			specReplicas, _, _ := unstructured.NestedInt64(got.Object, "spec", "replicas")
+			assert.Equal(t, int64(3), specReplicas)
+		}
+	})
+}
+
+var replicatedGVR = schema.GroupVersionResource{Group: "scale.kes.io", Version: "v1", Resource: "replicateds"}
+
+var _ resource.ObjectWithScalePaths = &Replicated{}
+
+// Replicated declares its scale subresource by the paths of its replicas only.
+type Replicated struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ReplicatedSpec   `json:"spec,omitempty"`
+	Status ReplicatedStatus `json:"status,omitempty"`
+}
+
+type ReplicatedSpec struct {
+	Replicas int32 `json:"replicas"`
+}
+
+type ReplicatedStatus struct {
+	Replicas int32 `json:"replicas"`
+}
+
+type ReplicatedList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Replicated `json:"items"`
+}
+
+func (r *Replicated) DeepCopyObject() runtime.Object {
+	out := *r
+	r.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+func (r *Replicated) GetObjectMeta() *metav1.ObjectMeta                    { return &r.ObjectMeta }
+func (r *Replicated) NamespaceScoped() bool                                { return true }
+func (r *Replicated) New() runtime.Object                                  { return &Replicated{} }
+func (r *Replicated) NewList() runtime.Object                              { return &ReplicatedList{} }
+func (r *Replicated) GetGroupVersionResource() schema.GroupVersionResource { return replicatedGVR }
+func (r *Replicated) IsStorageVersion() bool                               { return true }
+
+func (r *Replicated) GetScalePaths() resource.ScalePaths {
+	return resource.ScalePaths{SpecReplicasPath: ".spec.replicas", StatusReplicasPath: ".status.replicas"}
+}
+
+func (l *ReplicatedList) DeepCopyObject() runtime.Object {
+	out := *l
+	out.Items = make([]Replicated, len(l.Items))
+	for i := range l.Items {
+		out.Items[i] = *l.Items[i].DeepCopyObject().(*Replicated)
+	}
+	return &out
+}
+
+func (l *ReplicatedList) GetListMeta() *metav1.ListMeta { return &l.ListMeta }
+
+// replicatedDefinitions returns the OpenAPI definitions of Replicated.
+func replicatedDefinitions(ref openapicommon.ReferenceCallback) map[string]openapicommon.OpenAPIDefinition {
+	str := spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"string"}}}
+	replicas := spec.Schema{SchemaProps: spec.SchemaProps{
+		Type:       []string{"object"},
+		Properties: map[string]spec.Schema{"replicas": {SchemaProps: spec.SchemaProps{Type: []string{"integer"}, Format: "int32"}}},
+	}}
+	return map[string]openapicommon.OpenAPIDefinition{
+		"github.com/vine-io/kes/apiserver/pkg/testing.Replicated": {
+			Schema: spec.Schema{SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"apiVersion": str,
+					"kind":       str,
+					"metadata":   {SchemaProps: spec.SchemaProps{Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta")}},
+					"spec":       replicas,
+					"status":     replicas,
+				},
+			}},
+			Dependencies: []string{"k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+		},
+		"github.com/vine-io/kes/apiserver/pkg/testing.ReplicatedList": {
+			Schema: spec.Schema{SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"apiVersion": str,
+					"kind":       str,
+					"metadata":   {SchemaProps: spec.SchemaProps{Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta")}},
+					"items": {SchemaProps: spec.SchemaProps{
+						Type:  []string{"array"},
+						Items: &spec.SchemaOrArray{Schema: &spec.Schema{SchemaProps: spec.SchemaProps{Ref: ref("github.com/vine-io/kes/apiserver/pkg/testing.Replicated")}}},
+					}},
+				},
+			}},
+			Dependencies: []string{"github.com/vine-io/kes/apiserver/pkg/testing.Replicated", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+		},
+	}
+}
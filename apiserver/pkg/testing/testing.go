@@ -0,0 +1,225 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package testing starts a kes apiserver backed by an embedded etcd for end-to-end tests, e.g. of the strategies
+// of custom resources, in go test.
+//
+//	func TestFoo(t *testing.T) {
+//		env := kestesting.Start(t, v1.ResourceBuilder...)
+//		client := versioned.NewForConfigOrDie(env.Config)
+//		...
+//	}
+//
+// Everything is torn down when the test completes.
+//
+// Unit tests, e.g. of controllers, may use the clientset returned by NewClientset instead of the generated fake
+// clientset: the requests are handled in-process by a server storing the resources in memory, so the strategies
+// of the resources apply as in production.
+package testing
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/grpclog"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/admission"
+	restclient "k8s.io/client-go/rest"
+	openapicommon "k8s.io/kube-openapi/pkg/common"
+
+	"github.com/vine-io/kes/apiserver/pkg/etcd"
+	"github.com/vine-io/kes/apiserver/pkg/generated/clientset/versioned"
+	"github.com/vine-io/kes/apiserver/pkg/server"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+// readyTimeout is how long Start waits for the server to be ready.
+const readyTimeout = time.Minute
+
+// Options configures the server started by StartWithOptions.
+type Options struct {
+	// Resources are served in addition to the ResourceDefinitions.
+	Resources []resource.Object
+	// OpenAPIDefinitions returns the definitions of the Resources, unless generated along with the definitions
+	// of kes.
+	OpenAPIDefinitions openapicommon.GetOpenAPIDefinitions
+	// ServerFns are applied to the server before it runs, e.g. to register the controllers of a
+	// controller.Manager.
+	ServerFns []func(ws *server.WardleServer) error
+	// Admission, if not nil, admits the requests to the server, e.g. to test an admission plugin.
+	Admission admission.Interface
+}
+
+// Environment is a running server.
+type Environment struct {
+	// Config is the client config of the server, connecting over https with the credentials of the loopback
+	// client.
+	Config *restclient.Config
+	// Client is the clientset of the Config.
+	Client versioned.Interface
+	// Server is the running server.
+	Server *server.WardleServer
+	// EtcdEndpoint is the client URL of the embedded etcd storing the resources.
+	EtcdEndpoint string
+}
+
+// Start starts a server serving the resources, and fails the test if the server isn't ready in time.
+func Start(t testing.TB, resources ...resource.Object) *Environment {
+	t.Helper()
+	return StartWithOptions(t, Options{Resources: resources})
+}
+
+// StartWithOptions starts a server configured by the options, and fails the test if the server isn't ready in
+// time.  The etcd stores its data in a temporary directory and every listener binds a random port of 127.0.0.1,
+// so tests may run servers in parallel.  The server and the etcd are stopped when the test completes.
+func StartWithOptions(t testing.TB, opts Options) *Environment {
+	t.Helper()
+
+	etcdEndpoint := startEtcd(t)
+
+	o := server.NewWardleServerOptions(io.Discard, io.Discard)
+	o.Resources = opts.Resources
+	o.OpenAPIDefinitions = opts.OpenAPIDefinitions
+	o.EmbeddedEtcd = nil
+	o.RecommendedOptions.Etcd.StorageConfig.Transport.ServerList = []string{etcdEndpoint}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	o.RecommendedOptions.SecureServing.Listener = listener
+	o.RecommendedOptions.SecureServing.BindAddress = net.ParseIP("127.0.0.1")
+	o.RecommendedOptions.SecureServing.BindPort = listener.Addr().(*net.TCPAddr).Port
+	o.RecommendedOptions.SecureServing.ServerCert.CertDirectory = t.TempDir()
+
+	if err := o.Complete(); err != nil {
+		t.Fatalf("error completing the options: %v", err)
+	}
+	if err := o.Validate(nil); err != nil {
+		t.Fatalf("invalid options: %v", err)
+	}
+	serverConfig, err := o.Config()
+	if err != nil {
+		t.Fatalf("error creating the server config: %v", err)
+	}
+	if opts.Admission != nil {
+		serverConfig.GenericConfig.AdmissionControl = opts.Admission
+	}
+	ws, err := serverConfig.Complete().New()
+	if err != nil {
+		t.Fatalf("error creating the server: %v", err)
+	}
+	for _, fn := range opts.ServerFns {
+		if err := fn(ws); err != nil {
+			t.Fatalf("error applying the server fns: %v", err)
+		}
+	}
+
+	stopCh := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := ws.GenericAPIServer.PrepareRun().Run(stopCh); err != nil {
+			t.Errorf("error running the server: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		close(stopCh)
+		<-stopped
+	})
+
+	config := restclient.CopyConfig(ws.GenericAPIServer.LoopbackClientConfig)
+	client, err := versioned.NewForConfig(config)
+	if err != nil {
+		t.Fatalf("error creating the clientset: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+	err = wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(ctx context.Context) (bool, error) {
+		select {
+		case <-stopped:
+			// the server failed to run, the error is already reported
+			return false, io.EOF
+		default:
+		}
+		result := client.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx)
+		var status int
+		result.StatusCode(&status)
+		return status == 200, nil
+	})
+	if err != nil {
+		t.Fatalf("server not ready: %v", err)
+	}
+
+	return &Environment{
+		Config:       config,
+		Client:       client,
+		Server:       ws,
+		EtcdEndpoint: etcdEndpoint,
+	}
+}
+
+// discardGRPCLogs replaces the klog logger of grpc once: the etcd serves grpc before the server is created,
+// which sets the klog logger, racing with grpc logging to klog.
+var discardGRPCLogs sync.Once
+
+// startEtcd starts an etcd listening on random ports, and returns its client URL.
+func startEtcd(t testing.TB) string {
+	t.Helper()
+
+	discardGRPCLogs.Do(func() {
+		grpclog.SetLoggerV2(grpclog.NewLoggerV2(io.Discard, io.Discard, io.Discard))
+	})
+
+	freeURL := func() url.URL {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("error listening: %v", err)
+		}
+		defer l.Close()
+		return url.URL{Scheme: "http", Host: l.Addr().String()}
+	}
+
+	cfg := etcd.NewConfig()
+	cfg.Dir = t.TempDir()
+	clientURL, peerURL := freeURL(), freeURL()
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := etcd.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("error starting etcd: %v", err)
+	}
+	t.Cleanup(e.Close)
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(readyTimeout):
+		t.Fatal("etcd not ready")
+	}
+	return clientURL.String()
+}
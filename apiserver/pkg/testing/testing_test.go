@@ -0,0 +1,130 @@
+package testing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+
+	apiextensionsv1alpha1 "github.com/vine-io/kes/apiserver/pkg/apis/apiextensions/v1alpha1"
+	"github.com/vine-io/kes/apiserver/pkg/apis/sample/v1alpha1"
+)
+
+func TestStart(t *testing.T) {
+	env := Start(t, v1alpha1.ResourceBuilder...)
+	flunders := env.Client.SampleV1alpha1().Flunders("default")
+	ctx := context.Background()
+
+	t.Run("create", func(t *testing.T) {
+		flunder := &v1alpha1.Flunder{
+			ObjectMeta: metav1.ObjectMeta{Name: "valid"},
+			Spec:       v1alpha1.FlunderSpec{ReferenceType: v1alpha1.FlunderReferenceType, FlunderReference: "other"},
+		}
+		created, err := flunders.Create(ctx, flunder, metav1.CreateOptions{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "other", created.Spec.FlunderReference)
+		}
+
+		got, err := flunders.Get(ctx, "valid", metav1.GetOptions{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, created.UID, got.UID)
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		flunder := &v1alpha1.Flunder{
+			ObjectMeta: metav1.ObjectMeta{Name: "invalid"},
+			Spec:       v1alpha1.FlunderSpec{ReferenceType: v1alpha1.FischerReferenceType},
+		}
+		_, err := flunders.Create(ctx, flunder, metav1.CreateOptions{})
+		assert.True(t, apierrors.IsInvalid(err), "expected invalid error, got %v", err)
+	})
+
+	t.Run("validate update", func(t *testing.T) {
+		flunder, err := flunders.Get(ctx, "valid", metav1.GetOptions{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		flunder.Spec.FischerReference = "fischer"
+		_, err = flunders.Update(ctx, flunder, metav1.UpdateOptions{})
+		assert.True(t, apierrors.IsInvalid(err), "expected invalid error, got %v", err)
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		// the storage latency of the flunders created above is served along with the other metrics
+		metrics, err := env.Client.Discovery().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(metrics),
+				`kes_storage_operation_duration_seconds_count{operation="create",resource="flunders.sample.k8s.com",result="success"}`)
+		}
+	})
+
+	t.Run("define a resource", func(t *testing.T) {
+		// ResourceDefinitions have no typed client, only the REST client of their group
+		definitions := env.Client.ApiextensionsV1alpha1().RESTClient()
+		err := definitions.Post().Resource("resourcedefinitions").Body(&apiextensionsv1alpha1.ResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.com"},
+			Spec: apiextensionsv1alpha1.ResourceDefinitionSpec{
+				Group: "example.com",
+				Names: apiextensionsv1alpha1.ResourceDefinitionNames{Plural: "widgets", Kind: "Widget"},
+				Scope: apiextensionsv1alpha1.NamespaceScoped,
+				Versions: []apiextensionsv1alpha1.ResourceDefinitionVersion{{
+					Name:    "v1",
+					Served:  true,
+					Storage: true,
+					Schema: &runtime.RawExtension{Raw: []byte(`{"type":"object","properties":{"spec":{"type":"object",` +
+						`"properties":{"size":{"type":"integer","maximum":10}}}}}`)},
+				}},
+			},
+		}).Do(ctx).Error()
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, readyTimeout, true, func(ctx context.Context) (bool, error) {
+			def := &apiextensionsv1alpha1.ResourceDefinition{}
+			if err := definitions.Get().Resource("resourcedefinitions").Name("widgets.example.com").Do(ctx).Into(def); err != nil {
+				return false, err
+			}
+			return meta.IsStatusConditionTrue(def.Status.Conditions, apiextensionsv1alpha1.Established), nil
+		})
+		if !assert.NoError(t, err, "the definition is not established") {
+			return
+		}
+
+		client, err := dynamic.NewForConfig(env.Config)
+		if !assert.NoError(t, err) {
+			return
+		}
+		widgets := client.Resource(schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}).Namespace("default")
+		widget := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "example.com/v1",
+			"kind":       "Widget",
+			"metadata":   map[string]interface{}{"name": "widget"},
+			"spec":       map[string]interface{}{"size": int64(3)},
+		}}
+		created, err := widgets.Create(ctx, widget, metav1.CreateOptions{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		got, err := widgets.Get(ctx, "widget", metav1.GetOptions{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, created.GetUID(), got.GetUID())
+			size, _, _ := unstructured.NestedInt64(got.Object, "spec", "size")
+			assert.Equal(t, int64(3), size)
+		}
+
+		widget.SetName("invalid")
+		widget.Object["spec"] = map[string]interface{}{"size": int64(11)}
+		_, err = widgets.Create(ctx, widget, metav1.CreateOptions{})
+		assert.True(t, apierrors.IsInvalid(err), "expected invalid error, got %v", err)
+	})
+}
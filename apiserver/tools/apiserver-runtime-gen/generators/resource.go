@@ -0,0 +1,375 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package generators generates the resource.Object implementation of the types marked with +kes:resource.
+//
+// A type is marked as a resource by a comment such as
+//
+//	// +kes:resource:path=flunders,scope=Namespaced,storage
+//	// +kes:subresource:status
+//
+// The path is the resource name, by default the lowercase plural of the type name.  The scope is Namespaced,
+// the default, or Cluster.  storage declares the type as the storage version of the resource.  noRegister leaves
+// the resource out of the ResourceBuilder, e.g. for resources served only on demand.  The status subresource is
+// served from the Status field of the type.
+//
+// The type must embed metav1.ObjectMeta and have a list type named <Type>List embedding metav1.ListMeta.  The
+// package must declare SchemeGroupVersion.  Each resource is registered with the ResourceBuilder generated
+// for the package, unless marked noRegister.
+package generators
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/gengo/v2/generator"
+	"k8s.io/gengo/v2/namer"
+	"k8s.io/gengo/v2/types"
+)
+
+const (
+	resourceMarker  = "+kes:resource"
+	statusMarker    = "+kes:subresource:status"
+	resourcePackage = "github.com/vine-io/kes/apiserver/pkg/server/resource"
+)
+
+// resourceTags are the options of the +kes:resource marker of a type.
+type resourceTags struct {
+	// path is the resource name, e.g. "flunders".
+	path string
+	// cluster is true if the resource isn't namespaced.
+	cluster bool
+	// storage is true if the type is the storage version.
+	storage bool
+	// status is true if the type has the status subresource.
+	status bool
+	// noRegister is true if the resource isn't registered with the ResourceBuilder.
+	noRegister bool
+}
+
+// parseResourceTags returns the resource options in the comment lines, nil if there's no +kes:resource marker.
+func parseResourceTags(lines []string) (*resourceTags, error) {
+	var tags *resourceTags
+	status := false
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == statusMarker:
+			status = true
+		case line == resourceMarker:
+			if tags == nil {
+				tags = &resourceTags{}
+			}
+		case strings.HasPrefix(line, resourceMarker+":"):
+			if tags == nil {
+				tags = &resourceTags{}
+			}
+			for _, option := range strings.Split(strings.TrimPrefix(line, resourceMarker+":"), ",") {
+				key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+				switch key {
+				case "path":
+					tags.path = value
+				case "scope":
+					switch value {
+					case "Namespaced":
+						tags.cluster = false
+					case "Cluster":
+						tags.cluster = true
+					default:
+						return nil, fmt.Errorf("invalid scope %q, must be Namespaced or Cluster", value)
+					}
+				case "storage":
+					tags.storage = true
+				case "noRegister":
+					tags.noRegister = true
+				default:
+					return nil, fmt.Errorf("unknown option %q of %s", key, resourceMarker)
+				}
+			}
+		}
+	}
+	if tags == nil {
+		if status {
+			return nil, fmt.Errorf("%s requires %s", statusMarker, resourceMarker)
+		}
+		return nil, nil
+	}
+	tags.status = status
+	return tags, nil
+}
+
+// typeResourceTags returns the resource options of t, nil if t isn't a resource.
+func typeResourceTags(t *types.Type) (*resourceTags, error) {
+	if t.Kind != types.Struct {
+		return nil, nil
+	}
+	tags, err := parseResourceTags(append(t.SecondClosestCommentLines, t.CommentLines...))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", t, err)
+	}
+	return tags, nil
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public":             namer.NewPublicNamer(0),
+		"allLowercasePlural": namer.NewAllLowercasePluralNamer(nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to be processed by the generators
+// in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// GetTargets returns a target writing the zz_generated.resource.go file of each input package declaring
+// resources.
+func GetTargets(c *generator.Context, boilerplate []byte) []generator.Target {
+	var targets []generator.Target
+	for _, i := range c.Inputs {
+		pkg := c.Universe[i]
+		hasResources := false
+		for _, t := range pkg.Types {
+			if tags, err := typeResourceTags(t); err != nil || tags != nil {
+				// report errors when generating the type
+				hasResources = true
+				break
+			}
+		}
+		if !hasResources {
+			continue
+		}
+
+		targets = append(targets, &generator.SimpleTarget{
+			PkgName:       pkg.Name,
+			PkgPath:       pkg.Path,
+			PkgDir:        pkg.Dir,
+			HeaderComment: boilerplate,
+			FilterFunc: func(c *generator.Context, t *types.Type) bool {
+				return t.Name.Package == pkg.Path
+			},
+			GeneratorsFunc: func(c *generator.Context) []generator.Generator {
+				return []generator.Generator{
+					&resourceGenerator{
+						GoGenerator: generator.GoGenerator{
+							OutputFilename: "zz_generated.resource.go",
+						},
+						targetPackage: pkg.Path,
+						imports:       generator.NewImportTracker(),
+					},
+				}
+			},
+		})
+	}
+	return targets
+}
+
+// resourceGenerator generates the resource.Object implementation of the resources of a package.
+type resourceGenerator struct {
+	generator.GoGenerator
+	targetPackage string
+	imports       namer.ImportTracker
+}
+
+var _ generator.Generator = &resourceGenerator{}
+
+func (g *resourceGenerator) Name() string {
+	return "resource"
+}
+
+func (g *resourceGenerator) Filter(_ *generator.Context, t *types.Type) bool {
+	tags, err := typeResourceTags(t)
+	return err != nil || tags != nil
+}
+
+func (g *resourceGenerator) Namers(_ *generator.Context) namer.NameSystems {
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *resourceGenerator) Imports(_ *generator.Context) []string {
+	return g.imports.ImportLines()
+}
+
+func (g *resourceGenerator) Init(c *generator.Context, w io.Writer) error {
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do(resourceBuilder, map[string]interface{}{
+		"Builder": c.Universe.Type(types.Name{Package: resourcePackage, Name: "Builder"}),
+	})
+	return sw.Error()
+}
+
+func (g *resourceGenerator) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	tags, err := typeResourceTags(t)
+	if err != nil {
+		return err
+	}
+	if !hasMember(t, "ObjectMeta", true) {
+		return fmt.Errorf("%v: resource must embed ObjectMeta", t)
+	}
+	list := c.Universe.Type(types.Name{Package: t.Name.Package, Name: t.Name.Name + "List"})
+	if list.Kind != types.Struct || !hasMember(list, "ListMeta", true) {
+		return fmt.Errorf("%v: resource must have a list type %s embedding ListMeta", t, list.Name.Name)
+	}
+	path := tags.path
+	if path == "" {
+		path = c.Namers["allLowercasePlural"].Name(t)
+	}
+
+	m := map[string]interface{}{
+		"type":                        t,
+		"list":                        list,
+		"receiver":                    strings.ToLower(t.Name.Name[:1]),
+		"path":                        path,
+		"namespaced":                  !tags.cluster,
+		"storage":                     tags.storage,
+		"GroupVersionResource":        c.Universe.Type(types.Name{Package: "k8s.io/apimachinery/pkg/runtime/schema", Name: "GroupVersionResource"}),
+		"ObjectMeta":                  c.Universe.Type(types.Name{Package: "k8s.io/apimachinery/pkg/apis/meta/v1", Name: "ObjectMeta"}),
+		"ListMeta":                    c.Universe.Type(types.Name{Package: "k8s.io/apimachinery/pkg/apis/meta/v1", Name: "ListMeta"}),
+		"RuntimeObject":               c.Universe.Type(types.Name{Package: "k8s.io/apimachinery/pkg/runtime", Name: "Object"}),
+		"Object":                      c.Universe.Type(types.Name{Package: resourcePackage, Name: "Object"}),
+		"ObjectList":                  c.Universe.Type(types.Name{Package: resourcePackage, Name: "ObjectList"}),
+		"ObjectWithStatusSubResource": c.Universe.Type(types.Name{Package: resourcePackage, Name: "ObjectWithStatusSubResource"}),
+		"StatusSubResource":           c.Universe.Type(types.Name{Package: resourcePackage, Name: "StatusSubResource"}),
+	}
+
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do(resourceObject, m)
+	if tags.status {
+		var status *types.Type
+		for _, member := range t.Members {
+			if member.Name == "Status" && !member.Embedded {
+				status = member.Type
+			}
+		}
+		if status == nil {
+			return fmt.Errorf("%v: %s requires a Status field", t, statusMarker)
+		}
+		m["statusPointer"] = status.Kind == types.Pointer
+		if status.Kind == types.Pointer {
+			status = status.Elem
+		}
+		if status.Name.Package != t.Name.Package {
+			return fmt.Errorf("%v: the Status field must be of a type declared in the package of the resource", t)
+		}
+		m["status"] = status
+		sw.Do(statusSubResource, m)
+	}
+	if !tags.noRegister {
+		sw.Do(registerResource, m)
+	}
+	return sw.Error()
+}
+
+// hasMember returns true if the struct t has the member name.
+func hasMember(t *types.Type, name string, embedded bool) bool {
+	for _, member := range t.Members {
+		if member.Name == name && member.Embedded == embedded {
+			return true
+		}
+	}
+	return false
+}
+
+var resourceBuilder = `
+// ResourceBuilder collects the resources of the package to serve them with WithResources.
+var ResourceBuilder $.Builder|raw$
+`
+
+var resourceObject = `
+var _ $.Object|raw$ = &$.type|raw${}
+var _ $.ObjectList|raw$ = &$.list|raw${}
+
+// GetGroupVersionResource returns a GroupVersionResource with "$.path$" as the resource.
+// GetGroupVersionResource implements resource.Object
+func ($.type|raw$) GetGroupVersionResource() $.GroupVersionResource|raw$ {
+	return SchemeGroupVersion.WithResource("$.path$")
+}
+
+// GetObjectMeta implements resource.Object
+func ($.receiver$ *$.type|raw$) GetObjectMeta() *$.ObjectMeta|raw$ {
+	return &$.receiver$.ObjectMeta
+}
+
+$if .storage -$
+// IsStorageVersion returns true -- $.type|raw$ is used as the internal version.
+$- else -$
+// IsStorageVersion returns false -- $.type|raw$ is converted to the storage version.
+$- end$
+// IsStorageVersion implements resource.Object.
+func ($.type|raw$) IsStorageVersion() bool {
+	return $.storage$
+}
+
+$if .namespaced -$
+// NamespaceScoped returns true to indicate $.type|raw$ is a namespaced resource.
+$- else -$
+// NamespaceScoped returns false to indicate $.type|raw$ is a cluster scoped resource.
+$- end$
+// NamespaceScoped implements resource.Object.
+func ($.type|raw$) NamespaceScoped() bool {
+	return $.namespaced$
+}
+
+// New implements resource.Object
+func ($.type|raw$) New() $.RuntimeObject|raw$ {
+	return &$.type|raw${}
+}
+
+// NewList implements resource.Object
+func ($.type|raw$) NewList() $.RuntimeObject|raw$ {
+	return &$.list|raw${}
+}
+
+// GetListMeta implements resource.ObjectList
+func ($.receiver$ *$.list|raw$) GetListMeta() *$.ListMeta|raw$ {
+	return &$.receiver$.ListMeta
+}
+`
+
+var statusSubResource = `
+var _ $.ObjectWithStatusSubResource|raw$ = &$.type|raw${}
+
+// GetStatus implements resource.ObjectWithStatusSubResource
+func ($.receiver$ *$.type|raw$) GetStatus() $.StatusSubResource|raw$ {
+	return $.receiver$.Status
+}
+
+// SubResourceName implements resource.SubResource
+func ($if .statusPointer$*$end$$.status|raw$) SubResourceName() string {
+	return "status"
+}
+
+// CopyTo implements resource.StatusSubResource
+func (s $if .statusPointer$*$end$$.status|raw$) CopyTo(parent $.ObjectWithStatusSubResource|raw$) {
+	parent.(*$.type|raw$).Status = s
+}
+`
+
+var registerResource = `
+func init() {
+	ResourceBuilder.Register(&$.type|raw${})
+}
+`
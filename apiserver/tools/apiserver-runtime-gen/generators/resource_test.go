@@ -0,0 +1,114 @@
+package generators
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/gengo/v2"
+	"k8s.io/gengo/v2/generator"
+	"k8s.io/gengo/v2/parser"
+)
+
+const testdata = "github.com/vine-io/kes/apiserver/tools/apiserver-runtime-gen/generators/testdata/"
+
+func TestParseResourceTags(t *testing.T) {
+	t.Run("all options", func(t *testing.T) {
+		tags, err := parseResourceTags([]string{
+			"Widget is a resource.",
+			"+kes:resource:path=gizmos,scope=Cluster,storage,noRegister",
+			"+kes:subresource:status",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, &resourceTags{path: "gizmos", cluster: true, storage: true, status: true, noRegister: true}, tags)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		tags, err := parseResourceTags([]string{"+kes:resource"})
+		assert.NoError(t, err)
+		assert.Equal(t, &resourceTags{}, tags)
+
+		tags, err = parseResourceTags([]string{"+kes:resource:scope=Namespaced"})
+		assert.NoError(t, err)
+		assert.Equal(t, &resourceTags{}, tags)
+	})
+
+	t.Run("no marker", func(t *testing.T) {
+		tags, err := parseResourceTags([]string{"+genclient", "+k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object"})
+		assert.NoError(t, err)
+		assert.Nil(t, tags)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseResourceTags([]string{"+kes:resource:scope=Namespace"})
+		assert.ErrorContains(t, err, "invalid scope")
+
+		_, err = parseResourceTags([]string{"+kes:resource:plural=gizmos"})
+		assert.ErrorContains(t, err, `unknown option "plural"`)
+
+		_, err = parseResourceTags([]string{"+kes:subresource:status"})
+		assert.ErrorContains(t, err, "requires +kes:resource")
+	})
+}
+
+// generate runs the resource generator over the package, writing to a temporary directory, and returns the
+// generated file.
+func generate(t *testing.T, pkg string) (string, error) {
+	p := parser.NewWithOptions(parser.Options{BuildTags: []string{gengo.StdBuildTag}})
+	if err := p.LoadPackages(pkg); err != nil {
+		return "", err
+	}
+	c, err := generator.NewContext(p, NameSystems(), DefaultNameSystem())
+	if err != nil {
+		return "", err
+	}
+	dir := t.TempDir()
+	targets := GetTargets(c, nil)
+	for _, target := range targets {
+		target.(*generator.SimpleTarget).PkgDir = dir
+	}
+	if err := c.ExecuteTargets(targets); err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "zz_generated.resource.go"))
+	return string(b), err
+}
+
+func TestGetTargets(t *testing.T) {
+	t.Run("resources", func(t *testing.T) {
+		out, err := generate(t, testdata+"widgets")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Contains(t, out, "var ResourceBuilder resource.Builder")
+
+		assert.Contains(t, out, `return SchemeGroupVersion.WithResource("widgets")`)
+		assert.Contains(t, out, "func (w *Widget) GetObjectMeta() *v1.ObjectMeta {\n\treturn &w.ObjectMeta\n}")
+		assert.Contains(t, out, "func (Widget) IsStorageVersion() bool {\n\treturn true\n}")
+		assert.Contains(t, out, "func (Widget) NamespaceScoped() bool {\n\treturn true\n}")
+		assert.Contains(t, out, "func (Widget) NewList() runtime.Object {\n\treturn &WidgetList{}\n}")
+		assert.Contains(t, out, "func (w *WidgetList) GetListMeta() *v1.ListMeta {")
+		assert.Contains(t, out, "func (w *Widget) GetStatus() resource.StatusSubResource {")
+		assert.Contains(t, out, "func (*WidgetStatus) SubResourceName() string {")
+		assert.Contains(t, out, "func (s *WidgetStatus) CopyTo(parent resource.ObjectWithStatusSubResource) {\n\tparent.(*Widget).Status = s\n}")
+		assert.Contains(t, out, "ResourceBuilder.Register(&Widget{})")
+
+		assert.Contains(t, out, `return SchemeGroupVersion.WithResource("gizmos")`)
+		assert.Contains(t, out, "func (Gadget) IsStorageVersion() bool {\n\treturn false\n}")
+		assert.Contains(t, out, "func (Gadget) NamespaceScoped() bool {\n\treturn false\n}")
+		assert.NotContains(t, out, "func (g *Gadget) GetStatus()")
+		assert.Contains(t, out, "ResourceBuilder.Register(&Gadget{})")
+
+		assert.Contains(t, out, "func (Gauge) New() runtime.Object {")
+		assert.NotContains(t, out, "ResourceBuilder.Register(&Gauge{})")
+
+		assert.NotContains(t, out, "Part")
+	})
+
+	t.Run("missing list type", func(t *testing.T) {
+		_, err := generate(t, testdata+"invalid")
+		assert.ErrorContains(t, err, "resource must have a list type WidgetList")
+	})
+}
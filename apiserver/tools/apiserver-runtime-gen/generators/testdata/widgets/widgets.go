@@ -0,0 +1,63 @@
+package widgets
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var SchemeGroupVersion = schema.GroupVersion{Group: "widgets.example.com", Version: "v1"}
+
+// +kes:resource:storage
+// +kes:subresource:status
+
+// Widget is a namespaced resource with a status.
+type Widget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status *WidgetStatus `json:"status,omitempty"`
+}
+
+type WidgetStatus struct {
+	Ready bool `json:"ready"`
+}
+
+type WidgetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Widget `json:"items"`
+}
+
+// Gadget is a cluster scoped resource converted to the storage version.
+// +kes:resource:path=gizmos,scope=Cluster
+type Gadget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+}
+
+type GadgetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Gadget `json:"items"`
+}
+
+// Gauge is a resource left out of the ResourceBuilder.
+// +kes:resource:storage,noRegister
+type Gauge struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+}
+
+type GaugeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Gauge `json:"items"`
+}
+
+// Part isn't a resource.
+type Part struct {
+	Name string `json:"name"`
+}
@@ -4,21 +4,42 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
-	"strings"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/mod/modfile"
+	applyconfigurationargs "k8s.io/code-generator/cmd/applyconfiguration-gen/args"
+	applyconfigurationgenerators "k8s.io/code-generator/cmd/applyconfiguration-gen/generators"
+	clientargs "k8s.io/code-generator/cmd/client-gen/args"
+	clientgenerators "k8s.io/code-generator/cmd/client-gen/generators"
+	clienttypes "k8s.io/code-generator/cmd/client-gen/types"
+	deepcopyargs "k8s.io/code-generator/cmd/deepcopy-gen/args"
+	deepcopygenerators "k8s.io/code-generator/cmd/deepcopy-gen/generators"
+	informerargs "k8s.io/code-generator/cmd/informer-gen/args"
+	informergenerators "k8s.io/code-generator/cmd/informer-gen/generators"
+	listerargs "k8s.io/code-generator/cmd/lister-gen/args"
+	listergenerators "k8s.io/code-generator/cmd/lister-gen/generators"
+	"k8s.io/code-generator/pkg/util"
+	"k8s.io/gengo/v2"
+	"k8s.io/gengo/v2/generator"
+	"k8s.io/gengo/v2/namer"
+	openapiargs "k8s.io/kube-openapi/cmd/openapi-gen/args"
+	openapigenerators "k8s.io/kube-openapi/pkg/generators"
+
+	resourcegenerators "github.com/vine-io/kes/apiserver/tools/apiserver-runtime-gen/generators"
 )
 
-var bin, output string
-
 var cmd = cobra.Command{
-	Use:     "apiserver-runtime-gen",
-	Short:   "run code generators",
+	Use:   "apiserver-runtime-gen",
+	Short: "run code generators",
+	Long: `Runs the code generators linked into this binary over the API versions of the module.
+
+The generators are the libraries of k8s.io/code-generator and k8s.io/kube-openapi, so no generator binary has to
+be installed.  The packages are loaded with the go command in module mode, and the code is written under the
+module root, e.g. the clientset to pkg/generated/clientset/versioned.`,
 	PreRunE: preRunE,
 	RunE:    runE,
 }
@@ -30,158 +51,243 @@ func preRunE(cmd *cobra.Command, args []string) error {
 	if len(versions) == 0 {
 		return fmt.Errorf("must specify versions")
 	}
+	for _, g := range generators {
+		if _, ok := generatorFuncs[g]; !ok {
+			return fmt.Errorf("unknown generator %q, options: %v", g, generatorNames())
+		}
+	}
 	return nil
 }
 
 func runE(cmd *cobra.Command, args []string) error {
-	var err error
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	root = findModuleRoot(wd)
+	if root == "" {
+		return fmt.Errorf("%s is not in a go module", wd)
+	}
+	if header, err = filepath.Abs(header); err != nil {
+		return err
+	}
 
-	// get the location the generators are installed
-	bin = os.Getenv("GOBIN")
-	if bin == "" {
-		bin = filepath.Join(os.Getenv("GOPATH"), "bin")
+	gen := map[string]bool{}
+	for _, g := range generators {
+		gen[g] = true
 	}
-	// install the generators
-	if install {
-		for _, gen := range generators {
-			// nolint:gosec
-			err := run(exec.Command("go", "install", path.Join("k8s.io/code-generator/cmd", gen)))
-			if err != nil {
-				return err
-			}
+	// run the generators in dependency order, e.g. the clientset references the apply configurations
+	for _, g := range generatorOrder {
+		if !gen[g] {
+			continue
+		}
+		fmt.Println("running", g)
+		if err := generatorFuncs[g](); err != nil {
+			return fmt.Errorf("%s: %w", g, err)
 		}
 	}
+	return nil
+}
 
-	// setup the directory to generate the code to.
-	// code generators don't work with go modules, and try the full path of the module
-	output, err = os.MkdirTemp("", "gen")
-	if err != nil {
-		return err
-	}
-	if clean {
-		// nolint:errcheck
-		defer os.RemoveAll(output)
+// generatorOrder lists the generators in the order they run.
+var generatorOrder = []string{
+	"resource-gen", "deepcopy-gen", "openapi-gen", "applyconfiguration-gen", "client-gen", "lister-gen", "informer-gen",
+}
+
+var generatorFuncs = map[string]func() error{
+	"resource-gen":           genResources,
+	"deepcopy-gen":           genDeepCopy,
+	"openapi-gen":            genOpenAPI,
+	"applyconfiguration-gen": genApplyConfigurations,
+	"client-gen":             genClient,
+	"lister-gen":             genListers,
+	"informer-gen":           genInformers,
+}
+
+func generatorNames() []string {
+	names := make([]string, 0, len(generatorFuncs))
+	for name := range generatorFuncs {
+		names = append(names, name)
 	}
-	d, l := path.Split(module)                   // split the directory from the link we will create
-	p := filepath.Join(strings.Split(d, "/")...) // convert module path to os filepath
-	p = filepath.Join(output, p)                 // create the directory which will contain the link
-	err = os.MkdirAll(p, 0700)
+	sort.Strings(names)
+	return names
+}
+
+// outputDir returns the directory of the generated package pkg, relative to the module root, and its import path.
+func outputDir(pkg string) (string, string) {
+	return filepath.Join(root, filepath.FromSlash(pkg)), path.Join(module, pkg)
+}
+
+// execute runs the generator returning the targets of getTargets over the packages.
+func execute(nameSystems namer.NameSystems, defaultSystem string, getTargets func(*generator.Context) []generator.Target,
+	packages []string) error {
+	return gengo.Execute(nameSystems, defaultSystem, getTargets, gengo.StdBuildTag, packages)
+}
+
+func genResources() error {
+	boilerplate, err := gengo.GoBoilerplate(header, gengo.StdBuildTag, gengo.StdGeneratedBy)
 	if err != nil {
 		return err
 	}
-	// link the tmp location to this one so the code generator writes to the correct path
-	wd, err := os.Getwd()
-	if err != nil {
+	return execute(resourcegenerators.NameSystems(), resourcegenerators.DefaultNameSystem(),
+		func(c *generator.Context) []generator.Target {
+			return resourcegenerators.GetTargets(c, boilerplate)
+		}, versions)
+}
+
+func genDeepCopy() error {
+	args := deepcopyargs.New()
+	args.OutputFile = "zz_generated.deepcopy.go"
+	args.BoundingDirs = []string{path.Join(module, "pkg/apis")}
+	args.GoHeaderFile = header
+	if err := args.Validate(); err != nil {
 		return err
 	}
-	err = os.Symlink(wd, filepath.Join(p, l))
-	if err != nil {
+	return execute(deepcopygenerators.NameSystems(), deepcopygenerators.DefaultNameSystem(),
+		func(c *generator.Context) []generator.Target {
+			return deepcopygenerators.GetTargets(c, args)
+		}, versions)
+}
+
+func genOpenAPI() error {
+	args := openapiargs.New()
+	args.OutputDir, args.OutputPkg = outputDir("pkg/generated/openapi")
+	args.OutputFile = "zz_generated.openapi.go"
+	args.GoHeaderFile = header
+	args.ReportFilename = reportFilename
+	if err := args.Validate(); err != nil {
 		return err
 	}
-
-	return doGen()
+	packages := append([]string{
+		// the Scale of the scale subresources
+		"k8s.io/api/autoscaling/v1",
+		"k8s.io/apimachinery/pkg/api/resource",
+		"k8s.io/apimachinery/pkg/apis/meta/v1",
+		"k8s.io/apimachinery/pkg/runtime",
+		"k8s.io/apimachinery/pkg/version",
+	}, versions...)
+	return execute(openapigenerators.NameSystems(), openapigenerators.DefaultNameSystem(),
+		func(c *generator.Context) []generator.Target {
+			return openapigenerators.GetTargets(c, args)
+		}, packages)
 }
 
-func doGen() error {
-	inputs := strings.Join(versions, ",")
-
-	gen := map[string]bool{}
-	for _, g := range generators {
-		gen[g] = true
+func genApplyConfigurations() error {
+	args := applyconfigurationargs.New()
+	args.OutputDir, args.OutputPkg = outputDir("pkg/generated/applyconfiguration")
+	args.GoHeaderFile = header
+	if err := args.Validate(); err != nil {
+		return err
 	}
+	return execute(applyconfigurationgenerators.NameSystems(), applyconfigurationgenerators.DefaultNameSystem(),
+		func(c *generator.Context) []generator.Target {
+			return applyconfigurationgenerators.GetTargets(c, args)
+		}, versions)
+}
 
-	if gen["deepcopy-gen"] {
-		err := run(getCmd("deepcopy-gen",
-			"--input-dirs", inputs,
-			"-O", "zz_generated.deepcopy",
-			"--bounding-dirs", path.Join(module, "pkg/apis")))
-		if err != nil {
-			return err
-		}
+func genClient() error {
+	args := clientargs.New()
+	args.OutputDir, args.OutputPkg = outputDir("pkg/generated/clientset")
+	args.GoHeaderFile = header
+	args.ClientsetName = "versioned"
+	args.Groups = groupVersions(versions)
+	// the Apply functions reference the apply configurations, once generated
+	if _, err := os.Stat(filepath.Join(root, "pkg", "generated", "applyconfiguration")); err == nil {
+		_, args.ApplyConfigurationPackage = outputDir("pkg/generated/applyconfiguration")
 	}
-
-	if gen["openapi-gen"] {
-		err := run(getCmd("openapi-gen",
-			"--input-dirs", "k8s.io/apimachinery/pkg/api/resource,"+
-				"k8s.io/apimachinery/pkg/apis/meta/v1,"+
-				"k8s.io/apimachinery/pkg/runtime,"+
-				"k8s.io/apimachinery/pkg/version,"+
-				inputs,
-			"-O", "zz_generated.openapi",
-			"--output-package", path.Join(module, "pkg/generated/openapi")))
-		if err != nil {
-			return err
+	if err := args.Validate(); err != nil {
+		return err
+	}
+	var packages []string
+	for _, gv := range args.Groups {
+		for _, v := range gv.Versions {
+			packages = append(packages, v.Package)
 		}
 	}
+	return execute(clientgenerators.NameSystems(util.PluralExceptionListToMapOrDie(args.PluralExceptions)),
+		clientgenerators.DefaultNameSystem(),
+		func(c *generator.Context) []generator.Target {
+			return clientgenerators.GetTargets(c, args)
+		}, packages)
+}
 
-	//gopath := filepath.Join(os.Getenv("GOPATH"), "src")
-	//if gen["go-to-protobuf"] {
-	//	err := run(getCmd("go-to-protobuf",
-	//		fmt.Sprintf("--proto-import=%s/kubernetes/kubernetes/third_party/protobuf", gopath),
-	//		"--packages", inputs))
-	//	if err != nil {
-	//		return err
-	//	}
-	//}
-
-	if gen["client-gen"] {
-		inputBase := ""
-		versionsInputs := inputs
-		// e.g. base = "example.io/foo/api", strippedVersions = "v1,v1beta1"
-		// e.g. base = "example.io/foo/pkg/apis", strippedVersions = "test/v1,test/v1beta1"
-		if base, strippedVersions, ok := findInputBase(module, versions); ok {
-			inputBase = base
-			versionsInputs = strings.Join(strippedVersions, ",")
-		}
-		err := run(getCmd("client-gen",
-			"--clientset-name", "versioned", "--input-base", inputBase,
-			"--input", versionsInputs, "--output-package", path.Join(module, "pkg/generated/clientset")))
-		if err != nil {
-			return err
-		}
+func genListers() error {
+	args := listerargs.New()
+	args.OutputDir, args.OutputPkg = outputDir("pkg/generated/listers")
+	args.GoHeaderFile = header
+	if err := args.Validate(); err != nil {
+		return err
 	}
+	return execute(listergenerators.NameSystems(util.PluralExceptionListToMapOrDie(args.PluralExceptions)),
+		listergenerators.DefaultNameSystem(),
+		func(c *generator.Context) []generator.Target {
+			return listergenerators.GetTargets(c, args)
+		}, versions)
+}
 
-	if gen["lister-gen"] {
-		err := run(getCmd("lister-gen",
-			"--input-dirs", inputs, "--output-package", path.Join(module, "pkg/generated/listers")))
-		if err != nil {
-			return err
-		}
+func genInformers() error {
+	args := informerargs.New()
+	args.OutputDir, args.OutputPkg = outputDir("pkg/generated/informers")
+	args.GoHeaderFile = header
+	_, args.VersionedClientSetPackage = outputDir("pkg/generated/clientset/versioned")
+	_, args.ListersPackage = outputDir("pkg/generated/listers")
+	if err := args.Validate(); err != nil {
+		return err
 	}
+	return execute(informergenerators.NameSystems(util.PluralExceptionListToMapOrDie(args.PluralExceptions)),
+		informergenerators.DefaultNameSystem(),
+		func(c *generator.Context) []generator.Target {
+			return informergenerators.GetTargets(c, args)
+		}, versions)
+}
 
-	if gen["informer-gen"] {
-		err := run(getCmd("informer-gen",
-			"--input-dirs", inputs,
-			"--versioned-clientset-package", path.Join(module, "pkg/generated/clientset/versioned"),
-			"--listers-package", path.Join(module, "pkg/generated/listers"),
-			"--output-package", path.Join(module, "pkg/generated/informers")))
-		if err != nil {
-			return err
+// groupVersions returns the groups of the version packages for client-gen, e.g. the group sample with the version
+// v1alpha1 for example.io/foo/pkg/apis/sample/v1alpha1.
+func groupVersions(versions []string) []clienttypes.GroupVersions {
+	groups := map[string]*clienttypes.GroupVersions{}
+	for _, v := range versions {
+		group, version := path.Base(path.Dir(v)), path.Base(v)
+		if groups[group] == nil {
+			groups[group] = &clienttypes.GroupVersions{
+				PackageName: group,
+				Group:       clienttypes.Group(group),
+			}
 		}
+		groups[group].Versions = append(groups[group].Versions, clienttypes.PackageVersion{
+			Version: clienttypes.Version(version),
+			Package: v,
+		})
 	}
-
-	return nil
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	gvs := make([]clienttypes.GroupVersions, 0, len(names))
+	for _, name := range names {
+		gvs = append(gvs, *groups[name])
+	}
+	return gvs
 }
 
 var (
 	generators     []string
 	header         string
 	module         string
+	root           string
 	versions       []string
-	clean, install bool
+	reportFilename string
 )
 
 func main() {
-	cmd.Flags().BoolVar(&clean, "clean", true, "Delete temporary directory for code generation.")
-
-	options := []string{"client-gen", "deepcopy-gen", "informer-gen", "lister-gen", "openapi-gen", "go-to-protobuf"}
-	defaultGen := []string{"deepcopy-gen", "openapi-gen"}
+	defaultGen := []string{"resource-gen", "deepcopy-gen", "openapi-gen"}
 	cmd.Flags().StringSliceVarP(&generators, "generator", "g",
-		defaultGen, fmt.Sprintf("Code generator to install and run.  Options: %v.", options))
+		defaultGen, fmt.Sprintf("Code generator to run.  Options: %v.", generatorNames()))
 	defaultBoilerplate := filepath.Join("hack", "boilerplate.go.txt")
 	cmd.Flags().StringVar(&header, "go-header-file", defaultBoilerplate,
 		"File containing boilerplate header text. The string YEAR will be replaced with the current 4-digit year.")
-	cmd.Flags().BoolVar(&install, "install-generators", false, "Go get the generators")
+	cmd.Flags().StringVar(&reportFilename, "api-rule-violations-report", "-",
+		"File openapi-gen reports the API rule violations to, \"-\" for the standard output.")
 
 	var defaultModule string
 	cwd, _ := os.Getwd()
@@ -207,7 +313,7 @@ func main() {
 						if !match {
 							continue
 						}
-						defaultVersions = append(defaultVersions, path.Join(module, "pkg", "apis", f.Name(), v.Name()))
+						defaultVersions = append(defaultVersions, path.Join(defaultModule, "pkg", "apis", f.Name(), v.Name()))
 					}
 				}
 			}
@@ -225,23 +331,6 @@ func main() {
 
 var versionRegexp = regexp.MustCompile("^v[0-9]+((alpha|beta)?[0-9]+)?$")
 
-func run(cmd *exec.Cmd) error {
-	cmd.Env = os.Environ()
-	fmt.Println(strings.Join(cmd.Args, " "))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
-}
-
-func getCmd(cmd string, args ...string) *exec.Cmd {
-	// nolint:gosec
-	e := exec.Command(filepath.Join(bin, cmd), "--output-base", output, "--go-header-file", header)
-
-	e.Args = append(e.Args, args...)
-	return e
-}
-
 func findModuleRoot(dir string) string {
 	for {
 		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
@@ -256,32 +345,3 @@ func findModuleRoot(dir string) string {
 	}
 	return ""
 }
-
-func findInputBase(module string, versions []string) (string, []string, bool) {
-	if allHasPrefix(filepath.Join(module, "api"), versions) {
-		base := filepath.Join(module, "api")
-		return base, allTrimPrefix(base+"/", versions), true
-	}
-	if allHasPrefix(filepath.Join(module, "pkg", "apis"), versions) {
-		base := filepath.Join(module, "pkg", "apis")
-		return base, allTrimPrefix(base+"/", versions), true
-	}
-	return "", nil, false
-}
-
-func allHasPrefix(prefix string, paths []string) bool {
-	for _, p := range paths {
-		if !strings.HasPrefix(p, prefix) {
-			return false
-		}
-	}
-	return true
-}
-
-func allTrimPrefix(prefix string, versions []string) []string {
-	vs := make([]string, 0)
-	for _, v := range versions {
-		vs = append(vs, strings.TrimPrefix(v, prefix))
-	}
-	return vs
-}
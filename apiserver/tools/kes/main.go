@@ -0,0 +1,122 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Command kes scaffolds the modules of apiservers built with kes.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/modfile"
+
+	"github.com/vine-io/kes/apiserver/tools/kes/scaffold"
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "kes",
+	Short: "scaffold apiservers built with kes",
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "create the module of a new apiserver",
+	Long: `Creates the module of a new apiserver in the current directory: the main package, the server options, the
+package of the API group version, the header of the Go files and a Makefile generating code with
+apiserver-runtime-gen.  Then add a kind with kes create api and run:
+
+  go mod tidy -e && make generate && go mod tidy`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if initOptions.module == "" {
+			b, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+			if err != nil {
+				return fmt.Errorf("must specify module: %w", err)
+			}
+			initOptions.module = modfile.ModulePath(b)
+		}
+		p := &scaffold.Project{Dir: dir, Module: initOptions.module, Domain: initOptions.domain}
+		return p.Init(initOptions.group, initOptions.version)
+	},
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create",
+	Short: "add to the apiserver of the current directory",
+}
+
+var createAPICmd = &cobra.Command{
+	Use:   "api",
+	Short: "add a kind to an API group version",
+	Long: `Adds a kind to an API group version of the apiserver in the current directory, with the stubs of its strategy
+and a test.  The group version is created if it doesn't exist yet, and served by the server options.  Run
+make generate to register the kind.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		p, err := scaffold.LoadProject(dir)
+		if err != nil {
+			return fmt.Errorf("%s is not a kes project, run kes init: %w", dir, err)
+		}
+		return p.CreateAPI(createOptions)
+	},
+}
+
+var (
+	initOptions struct {
+		module  string
+		domain  string
+		group   string
+		version string
+	}
+	createOptions scaffold.API
+)
+
+func main() {
+	initCmd.Flags().StringVar(&initOptions.module, "module", "", "Go module of the apiserver, by default the module of the go.mod.")
+	initCmd.Flags().StringVar(&initOptions.domain, "domain", "example.com", "Suffix of the API groups.")
+	initCmd.Flags().StringVar(&initOptions.group, "group", "", "API group, without the domain.")
+	initCmd.Flags().StringVar(&initOptions.version, "version", "v1alpha1", "Version of the API group.")
+	_ = initCmd.MarkFlagRequired("group")
+
+	createAPICmd.Flags().StringVar(&createOptions.Group, "group", "", "API group, without the domain.")
+	createAPICmd.Flags().StringVar(&createOptions.Version, "version", "v1alpha1", "Version of the API group.")
+	createAPICmd.Flags().StringVar(&createOptions.Kind, "kind", "", "Kind of the objects, in UpperCamelCase.")
+	createAPICmd.Flags().BoolVar(&createOptions.Namespaced, "namespaced", true, "Whether the objects are namespaced.")
+	_ = createAPICmd.MarkFlagRequired("group")
+	_ = createAPICmd.MarkFlagRequired("kind")
+
+	createCmd.AddCommand(createAPICmd)
+	rootCmd.AddCommand(initCmd, createCmd)
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,299 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package scaffold creates apiservers built with kes: the module of a new apiserver, and the API kinds served
+// by it.
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/gengo/v2/namer"
+	"k8s.io/gengo/v2/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ProjectFile is the file recording the Project in the root directory of the module.
+	ProjectFile = "PROJECT"
+	// BoilerplateFile is the header of the Go files of the module, relative to the root directory.
+	BoilerplateFile = "hack/boilerplate.go.txt"
+	// OptionsFile is the file declaring the server options, relative to the root directory.
+	OptionsFile = "pkg/server/options.go"
+
+	// importsMarker and resourcesMarker mark where the API group versions are added to the OptionsFile.
+	importsMarker   = "// +kes:scaffold:imports"
+	resourcesMarker = "// +kes:scaffold:resources"
+)
+
+var (
+	versionRegexp = regexp.MustCompile("^v[0-9]+((alpha|beta)[0-9]+)?$")
+	kindRegexp    = regexp.MustCompile("^[A-Z][A-Za-z0-9]*$")
+)
+
+// Project is the module of an apiserver built with kes.
+type Project struct {
+	// Dir is the root directory of the module.
+	Dir string `json:"-"`
+	// Module is the path of the Go module.
+	Module string `json:"module"`
+	// Domain is the suffix of the API groups, e.g. example.com for the group ships.example.com.
+	Domain string `json:"domain"`
+}
+
+// API is a kind served by the apiserver.
+type API struct {
+	// Group is the API group without the domain of the project, e.g. ships.
+	Group string
+	// Version is the version of the API group, e.g. v1alpha1.
+	Version string
+	// Kind is the kind of the objects, e.g. Frigate.
+	Kind string
+	// Namespaced is true if the objects are namespaced.
+	Namespaced bool
+}
+
+// LoadProject reads the Project of the module in dir.
+func LoadProject(dir string) (*Project, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ProjectFile))
+	if err != nil {
+		return nil, err
+	}
+	p := &Project{}
+	if err := yaml.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ProjectFile, err)
+	}
+	p.Dir = dir
+	return p, nil
+}
+
+// Init creates the module of a new apiserver in the directory of the project: the main package, the server
+// options, the package of the API group version, the header of the Go files and a Makefile generating code with
+// apiserver-runtime-gen.  Existing files are never overwritten.  The package of the API group version builds once
+// a kind is added with CreateAPI and the code is generated.
+func (p *Project) Init(group, version string) error {
+	if p.Module == "" {
+		return fmt.Errorf("the module is required")
+	}
+	if errs := validation.IsDNS1123Subdomain(p.Domain); len(errs) != 0 {
+		return fmt.Errorf("invalid domain %q: %s", p.Domain, strings.Join(errs, ", "))
+	}
+	if err := validateGroupVersion(group, version); err != nil {
+		return err
+	}
+
+	b, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := p.writeFile(ProjectFile, b); err != nil {
+		return err
+	}
+	if err := p.writeFile(BoilerplateFile, []byte(strings.ReplaceAll(boilerplate, "NAME", path.Base(p.Module)))); err != nil {
+		return err
+	}
+	header, err := p.header()
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"Module":          p.Module,
+		"Header":          header,
+		"ImportsMarker":   importsMarker,
+		"ResourcesMarker": resourcesMarker,
+	}
+	for _, f := range []struct {
+		name string
+		tmpl *template.Template
+	}{
+		{"go.mod", goModTemplate},
+		{"Makefile", makefileTemplate},
+		{"tools/tools.go", toolsTemplate},
+		{"main.go", mainTemplate},
+		{OptionsFile, optionsTemplate},
+	} {
+		if _, err := os.Stat(filepath.Join(p.Dir, f.name)); err == nil && f.name == "go.mod" {
+			// keep the module created by go mod init
+			continue
+		}
+		if err := p.execute(f.name, f.tmpl, data); err != nil {
+			return err
+		}
+	}
+	return p.createGroupVersion(group, version)
+}
+
+// CreateAPI adds the kind to the API group version, with the stubs of its strategy and a test.  The group
+// version is created if it doesn't exist yet, and served by the server options.  The kind is registered with the
+// resources of the group version by apiserver-runtime-gen.
+func (p *Project) CreateAPI(api API) error {
+	if err := validateGroupVersion(api.Group, api.Version); err != nil {
+		return err
+	}
+	if !kindRegexp.MatchString(api.Kind) {
+		return fmt.Errorf("invalid kind %q, must be in UpperCamelCase", api.Kind)
+	}
+
+	if _, err := os.Stat(filepath.Join(p.Dir, p.versionDir(api.Group, api.Version))); os.IsNotExist(err) {
+		if err := p.createGroupVersion(api.Group, api.Version); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	header, err := p.header()
+	if err != nil {
+		return err
+	}
+	plural := namer.NewAllLowercasePluralNamer(nil).Name(&types.Type{Name: types.Name{Name: api.Kind}})
+	scope := "Cluster"
+	if api.Namespaced {
+		scope = "Namespaced"
+	}
+	data := map[string]interface{}{
+		"Header":     header,
+		"Version":    api.Version,
+		"Kind":       api.Kind,
+		"Plural":     plural,
+		"Scope":      scope,
+		"Namespaced": api.Namespaced,
+		"Receiver":   strings.ToLower(api.Kind[:1]),
+	}
+	dir := p.versionDir(api.Group, api.Version)
+	if err := p.execute(path.Join(dir, plural+".go"), typesTemplate, data); err != nil {
+		return err
+	}
+	if err := p.execute(path.Join(dir, plural+"_test.go"), typesTestTemplate, data); err != nil {
+		return err
+	}
+	return p.serveGroupVersion(api.Group, api.Version)
+}
+
+// createGroupVersion creates the package of the API group version.
+func (p *Project) createGroupVersion(group, version string) error {
+	header, err := p.header()
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"Header":  header,
+		"Group":   group + "." + p.Domain,
+		"Version": version,
+	}
+	dir := p.versionDir(group, version)
+	if err := p.execute(path.Join(dir, "doc.go"), docTemplate, data); err != nil {
+		return err
+	}
+	return p.execute(path.Join(dir, "register.go"), registerTemplate, data)
+}
+
+// serveGroupVersion adds the resources of the API group version to the server options, unless they are already
+// added.  The ResourceBuilder is only generated for packages with resources, so the group version is served
+// from its first kind.
+func (p *Project) serveGroupVersion(group, version string) error {
+	options := filepath.Join(p.Dir, filepath.FromSlash(OptionsFile))
+	b, err := os.ReadFile(options)
+	if err != nil {
+		return err
+	}
+	pkg, alias := path.Join(p.Module, p.versionDir(group, version)), strings.ReplaceAll(group, "-", "")+version
+	src := string(b)
+	if strings.Contains(src, strconv.Quote(pkg)) {
+		return nil
+	}
+	if !strings.Contains(src, importsMarker) || !strings.Contains(src, resourcesMarker) {
+		return fmt.Errorf("%s must contain the %q and %q markers", OptionsFile, importsMarker, resourcesMarker)
+	}
+	src = strings.Replace(src, importsMarker, fmt.Sprintf("%s %q\n%s", alias, pkg, importsMarker), 1)
+	src = strings.Replace(src, resourcesMarker,
+		fmt.Sprintf("o.Resources = append(o.Resources, %s.ResourceBuilder...)\n%s", alias, resourcesMarker), 1)
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return fmt.Errorf("%s: %w", OptionsFile, err)
+	}
+	return os.WriteFile(options, formatted, 0644)
+}
+
+// versionDir returns the directory of the package of the API group version, relative to the root directory.
+func (p *Project) versionDir(group, version string) string {
+	return path.Join("pkg", "apis", group, version)
+}
+
+// header returns the header of the Go files, the BoilerplateFile for the current year.
+func (p *Project) header() (string, error) {
+	b, err := os.ReadFile(filepath.Join(p.Dir, filepath.FromSlash(BoilerplateFile)))
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(string(b), "YEAR", strconv.Itoa(time.Now().Year())), nil
+}
+
+// execute writes the file name, relative to the root directory, from the template.  Go files are formatted.
+func (p *Project) execute(name string, tmpl *template.Template, data interface{}) error {
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	b := buf.Bytes()
+	if strings.HasSuffix(name, ".go") {
+		formatted, err := format.Source(b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		b = formatted
+	}
+	return p.writeFile(name, b)
+}
+
+// writeFile writes the file name, relative to the root directory, unless it exists.
+func (p *Project) writeFile(name string, b []byte) error {
+	file := filepath.Join(p.Dir, filepath.FromSlash(name))
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("%s already exists", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0644)
+}
+
+func validateGroupVersion(group, version string) error {
+	if errs := validation.IsDNS1123Label(group); len(errs) != 0 {
+		return fmt.Errorf("invalid group %q: %s", group, strings.Join(errs, ", "))
+	}
+	if !versionRegexp.MatchString(version) {
+		return fmt.Errorf("invalid version %q, must be like v1, v1alpha1 or v2beta1", version)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readFile(t *testing.T, dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestInit(t *testing.T) {
+	t.Run("creates the module", func(t *testing.T) {
+		dir := t.TempDir()
+		p := &Project{Dir: dir, Module: "example.com/ships", Domain: "example.com"}
+		assert.NoError(t, p.Init("ships", "v1alpha1"))
+
+		for _, name := range []string{
+			"go.mod", "Makefile", "tools/tools.go", "main.go", OptionsFile, BoilerplateFile,
+			"pkg/apis/ships/v1alpha1/doc.go", "pkg/apis/ships/v1alpha1/register.go",
+		} {
+			assert.FileExists(t, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+		assert.Contains(t, readFile(t, dir, "go.mod"), "module example.com/ships")
+		assert.Contains(t, readFile(t, dir, "Makefile"), "apiserver-runtime-gen")
+		assert.Contains(t, readFile(t, dir, BoilerplateFile), "The ships Authors")
+		assert.Contains(t, readFile(t, dir, "pkg/apis/ships/v1alpha1/doc.go"), "+groupName=ships.example.com")
+		assert.NotContains(t, readFile(t, dir, "main.go"), "YEAR")
+
+		loaded, err := LoadProject(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, p, loaded)
+	})
+
+	t.Run("keeps the go.mod", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/ships\n\ngo 1.22\n"), 0644))
+		p := &Project{Dir: dir, Module: "example.com/ships", Domain: "example.com"}
+		assert.NoError(t, p.Init("ships", "v1alpha1"))
+		assert.Contains(t, readFile(t, dir, "go.mod"), "go 1.22")
+	})
+
+	t.Run("never overwrites", func(t *testing.T) {
+		dir := t.TempDir()
+		p := &Project{Dir: dir, Module: "example.com/ships", Domain: "example.com"}
+		assert.NoError(t, p.Init("ships", "v1alpha1"))
+		assert.ErrorContains(t, p.Init("ships", "v1alpha1"), "PROJECT already exists")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		p := &Project{Dir: t.TempDir(), Domain: "example.com"}
+		assert.ErrorContains(t, p.Init("ships", "v1alpha1"), "module is required")
+
+		p.Module = "example.com/ships"
+		assert.ErrorContains(t, p.Init("Ships", "v1alpha1"), "invalid group")
+		assert.ErrorContains(t, p.Init("ships", "alpha1"), "invalid version")
+
+		p.Domain = "example_com"
+		assert.ErrorContains(t, p.Init("ships", "v1alpha1"), "invalid domain")
+	})
+}
+
+func TestCreateAPI(t *testing.T) {
+	dir := t.TempDir()
+	p := &Project{Dir: dir, Module: "example.com/ships", Domain: "example.com"}
+	assert.NoError(t, p.Init("ships", "v1alpha1"))
+
+	t.Run("namespaced", func(t *testing.T) {
+		assert.NoError(t, p.CreateAPI(API{Group: "ships", Version: "v1alpha1", Kind: "Frigate", Namespaced: true}))
+
+		types := readFile(t, dir, "pkg/apis/ships/v1alpha1/frigates.go")
+		assert.Contains(t, types, "+kes:resource:path=frigates,scope=Namespaced,storage")
+		assert.Contains(t, types, "+kes:subresource:status")
+		assert.NotContains(t, types, "+genclient:nonNamespaced")
+		assert.Contains(t, types, "func (f *Frigate) Validate(")
+		assert.Contains(t, types, "type FrigateList struct")
+		assert.Contains(t, readFile(t, dir, "pkg/apis/ships/v1alpha1/frigates_test.go"), "func TestFrigate(")
+
+		options := readFile(t, dir, OptionsFile)
+		assert.Contains(t, options, `shipsv1alpha1 "example.com/ships/pkg/apis/ships/v1alpha1"`)
+		assert.Contains(t, options, "o.Resources = append(o.Resources, shipsv1alpha1.ResourceBuilder...)")
+	})
+
+	t.Run("cluster scoped", func(t *testing.T) {
+		assert.NoError(t, p.CreateAPI(API{Group: "ships", Version: "v1alpha1", Kind: "Harbor"}))
+
+		types := readFile(t, dir, "pkg/apis/ships/v1alpha1/harbors.go")
+		assert.Contains(t, types, "+genclient:nonNamespaced")
+		assert.Contains(t, types, "+kes:resource:path=harbors,scope=Cluster,storage")
+
+		// the group version is only served once
+		assert.Equal(t, 1, strings.Count(readFile(t, dir, OptionsFile), "shipsv1alpha1.ResourceBuilder"))
+	})
+
+	t.Run("new group version", func(t *testing.T) {
+		assert.NoError(t, p.CreateAPI(API{Group: "docks", Version: "v1", Kind: "Crane", Namespaced: true}))
+
+		assert.FileExists(t, filepath.Join(dir, "pkg", "apis", "docks", "v1", "register.go"))
+		assert.Contains(t, readFile(t, dir, "pkg/apis/docks/v1/doc.go"), "+groupName=docks.example.com")
+		options := readFile(t, dir, OptionsFile)
+		assert.Contains(t, options, `docksv1 "example.com/ships/pkg/apis/docks/v1"`)
+		assert.Contains(t, options, "o.Resources = append(o.Resources, docksv1.ResourceBuilder...)")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.ErrorContains(t, p.CreateAPI(API{Group: "ships", Version: "v1alpha1", Kind: "Frigate"}),
+			"frigates.go already exists")
+		assert.ErrorContains(t, p.CreateAPI(API{Group: "ships", Version: "v1alpha1", Kind: "frigate"}),
+			"invalid kind")
+		assert.ErrorContains(t, p.CreateAPI(API{Group: "ships", Version: "1", Kind: "Frigate"}),
+			"invalid version")
+	})
+}
@@ -0,0 +1,270 @@
+/*
+   Copyright 2024 The kes Authors
+
+   This program is offered under a commercial and under the AGPL license.
+   For AGPL licensing, see below.
+
+   AGPL licensing:
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package scaffold
+
+import (
+	"text/template"
+)
+
+// boilerplate is the header of the Go files, NAME is replaced by the name of the module.  apiserver-runtime-gen
+// replaces YEAR by the current year, as the scaffolding does.
+const boilerplate = `/*
+Copyright YEAR The NAME Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+`
+
+var goModTemplate = template.Must(template.New("go.mod").Parse(`module {{.Module}}
+
+go 1.23.0
+`))
+
+var makefileTemplate = template.Must(template.New("Makefile").Parse(`all: build
+
+# Generates the resource boilerplate, deep copies, OpenAPI definitions and clients of the API types.
+generate:
+	go run github.com/vine-io/kes/apiserver/tools/apiserver-runtime-gen \
+		-g resource-gen \
+		-g deepcopy-gen \
+		-g openapi-gen \
+		-g applyconfiguration-gen \
+		-g client-gen \
+		-g lister-gen \
+		-g informer-gen
+
+build: generate
+	go build -o bin/apiserver .
+
+test: generate
+	go test ./...
+
+# Runs the apiserver with an embedded etcd, storing the data under _output.
+run: build
+	./bin/apiserver --secure-port 6443 --etcd-servers=http://127.0.0.1:2379
+
+.PHONY: all generate build test run
+`))
+
+var toolsTemplate = template.Must(template.New("tools.go").Parse(`//go:build tools
+
+{{.Header}}
+// Package tools imports the code generators run by the Makefile, so that go mod tidy keeps their dependencies.
+package tools
+
+import (
+	_ "github.com/vine-io/kes/apiserver/tools/apiserver-runtime-gen"
+)
+`))
+
+var mainTemplate = template.Must(template.New("main.go").Parse(`{{.Header}}
+package main
+
+import (
+	"os"
+
+	kesserver "github.com/vine-io/kes/apiserver/pkg/server"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/component-base/cli"
+	"k8s.io/component-base/logs"
+
+	"{{.Module}}/pkg/server"
+)
+
+func main() {
+	logs.InitLogs()
+	defer logs.FlushLogs()
+
+	stopCh := genericapiserver.SetupSignalHandler()
+	options := server.NewServerOptions(os.Stdout, os.Stderr)
+	cmd := kesserver.NewCommandStartWardleServer(options, stopCh)
+	code := cli.Run(cmd)
+	os.Exit(code)
+}
+`))
+
+var optionsTemplate = template.Must(template.New("options.go").Parse(`{{.Header}}
+package server
+
+import (
+	"io"
+
+	kesserver "github.com/vine-io/kes/apiserver/pkg/server"
+	"github.com/vine-io/kes/apiserver/pkg/server/resource"
+
+	"{{.Module}}/pkg/generated/openapi"
+	{{.ImportsMarker}}
+)
+
+// NewServerOptions returns the options of the apiserver serving the resources of the API group versions.
+func NewServerOptions(out, errOut io.Writer) *kesserver.WardleServerOptions {
+	o := kesserver.NewWardleServerOptions(out, errOut)
+	o.Resources = []resource.Object{}
+	{{.ResourcesMarker}}
+	o.OpenAPIDefinitions = openapi.GetOpenAPIDefinitions
+	return o
+}
+`))
+
+var docTemplate = template.Must(template.New("doc.go").Parse(`{{.Header}}
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=package
+// +groupName={{.Group}}
+
+// Package {{.Version}} is the {{.Version}} version of the {{.Group}} API group.
+package {{.Version}}
+`))
+
+var registerTemplate = template.Must(template.New("register.go").Parse(`{{.Header}}
+package {{.Version}}
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	// SchemeGroupVersion contains the API group and version information for the types in this package.
+	SchemeGroupVersion = schema.GroupVersion{Group: "{{.Group}}", Version: "{{.Version}}"}
+	// SchemeBuilder points to a list of functions added to Scheme.
+	SchemeBuilder      = runtime.NewSchemeBuilder(addKnownTypes)
+	localSchemeBuilder = &SchemeBuilder
+	// AddToScheme applies all the stored functions to the scheme.
+	AddToScheme = localSchemeBuilder.AddToScheme
+)
+
+// Resource takes an unqualified resource and returns a Group qualified GroupResource
+func Resource(resource string) schema.GroupResource {
+	return SchemeGroupVersion.WithResource(resource).GroupResource()
+}
+
+// Adds the list of known types to scheme, the resources registered with the ResourceBuilder.
+func addKnownTypes(scheme *runtime.Scheme) error {
+	for _, obj := range ResourceBuilder {
+		scheme.AddKnownTypes(SchemeGroupVersion, obj.New(), obj.NewList())
+	}
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
+`))
+
+var typesTemplate = template.Must(template.New("types.go").Parse(`{{.Header}}
+package {{.Version}}
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/vine-io/kes/apiserver/pkg/server/resource/resourcestrategy"
+)
+
+var _ resourcestrategy.Defaulter = &{{.Kind}}{}
+var _ resourcestrategy.Validater = &{{.Kind}}{}
+var _ resourcestrategy.ValidateUpdater = &{{.Kind}}{}
+
+// {{.Kind}}Spec is the specification of a {{.Kind}}.
+type {{.Kind}}Spec struct {
+}
+
+// {{.Kind}}Status is the status of a {{.Kind}}.
+type {{.Kind}}Status struct {
+}
+
+// +genclient
+{{- if not .Namespaced}}
+// +genclient:nonNamespaced
+{{- end}}
+// +kes:resource:path={{.Plural}},scope={{.Scope}},storage
+// +kes:subresource:status
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// {{.Kind}} defines the schema for the "{{.Plural}}" resource.
+type {{.Kind}} struct {
+	metav1.TypeMeta   ` + "`" + `json:",inline"` + "`" + `
+	metav1.ObjectMeta ` + "`" + `json:"metadata,omitempty"` + "`" + `
+
+	Spec   {{.Kind}}Spec   ` + "`" + `json:"spec,omitempty"` + "`" + `
+	Status {{.Kind}}Status ` + "`" + `json:"status,omitempty"` + "`" + `
+}
+
+// Default implements resourcestrategy.Defaulter
+func ({{.Receiver}} *{{.Kind}}) Default() {
+}
+
+// Validate implements resourcestrategy.Validater
+func ({{.Receiver}} *{{.Kind}}) Validate(_ context.Context) field.ErrorList {
+	allErrs := field.ErrorList{}
+	return allErrs
+}
+
+// ValidateUpdate implements resourcestrategy.ValidateUpdater
+func ({{.Receiver}} *{{.Kind}}) ValidateUpdate(ctx context.Context, _ runtime.Object) field.ErrorList {
+	return {{.Receiver}}.Validate(ctx)
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// {{.Kind}}List is a list of {{.Kind}} objects.
+type {{.Kind}}List struct {
+	metav1.TypeMeta ` + "`" + `json:",inline"` + "`" + `
+	metav1.ListMeta ` + "`" + `json:"metadata,omitempty"` + "`" + `
+
+	Items []{{.Kind}} ` + "`" + `json:"items"` + "`" + `
+}
+`))
+
+var typesTestTemplate = template.Must(template.New("types_test.go").Parse(`package {{.Version}}
+
+import (
+	"context"
+	"testing"
+)
+
+func Test{{.Kind}}(t *testing.T) {
+	obj := &{{.Kind}}{}
+	if gvr := obj.GetGroupVersionResource(); gvr.Resource != "{{.Plural}}" {
+		t.Errorf("expected the resource {{.Plural}}, got %s", gvr.Resource)
+	}
+	if obj.NamespaceScoped() != {{.Namespaced}} {
+		t.Errorf("expected NamespaceScoped to return {{.Namespaced}}")
+	}
+
+	obj.Default()
+	if errs := obj.Validate(context.Background()); len(errs) != 0 {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+}
+`))
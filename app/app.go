@@ -123,19 +123,24 @@ func (app *App) Start(stopc <-chan struct{}) error {
 	if err != nil {
 		return err
 	}
+	// Close stops the member once its WAL is synced, so a restart never has to repair it
+	defer etcd.Close()
 
 	select {
 	case <-etcd.Server.ReadyNotify():
 	case <-stopc:
+		return nil
 	}
 
-	v3client.New(etcd.Server)
+	client := v3client.New(etcd.Server)
+	defer client.Close()
 
 	select {
 	case <-stopc:
+	case err = <-etcd.Err():
 	}
 
-	return nil
+	return err
 }
 
 // InstallAPIGroup exposes the given api group in the API.